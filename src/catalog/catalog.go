@@ -0,0 +1,208 @@
+// Package catalog 维护已录制文件的索引，支持按直播间、时间和标题查询录制文件。
+package catalog
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yuhaohwang/bililive-go/src/live"
+	"github.com/yuhaohwang/bililive-go/src/pkg/metadata"
+)
+
+// 分页的默认值和上限。
+const (
+	defaultPageSize = 20
+	maxPageSize     = 200
+)
+
+// ErrRecording 表示文件仍在录制中，暂不加入索引。
+var ErrRecording = errors.New("文件正在录制")
+
+// Entry 是索引中的一个录制文件。
+type Entry struct {
+	File       string    `json:"file"`                // 录制文件路径
+	Files      []string  `json:"files"`               // 包括录制文件在内的所有同名文件
+	LiveId     live.ID   `json:"live_id"`             // 直播唯一标识
+	LiveUrl    string    `json:"live_url"`            // 直播原始 URL
+	Platform   string    `json:"platform"`            // 平台中文名称
+	HostName   string    `json:"host_name"`           // 主播名
+	Titles     []string  `json:"titles"`              // 录制期间的房间标题
+	StartTime  time.Time `json:"start_time"`          // 开始录制的时间
+	EndTime    time.Time `json:"end_time"`            // 结束录制的时间
+	DurationMs int64     `json:"duration_ms"`         // 录制时长，有完整性检查结果时为实际时长
+	Size       int64     `json:"size"`                // 录制文件大小
+	Integrity  string    `json:"integrity,omitempty"` // 完整性检查结果
+}
+
+// Query 是查询录制文件的条件，未设置的条件不做限制。
+type Query struct {
+	Room     string    // 直播原始 URL 或直播唯一标识
+	Title    string    // 房间标题包含的文字，不区分大小写
+	From     time.Time // 录制结束时间不早于该时间
+	To       time.Time // 录制开始时间不晚于该时间
+	Page     int       // 页码，从 1 开始
+	PageSize int       // 每页数量
+}
+
+// Page 是一页查询结果，按开始录制的时间倒序排列。
+type Page struct {
+	Total      int      `json:"total"`      // 符合条件的录制文件总数
+	Page       int      `json:"page"`       // 页码
+	PageSize   int      `json:"page_size"`  // 每页数量
+	Recordings []*Entry `json:"recordings"` // 本页的录制文件
+}
+
+// entryOf 根据录制文件及其元数据文件生成索引项，没有元数据文件时返回错误。
+func entryOf(file string) (*Entry, error) {
+	stat, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	md, err := metadata.Read(metadata.PathOf(file))
+	if err != nil {
+		return nil, err
+	}
+	if md.Recording {
+		return nil, ErrRecording
+	}
+
+	e := &Entry{
+		File:      file,
+		Files:     relatedFiles(file),
+		LiveId:    live.ID(md.Id),
+		LiveUrl:   md.LiveUrl,
+		Platform:  md.PlatformCNName,
+		HostName:  md.HostName,
+		Titles:    []string{},
+		Size:      stat.Size(),
+		Integrity: md.Integrity,
+	}
+	if md.RoomName != "" {
+		e.Titles = append(e.Titles, md.RoomName)
+	}
+
+	// 切分得到的文件使用分段的时间，没有记录结束时间的文件使用最后修改时间
+	start, end := md.StartTimeUnix, md.EndTimeUnix
+	if md.Split != nil {
+		start, end = md.Split.StartTimeUnix, md.Split.EndTimeUnix
+	}
+	e.EndTime = stat.ModTime()
+	if end > 0 {
+		e.EndTime = time.Unix(end, 0)
+	}
+	if md.IntegrityReport != nil {
+		e.DurationMs = md.IntegrityReport.DurationMs
+	}
+	switch {
+	case start > 0:
+		e.StartTime = time.Unix(start, 0)
+	default:
+		e.StartTime = e.EndTime.Add(-time.Duration(e.DurationMs) * time.Millisecond)
+	}
+	if e.DurationMs == 0 {
+		e.DurationMs = e.EndTime.Sub(e.StartTime).Milliseconds()
+	}
+	return e, nil
+}
+
+// relatedFiles 返回录制文件及与其同名的附属文件。
+// 附属文件归入文件名前缀最长的录制文件，避免 a.flv 抢走 a.b.flv 的附属文件。
+func relatedFiles(file string) []string {
+	files := []string{file}
+	dir, name := filepath.Split(file)
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return files
+	}
+	var longer []string
+	for _, entry := range entries {
+		n := entry.Name()
+		b := strings.TrimSuffix(n, filepath.Ext(n))
+		if videoExts[filepath.Ext(n)] && b != base && strings.HasPrefix(b, base+".") {
+			longer = append(longer, b+".")
+		}
+	}
+	for _, entry := range entries {
+		n := entry.Name()
+		if !entry.IsDir() && n != name && strings.HasPrefix(n, base+".") && !hasAnyPrefix(n, longer) {
+			files = append(files, filepath.Join(dir, n))
+		}
+	}
+	return files
+}
+
+// hasAnyPrefix 返回字符串是否以任意一个前缀开头。
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// match 返回索引项是否满足查询条件。
+func (q *Query) match(e *Entry) bool {
+	if q.Room != "" && q.Room != e.LiveUrl && q.Room != string(e.LiveId) {
+		return false
+	}
+	if !q.From.IsZero() && e.EndTime.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && e.StartTime.After(q.To) {
+		return false
+	}
+	if q.Title != "" {
+		title := strings.ToLower(q.Title)
+		for _, t := range e.Titles {
+			if strings.Contains(strings.ToLower(t), title) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// normalize 补全分页参数。
+func (q *Query) normalize() {
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.PageSize <= 0 {
+		q.PageSize = defaultPageSize
+	}
+	if q.PageSize > maxPageSize {
+		q.PageSize = maxPageSize
+	}
+}
+
+// paginate 将满足条件的索引项按开始录制的时间倒序排列后分页。
+func paginate(entries []*Entry, q Query) *Page {
+	q.normalize()
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].StartTime.Equal(entries[j].StartTime) {
+			return entries[i].StartTime.After(entries[j].StartTime)
+		}
+		return entries[i].File < entries[j].File
+	})
+	page := &Page{
+		Total:      len(entries),
+		Page:       q.Page,
+		PageSize:   q.PageSize,
+		Recordings: []*Entry{},
+	}
+	if start := (q.Page - 1) * q.PageSize; start < len(entries) {
+		end := start + q.PageSize
+		if end > len(entries) {
+			end = len(entries)
+		}
+		page.Recordings = entries[start:end]
+	}
+	return page
+}
@@ -0,0 +1,121 @@
+package catalog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yuhaohwang/bililive-go/src/configs"
+	"github.com/yuhaohwang/bililive-go/src/instance"
+	"github.com/yuhaohwang/bililive-go/src/interfaces"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	assert.NoError(t, os.MkdirAll(dir, os.ModePerm))
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+}
+
+func TestEntryOf(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.flv":             "12345",
+		"a.jpg":             "1",
+		"a.metadata.json":   `{"id":"1","live_url":"https://example.com/1","host_name":"主播","room_name":"标题","start_time_unix":1700000000,"end_time_unix":1700003600,"integrity":"ok","integrity_report":{"duration_ms":3590000}}`,
+		"a.b.flv":           "1",
+		"a.b.metadata.json": `{"split":{"index":1,"start_time_unix":1700000000,"end_time_unix":1700000060}}`,
+		"c.flv":             "1",
+		"c.metadata.json":   `{"recording":true}`,
+		"d.flv":             "1",
+	})
+
+	// 优先使用记录的时间和完整性检查得到的时长，附属文件不包括前缀更长的录制文件
+	e, err := entryOf(filepath.Join(dir, "a.flv"))
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		filepath.Join(dir, "a.flv"),
+		filepath.Join(dir, "a.jpg"),
+		filepath.Join(dir, "a.metadata.json"),
+	}, e.Files)
+	assert.Equal(t, "https://example.com/1", e.LiveUrl)
+	assert.Equal(t, []string{"标题"}, e.Titles)
+	assert.Equal(t, int64(1700000000), e.StartTime.Unix())
+	assert.Equal(t, int64(1700003600), e.EndTime.Unix())
+	assert.Equal(t, int64(3590000), e.DurationMs)
+	assert.Equal(t, int64(5), e.Size)
+	assert.Equal(t, "ok", e.Integrity)
+
+	// 切分得到的文件使用分段的时间
+	e, err = entryOf(filepath.Join(dir, "a.b.flv"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(60000), e.DurationMs)
+
+	// 正在录制或没有元数据文件时不加入索引
+	_, err = entryOf(filepath.Join(dir, "c.flv"))
+	assert.ErrorIs(t, err, ErrRecording)
+	_, err = entryOf(filepath.Join(dir, "d.flv"))
+	assert.Error(t, err)
+}
+
+func TestManagerQuery(t *testing.T) {
+	cfg := configs.NewConfig()
+	cfg.OutPutPath = t.TempDir()
+	ctx := context.WithValue(context.Background(), instance.Key, &instance.Instance{
+		Config: cfg,
+		Logger: &interfaces.Logger{Logger: logrus.New()},
+	})
+	dir := filepath.Join(cfg.OutPutPath, "平台", "主播")
+	writeFiles(t, dir, map[string]string{
+		"1.flv":           "1",
+		"1.metadata.json": `{"id":"1","live_url":"https://example.com/1","room_name":"Morning Talk","start_time_unix":1700000000,"end_time_unix":1700003600}`,
+		"2.flv":           "1",
+		"2.metadata.json": `{"id":"1","live_url":"https://example.com/1","room_name":"游戏","start_time_unix":1700086400,"end_time_unix":1700090000}`,
+		"3.ts":            "1",
+		"3.metadata.json": `{"id":"2","live_url":"https://example.com/2","room_name":"morning show","start_time_unix":1700172800,"end_time_unix":1700176400}`,
+	})
+
+	m := NewManager(ctx).(*manager)
+	s, err := openStore(filepath.Join(cfg.OutPutPath, storeFileName))
+	assert.NoError(t, err)
+	m.store = s
+	n, err := m.Backfill(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	files := func(page *Page) []string {
+		names := make([]string, 0, len(page.Recordings))
+		for _, e := range page.Recordings {
+			names = append(names, filepath.Base(e.File))
+		}
+		return names
+	}
+
+	// 按开始时间倒序分页
+	page := m.Query(ctx, Query{PageSize: 2})
+	assert.Equal(t, 3, page.Total)
+	assert.Equal(t, []string{"3.ts", "2.flv"}, files(page))
+	page = m.Query(ctx, Query{Page: 2, PageSize: 2})
+	assert.Equal(t, []string{"1.flv"}, files(page))
+	page = m.Query(ctx, Query{Page: 3, PageSize: 2})
+	assert.Empty(t, page.Recordings)
+
+	// 按直播间、标题和时间范围过滤
+	assert.Equal(t, []string{"2.flv", "1.flv"}, files(m.Query(ctx, Query{Room: "https://example.com/1"})))
+	assert.Equal(t, []string{"3.ts"}, files(m.Query(ctx, Query{Room: "2"})))
+	assert.Equal(t, []string{"3.ts", "1.flv"}, files(m.Query(ctx, Query{Title: "MORNING"})))
+	assert.Equal(t, []string{"2.flv"}, files(m.Query(ctx, Query{
+		From: time.Unix(1700003601, 0),
+		To:   time.Unix(1700172799, 0),
+	})))
+
+	// 已删除的文件从索引中移除
+	assert.NoError(t, os.Remove(filepath.Join(dir, "2.flv")))
+	assert.Equal(t, 2, m.Query(ctx, Query{}).Total)
+	assert.Len(t, m.store.all(), 2)
+}
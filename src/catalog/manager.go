@@ -0,0 +1,167 @@
+package catalog
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/yuhaohwang/bililive-go/src/configs"
+	"github.com/yuhaohwang/bililive-go/src/instance"
+	"github.com/yuhaohwang/bililive-go/src/interfaces"
+	"github.com/yuhaohwang/bililive-go/src/pkg/events"
+	"github.com/yuhaohwang/bililive-go/src/pkg/metadata"
+	"github.com/yuhaohwang/bililive-go/src/postprocessors"
+	"github.com/yuhaohwang/bililive-go/src/recorders"
+)
+
+// 定义状态常量用于标记管理器的状态。
+const (
+	begin uint32 = iota
+	running
+	stopped
+)
+
+// videoExts 是录制文件的扩展名。
+var videoExts = map[string]bool{
+	".flv": true,
+	".ts":  true,
+	".mp4": true,
+	".mkv": true,
+	".aac": true,
+	".m4a": true,
+}
+
+// Manager 定义了录制文件索引的接口，它实现了 interfaces.Module 接口。
+type Manager interface {
+	interfaces.Module
+	Query(ctx context.Context, q Query) *Page
+	Backfill(ctx context.Context) (int, error)
+}
+
+// NewManager 创建一个新的录制文件索引。
+func NewManager(ctx context.Context) Manager {
+	inst := instance.GetInstance(ctx)
+	m := &manager{
+		config: inst.Config,
+		logger: inst.Logger,
+		state:  begin,
+	}
+	inst.CatalogManager = m
+	return m
+}
+
+// manager 实现了 Manager 接口。
+type manager struct {
+	config *configs.Config
+	logger *interfaces.Logger
+	store  *store
+	state  uint32
+}
+
+// Start 读取索引文件，注册事件监听器，并在后台扫描输出目录补全索引。
+func (m *manager) Start(ctx context.Context) error {
+	if !atomic.CompareAndSwapUint32(&m.state, begin, running) {
+		return nil
+	}
+	s, err := openStore(filepath.Join(m.config.OutPutPath, storeFileName))
+	if err != nil {
+		return err
+	}
+	m.store = s
+	if ed, ok := instance.GetInstance(ctx).EventDispatcher.(events.Dispatcher); ok {
+		m.registryListener(ed)
+	}
+	go func() {
+		n, err := m.Backfill(ctx)
+		if err != nil {
+			m.logger.WithError(err).Error("扫描录制文件失败")
+			return
+		}
+		m.logger.Infof("录制文件索引已更新，共%d个录制文件", n)
+	}()
+	return nil
+}
+
+// Close 关闭录制文件索引。
+func (m *manager) Close(ctx context.Context) {
+	atomic.CompareAndSwapUint32(&m.state, running, stopped)
+}
+
+// registryListener 注册事件监听器，录制完成或录制后处理改变文件时更新索引。
+func (m *manager) registryListener(ed events.Dispatcher) {
+	// 1. 录制文件写入完成。
+	ed.AddEventListener(recorders.RecordingFinished, events.NewEventListener(func(event *events.Event) {
+		m.index(event.Object.(string))
+	}))
+
+	// 2. 录制后处理可能会移动、转换或删除录制文件。
+	ed.AddEventListener(postprocessors.JobFinished, events.NewEventListener(func(event *events.Event) {
+		job := event.Object.(*postprocessors.Job)
+		m.index(job.File)
+		m.prune()
+	}))
+}
+
+// index 将录制文件加入索引，文件正在录制或没有元数据文件时跳过。
+func (m *manager) index(file string) {
+	if file, err := filepath.Abs(file); err == nil {
+		if e, err := entryOf(file); err == nil {
+			if err := m.store.put(e); err != nil {
+				m.logger.WithError(err).Error("写入录制文件索引失败")
+			}
+		}
+	}
+}
+
+// prune 从索引中删除已不存在的录制文件。
+func (m *manager) prune() {
+	for _, e := range m.store.all() {
+		if _, err := os.Stat(e.File); errors.Is(err, os.ErrNotExist) {
+			if err := m.store.delete(e.File); err != nil {
+				m.logger.WithError(err).Error("写入录制文件索引失败")
+			}
+		}
+	}
+}
+
+// Backfill 扫描全局和各直播间的输出目录，将带有元数据文件的录制文件加入索引，
+// 并删除已不存在的录制文件，返回索引中的录制文件数量。
+func (m *manager) Backfill(ctx context.Context) (int, error) {
+	for _, root := range m.config.OutputRoots() {
+		err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || !videoExts[filepath.Ext(path)] {
+				return nil
+			}
+			if _, err := os.Stat(metadata.PathOf(path)); err == nil {
+				m.index(path)
+			}
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	m.prune()
+	return len(m.store.all()), nil
+}
+
+// Query 查询满足条件的录制文件，已被删除的录制文件会从索引中移除。
+func (m *manager) Query(ctx context.Context, q Query) *Page {
+	matched := make([]*Entry, 0, 64)
+	for _, e := range m.store.all() {
+		if !q.match(e) {
+			continue
+		}
+		if _, err := os.Stat(e.File); errors.Is(err, os.ErrNotExist) {
+			m.store.delete(e.File)
+			continue
+		}
+		matched = append(matched, e)
+	}
+	return paginate(matched, q)
+}
@@ -0,0 +1,199 @@
+package catalog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// storeFileName 是索引在输出目录中的文件名。
+const storeFileName = ".recordings.jsonl"
+
+// compactSlack 是索引文件中允许的过期记录数，超过后重写索引文件。
+const compactSlack = 256
+
+// 索引文件中的操作类型。
+const (
+	opPut    = "put"
+	opDelete = "delete"
+)
+
+// record 是索引文件中的一条记录。
+type record struct {
+	Op    string `json:"op"`              // 操作类型
+	File  string `json:"file"`            // 录制文件路径
+	Entry *Entry `json:"entry,omitempty"` // 写入的索引项
+}
+
+// store 以 JSON Lines 格式追加记录索引的变化，启动时按顺序重放得到当前的索引。
+// 过期的记录过多时重写索引文件。
+type store struct {
+	lock    sync.RWMutex
+	path    string
+	entries map[string]*Entry
+	records int // 索引文件中的记录数
+}
+
+// openStore 读取索引文件，文件不存在时返回空的索引。
+// 写入中断会留下不完整的记录，此时忽略该记录并重写索引文件，避免之后追加的记录与其连在一起。
+func openStore(path string) (*store, error) {
+	s := &store{path: path, entries: make(map[string]*Entry)}
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s, nil
+		}
+		return nil, err
+	}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	broken := false
+	for scanner.Scan() {
+		var r record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			broken = true
+			continue
+		}
+		s.records++
+		switch {
+		case r.Op == opPut && r.Entry != nil:
+			s.entries[r.File] = r.Entry
+		case r.Op == opDelete:
+			delete(s.entries, r.File)
+		}
+	}
+	err = scanner.Err()
+	f.Close()
+	if err != nil {
+		return nil, err
+	}
+	if broken {
+		if err := s.rewriteLocked(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// put 写入索引项，与已有的索引项相同时不做记录。
+func (s *store) put(e *Entry) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if old, ok := s.entries[e.File]; ok && sameEntry(old, e) {
+		return nil
+	}
+	if err := s.appendLocked(record{Op: opPut, File: e.File, Entry: e}); err != nil {
+		return err
+	}
+	s.entries[e.File] = e
+	return s.compactLocked()
+}
+
+// sameEntry 返回两个索引项序列化后是否相同，从索引文件读取的时间不带时区和单调时钟，不能直接比较。
+func sameEntry(a, b *Entry) bool {
+	ab, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bb, err := json.Marshal(b)
+	return err == nil && bytes.Equal(ab, bb)
+}
+
+// delete 删除索引项。
+func (s *store) delete(file string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.entries[file]; !ok {
+		return nil
+	}
+	if err := s.appendLocked(record{Op: opDelete, File: file}); err != nil {
+		return err
+	}
+	delete(s.entries, file)
+	return s.compactLocked()
+}
+
+// get 返回文件的索引项。
+func (s *store) get(file string) (*Entry, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	e, ok := s.entries[file]
+	return e, ok
+}
+
+// all 返回所有索引项，索引项写入后不会被修改，调用方不能修改返回的索引项。
+func (s *store) all() []*Entry {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	entries := make([]*Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// appendLocked 追加一条记录，调用方需持有锁。
+func (s *store) appendLocked(r record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	s.records++
+	return nil
+}
+
+// compactLocked 在过期记录过多时重写索引文件，调用方需持有锁。
+func (s *store) compactLocked() error {
+	if s.records <= len(s.entries)+compactSlack {
+		return nil
+	}
+	return s.rewriteLocked()
+}
+
+// rewriteLocked 只保留当前的索引项重写索引文件，调用方需持有锁。
+// 先写入临时文件再替换，避免写入中断导致索引损坏。
+func (s *store) rewriteLocked() error {
+	tmp := s.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for file, e := range s.entries {
+		if err := enc.Encode(record{Op: opPut, File: file, Entry: e}); err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	s.records = len(s.entries)
+	return nil
+}
@@ -0,0 +1,57 @@
+package catalog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), storeFileName)
+	s, err := openStore(path)
+	assert.NoError(t, err)
+
+	start := time.Unix(1700000000, 0)
+	a := &Entry{File: "/a.flv", Titles: []string{"a"}, StartTime: start}
+	b := &Entry{File: "/b.flv", Titles: []string{"b"}, StartTime: start}
+	assert.NoError(t, s.put(a))
+	assert.NoError(t, s.put(b))
+	assert.NoError(t, s.delete("/b.flv"))
+
+	// 重新打开后按顺序重放记录，相同的索引项不重复记录
+	s, err = openStore(path)
+	assert.NoError(t, err)
+	assert.Len(t, s.all(), 1)
+	assert.Equal(t, 3, s.records)
+	assert.NoError(t, s.put(&Entry{File: "/a.flv", Titles: []string{"a"}, StartTime: start}))
+	assert.Equal(t, 3, s.records)
+
+	// 写入中断留下的不完整记录被忽略，并重写索引文件
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	_, err = f.WriteString(`{"op":"put","file":"/c.flv","entry":{"fi`)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	s, err = openStore(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, s.records)
+	assert.NoError(t, s.put(b))
+	s, err = openStore(path)
+	assert.NoError(t, err)
+	assert.Len(t, s.all(), 2)
+
+	// 过期记录过多时重写索引文件
+	for i := 0; i <= compactSlack; i++ {
+		b.Titles = []string{time.Duration(i).String()}
+		assert.NoError(t, s.put(&Entry{File: b.File, Titles: b.Titles}))
+	}
+	assert.LessOrEqual(t, s.records, len(s.entries)+compactSlack)
+	s, err = openStore(path)
+	assert.NoError(t, err)
+	e, ok := s.get("/b.flv")
+	assert.True(t, ok)
+	assert.Equal(t, []string{time.Duration(compactSlack).String()}, e.Titles)
+}
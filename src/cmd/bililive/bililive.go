@@ -12,19 +12,24 @@ import (
 
 	"github.com/bluele/gcache"
 
+	"github.com/yuhaohwang/bililive-go/src/catalog"
 	_ "github.com/yuhaohwang/bililive-go/src/cmd/bililive/internal"
 	"github.com/yuhaohwang/bililive-go/src/cmd/bililive/internal/flag"
 	"github.com/yuhaohwang/bililive-go/src/configs"
 	"github.com/yuhaohwang/bililive-go/src/consts"
+	"github.com/yuhaohwang/bililive-go/src/disk"
 	"github.com/yuhaohwang/bililive-go/src/instance"
 	"github.com/yuhaohwang/bililive-go/src/listeners"
 	"github.com/yuhaohwang/bililive-go/src/live"
 	"github.com/yuhaohwang/bililive-go/src/log"
 	"github.com/yuhaohwang/bililive-go/src/metrics"
+	"github.com/yuhaohwang/bililive-go/src/network"
 	"github.com/yuhaohwang/bililive-go/src/pkg/events"
 	"github.com/yuhaohwang/bililive-go/src/pkg/utils"
+	"github.com/yuhaohwang/bililive-go/src/postprocessors"
 	"github.com/yuhaohwang/bililive-go/src/pushers"
 	"github.com/yuhaohwang/bililive-go/src/recorders"
+	"github.com/yuhaohwang/bililive-go/src/retention"
 	"github.com/yuhaohwang/bililive-go/src/rtmp"
 	"github.com/yuhaohwang/bililive-go/src/servers"
 )
@@ -79,12 +84,17 @@ func getConfigBesidesExecutable() (*configs.Config, error) {
 }
 
 func main() {
+	// 执行不需要配置信息的子命令。
+	if flag.Command == flag.FLVMetadata.FullCommand() {
+		os.Exit(flvMetadata(*flag.FLVMetadataFiles))
+	}
+
 	// 获取配置信息
 	config, err := getConfig()
 	if err != nil {
 		// 如果获取配置信息失败，打印错误信息到标准错误并退出程序。
 		fmt.Fprint(os.Stderr, err.Error())
-		os.Exit(1)
+		os.Exit(exitError)
 	}
 
 	// 创建一个新的程序实例（instance.Instance），并设置配置信息。
@@ -142,7 +152,7 @@ func main() {
 			continue
 		}
 		if _, ok := inst.Lives[l.GetLiveId()]; ok {
-			logger.Errorf("%s 已存在!", room)
+			logger.Errorf("%s 已存在!", room.Url)
 			continue
 		}
 		inst.Lives[l.GetLiveId()] = l
@@ -156,6 +166,26 @@ func main() {
 		}
 	}
 
+	// 创建磁盘空间检测器，剩余空间不足时暂停或停止录制。
+	if err := disk.NewMonitor(ctx).Start(ctx); err != nil {
+		logger.Fatalf("初始化磁盘空间检测器失败，错误: %s", err)
+	}
+
+	// 创建保留策略管理器，定期清理过期的录制文件。
+	if err := retention.NewManager(ctx).Start(ctx); err != nil {
+		logger.Fatalf("初始化保留策略管理器失败，错误: %s", err)
+	}
+
+	// 创建录制后处理管理器，并启动它。
+	if err := postprocessors.NewManager(ctx).Start(ctx); err != nil {
+		logger.Fatalf("初始化录制后处理管理器失败，错误: %s", err)
+	}
+
+	// 创建录制文件索引，记录录制完成的文件并补全已有的录制文件。
+	if err := catalog.NewManager(ctx).Start(ctx); err != nil {
+		logger.Fatalf("初始化录制文件索引失败，错误: %s", err)
+	}
+
 	// 创建监听器管理器和录制器管理器，并启动它们。
 	lm := listeners.NewManager(ctx)
 	rm := recorders.NewManager(ctx)
@@ -177,6 +207,11 @@ func main() {
 		logger.Fatalf("初始化RTMP自动配置器失败，错误: %s", err)
 	}
 
+	// 创建网络检测器，断网时冻结监听器状态。
+	if err := network.NewMonitor(ctx).Start(ctx); err != nil {
+		logger.Fatalf("初始化网络检测器失败，错误: %s", err)
+	}
+
 	// 初始化指标收集器并启动它。
 	if err = metrics.NewCollector(ctx).Start(ctx); err != nil {
 		logger.Fatalf("初始化指标收集器失败，错误: %s", err)
@@ -198,21 +233,20 @@ func main() {
 		time.Sleep(time.Second * 5)
 	}
 
-	// 创建一个用于捕获信号的通道。
+	// 等待退出信号，按顺序关闭各个模块。退出过程中再次收到信号时不再等待，立即退出。
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-c
+	logger.Infof("收到信号 %s，正在退出...", sig)
 	go func() {
 		<-c
-		// 如果配置中启用了RPC服务器，关闭RPC服务器。
-		if inst.Config.RPC.Enable {
-			inst.Server.Close(ctx)
-		}
-		// 关闭监听器管理器和录制器管理器。
-		inst.ListenerManager.Close(ctx)
-		inst.RecorderManager.Close(ctx)
+		logger.Warn("再次收到退出信号，强制退出")
+		os.Exit(exitForced)
 	}()
+	code := shutdown(ctx, inst, rtmpAutoConfig)
 
-	// 等待程序实例的WaitGroup计数为0，即等待所有协程结束。
+	// 等待程序实例的WaitGroup计数为0，即等待所有模块关闭。
 	inst.WaitGroup.Wait()
 	logger.Info("再见~")
+	os.Exit(code)
 }
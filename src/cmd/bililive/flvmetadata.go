@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/yuhaohwang/bililive-go/src/pkg/parser/native/flv"
+)
+
+// flvMetadata 依次为 FLV 文件写入时长和关键帧索引并替换原文件，返回退出码。
+func flvMetadata(files []string) int {
+	code := exitOK
+	for _, file := range files {
+		tmp := file + ".tmp"
+		result, err := flv.InjectMetadata(file, tmp)
+		if err == nil {
+			err = os.Rename(tmp, file)
+		}
+		if err != nil {
+			os.Remove(tmp)
+			fmt.Fprintf(os.Stderr, "%s: %s\n", file, err)
+			code = exitError
+			continue
+		}
+		fmt.Printf("%s: 时长%s，关键帧%d个，丢弃损坏的标签%d个，修正时间戳跳变%d次\n",
+			file, result.Duration, result.Keyframes, result.DroppedTags, result.Discontinuities)
+	}
+	return code
+}
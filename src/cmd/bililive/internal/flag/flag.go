@@ -42,16 +42,29 @@ var (
 	// 使用本地FLV解析器标志
 	NativeFlvParser = app.Flag("native-flv-parser", "使用本地FLV解析器").Default("false").Bool()
 
+	// 使用本地HLS解析器标志
+	NativeHlsParser = app.Flag("native-hls-parser", "使用本地HLS解析器").Default("false").Bool()
+
 	// 输出文件名模板
 	OutputFileTmpl = app.Flag("output-file-tmpl", "输出文件名模板").Default("").String()
 
 	// 视频分割策略
 	SplitStrategies = app.Flag("split-strategies", "视频分割策略，支持\"on_room_name_changed\", \"max_duration:(duration)\"").Strings()
+
+	// 监听直播间并录制，未指定子命令时默认执行
+	Record = app.Command("record", "监听直播间并录制。").Default()
+
+	// 为 FLV 文件写入时长和关键帧索引
+	FLVMetadata      = app.Command("flv-metadata", "为 FLV 文件写入时长和关键帧索引，使其可以拖动播放。")
+	FLVMetadataFiles = FLVMetadata.Arg("files", "FLV 文件路径").Required().ExistingFiles()
 )
 
+// Command 是命令行中选择的子命令
+var Command string
+
 func init() {
 	// 解析命令行参数
-	kingpin.MustParse(app.Parse(os.Args[1:]))
+	Command = kingpin.MustParse(app.Parse(os.Args[1:]))
 }
 
 // GenConfigFromFlags 通过解析命令行参数生成配置信息。
@@ -67,8 +80,10 @@ func GenConfigFromFlags() *configs.Config {
 	cfg.FfmpegPath = *FfmpegPath
 	cfg.OutputTmpl = *OutputFileTmpl
 	cfg.LiveRooms = configs.NewLiveRoomsWithStrings(*Input)
+	cfg.RefreshLiveRoomIndexCache()
 	cfg.Feature = configs.Feature{
 		UseNativeFlvParser: *NativeFlvParser,
+		UseNativeHlsParser: *NativeHlsParser,
 	}
 
 	if SplitStrategies != nil && len(*SplitStrategies) > 0 {
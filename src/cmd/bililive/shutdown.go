@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+
+	"github.com/yuhaohwang/bililive-go/src/instance"
+	"github.com/yuhaohwang/bililive-go/src/postprocessors"
+	"github.com/yuhaohwang/bililive-go/src/pushers"
+	"github.com/yuhaohwang/bililive-go/src/recorders"
+	"github.com/yuhaohwang/bililive-go/src/rtmp"
+)
+
+// 程序的退出码
+const (
+	exitOK      = 0 // 正常退出
+	exitError   = 1 // 启动失败
+	exitUnclean = 2 // 有录制、推送或录制后处理任务未能在退出期限内结束
+	exitForced  = 3 // 退出过程中再次收到信号，强制退出
+)
+
+// shutdown 按顺序关闭各个模块并返回退出码：先停止接收请求和监听，再结束所有录制和推送，
+// 等待录制文件关闭、元数据写入完成，最后按配置等待录制后处理任务完成或将其留在任务日志中。
+func shutdown(ctx context.Context, inst *instance.Instance, rtmpAutoConfig rtmp.Rtmp) int {
+	logger := inst.Logger
+	cfg := inst.Config.Shutdown
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+	}
+	code := exitOK
+
+	// 1. 关闭RPC服务器和后台任务。
+	if inst.Config.RPC.Enable {
+		inst.Server.Close(ctx)
+	}
+	inst.NetworkMonitor.Close(ctx)
+	inst.DiskMonitor.Close(ctx)
+	inst.RetentionManager.Close(ctx)
+
+	// 2. 关闭监听器，不再开始新的录制。
+	inst.ListenerManager.Close(ctx)
+	rtmpAutoConfig.Close()
+
+	// 3. 结束所有录制和推送，等待录制文件关闭、元数据写入完成，录制文件检查完成并提交录制后处理任务。
+	if err := inst.RecorderManager.(recorders.Manager).Shutdown(ctx); err != nil {
+		logger.WithError(err).Error("录制未能在退出期限内结束")
+		code = exitUnclean
+	}
+	if err := inst.PusherManager.(pushers.Manager).Shutdown(ctx); err != nil {
+		logger.WithError(err).Error("推送未能在退出期限内结束")
+		code = exitUnclean
+	}
+
+	// 4. 等待录制后处理任务完成，未完成的任务保留在任务日志中，下次启动时继续执行。
+	ppm := inst.PostProcessorManager.(postprocessors.Manager)
+	if cfg.FinishPostProcess {
+		if err := ppm.Drain(ctx); err != nil {
+			logger.WithError(err).Error("录制后处理任务未能在退出期限内完成，将在下次启动时继续")
+			code = exitUnclean
+		}
+	}
+	ppm.Close(ctx)
+	inst.CatalogManager.Close(ctx)
+	return code
+}
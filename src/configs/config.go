@@ -6,6 +6,11 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/yuhaohwang/bililive-go/src/live"
@@ -40,14 +45,48 @@ func (r *RPC) verify() error {
 // Feature包含特性相关信息。
 type Feature struct {
 	UseNativeFlvParser         bool `yaml:"use_native_flv_parser"`         // 是否使用本地FLV解析器
+	UseNativeHlsParser         bool `yaml:"use_native_hls_parser"`         // 是否使用本地HLS解析器
 	RemoveSymbolOtherCharacter bool `yaml:"remove_symbol_other_character"` // 是否删除特殊符号
 }
 
 // VideoSplitStrategies包含视频分割策略信息。
 type VideoSplitStrategies struct {
 	OnRoomNameChanged bool          `yaml:"on_room_name_changed"` // 当房间名称更改时是否分割视频
+	ChapterOnChanged  bool          `yaml:"chapter_on_changed"`   // 房间名称或分区更改时不分割视频，在同一个文件中记录章节
 	MaxDuration       time.Duration `yaml:"max_duration"`         // 最大分割视频时长
-	MaxFileSize       int           `yaml:"max_file_size"`        // 最大分割文件大小
+	MaxFileSize       int           `yaml:"max_file_size"`        // 最大分割文件大小（字节），与最大时长均在关键帧处无缝切分
+	AlignInterval     time.Duration `yaml:"align_interval"`       // 按时钟对齐的切分间隔，从每天零点开始计算，如 1h 表示在每个整点切分
+	AlignTimes        []string      `yaml:"align_times"`          // 每天固定的切分时间点，格式为 HH:MM
+	TimeZone          string        `yaml:"time_zone"`            // 按时钟对齐切分使用的时区，如 Asia/Shanghai，为空时使用本地时区
+}
+
+// FfmpegOptions包含传递给FFmpeg的额外参数。
+type FfmpegOptions struct {
+	InputArgs  []string `yaml:"input_args"`  // 添加在输入参数 -i 之前的参数
+	OutputArgs []string `yaml:"output_args"` // 添加在输出文件之前的参数，可以覆盖默认的编码参数
+}
+
+// HlsBacklog包含HLS录制开始时从直播回看窗口中补录的方式，仅对本地HLS解析器生效。
+type HlsBacklog struct {
+	FromOldest bool          `yaml:"from_oldest"` // 从最早的可用分片开始录制
+	Lookback   time.Duration `yaml:"lookback"`    // 从最新分片往前回看的时长
+}
+
+// Redundancy包含冗余录制相关信息，开启后同时从多个直播流地址录制同一场直播，录制结束后保留断档最少的副本。
+type Redundancy struct {
+	Copies     int  `yaml:"copies"`      // 同时录制的副本数量，小于2时不启用
+	KeepOthers bool `yaml:"keep_others"` // 选出最佳副本后是否保留其他副本
+}
+
+// SessionConcat包含直播场次结束后拼接录制文件的方式，开启后将一场直播的所有分段无损拼接为一个文件。
+type SessionConcat struct {
+	Enable    bool `yaml:"enable"`     // 是否拼接
+	KeepParts bool `yaml:"keep_parts"` // 拼接并校验通过后是否保留原分段
+}
+
+// LiveStates包含不同直播间状态的处理方式。
+type LiveStates struct {
+	RecordReplay bool `yaml:"record_replay"` // 轮播（录像回放）时是否视为开播并录制
 }
 
 // OnRecordFinished包含录制完成后的操作信息。
@@ -57,6 +96,60 @@ type OnRecordFinished struct {
 	CustomCommandline     string `yaml:"custom_commandline"`       // 自定义命令行操作
 }
 
+// PostProcessStep包含单个录制后处理步骤的信息。
+type PostProcessStep struct {
+	Name string            `yaml:"name"`           // 步骤名称
+	Args map[string]string `yaml:"args,omitempty"` // 步骤参数
+}
+
+// PostProcess包含录制后处理流水线相关信息。
+type PostProcess struct {
+	Workers int               `yaml:"workers"` // 同时处理的任务数
+	Retries int               `yaml:"retries"` // 单个步骤失败后的重试次数
+	Timeout time.Duration     `yaml:"timeout"` // 单个步骤的超时时间
+	Steps   []PostProcessStep `yaml:"steps"`   // 默认的处理步骤
+}
+
+// Shutdown包含程序退出相关信息。
+type Shutdown struct {
+	Timeout           time.Duration `yaml:"timeout"`             // 等待录制和推送结束的最长时间，0表示一直等待
+	FinishPostProcess bool          `yaml:"finish_post_process"` // 退出前是否等待录制后处理任务完成，否则未完成的任务在下次启动时继续
+}
+
+// NetworkMonitor包含网络连通性检测相关信息。
+type NetworkMonitor struct {
+	Enable           bool          `yaml:"enable"`            // 是否启用网络检测
+	Endpoints        []string      `yaml:"endpoints"`         // 探测地址，支持URL和host:port
+	Interval         time.Duration `yaml:"interval"`          // 探测间隔
+	Timeout          time.Duration `yaml:"timeout"`           // 单次探测超时时间
+	FailureThreshold int           `yaml:"failure_threshold"` // 连续失败多少次后判定为断网
+}
+
+// DiskGuard包含磁盘剩余空间保护相关信息，阈值单位为MB。
+type DiskGuard struct {
+	Enable         bool          `yaml:"enable"`           // 是否启用磁盘空间保护
+	Interval       time.Duration `yaml:"interval"`         // 检测间隔
+	WarnFreeMB     uint64        `yaml:"warn_free_mb"`     // 剩余空间低于该值时告警
+	CriticalFreeMB uint64        `yaml:"critical_free_mb"` // 剩余空间低于该值时不再开始新的录制
+	StopFreeMB     uint64        `yaml:"stop_free_mb"`     // 剩余空间低于该值时停止优先级最低的录制
+}
+
+// RetentionPolicy包含单个直播间录制文件的保留规则，值为0表示不限制。
+type RetentionPolicy struct {
+	MaxAgeDays   int    `yaml:"max_age_days"`  // 录制文件保留的天数
+	KeepSessions int    `yaml:"keep_sessions"` // 保留最近的直播场次数
+	MaxSizeMB    uint64 `yaml:"max_size_mb"`   // 录制文件的总大小上限
+}
+
+// Retention包含录制文件保留策略相关信息。
+type Retention struct {
+	Enable            bool              `yaml:"enable"`               // 是否启用保留策略
+	Interval          time.Duration     `yaml:"interval"`             // 执行间隔
+	DryRun            bool              `yaml:"dry_run"`              // 只记录将要删除的文件，不实际删除
+	Default           RetentionPolicy   `yaml:"default"`              // 直播间默认的保留规则
+	PlatformMaxSizeMB map[string]uint64 `yaml:"platform_max_size_mb"` // 各平台录制文件的总大小上限，键为平台中文名称
+}
+
 // Log包含日志相关信息。
 type Log struct {
 	OutPutFolder string `yaml:"out_put_folder"` // 输出日志文件夹
@@ -66,22 +159,129 @@ type Log struct {
 
 // Config包含所有配置信息。
 type Config struct {
-	File                 string               `yaml:"-"`                      // 配置文件路径
-	RPC                  RPC                  `yaml:"rpc"`                    // RPC配置
-	Debug                bool                 `yaml:"debug"`                  // 是否启用调试模式
-	Interval             int                  `yaml:"interval"`               // 采集间隔
-	OutPutPath           string               `yaml:"out_put_path"`           // 输出路径
-	FfmpegPath           string               `yaml:"ffmpeg_path"`            // FFmpeg路径
-	Log                  Log                  `yaml:"log"`                    // 日志配置
-	Feature              Feature              `yaml:"feature"`                // 特性配置
-	LiveRooms            []LiveRoom           `yaml:"live_rooms"`             // 直播房间配置
-	OutputTmpl           string               `yaml:"out_put_tmpl"`           // 输出模板
-	VideoSplitStrategies VideoSplitStrategies `yaml:"video_split_strategies"` // 视频分割策略
-	Cookies              map[string]string    `yaml:"cookies"`                // Cookies配置
-	OnRecordFinished     OnRecordFinished     `yaml:"on_record_finished"`     // 录制完成后的操作配置
-	TimeoutInUs          int                  `yaml:"timeout_in_us"`          // 超时时间（微秒）
-
-	liveRoomIndexCache map[string]int
+	File                 string                `yaml:"-"`                      // 配置文件路径
+	RPC                  RPC                   `yaml:"rpc"`                    // RPC配置
+	Debug                bool                  `yaml:"debug"`                  // 是否启用调试模式
+	Interval             int                   `yaml:"interval"`               // 采集间隔
+	OutPutPath           string                `yaml:"out_put_path"`           // 输出路径
+	FfmpegPath           string                `yaml:"ffmpeg_path"`            // FFmpeg路径
+	Log                  Log                   `yaml:"log"`                    // 日志配置
+	Feature              Feature               `yaml:"feature"`                // 特性配置
+	LiveRooms            []LiveRoom            `yaml:"live_rooms"`             // 直播房间配置
+	OutputTmpl           string                `yaml:"out_put_tmpl"`           // 输出模板
+	VideoSplitStrategies VideoSplitStrategies  `yaml:"video_split_strategies"` // 视频分割策略
+	LiveStates           LiveStates            `yaml:"live_states"`            // 直播间状态处理方式
+	Cookies              map[string]string     `yaml:"cookies"`                // Cookies配置
+	OnRecordFinished     OnRecordFinished      `yaml:"on_record_finished"`     // 录制完成后的操作配置
+	PostProcess          PostProcess           `yaml:"post_process"`           // 录制后处理流水线配置
+	TimeoutInUs          int                   `yaml:"timeout_in_us"`          // 超时时间（微秒）
+	StallTimeout         time.Duration         `yaml:"stall_timeout"`          // 录制文件持续多久没有增长时视为直播流停滞，0表示不检测
+	MaxRecordings        int                   `yaml:"max_recordings"`         // 同时录制的直播间数量上限，0表示不限制
+	NetworkMonitor       NetworkMonitor        `yaml:"network_monitor"`        // 网络检测配置
+	DiskGuard            DiskGuard             `yaml:"disk_guard"`             // 磁盘空间保护配置
+	Retention            Retention             `yaml:"retention"`              // 录制文件保留策略配置
+	FfmpegOptions        FfmpegOptions         `yaml:"ffmpeg_options"`         // FFmpeg额外参数
+	HlsBacklog           HlsBacklog            `yaml:"hls_backlog"`            // HLS开播补录配置
+	Redundancy           Redundancy            `yaml:"redundancy"`             // 冗余录制配置
+	SessionConcat        SessionConcat         `yaml:"session_concat"`         // 直播场次拼接配置
+	Shutdown             Shutdown              `yaml:"shutdown"`               // 程序退出配置
+	Profiles             map[string]RoomConfig `yaml:"profiles"`               // 可被直播间继承的配置模板
+
+	liveRoomIndexCache *liveRoomIndex
+}
+
+// liveRoomIndex 是直播房间URL到其在LiveRooms中的位置的索引，可以被多个goroutine同时读取。
+type liveRoomIndex struct {
+	lock    sync.RWMutex
+	indexes map[string]int
+}
+
+// get 返回直播房间在LiveRooms中的位置。
+func (i *liveRoomIndex) get(url string) (int, bool) {
+	if i == nil {
+		return 0, false
+	}
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+	index, ok := i.indexes[url]
+	return index, ok
+}
+
+// rebuild 根据直播房间列表重新生成索引。
+func (i *liveRoomIndex) rebuild(rooms []LiveRoom) {
+	indexes := make(map[string]int, len(rooms))
+	for index, room := range rooms {
+		indexes[room.Url] = index
+	}
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	i.indexes = indexes
+}
+
+// RoomConfig包含可以按直播间覆盖的配置，也用于定义可被继承的配置模板（profile）。
+// 未设置的字段继承上一级配置，结构体类型的字段会整体覆盖。
+type RoomConfig struct {
+	Profile              string                `yaml:"profile,omitempty"`                // 继承的配置模板名称
+	OutPutPath           *string               `yaml:"out_put_path,omitempty"`           // 输出路径
+	OutputTmpl           *string               `yaml:"out_put_tmpl,omitempty"`           // 输出模板
+	VideoSplitStrategies *VideoSplitStrategies `yaml:"video_split_strategies,omitempty"` // 视频分割策略
+	OnRecordFinished     *OnRecordFinished     `yaml:"on_record_finished,omitempty"`     // 录制完成后的操作配置
+	FfmpegOptions        *FfmpegOptions        `yaml:"ffmpeg_options,omitempty"`         // FFmpeg额外参数
+	TimeoutInUs          *int                  `yaml:"timeout_in_us,omitempty"`          // 超时时间（微秒）
+	StallTimeout         *time.Duration        `yaml:"stall_timeout,omitempty"`          // 直播流停滞检测时间
+	UseNativeFlvParser   *bool                 `yaml:"use_native_flv_parser,omitempty"`  // 是否使用本地FLV解析器
+	UseNativeHlsParser   *bool                 `yaml:"use_native_hls_parser,omitempty"`  // 是否使用本地HLS解析器
+	HlsBacklog           *HlsBacklog           `yaml:"hls_backlog,omitempty"`            // HLS开播补录配置
+	Redundancy           *Redundancy           `yaml:"redundancy,omitempty"`             // 冗余录制配置
+	SessionConcat        *SessionConcat        `yaml:"session_concat,omitempty"`         // 直播场次拼接配置
+	PostProcessSteps     []PostProcessStep     `yaml:"post_process_steps,omitempty"`     // 录制后处理步骤
+	Retention            *RetentionPolicy      `yaml:"retention,omitempty"`              // 保留规则
+}
+
+// applyTo 将已设置的字段覆盖到配置中。
+func (rc *RoomConfig) applyTo(c *Config) {
+	if rc.OutPutPath != nil {
+		c.OutPutPath = *rc.OutPutPath
+	}
+	if rc.OutputTmpl != nil {
+		c.OutputTmpl = *rc.OutputTmpl
+	}
+	if rc.VideoSplitStrategies != nil {
+		c.VideoSplitStrategies = *rc.VideoSplitStrategies
+	}
+	if rc.OnRecordFinished != nil {
+		c.OnRecordFinished = *rc.OnRecordFinished
+	}
+	if rc.FfmpegOptions != nil {
+		c.FfmpegOptions = *rc.FfmpegOptions
+	}
+	if rc.TimeoutInUs != nil {
+		c.TimeoutInUs = *rc.TimeoutInUs
+	}
+	if rc.StallTimeout != nil {
+		c.StallTimeout = *rc.StallTimeout
+	}
+	if rc.UseNativeFlvParser != nil {
+		c.Feature.UseNativeFlvParser = *rc.UseNativeFlvParser
+	}
+	if rc.UseNativeHlsParser != nil {
+		c.Feature.UseNativeHlsParser = *rc.UseNativeHlsParser
+	}
+	if rc.HlsBacklog != nil {
+		c.HlsBacklog = *rc.HlsBacklog
+	}
+	if rc.Redundancy != nil {
+		c.Redundancy = *rc.Redundancy
+	}
+	if rc.SessionConcat != nil {
+		c.SessionConcat = *rc.SessionConcat
+	}
+	if len(rc.PostProcessSteps) > 0 {
+		c.PostProcess.Steps = rc.PostProcessSteps
+	}
+	if rc.Retention != nil {
+		c.Retention.Default = *rc.Retention
+	}
 }
 
 // LiveRoom包含直播房间信息。
@@ -96,6 +296,9 @@ type LiveRoom struct {
 	Rtmp      string  `yaml:"rtmp"`         // 转推地址
 	Push      bool    `yaml:"push"`         // 转推
 	Pushing   bool    `yaml:"is_pushing"`   // 转推状态
+	Priority  int     `yaml:"priority"`     // 录制优先级，磁盘空间不足或超过同时录制上限时优先停止优先级低的录制
+
+	RoomConfig `yaml:",inline"` // 该直播间覆盖的配置，未设置的字段使用配置模板或全局配置
 }
 
 // liveRoomAlias用于在配置中同时支持字符串和LiveRoom格式。
@@ -145,25 +348,56 @@ var defaultConfig = Config{
 	},
 	Feature: Feature{
 		UseNativeFlvParser:         false,
+		UseNativeHlsParser:         false,
 		RemoveSymbolOtherCharacter: false,
 	},
-	LiveRooms:          []LiveRoom{},
-	File:               "",
-	liveRoomIndexCache: map[string]int{},
+	LiveRooms: []LiveRoom{},
+	File:      "",
 	VideoSplitStrategies: VideoSplitStrategies{
 		OnRoomNameChanged: false,
 	},
+	LiveStates: LiveStates{
+		RecordReplay: false,
+	},
 	OnRecordFinished: OnRecordFinished{
 		ConvertToMp4:          false,
 		DeleteFlvAfterConvert: false,
 	},
-	TimeoutInUs: 60000000,
+	PostProcess: PostProcess{
+		Workers: 1,
+		Retries: 2,
+		Timeout: 2 * time.Hour,
+	},
+	TimeoutInUs:  60000000,
+	StallTimeout: 30 * time.Second,
+	NetworkMonitor: NetworkMonitor{
+		Enable:           false,
+		Endpoints:        []string{"https://www.baidu.com", "https://www.bing.com", "223.5.5.5:53"},
+		Interval:         10 * time.Second,
+		Timeout:          5 * time.Second,
+		FailureThreshold: 2,
+	},
+	DiskGuard: DiskGuard{
+		Enable:         false,
+		Interval:       30 * time.Second,
+		WarnFreeMB:     10240,
+		CriticalFreeMB: 2048,
+		StopFreeMB:     1024,
+	},
+	Retention: Retention{
+		Enable:   false,
+		Interval: time.Hour,
+		DryRun:   true,
+	},
+	Shutdown: Shutdown{
+		Timeout: 30 * time.Second,
+	},
 }
 
 // NewConfig 创建新的Config对象。
 func NewConfig() *Config {
 	config := defaultConfig
-	config.liveRoomIndexCache = map[string]int{}
+	config.liveRoomIndexCache = new(liveRoomIndex)
 	return &config
 }
 
@@ -181,8 +415,45 @@ func (c *Config) Verify() error {
 	if _, err := os.Stat(c.OutPutPath); err != nil {
 		return fmt.Errorf(`输出路径 "%s" 不存在`, c.OutPutPath)
 	}
-	if maxDur := c.VideoSplitStrategies.MaxDuration; maxDur > 0 && maxDur < time.Minute {
-		return fmt.Errorf("max_duration的最小值为一分钟")
+	if err := c.VideoSplitStrategies.verify(); err != nil {
+		return err
+	}
+	if nm := c.NetworkMonitor; nm.Enable && (nm.Interval <= 0 || nm.Timeout <= 0) {
+		return fmt.Errorf("network_monitor的interval和timeout必须大于0")
+	}
+	if dg := c.DiskGuard; dg.Enable {
+		if dg.Interval <= 0 {
+			return fmt.Errorf("disk_guard的interval必须大于0")
+		}
+		if dg.WarnFreeMB < dg.CriticalFreeMB || dg.CriticalFreeMB < dg.StopFreeMB {
+			return fmt.Errorf("disk_guard的阈值需满足warn_free_mb >= critical_free_mb >= stop_free_mb")
+		}
+	}
+	if err := c.verifyProfiles(); err != nil {
+		return err
+	}
+	for _, room := range c.LiveRooms {
+		if err := c.EffectiveConfig(room.Url).VideoSplitStrategies.verify(); err != nil {
+			return fmt.Errorf("直播间 %s: %w", room.Url, err)
+		}
+	}
+	if c.StallTimeout < 0 {
+		return fmt.Errorf("stall_timeout不能小于0")
+	}
+	if c.MaxRecordings < 0 {
+		return fmt.Errorf("max_recordings不能小于0")
+	}
+	if c.Redundancy.Copies < 0 {
+		return fmt.Errorf("redundancy的copies不能小于0")
+	}
+	if c.Retention.Enable && c.Retention.Interval <= 0 {
+		return fmt.Errorf("retention的interval必须大于0")
+	}
+	if c.PostProcess.Workers < 0 || c.PostProcess.Retries < 0 {
+		return fmt.Errorf("post_process的workers和retries不能小于0")
+	}
+	if c.Shutdown.Timeout < 0 {
+		return fmt.Errorf("shutdown的timeout不能小于0")
 	}
 	if !c.RPC.Enable && len(c.LiveRooms) == 0 {
 		return fmt.Errorf("RPC未启用，且未设置直播房间，程序没有可执行操作")
@@ -190,20 +461,21 @@ func (c *Config) Verify() error {
 	return nil
 }
 
-// RefreshLiveRoomIndexCache 刷新直播房间索引缓存。
+// RefreshLiveRoomIndexCache 刷新直播房间索引缓存，修改LiveRooms后需要调用。
 func (c *Config) RefreshLiveRoomIndexCache() {
-	for index, room := range c.LiveRooms {
-		c.liveRoomIndexCache[room.Url] = index
+	if c.liveRoomIndexCache == nil {
+		c.liveRoomIndexCache = new(liveRoomIndex)
 	}
+	c.liveRoomIndexCache.rebuild(c.LiveRooms)
 }
 
 // RemoveLiveRoomByUrl 通过URL移除直播房间。
 func (c *Config) RemoveLiveRoomByUrl(url string) error {
 	c.RefreshLiveRoomIndexCache()
-	if index, ok := c.liveRoomIndexCache[url]; ok {
+	if index, ok := c.liveRoomIndexCache.get(url); ok {
 		if index >= 0 && index < len(c.LiveRooms) && c.LiveRooms[index].Url == url {
 			c.LiveRooms = append(c.LiveRooms[:index], c.LiveRooms[index+1:]...)
-			delete(c.liveRoomIndexCache, url)
+			c.RefreshLiveRoomIndexCache()
 			return nil
 		}
 	}
@@ -213,7 +485,7 @@ func (c *Config) RemoveLiveRoomByUrl(url string) error {
 // UpdateLiveRoomByUrl 通过URL更新直播房间。
 func (c *Config) UpdateLiveRoomByUrl(url string, room *LiveRoom) error {
 	c.RefreshLiveRoomIndexCache()
-	if index, ok := c.liveRoomIndexCache[url]; ok {
+	if index, ok := c.liveRoomIndexCache.get(url); ok {
 		if index >= 0 && index < len(c.LiveRooms) && c.LiveRooms[index].Url == url {
 			// 从指针 room 创建一个新的 LiveRoom 值
 			newRoom := *room
@@ -229,20 +501,9 @@ func (c *Config) UpdateLiveRoomByUrl(url string, room *LiveRoom) error {
 }
 
 // GetLiveRoomByUrl 通过URL获取直播房间。
+// 可能被多个goroutine同时调用，只读取索引，找不到时不会刷新索引。
 func (c *Config) GetLiveRoomByUrl(url string) (*LiveRoom, error) {
-	room, err := c.getLiveRoomByUrlImpl(url)
-	if err != nil {
-		c.RefreshLiveRoomIndexCache()
-		if room, err = c.getLiveRoomByUrlImpl(url); err != nil {
-			return nil, err
-		}
-	}
-	return room, nil
-}
-
-// getLiveRoomByUrlImpl 通过URL获取直播房间的实现方法。
-func (c Config) getLiveRoomByUrlImpl(url string) (*LiveRoom, error) {
-	if index, ok := c.liveRoomIndexCache[url]; ok {
+	if index, ok := c.liveRoomIndexCache.get(url); ok {
 		if index >= 0 && index < len(c.LiveRooms) && c.LiveRooms[index].Url == url {
 			return &c.LiveRooms[index], nil
 		}
@@ -283,7 +544,17 @@ func (c *Config) Marshal() error {
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(c.File, b, os.ModeAppend)
+	// 先写入临时文件再替换，避免磁盘写满等情况导致配置文件被截断
+	perm := os.FileMode(0644)
+	if stat, err := os.Stat(c.File); err == nil {
+		perm = stat.Mode().Perm()
+	}
+	tmp := c.File + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, perm); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, c.File)
 }
 
 // GetFilePath 获取配置文件路径。
@@ -293,3 +564,121 @@ func (c Config) GetFilePath() (string, error) {
 	}
 	return c.File, nil
 }
+
+// EffectiveConfig 返回直播间生效的配置。
+// 依次应用全局配置、直播间继承的配置模板（由远及近）和直播间覆盖的配置，返回的是副本，修改它不会影响全局配置。
+func (c *Config) EffectiveConfig(url string) *Config {
+	effective := *c
+	room, err := c.GetLiveRoomByUrl(url)
+	if err != nil {
+		return &effective
+	}
+	chain, err := c.profileChain(room.Profile)
+	if err != nil {
+		return &effective
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		chain[i].applyTo(&effective)
+	}
+	room.RoomConfig.applyTo(&effective)
+	return &effective
+}
+
+// profileChain 返回配置模板及其继承的所有配置模板，由近及远排列。
+func (c *Config) profileChain(name string) ([]*RoomConfig, error) {
+	chain := make([]*RoomConfig, 0, 2)
+	visited := make(map[string]bool)
+	for name != "" {
+		if visited[name] {
+			return nil, fmt.Errorf("配置模板 %s 存在循环继承", name)
+		}
+		visited[name] = true
+		profile, ok := c.Profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("配置模板 %s 不存在", name)
+		}
+		chain = append(chain, &profile)
+		name = profile.Profile
+	}
+	return chain, nil
+}
+
+// verifyProfiles 检查配置模板和直播间引用的配置模板是否有效。
+func (c *Config) verifyProfiles() error {
+	for name := range c.Profiles {
+		if _, err := c.profileChain(name); err != nil {
+			return err
+		}
+	}
+	for _, room := range c.LiveRooms {
+		if _, err := c.profileChain(room.Profile); err != nil {
+			return fmt.Errorf("直播间 %s: %w", room.Url, err)
+		}
+	}
+	return nil
+}
+
+// GetPostProcessSteps 返回直播间生效的录制后处理步骤。
+// 优先使用直播间或配置模板中的配置，其次为全局配置，最后兼容旧的 on_record_finished 配置。
+func (c *Config) GetPostProcessSteps(url string) []PostProcessStep {
+	effective := c.EffectiveConfig(url)
+	if len(effective.PostProcess.Steps) > 0 {
+		return effective.PostProcess.Steps
+	}
+	onRecordFinished := effective.OnRecordFinished
+	deleteSource := strconv.FormatBool(onRecordFinished.DeleteFlvAfterConvert)
+	if cmd := strings.TrimSpace(onRecordFinished.CustomCommandline); cmd != "" {
+		return []PostProcessStep{{
+			Name: "custom_command",
+			Args: map[string]string{"commandline": cmd, "delete_source": deleteSource},
+		}}
+	}
+	if onRecordFinished.ConvertToMp4 {
+		return []PostProcessStep{{
+			Name: "remux",
+			Args: map[string]string{"format": "mp4", "delete_source": deleteSource},
+		}}
+	}
+	return nil
+}
+
+// OutputRoots 返回全局和各直播间的输出目录，已被其他目录包含或不存在的目录会被跳过。
+func (c *Config) OutputRoots() []string {
+	paths := []string{c.OutPutPath}
+	for _, room := range c.LiveRooms {
+		paths = append(paths, c.EffectiveConfig(room.Url).OutPutPath)
+	}
+	abs := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if p, err := filepath.Abs(path); err == nil {
+			abs = append(abs, p)
+		}
+	}
+	// 按长度排序，保证父目录先于子目录被处理
+	sort.Slice(abs, func(i, j int) bool { return len(abs[i]) < len(abs[j]) })
+	roots := make([]string, 0, len(abs))
+	for _, path := range abs {
+		if containsPath(roots, path) {
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			roots = append(roots, path)
+		}
+	}
+	return roots
+}
+
+// containsPath 返回路径是否等于或位于任意一个目录之下。
+func containsPath(dirs []string, path string) bool {
+	for _, dir := range dirs {
+		if path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetRetentionPolicy 返回直播间生效的保留规则，直播间未单独配置时使用全局默认规则。
+func (c *Config) GetRetentionPolicy(url string) RetentionPolicy {
+	return c.EffectiveConfig(url).Retention.Default
+}
@@ -2,7 +2,9 @@ package configs
 
 import (
 	"os"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -72,4 +74,153 @@ func TestConfig_Verify(t *testing.T) {
 	cfg.OutPutPath = os.TempDir()
 	cfg.RPC.Enable = false
 	assert.Error(t, cfg.Verify())
+
+	// 房间名称更改时分割视频和记录章节不能同时开启
+	cfg.RPC.Enable = true
+	cfg.VideoSplitStrategies.OnRoomNameChanged = true
+	cfg.VideoSplitStrategies.ChapterOnChanged = true
+	assert.Error(t, cfg.Verify())
+}
+
+// TestConfig_GetPostProcessSteps 测试录制后处理步骤的生效顺序。
+func TestConfig_GetPostProcessSteps(t *testing.T) {
+	cfg := NewConfig()
+	cfg.LiveRooms = []LiveRoom{{Url: "https://example.com/a"}, {Url: "https://example.com/b"}}
+	cfg.RefreshLiveRoomIndexCache()
+
+	// 未配置任何步骤
+	assert.Empty(t, cfg.GetPostProcessSteps("https://example.com/a"))
+
+	// 兼容旧的 on_record_finished 配置
+	cfg.OnRecordFinished.ConvertToMp4 = true
+	cfg.OnRecordFinished.DeleteFlvAfterConvert = true
+	assert.Equal(t, []PostProcessStep{{
+		Name: "remux",
+		Args: map[string]string{"format": "mp4", "delete_source": "true"},
+	}}, cfg.GetPostProcessSteps("https://example.com/a"))
+
+	// 全局配置优先于旧配置
+	cfg.PostProcess.Steps = []PostProcessStep{{Name: "checksum"}}
+	assert.Equal(t, cfg.PostProcess.Steps, cfg.GetPostProcessSteps("https://example.com/a"))
+
+	// 直播间配置优先于全局配置
+	cfg.LiveRooms[1].PostProcessSteps = []PostProcessStep{{Name: "thumbnail"}}
+	assert.Equal(t, cfg.LiveRooms[1].PostProcessSteps, cfg.GetPostProcessSteps("https://example.com/b"))
+	assert.Equal(t, cfg.PostProcess.Steps, cfg.GetPostProcessSteps("https://example.com/a"))
+}
+
+// TestConfig_EffectiveConfig 测试直播间配置、配置模板与全局配置的合并。
+func TestConfig_EffectiveConfig(t *testing.T) {
+	raw := `
+out_put_path: /global
+timeout_in_us: 100
+profiles:
+  base:
+    out_put_path: /base
+    ffmpeg_options:
+      output_args: ["-c:v", "libx265"]
+  archive-hevc:
+    profile: base
+    timeout_in_us: 200
+live_rooms:
+- url: https://example.com/a
+  profile: archive-hevc
+  out_put_tmpl: "{{ .HostName }}.flv"
+- url: https://example.com/b
+  video_split_strategies:
+    max_duration: 1h
+- https://example.com/c
+`
+	cfg, err := NewConfigWithBytes([]byte(raw))
+	assert.NoError(t, err)
+	assert.NoError(t, cfg.verifyProfiles())
+
+	// 直播间覆盖 > 配置模板 > 继承的配置模板 > 全局配置
+	a := cfg.EffectiveConfig("https://example.com/a")
+	assert.Equal(t, "/base", a.OutPutPath)
+	assert.Equal(t, 200, a.TimeoutInUs)
+	assert.Equal(t, "{{ .HostName }}.flv", a.OutputTmpl)
+	assert.Equal(t, []string{"-c:v", "libx265"}, a.FfmpegOptions.OutputArgs)
+
+	b := cfg.EffectiveConfig("https://example.com/b")
+	assert.Equal(t, "/global", b.OutPutPath)
+	assert.Equal(t, time.Hour, b.VideoSplitStrategies.MaxDuration)
+
+	// 未覆盖任何配置的直播间和未知直播间使用全局配置，且不会修改全局配置
+	c := cfg.EffectiveConfig("https://example.com/c")
+	assert.Equal(t, "/global", c.OutPutPath)
+	assert.Equal(t, 100, cfg.EffectiveConfig("https://example.com/unknown").TimeoutInUs)
+	assert.Equal(t, "/global", cfg.OutPutPath)
+	assert.Equal(t, time.Duration(0), cfg.VideoSplitStrategies.MaxDuration)
+
+	// 引用不存在的配置模板或循环继承时校验失败
+	cfg.LiveRooms[1].Profile = "not-exist"
+	assert.Error(t, cfg.verifyProfiles())
+	cfg.LiveRooms[1].Profile = ""
+	cfg.Profiles["base"] = RoomConfig{Profile: "archive-hevc"}
+	assert.Error(t, cfg.verifyProfiles())
+}
+
+// TestVideoSplitStrategies_AlignedTime 测试按时钟对齐的切分时间。
+// TestConfig_GetLiveRoomByUrlConcurrent 测试找不到直播房间时不会修改索引，可以与刷新索引同时进行。
+func TestConfig_GetLiveRoomByUrlConcurrent(t *testing.T) {
+	cfg := NewConfig()
+	cfg.LiveRooms = []LiveRoom{{Url: "https://example.com/a"}}
+	cfg.RefreshLiveRoomIndexCache()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				cfg.EffectiveConfig("")
+				cfg.EffectiveConfig("https://example.com/removed")
+				cfg.RefreshLiveRoomIndexCache()
+			}
+		}()
+	}
+	wg.Wait()
+
+	room, err := cfg.GetLiveRoomByUrl("https://example.com/a")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/a", room.Url)
+	_, err = cfg.GetLiveRoomByUrl("https://example.com/removed")
+	assert.Error(t, err)
+}
+
+func TestVideoSplitStrategies_AlignedTime(t *testing.T) {
+	v := VideoSplitStrategies{TimeZone: "Asia/Shanghai"}
+	loc, err := v.Location()
+	assert.NoError(t, err)
+	at := func(d, h, m int) time.Time { return time.Date(2024, 1, d, h, m, 0, 0, loc) }
+
+	// 未配置对齐切分
+	assert.True(t, v.NextAlignedTime(at(1, 12, 30)).IsZero())
+	assert.Equal(t, at(1, 12, 30), v.LastAlignedTime(at(1, 12, 30)))
+
+	// 每小时整点切分，跨天时切分在零点
+	v.AlignInterval = time.Hour
+	assert.True(t, at(1, 13, 0).Equal(v.NextAlignedTime(at(1, 12, 30))))
+	assert.True(t, at(1, 13, 0).Equal(v.NextAlignedTime(at(1, 12, 0))))
+	assert.True(t, at(2, 0, 0).Equal(v.NextAlignedTime(at(1, 23, 59))))
+	assert.True(t, at(1, 12, 0).Equal(v.LastAlignedTime(at(1, 12, 30))))
+
+	// 时区不同时按配置的时区对齐
+	v.AlignInterval = 0
+	v.AlignTimes = []string{"08:30", "20:00"}
+	assert.True(t, at(1, 20, 0).Equal(v.NextAlignedTime(at(1, 9, 0).UTC())))
+	assert.True(t, at(2, 8, 30).Equal(v.NextAlignedTime(at(1, 21, 0))))
+	assert.True(t, at(1, 20, 0).Equal(v.LastAlignedTime(at(2, 8, 0))))
+
+	// 校验配置
+	assert.NoError(t, v.verify())
+	v.AlignTimes = []string{"8点"}
+	assert.Error(t, v.verify())
+	v.AlignTimes = nil
+	v.AlignInterval = time.Second
+	assert.Error(t, v.verify())
+	v.AlignInterval = time.Hour
+	v.TimeZone = "Mars/Olympus"
+	assert.Error(t, v.verify())
 }
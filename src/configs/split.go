@@ -0,0 +1,101 @@
+package configs
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	// 保证在没有时区数据库的系统上也能加载 time_zone
+	_ "time/tzdata"
+)
+
+// verify 验证视频分割策略的有效性。
+func (v VideoSplitStrategies) verify() error {
+	if v.OnRoomNameChanged && v.ChapterOnChanged {
+		return fmt.Errorf("on_room_name_changed和chapter_on_changed不能同时开启")
+	}
+	if v.MaxDuration > 0 && v.MaxDuration < time.Minute {
+		return fmt.Errorf("max_duration的最小值为一分钟")
+	}
+	if v.AlignInterval != 0 && (v.AlignInterval < time.Minute || v.AlignInterval > 24*time.Hour) {
+		return fmt.Errorf("align_interval需在一分钟到24小时之间")
+	}
+	for _, s := range v.AlignTimes {
+		if _, err := time.Parse("15:04", s); err != nil {
+			return fmt.Errorf(`align_times中的时间点 "%s" 格式错误，应为HH:MM`, s)
+		}
+	}
+	if _, err := v.Location(); err != nil {
+		return fmt.Errorf(`未知的时区 "%s"`, v.TimeZone)
+	}
+	return nil
+}
+
+// Aligned 返回是否配置了按时钟对齐的切分。
+func (v VideoSplitStrategies) Aligned() bool {
+	return v.AlignInterval > 0 || len(v.AlignTimes) > 0
+}
+
+// Location 返回按时钟对齐切分使用的时区。
+func (v VideoSplitStrategies) Location() (*time.Location, error) {
+	if v.TimeZone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(v.TimeZone)
+}
+
+// NextAlignedTime 返回 t 之后的第一个对齐切分时间，未配置按时钟对齐切分时返回零值。
+func (v VideoSplitStrategies) NextAlignedTime(t time.Time) time.Time {
+	loc, err := v.Location()
+	if err != nil || !v.Aligned() {
+		return time.Time{}
+	}
+	t = t.In(loc)
+	for day := 0; day <= 1; day++ {
+		for _, b := range v.alignedTimesOfDay(t, day) {
+			if b.After(t) {
+				return b
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// LastAlignedTime 返回不晚于 t 的最近一个对齐切分时间，未配置按时钟对齐切分时返回 t。
+func (v VideoSplitStrategies) LastAlignedTime(t time.Time) time.Time {
+	loc, err := v.Location()
+	if err != nil || !v.Aligned() {
+		return t
+	}
+	t = t.In(loc)
+	for day := 0; day >= -1; day-- {
+		times := v.alignedTimesOfDay(t, day)
+		for i := len(times) - 1; i >= 0; i-- {
+			if !times[i].After(t) {
+				return times[i]
+			}
+		}
+	}
+	return t
+}
+
+// alignedTimesOfDay 返回 t 所在日期偏移 day 天后当天的所有对齐切分时间，按时间排序。
+// 使用日历时间计算，夏令时切换的日期也能对齐到正确的钟点。
+func (v VideoSplitStrategies) alignedTimesOfDay(t time.Time, day int) []time.Time {
+	y, m, d := t.Date()
+	d += day
+	var times []time.Time
+	if v.AlignInterval > 0 {
+		step := int(v.AlignInterval / time.Second)
+		for sec := 0; sec < 24*60*60; sec += step {
+			times = append(times, time.Date(y, m, d, 0, 0, sec, 0, t.Location()))
+		}
+	}
+	for _, s := range v.AlignTimes {
+		if hm, err := time.Parse("15:04", s); err == nil {
+			times = append(times, time.Date(y, m, d, hm.Hour(), hm.Minute(), 0, 0, t.Location()))
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	return times
+}
@@ -0,0 +1,11 @@
+package disk
+
+import (
+	"github.com/yuhaohwang/bililive-go/src/pkg/events"
+)
+
+// DiskLow 表示磁盘剩余空间低于阈值的事件类型，事件对象为 *Status。
+const DiskLow events.EventType = "DiskLow"
+
+// DiskRecovered 表示磁盘剩余空间恢复正常的事件类型，事件对象为 *Status。
+const DiskRecovered events.EventType = "DiskRecovered"
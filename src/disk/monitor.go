@@ -0,0 +1,289 @@
+package disk
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yuhaohwang/bililive-go/src/configs"
+	"github.com/yuhaohwang/bililive-go/src/instance"
+	"github.com/yuhaohwang/bililive-go/src/interfaces"
+	"github.com/yuhaohwang/bililive-go/src/pkg/events"
+)
+
+// 定义状态常量用于标记检测器的状态。
+const (
+	begin uint32 = iota
+	running
+	stopped
+)
+
+const mb = 1024 * 1024
+
+// Level 表示磁盘剩余空间的告警级别。
+type Level uint32
+
+const (
+	LevelOK       Level = iota // 剩余空间充足
+	LevelWarn                  // 低于告警阈值
+	LevelCritical              // 低于严重阈值，不再开始新的录制
+	LevelStop                  // 低于停止阈值，停止优先级最低的录制
+)
+
+var levelNames = map[Level]string{
+	LevelOK:       "ok",
+	LevelWarn:     "warn",
+	LevelCritical: "critical",
+	LevelStop:     "stop",
+}
+
+// String 返回告警级别的名称。
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// MarshalText 实现 encoding.TextMarshaler 接口，在 JSON 中以名称表示。
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// Status 表示一个输出目录所在磁盘的当前状态。
+type Status struct {
+	Usage
+	Level Level `json:"level"` // 告警级别
+}
+
+// Monitor 定义了磁盘空间检测器的接口，它实现了 interfaces.Module 接口。
+type Monitor interface {
+	interfaces.Module
+	Level() Level
+	LevelOf(path string) Level
+	Status() (*Status, error)
+	Statuses() ([]*Status, error)
+}
+
+// for test
+var getUsageFunc = GetUsage
+
+// NewMonitor 创建一个新的磁盘空间检测器。
+func NewMonitor(ctx context.Context) Monitor {
+	// 1. 获取应用程序实例 inst。
+	inst := instance.GetInstance(ctx)
+
+	// 2. 创建磁盘空间检测器实例，并注册到应用程序实例中。
+	m := &monitor{
+		config: inst.Config,
+		logger: inst.Logger,
+		levels: make(map[string]Level),
+		state:  begin,
+		stop:   make(chan struct{}),
+	}
+	inst.DiskMonitor = m
+	return m
+}
+
+// monitor 实现了 Monitor 接口。
+type monitor struct {
+	config *configs.Config
+	ed     events.Dispatcher
+	logger *interfaces.Logger
+
+	level  uint32           // 所有输出目录中最高的告警级别
+	lock   sync.RWMutex     // 保护 levels
+	levels map[string]Level // 每个输出目录的告警级别
+
+	state uint32
+	stop  chan struct{}
+}
+
+// Start 启动磁盘空间检测器。
+func (m *monitor) Start(ctx context.Context) error {
+	// 1. 未启用磁盘空间保护时直接返回。
+	if !m.config.DiskGuard.Enable {
+		return nil
+	}
+
+	// 2. 使用原子操作检查并设置检测器的状态为 running。
+	if !atomic.CompareAndSwapUint32(&m.state, begin, running) {
+		return nil
+	}
+	m.ed = instance.GetInstance(ctx).EventDispatcher.(events.Dispatcher)
+
+	// 3. 立即检测一次，避免启动时磁盘已满仍开始录制，然后启动主循环。
+	m.check()
+	go m.run()
+	return nil
+}
+
+// Close 关闭磁盘空间检测器。
+func (m *monitor) Close(ctx context.Context) {
+	if !atomic.CompareAndSwapUint32(&m.state, running, stopped) {
+		return
+	}
+	close(m.stop)
+}
+
+// Level 返回最近一次检测得到的所有输出目录中最高的告警级别。
+func (m *monitor) Level() Level {
+	return Level(atomic.LoadUint32(&m.level))
+}
+
+// LevelOf 返回最近一次检测得到的 path 所在输出目录的告警级别，
+// path 不在任何已检测的输出目录之下时返回所有输出目录中最高的告警级别。
+func (m *monitor) LevelOf(path string) Level {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return m.Level()
+	}
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	root, level := "", m.Level()
+	for r, l := range m.levels {
+		if len(r) > len(root) && IsUnder(abs, r) {
+			root, level = r, l
+		}
+	}
+	return level
+}
+
+// Status 返回全局输出目录所在磁盘的当前状态。
+func (m *monitor) Status() (*Status, error) {
+	return m.statusOf(m.config.OutPutPath)
+}
+
+// Statuses 返回所有输出目录所在磁盘的当前状态，包括直播间单独配置的输出目录。
+// 只有所有输出目录都获取失败时才返回错误。
+func (m *monitor) Statuses() ([]*Status, error) {
+	var (
+		statuses []*Status
+		lastErr  error
+	)
+	for _, root := range m.roots() {
+		status, err := m.statusOf(root)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		statuses = append(statuses, status)
+	}
+	if len(statuses) == 0 {
+		return nil, lastErr
+	}
+	return statuses, nil
+}
+
+// statusOf 返回路径所在磁盘的当前状态。
+func (m *monitor) statusOf(path string) (*Status, error) {
+	usage, err := getUsageFunc(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Status{
+		Usage: *usage,
+		Level: m.levelOf(usage.FreeBytes),
+	}, nil
+}
+
+// roots 返回需要检测的输出目录，没有已存在的输出目录时检测全局输出目录。
+func (m *monitor) roots() []string {
+	if roots := m.config.OutputRoots(); len(roots) > 0 {
+		return roots
+	}
+	if abs, err := filepath.Abs(m.config.OutPutPath); err == nil {
+		return []string{abs}
+	}
+	return []string{m.config.OutPutPath}
+}
+
+// IsUnder 返回 path 是否等于 root 或位于 root 之下，两者都需要是绝对路径。
+func IsUnder(path, root string) bool {
+	return path == root || strings.HasPrefix(path, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// run 启动检测器的主循环。
+func (m *monitor) run() {
+	ticker := time.NewTicker(m.config.DiskGuard.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			m.check()
+		}
+	}
+}
+
+// levelOf 根据剩余空间计算告警级别。
+func (m *monitor) levelOf(free uint64) Level {
+	cfg := m.config.DiskGuard
+	switch {
+	case !cfg.Enable:
+		return LevelOK
+	case free < cfg.StopFreeMB*mb:
+		return LevelStop
+	case free < cfg.CriticalFreeMB*mb:
+		return LevelCritical
+	case free < cfg.WarnFreeMB*mb:
+		return LevelWarn
+	default:
+		return LevelOK
+	}
+}
+
+// check 检测每个输出目录的剩余空间，并在告警级别变化时分发事件。
+func (m *monitor) check() {
+	// 1. 获取剩余空间，获取失败的输出目录保持原有级别。
+	for _, root := range m.roots() {
+		status, err := m.statusOf(root)
+		if err != nil {
+			m.logger.WithError(err).WithField("path", root).Debug("获取磁盘剩余空间失败")
+			continue
+		}
+		m.lock.Lock()
+		prev := m.levels[root]
+		m.levels[root] = status.Level
+		m.lock.Unlock()
+		m.notify(status, prev)
+	}
+
+	// 2. 更新所有输出目录中最高的告警级别。
+	m.lock.RLock()
+	var max Level
+	for _, level := range m.levels {
+		if level > max {
+			max = level
+		}
+	}
+	m.lock.RUnlock()
+	atomic.StoreUint32(&m.level, uint32(max))
+}
+
+// notify 在输出目录的告警级别变化时分发事件。
+func (m *monitor) notify(status *Status, prev Level) {
+	// 1. 恢复正常时分发 DiskRecovered 事件。
+	if status.Level == LevelOK {
+		if prev != LevelOK {
+			m.logger.WithField("free_bytes", status.FreeBytes).Info("Disk space is recovered")
+			m.ed.DispatchEvent(events.NewEvent(DiskRecovered, status))
+		}
+		return
+	}
+
+	// 2. 级别变化时分发 DiskLow 事件，低于停止阈值时每次检测都分发，以便逐个停止录制。
+	if status.Level != prev || status.Level == LevelStop {
+		m.logger.WithFields(map[string]interface{}{
+			"path":       status.Path,
+			"free_bytes": status.FreeBytes,
+			"level":      status.Level.String(),
+		}).Warn("Disk space is low")
+		m.ed.DispatchEvent(events.NewEvent(DiskLow, status))
+	}
+}
@@ -0,0 +1,148 @@
+package disk
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yuhaohwang/bililive-go/src/configs"
+	"github.com/yuhaohwang/bililive-go/src/instance"
+	"github.com/yuhaohwang/bililive-go/src/log"
+	"github.com/yuhaohwang/bililive-go/src/pkg/events"
+	evtmock "github.com/yuhaohwang/bililive-go/src/pkg/events/mock"
+)
+
+func TestGetUsage(t *testing.T) {
+	usage, err := GetUsage(os.TempDir())
+	if err == ErrNotSupported {
+		t.Skip(err)
+	}
+	assert.NoError(t, err)
+	assert.True(t, usage.TotalBytes > 0)
+	assert.True(t, usage.FreeBytes <= usage.TotalBytes)
+}
+
+func TestMonitorCheck(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ed := evtmock.NewMockDispatcher(ctrl)
+	cfg := configs.NewConfig()
+	cfg.DiskGuard.Enable = true
+	cfg.DiskGuard.WarnFreeMB = 100
+	cfg.DiskGuard.CriticalFreeMB = 50
+	cfg.DiskGuard.StopFreeMB = 10
+	cfg.Log.OutPutFolder = t.TempDir()
+	ctx := context.WithValue(context.Background(), instance.Key, &instance.Instance{
+		EventDispatcher: ed,
+		Config:          cfg,
+	})
+	log.New(ctx)
+	m := NewMonitor(ctx).(*monitor)
+	m.ed = ed
+
+	backup := getUsageFunc
+	defer func() { getUsageFunc = backup }()
+	var free uint64
+	getUsageFunc = func(path string) (*Usage, error) {
+		return &Usage{Path: path, FreeBytes: free, TotalBytes: 1000 * mb}, nil
+	}
+	expectEvent := func(typ events.EventType, level Level) {
+		ed.EXPECT().DispatchEvent(gomock.Any()).Do(func(event *events.Event) {
+			assert.Equal(t, typ, event.Type)
+			assert.Equal(t, level, event.Object.(*Status).Level)
+		})
+	}
+
+	// 空间充足时不分发事件
+	free = 200 * mb
+	m.check()
+	assert.Equal(t, LevelOK, m.Level())
+
+	// 级别变化时分发一次事件
+	free = 80 * mb
+	expectEvent(DiskLow, LevelWarn)
+	m.check()
+	m.check()
+	assert.Equal(t, LevelWarn, m.Level())
+
+	free = 30 * mb
+	expectEvent(DiskLow, LevelCritical)
+	m.check()
+	assert.Equal(t, LevelCritical, m.Level())
+
+	// 低于停止阈值时每次检测都分发事件
+	free = 5 * mb
+	expectEvent(DiskLow, LevelStop)
+	expectEvent(DiskLow, LevelStop)
+	m.check()
+	m.check()
+	assert.Equal(t, LevelStop, m.Level())
+
+	// 恢复正常
+	free = 200 * mb
+	expectEvent(DiskRecovered, LevelOK)
+	m.check()
+	assert.Equal(t, LevelOK, m.Level())
+
+	// 未启用时总是返回正常级别
+	cfg.DiskGuard.Enable = false
+	free = 5 * mb
+	status, err := m.Status()
+	assert.NoError(t, err)
+	assert.Equal(t, LevelOK, status.Level)
+}
+
+func TestMonitorCheckRoots(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ed := evtmock.NewMockDispatcher(ctrl)
+	cfg := configs.NewConfig()
+	cfg.DiskGuard.Enable = true
+	cfg.DiskGuard.WarnFreeMB = 100
+	cfg.DiskGuard.CriticalFreeMB = 50
+	cfg.DiskGuard.StopFreeMB = 10
+	cfg.Log.OutPutFolder = t.TempDir()
+	cfg.OutPutPath = t.TempDir()
+	other := t.TempDir()
+	cfg.LiveRooms = []configs.LiveRoom{
+		{Url: "https://example.com/other", RoomConfig: configs.RoomConfig{OutPutPath: &other}},
+	}
+	cfg.RefreshLiveRoomIndexCache()
+	ctx := context.WithValue(context.Background(), instance.Key, &instance.Instance{
+		EventDispatcher: ed,
+		Config:          cfg,
+	})
+	log.New(ctx)
+	m := NewMonitor(ctx).(*monitor)
+	m.ed = ed
+
+	backup := getUsageFunc
+	defer func() { getUsageFunc = backup }()
+	getUsageFunc = func(path string) (*Usage, error) {
+		var free uint64 = 200 * mb
+		if path == other {
+			free = 5 * mb
+		}
+		return &Usage{Path: path, FreeBytes: free, TotalBytes: 1000 * mb}, nil
+	}
+
+	// 只有直播间单独配置的输出目录空间不足，事件携带该目录
+	ed.EXPECT().DispatchEvent(gomock.Any()).Do(func(event *events.Event) {
+		assert.Equal(t, DiskLow, event.Type)
+		assert.Equal(t, other, event.Object.(*Status).Path)
+	})
+	m.check()
+	assert.Equal(t, LevelStop, m.Level())
+	assert.Equal(t, LevelStop, m.LevelOf(filepath.Join(other, "room")))
+	assert.Equal(t, LevelOK, m.LevelOf(cfg.OutPutPath))
+
+	statuses, err := m.Statuses()
+	assert.NoError(t, err)
+	assert.Len(t, statuses, 2)
+}
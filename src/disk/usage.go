@@ -0,0 +1,27 @@
+// Package disk 包含磁盘剩余空间检测相关的代码。
+package disk
+
+import "errors"
+
+// ErrNotSupported 表示当前平台不支持获取磁盘空间。
+var ErrNotSupported = errors.New("disk usage is not supported on this platform")
+
+// Usage 表示路径所在磁盘的空间使用情况。
+type Usage struct {
+	Path       string `json:"path"`        // 检测的路径
+	FreeBytes  uint64 `json:"free_bytes"`  // 当前用户可用的剩余空间
+	TotalBytes uint64 `json:"total_bytes"` // 磁盘总空间
+}
+
+// GetUsage 获取路径所在磁盘的空间使用情况。
+func GetUsage(path string) (*Usage, error) {
+	free, total, err := getUsage(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Usage{
+		Path:       path,
+		FreeBytes:  free,
+		TotalBytes: total,
+	}, nil
+}
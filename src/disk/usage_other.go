@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd && !dragonfly && !windows
+
+package disk
+
+// getUsage 在不支持的平台上返回 ErrNotSupported。
+func getUsage(path string) (free, total uint64, err error) {
+	return 0, 0, ErrNotSupported
+}
@@ -12,15 +12,20 @@ import (
 
 // Instance 结构体包含了应用程序中的各种组件和配置信息。
 type Instance struct {
-	WaitGroup        sync.WaitGroup              // WaitGroup 用于等待各个 goroutine 的完成。
-	Config           *configs.Config             // Config 包含应用程序的配置信息。
-	Logger           *interfaces.Logger          // Logger 是日志记录器接口，用于记录日志。
-	Lives            map[live.ID]live.Live       // Lives 包含所有 live.Live 接口的实例。
-	Cache            gcache.Cache                // Cache 是一个缓存实例，用于存储临时数据。
-	Server           interfaces.Module           // Server 是应用程序的服务器模块。
-	EventDispatcher  interfaces.Module           // EventDispatcher 是事件分发器模块。
-	ListenerManager  interfaces.Module           // ListenerManager 是监听器管理器模块。
-	RecorderManager  interfaces.Module           // RecorderManager 是录制器管理器模块。
-	PusherManager    interfaces.Module           // PusherManager 是推送器管理器模块。
-	WebsocketManager interfaces.WebsocketManager // WebsocketManager 是websocket管理器模块。
+	WaitGroup            sync.WaitGroup              // WaitGroup 用于等待各个 goroutine 的完成。
+	Config               *configs.Config             // Config 包含应用程序的配置信息。
+	Logger               *interfaces.Logger          // Logger 是日志记录器接口，用于记录日志。
+	Lives                map[live.ID]live.Live       // Lives 包含所有 live.Live 接口的实例。
+	Cache                gcache.Cache                // Cache 是一个缓存实例，用于存储临时数据。
+	Server               interfaces.Module           // Server 是应用程序的服务器模块。
+	EventDispatcher      interfaces.Module           // EventDispatcher 是事件分发器模块。
+	ListenerManager      interfaces.Module           // ListenerManager 是监听器管理器模块。
+	RecorderManager      interfaces.Module           // RecorderManager 是录制器管理器模块。
+	PusherManager        interfaces.Module           // PusherManager 是推送器管理器模块。
+	NetworkMonitor       interfaces.Module           // NetworkMonitor 是网络检测模块。
+	DiskMonitor          interfaces.Module           // DiskMonitor 是磁盘空间检测模块。
+	RetentionManager     interfaces.Module           // RetentionManager 是录制文件保留策略管理器模块。
+	PostProcessorManager interfaces.Module           // PostProcessorManager 是录制后处理管理器模块。
+	CatalogManager       interfaces.Module           // CatalogManager 是录制文件索引模块。
+	WebsocketManager     interfaces.WebsocketManager // WebsocketManager 是websocket管理器模块。
 }
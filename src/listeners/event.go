@@ -1,6 +1,7 @@
 package listeners
 
 import (
+	"github.com/yuhaohwang/bililive-go/src/live"
 	"github.com/yuhaohwang/bililive-go/src/pkg/events"
 )
 
@@ -22,8 +23,21 @@ const RecorderStart events.EventType = "RecorderStart"
 // RecorderEnd 表示关闭推送的事件类型。
 const RecorderEnd events.EventType = "RecorderEnd"
 
+// LiveStateChanged 表示直播间状态（开播、轮播、封禁等）变更的事件类型，事件对象为 *LiveStateChange。
+const LiveStateChanged events.EventType = "LiveStateChanged"
+
+// LiveStateChange 是 LiveStateChanged 事件的对象，包含变更前后的直播间状态。
+type LiveStateChange struct {
+	Live live.Live
+	From live.LiveState
+	To   live.LiveState
+}
+
 // RoomNameChanged 表示房间名称变更的事件类型。
 const RoomNameChanged events.EventType = "RoomNameChanged"
 
+// RoomInfoChanged 表示以章节模式录制的直播间房间名称或分区变更的事件类型。
+const RoomInfoChanged events.EventType = "RoomInfoChanged"
+
 // RoomInitializingFinished 表示房间初始化完成的事件类型。
 const RoomInitializingFinished events.EventType = "RoomInitializingFinished"
@@ -46,6 +46,7 @@ func NewListener(ctx context.Context, live live.Live) Listener {
 		ed:     inst.EventDispatcher.(events.Dispatcher),
 		logger: inst.Logger,
 		state:  begin,
+		inst:   inst,
 	}
 }
 
@@ -57,6 +58,7 @@ type listener struct {
 	config *configs.Config
 	ed     events.Dispatcher
 	logger *interfaces.Logger
+	inst   *instance.Instance
 
 	state uint32
 	stop  chan struct{}
@@ -97,8 +99,31 @@ func (l *listener) Close() {
 	close(l.stop)
 }
 
+// isLiving 根据直播间状态和配置判断是否视为开播。
+func (l *listener) isLiving(state live.LiveState) bool {
+	switch state {
+	case live.StateLive:
+		return true
+	case live.StateReplay:
+		return l.config.LiveStates.RecordReplay
+	default:
+		return false
+	}
+}
+
+// isOutage 返回监听器管理器是否处于断网状态。
+func (l *listener) isOutage() bool {
+	lm, ok := l.inst.ListenerManager.(Manager)
+	return ok && lm.IsOutage()
+}
+
 // refresh 刷新监听器状态。
 func (l *listener) refresh() {
+	// 0. 断网期间冻结状态变化，避免网络恢复后出现大量的开播、下播事件。
+	if l.isOutage() {
+		return
+	}
+
 	// 1. 获取直播信息和可能的错误。
 	info, err := l.Live.GetInfo()
 	if err != nil {
@@ -111,7 +136,8 @@ func (l *listener) refresh() {
 
 	// 2. 创建最新状态 latestStatus。
 	var (
-		latestStatus = status{roomName: info.RoomName, roomStatus: info.Status}
+		state        = info.GetState()
+		latestStatus = status{roomName: info.RoomName, category: info.Category, roomStatus: l.isLiving(state), liveState: state}
 		evtTyp       events.EventType
 		logInfo      string
 		fields       = map[string]interface{}{
@@ -120,10 +146,28 @@ func (l *listener) refresh() {
 		}
 	)
 
-	// 3. 使用延迟函数来设置监听器状态为 latestStatus。
+	// 3. 直播间状态发生变化时分发 LiveStateChanged 事件。
+	if l.status.liveState != state {
+		l.ed.DispatchEvent(events.NewEvent(LiveStateChanged, &LiveStateChange{Live: l.Live, From: l.status.liveState, To: state}))
+		l.logger.WithFields(fields).Infof("Live state changed: %s -> %s", l.status.liveState, state)
+	}
+
+	// 4. 使用延迟函数来设置监听器状态为 latestStatus。
 	defer func() { l.status = latestStatus }()
 
-	// 4. 检查是否状态发生了变化，判断是否需要分发事件。
+	// 5. 房间名称或分区变化时，以章节模式录制的直播间只通知录制器记录章节。
+	var strategies configs.VideoSplitStrategies
+	if l.status.roomStatus && latestStatus.roomStatus &&
+		(l.status.roomName != latestStatus.roomName || l.status.category != latestStatus.category) {
+		strategies = l.config.EffectiveConfig(l.Live.GetRawUrl()).VideoSplitStrategies
+		if strategies.ChapterOnChanged {
+			l.ed.DispatchEvent(events.NewEvent(RoomInfoChanged, l.Live))
+			l.logger.WithFields(fields).Info("Room info was changed")
+			return
+		}
+	}
+
+	// 6. 检查是否状态发生了变化，判断是否需要分发事件。
 	isStatusChanged := true
 	switch l.status.Diff(latestStatus) {
 	case 0:
@@ -136,20 +180,20 @@ func (l *listener) refresh() {
 		evtTyp = LiveEnd
 		logInfo = "Live end"
 	case roomNameChangedEvt:
-		if !l.config.VideoSplitStrategies.OnRoomNameChanged {
+		if !strategies.OnRoomNameChanged {
 			return
 		}
 		evtTyp = RoomNameChanged
 		logInfo = "Room name was changed"
 	}
 
-	// 5. 如果状态发生了变化，分发相应的事件，并记录日志。
+	// 7. 如果状态发生了变化，分发相应的事件，并记录日志。
 	if isStatusChanged {
 		l.ed.DispatchEvent(events.NewEvent(evtTyp, l.Live))
 		l.logger.WithFields(fields).Info(logInfo)
 	}
 
-	// 6. 检查是否直播正在初始化中。
+	// 8. 检查是否直播正在初始化中。
 	if info.Initializing {
 		initializingLive := l.Live.(*live.WrappedLive).Live.(*system.InitializingLive)
 		info, err = initializingLive.OriginalLive.GetInfo()
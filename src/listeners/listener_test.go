@@ -42,22 +42,72 @@ func TestRefresh(t *testing.T) {
 	// false -> true
 	live.EXPECT().GetInfo().Return(&livepkg.Info{Status: true}, nil)
 	live.EXPECT().SetLastStartTime(gomock.Any())
+	ed.EXPECT().DispatchEvent(events.NewEvent(LiveStateChanged, &LiveStateChange{Live: live, From: livepkg.StateOffline, To: livepkg.StateLive}))
 	ed.EXPECT().DispatchEvent(events.NewEvent(LiveStart, live))
 	l.refresh()
 	assert.True(t, l.status.roomStatus)
 
 	// true -> true, roomName change
 	live.EXPECT().GetInfo().Return(&livepkg.Info{Status: true, RoomName: "a"}, nil)
+	live.EXPECT().GetRawUrl().Return("")
 	l.refresh()
 
 	// true -> true, roomName change
 	cfg.VideoSplitStrategies.OnRoomNameChanged = true
 	live.EXPECT().GetInfo().Return(&livepkg.Info{Status: true, RoomName: "b"}, nil)
+	live.EXPECT().GetRawUrl().Return("")
 	ed.EXPECT().DispatchEvent(events.NewEvent(RoomNameChanged, live))
 	l.refresh()
 
+	// true -> true, category change with chapters
+	cfg.VideoSplitStrategies.OnRoomNameChanged = false
+	cfg.VideoSplitStrategies.ChapterOnChanged = true
+	live.EXPECT().GetInfo().Return(&livepkg.Info{Status: true, RoomName: "b", Category: "c"}, nil)
+	live.EXPECT().GetRawUrl().Return("")
+	ed.EXPECT().DispatchEvent(events.NewEvent(RoomInfoChanged, live))
+	l.refresh()
+	assert.Equal(t, "c", l.status.category)
+
 	// true -> false
 	live.EXPECT().GetInfo().Return(&livepkg.Info{Status: false}, nil)
+	ed.EXPECT().DispatchEvent(events.NewEvent(LiveStateChanged, &LiveStateChange{Live: live, From: livepkg.StateLive, To: livepkg.StateOffline}))
+	ed.EXPECT().DispatchEvent(events.NewEvent(LiveEnd, live))
+	l.refresh()
+	assert.False(t, l.status.roomStatus)
+}
+
+func TestRefreshWithLiveState(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ed := evtmock.NewMockDispatcher(ctrl)
+	cfg := configs.NewConfig()
+	ctx := context.WithValue(context.Background(), instance.Key, &instance.Instance{
+		EventDispatcher: ed,
+		Config:          cfg,
+	})
+	log.New(ctx)
+	live := livemock.NewMockLive(ctrl)
+	l := NewListener(ctx, live).(*listener)
+
+	// offline -> replay，默认不视为开播
+	live.EXPECT().GetInfo().Return(&livepkg.Info{State: livepkg.StateReplay}, nil)
+	ed.EXPECT().DispatchEvent(events.NewEvent(LiveStateChanged, &LiveStateChange{Live: live, From: livepkg.StateOffline, To: livepkg.StateReplay}))
+	l.refresh()
+	assert.False(t, l.status.roomStatus)
+	assert.Equal(t, livepkg.StateReplay, l.status.liveState)
+
+	// replay -> replay，开启轮播录制后视为开播
+	cfg.LiveStates.RecordReplay = true
+	live.EXPECT().GetInfo().Return(&livepkg.Info{State: livepkg.StateReplay}, nil)
+	live.EXPECT().SetLastStartTime(gomock.Any())
+	ed.EXPECT().DispatchEvent(events.NewEvent(LiveStart, live))
+	l.refresh()
+	assert.True(t, l.status.roomStatus)
+
+	// replay -> banned
+	live.EXPECT().GetInfo().Return(&livepkg.Info{State: livepkg.StateBanned}, nil)
+	ed.EXPECT().DispatchEvent(events.NewEvent(LiveStateChanged, &LiveStateChange{Live: live, From: livepkg.StateReplay, To: livepkg.StateBanned}))
 	ed.EXPECT().DispatchEvent(events.NewEvent(LiveEnd, live))
 	l.refresh()
 	assert.False(t, l.status.roomStatus)
@@ -105,3 +155,33 @@ func TestListenerStartAndClose(t *testing.T) {
 	l.Close()
 	l.Close()
 }
+
+func TestRefreshDuringOutage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ed := evtmock.NewMockDispatcher(ctrl)
+	lm := NewMockManager(ctrl)
+	ctx := context.WithValue(context.Background(), instance.Key, &instance.Instance{
+		EventDispatcher: ed,
+		ListenerManager: lm,
+		Config:          configs.NewConfig(),
+	})
+	log.New(ctx)
+	live := livemock.NewMockLive(ctrl)
+	l := NewListener(ctx, live).(*listener)
+	l.status = status{roomStatus: true, liveState: livepkg.StateLive}
+
+	// 断网期间不获取直播信息，也不分发事件
+	lm.EXPECT().IsOutage().Return(true)
+	l.refresh()
+	assert.True(t, l.status.roomStatus)
+
+	// 网络恢复后正常刷新
+	lm.EXPECT().IsOutage().Return(false)
+	live.EXPECT().GetInfo().Return(&livepkg.Info{Status: false}, nil)
+	ed.EXPECT().DispatchEvent(events.NewEvent(LiveStateChanged, &LiveStateChange{Live: live, From: livepkg.StateLive, To: livepkg.StateOffline}))
+	ed.EXPECT().DispatchEvent(events.NewEvent(LiveEnd, live))
+	l.refresh()
+	assert.False(t, l.status.roomStatus)
+}
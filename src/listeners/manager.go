@@ -4,10 +4,12 @@ package listeners
 import (
 	"context"
 	"sync"
+	"sync/atomic"
 
 	"github.com/yuhaohwang/bililive-go/src/instance"
 	"github.com/yuhaohwang/bililive-go/src/interfaces"
 	"github.com/yuhaohwang/bililive-go/src/live"
+	"github.com/yuhaohwang/bililive-go/src/network"
 	"github.com/yuhaohwang/bililive-go/src/pkg/events"
 )
 
@@ -35,15 +37,17 @@ type Manager interface {
 	RemoveListener(ctx context.Context, liveId live.ID) error
 	GetListener(ctx context.Context, liveId live.ID) (Listener, error)
 	HasListener(ctx context.Context, liveId live.ID) bool
+	IsOutage() bool
 }
 
 // manager 实现了监听器管理器的接口。
 type manager struct {
 	lock      sync.RWMutex
 	listeners map[live.ID]Listener
+	outage    uint32
 }
 
-// registryListener 注册监听器，用于监听直播房间初始化完成事件。
+// registryListener 注册监听器，用于监听直播房间初始化完成事件和网络状态事件。
 func (m *manager) registryListener(ctx context.Context, ed events.Dispatcher) {
 	// 1. 添加一个事件监听器，监听 "RoomInitializingFinished" 事件。
 	ed.AddEventListener(RoomInitializingFinished, events.NewEventListener(func(event *events.Event) {
@@ -88,6 +92,14 @@ func (m *manager) registryListener(ctx context.Context, ed events.Dispatcher) {
 			}
 		}
 	}))
+
+	// 11. 断网时冻结所有监听器的状态变化，网络恢复后解除。
+	ed.AddEventListener(network.NetworkDown, events.NewEventListener(func(event *events.Event) {
+		atomic.StoreUint32(&m.outage, 1)
+	}))
+	ed.AddEventListener(network.NetworkUp, events.NewEventListener(func(event *events.Event) {
+		atomic.StoreUint32(&m.outage, 0)
+	}))
 }
 
 // Start 启动监听器管理器。
@@ -222,3 +234,8 @@ func (m *manager) HasListener(ctx context.Context, liveId live.ID) bool {
 	_, ok := m.listeners[liveId]
 	return ok
 }
+
+// IsOutage 返回当前是否处于断网状态。
+func (m *manager) IsOutage() bool {
+	return atomic.LoadUint32(&m.outage) == 1
+}
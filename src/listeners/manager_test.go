@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
@@ -12,6 +13,8 @@ import (
 	"github.com/yuhaohwang/bililive-go/src/instance"
 	"github.com/yuhaohwang/bililive-go/src/live"
 	livemock "github.com/yuhaohwang/bililive-go/src/live/mock"
+	"github.com/yuhaohwang/bililive-go/src/network"
+	"github.com/yuhaohwang/bililive-go/src/pkg/events"
 	evtmock "github.com/yuhaohwang/bililive-go/src/pkg/events/mock"
 )
 
@@ -49,6 +52,8 @@ func TestManagerStartAndClose(t *testing.T) {
 	defer ctrl.Finish()
 	ed := evtmock.NewMockDispatcher(ctrl)
 	ed.EXPECT().AddEventListener(RoomInitializingFinished, gomock.Any())
+	ed.EXPECT().AddEventListener(network.NetworkDown, gomock.Any())
+	ed.EXPECT().AddEventListener(network.NetworkUp, gomock.Any())
 	ctx := context.WithValue(context.Background(), instance.Key, &instance.Instance{
 		EventDispatcher: ed,
 		Config: &configs.Config{
@@ -73,3 +78,20 @@ func TestManagerStartAndClose(t *testing.T) {
 	}
 	m.Close(ctx)
 }
+
+func TestManagerOutage(t *testing.T) {
+	ed := events.NewDispatcher(context.Background())
+	ctx := context.WithValue(context.Background(), instance.Key, &instance.Instance{
+		EventDispatcher: ed,
+		Config:          configs.NewConfig(),
+	})
+	m := NewManager(ctx)
+	assert.NoError(t, m.Start(ctx))
+	assert.False(t, m.IsOutage())
+
+	ed.DispatchEvent(events.NewEvent(network.NetworkDown, nil))
+	assert.Eventually(t, m.IsOutage, time.Second, 10*time.Millisecond)
+
+	ed.DispatchEvent(events.NewEvent(network.NetworkUp, nil))
+	assert.Eventually(t, func() bool { return !m.IsOutage() }, time.Second, 10*time.Millisecond)
+}
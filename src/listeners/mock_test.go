@@ -139,6 +139,20 @@ func (mr *MockManagerMockRecorder) HasListener(arg0, arg1 interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "HasListener", reflect.TypeOf((*MockManager)(nil).HasListener), arg0, arg1)
 }
 
+// IsOutage mocks base method.
+func (m *MockManager) IsOutage() bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsOutage")
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// IsOutage indicates an expected call of IsOutage.
+func (mr *MockManagerMockRecorder) IsOutage() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsOutage", reflect.TypeOf((*MockManager)(nil).IsOutage))
+}
+
 // RemoveListener mocks base method.
 func (m *MockManager) RemoveListener(arg0 context.Context, arg1 live.ID) error {
 	m.ctrl.T.Helper()
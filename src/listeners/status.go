@@ -1,5 +1,9 @@
 package listeners
 
+import (
+	"github.com/yuhaohwang/bililive-go/src/live"
+)
+
 type statusEvt uint8
 
 const (
@@ -10,8 +14,10 @@ const (
 
 // status 表示监听器的状态，包括房间名称和房间状态。
 type status struct {
-	roomName   string // 房间名称
-	roomStatus bool   // 房间状态
+	roomName   string         // 房间名称
+	category   string         // 直播分区
+	roomStatus bool           // 房间状态
+	liveState  live.LiveState // 直播间状态
 }
 
 // Diff 比较两个状态之间的差异并返回相应的事件标志。
@@ -18,7 +18,10 @@ import (
 const (
 	domain = "live.bilibili.com"
 	cnName = "哔哩哔哩"
+)
 
+// 接口地址，测试时可以替换为本地服务器
+var (
 	roomInitUrl  = "https://api.live.bilibili.com/room/v1/Room/room_init"
 	roomApiUrl   = "https://api.live.bilibili.com/room/v1/Room/get_info"
 	userApiUrl   = "https://api.live.bilibili.com/live_user/v1/UserInfo/get_anchor_in_room"
@@ -42,10 +45,12 @@ func (b *builder) Build(url *url.URL, opt ...live.Option) (live.Live, error) {
 // Live 结构体，表示 Bilibili 直播源
 type Live struct {
 	internal.BaseLive
-	realID string
+	realID    string
+	locked    bool // 直播间被封禁
+	encrypted bool // 直播间加密且未验证密码
 }
 
-// parseRealId 从 URL 解析出真实房间ID
+// parseRealId 从 URL 解析出真实房间ID，同时更新直播间的封禁和加密状态
 func (l *Live) parseRealId() error {
 	paths := strings.Split(l.Url.Path, "/")
 	if len(paths) < 2 {
@@ -68,16 +73,16 @@ func (l *Live) parseRealId() error {
 		return live.ErrRoomNotExist
 	}
 	l.realID = gjson.GetBytes(body, "data.room_id").String()
+	l.locked = gjson.GetBytes(body, "data.is_locked").Bool()
+	l.encrypted = gjson.GetBytes(body, "data.encrypted").Bool() && !gjson.GetBytes(body, "data.pwd_verified").Bool()
 	return nil
 }
 
 // GetInfo 获取直播房间信息
 func (l *Live) GetInfo() (info *live.Info, err error) {
-	// 从 URL 解析出真实房间ID
-	if l.realID == "" {
-		if err := l.parseRealId(); err != nil {
-			return nil, err
-		}
+	// 从 URL 解析出真实房间ID，封禁和加密状态可能随时变化，每次都重新获取
+	if err := l.parseRealId(); err != nil {
+		return nil, err
 	}
 	cookies := l.Options.Cookies.Cookies(l.Url)
 	cookieKVs := make(map[string]string)
@@ -105,10 +110,25 @@ func (l *Live) GetInfo() (info *live.Info, err error) {
 		return nil, live.ErrRoomNotExist
 	}
 
+	// live_status: 0 未开播，1 直播中，2 轮播
+	state := live.StateOffline
+	switch {
+	case l.locked:
+		state = live.StateBanned
+	case l.encrypted:
+		state = live.StateLocked
+	case gjson.GetBytes(body, "data.live_status").Int() == 1:
+		state = live.StateLive
+	case gjson.GetBytes(body, "data.live_status").Int() == 2:
+		state = live.StateReplay
+	}
+
 	info = &live.Info{
 		Live:     l,
 		RoomName: gjson.GetBytes(body, "data.title").String(),
-		Status:   gjson.GetBytes(body, "data.live_status").Int() == 1,
+		Category: gjson.GetBytes(body, "data.area_name").String(),
+		Status:   state == live.StateLive,
+		State:    state,
 	}
 
 	resp, err = requests.Get(userApiUrl, live.CommonUserAgent, requests.Query("roomid", l.realID))
@@ -0,0 +1,55 @@
+package bilibili
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yuhaohwang/bililive-go/src/live"
+)
+
+func TestGetInfoRefreshesRoomFlags(t *testing.T) {
+	var locked, encrypted bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/room_init":
+			fmt.Fprintf(w, `{"code":0,"data":{"room_id":1030,"is_locked":%t,"encrypted":%t,"pwd_verified":false}}`, locked, encrypted)
+		case "/get_info":
+			fmt.Fprint(w, `{"code":0,"data":{"live_status":1,"title":"title","area_name":"area"}}`)
+		case "/get_anchor_in_room":
+			fmt.Fprint(w, `{"code":0,"data":{"info":{"uname":"host"}}}`)
+		}
+	}))
+	defer server.Close()
+	defer func(a, b, c string) { roomInitUrl, roomApiUrl, userApiUrl = a, b, c }(roomInitUrl, roomApiUrl, userApiUrl)
+	roomInitUrl, roomApiUrl, userApiUrl = server.URL+"/room_init", server.URL+"/get_info", server.URL+"/get_anchor_in_room"
+
+	u, _ := url.Parse("https://live.bilibili.com/1030")
+	l, err := new(builder).Build(u)
+	assert.NoError(t, err)
+
+	// 直播间被封禁后，再次获取信息时更新状态
+	info, err := l.GetInfo()
+	assert.NoError(t, err)
+	assert.Equal(t, live.StateLive, info.State)
+	locked = true
+	info, err = l.GetInfo()
+	assert.NoError(t, err)
+	assert.Equal(t, live.StateBanned, info.State)
+	assert.False(t, info.Status)
+
+	// 解除封禁后加密，再恢复正常
+	locked, encrypted = false, true
+	info, err = l.GetInfo()
+	assert.NoError(t, err)
+	assert.Equal(t, live.StateLocked, info.State)
+	encrypted = false
+	info, err = l.GetInfo()
+	assert.NoError(t, err)
+	assert.Equal(t, live.StateLive, info.State)
+	assert.True(t, info.Status)
+}
@@ -216,6 +216,7 @@ func (l *Live) GetInfo() (info *live.Info, err error) {
 				HostName: "您观看的房间已被关闭",
 				RoomName: "您观看的房间已被关闭",
 				Status:   false,
+				State:    live.StateBanned,
 			}, nil
 		} else {
 			return nil, err
@@ -241,11 +242,21 @@ func (l *Live) GetInfo() (info *live.Info, err error) {
 		print(body)
 	}
 
+	// show_status 为 1 表示开播，videoLoop 为 1 表示正在轮播录像
+	state := live.StateOffline
+	if gjson.GetBytes(body, "room.show_status").Int() == 1 {
+		state = live.StateLive
+		if gjson.GetBytes(body, "room.videoLoop").Int() == 1 {
+			state = live.StateReplay
+		}
+	}
+
 	info = &live.Info{
 		Live:         l,
 		HostName:     gjson.GetBytes(body, "room.owner_name").String(),
 		RoomName:     gjson.GetBytes(body, "room.room_name").String(),
-		Status:       gjson.GetBytes(body, "room.show_status").Int() == 1 && gjson.GetBytes(body, "room.videoLoop").Int() == 0,
+		Status:       state == live.StateLive,
+		State:        state,
 		CustomLiveId: "douyu/" + l.roomID,
 	}
 	return info, nil
@@ -69,6 +69,7 @@ func (l *Live) GetInfo() (info *live.Info, err error) {
 			HostName: "该主播涉嫌违规，正在整改中",
 			RoomName: "该主播涉嫌违规，正在整改中",
 			Status:   false,
+			State:    live.StateBanned,
 		}, nil
 	}
 
@@ -8,42 +8,50 @@ import (
 type Info struct {
 	Live                          Live
 	HostName, RoomName            string
+	Category                      string // 直播分区，不支持的平台为空
 	RtmpUrl                       string
-	Status                        bool // 表示是否正在直播，可能最好重命名为 IsLiving
+	Status                        bool      // 表示是否正在直播，可能最好重命名为 IsLiving
+	State                         LiveState // 直播间状态，未上报时根据 Status 推断
 	Listen, Record, Push          bool
 	Listening, Recording, Pushing bool
 	Initializing                  bool
 	CustomLiveId                  string
 	AudioOnly                     bool
+	RecorderStatus                interface{} // 录制器的状态，只在正在录制时有值，避免循环引用不使用具体类型
 }
 
 // MarshalJSON 方法用于将 Info 结构体序列化为 JSON 格式。
 func (i *Info) MarshalJSON() ([]byte, error) {
 	t := struct {
-		Id                ID     `json:"id"`                             // 直播唯一标识
-		LiveUrl           string `json:"live_url"`                       // 直播原始 URL
-		PlatformCNName    string `json:"platform_cn_name"`               // 平台中文名称
-		HostName          string `json:"host_name"`                      // 主播名
-		RoomName          string `json:"room_name"`                      // 房间名
-		Status            bool   `json:"status"`                         // 是否正在直播
-		Listening         bool   `json:"listening"`                      // 是否正在监听
-		Recording         bool   `json:"recording"`                      // 是否正在录制
-		Pushing           bool   `json:"pushing"`                        // 是否正在转推
-		Initializing      bool   `json:"initializing"`                   // 是否正在初始化
-		LastStartTime     string `json:"last_start_time,omitempty"`      // 上次开始时间的字符串表示形式
-		LastStartTimeUnix int64  `json:"last_start_time_unix,omitempty"` // 上次开始时间的 UNIX 时间戳
-		AudioOnly         bool   `json:"audio_only"`                     // 是否仅音频直播
-		RtmpUrl           string `json:"rtmp_url"`                       // 直播转推 URL
-		Listen            bool   `json:"listen"`                         // 是否开启直播监听
-		Record            bool   `json:"record"`                         // 是否开启直播录制
-		Push              bool   `json:"push"`                           // 是否开启直播转推
+		Id                ID          `json:"id"`                             // 直播唯一标识
+		LiveUrl           string      `json:"live_url"`                       // 直播原始 URL
+		PlatformCNName    string      `json:"platform_cn_name"`               // 平台中文名称
+		HostName          string      `json:"host_name"`                      // 主播名
+		RoomName          string      `json:"room_name"`                      // 房间名
+		Category          string      `json:"category,omitempty"`             // 直播分区
+		Status            bool        `json:"status"`                         // 是否正在直播
+		State             LiveState   `json:"state"`                          // 直播间状态
+		Listening         bool        `json:"listening"`                      // 是否正在监听
+		Recording         bool        `json:"recording"`                      // 是否正在录制
+		Pushing           bool        `json:"pushing"`                        // 是否正在转推
+		Initializing      bool        `json:"initializing"`                   // 是否正在初始化
+		LastStartTime     string      `json:"last_start_time,omitempty"`      // 上次开始时间的字符串表示形式
+		LastStartTimeUnix int64       `json:"last_start_time_unix,omitempty"` // 上次开始时间的 UNIX 时间戳
+		AudioOnly         bool        `json:"audio_only"`                     // 是否仅音频直播
+		RtmpUrl           string      `json:"rtmp_url"`                       // 直播转推 URL
+		Listen            bool        `json:"listen"`                         // 是否开启直播监听
+		Record            bool        `json:"record"`                         // 是否开启直播录制
+		Push              bool        `json:"push"`                           // 是否开启直播转推
+		RecorderStatus    interface{} `json:"recorder_status,omitempty"`      // 录制器的状态
 	}{
 		Id:             i.Live.GetLiveId(),
 		LiveUrl:        i.Live.GetRawUrl(),
 		PlatformCNName: i.Live.GetPlatformCNName(),
 		HostName:       i.HostName,
 		RoomName:       i.RoomName,
+		Category:       i.Category,
 		Status:         i.Status,
+		State:          i.GetState(),
 		Listening:      i.Listening,
 		Recording:      i.Recording,
 		Pushing:        i.Pushing,
@@ -53,6 +61,7 @@ func (i *Info) MarshalJSON() ([]byte, error) {
 		Listen:         i.Listen,
 		Record:         i.Record,
 		Push:           i.Push,
+		RecorderStatus: i.RecorderStatus,
 	}
 	if !i.Live.GetLastStartTime().IsZero() {
 		t.LastStartTime = i.Live.GetLastStartTime().Format("2006-01-02 15:04:05")
@@ -60,3 +69,11 @@ func (i *Info) MarshalJSON() ([]byte, error) {
 	}
 	return json.Marshal(t)
 }
+
+// GetState 返回直播间状态，未上报状态的平台根据 Status 推断。
+func (i *Info) GetState() LiveState {
+	if i.State == StateOffline && i.Status {
+		return StateLive
+	}
+	return i.State
+}
@@ -0,0 +1,57 @@
+package live
+
+import (
+	"fmt"
+)
+
+// LiveState 表示直播间的状态。
+type LiveState uint8
+
+const (
+	StateOffline LiveState = iota // 未开播
+	StateLive                     // 直播中
+	StateReplay                   // 轮播（录像回放）
+	StateBanned                   // 直播间被封禁或关闭
+	StateLocked                   // 直播间加锁（需要密码等）
+)
+
+var liveStateNames = map[LiveState]string{
+	StateOffline: "offline",
+	StateLive:    "live",
+	StateReplay:  "replay",
+	StateBanned:  "banned",
+	StateLocked:  "locked",
+}
+
+// String 返回直播状态的名称。
+func (s LiveState) String() string {
+	if name, ok := liveStateNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(s))
+}
+
+// MarshalText 将直播状态序列化为名称，用于 JSON 和 YAML。
+func (s LiveState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText 从名称解析直播状态。
+func (s *LiveState) UnmarshalText(text []byte) error {
+	state, err := ParseLiveState(string(text))
+	if err != nil {
+		return err
+	}
+	*s = state
+	return nil
+}
+
+// ParseLiveState 根据名称解析直播状态。
+func ParseLiveState(name string) (LiveState, error) {
+	for state, stateName := range liveStateNames {
+		if stateName == name {
+			return state, nil
+		}
+	}
+	return StateOffline, fmt.Errorf("未知的直播状态: %s", name)
+}
@@ -0,0 +1,25 @@
+package live
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLiveStateText(t *testing.T) {
+	b, err := json.Marshal(StateReplay)
+	assert.NoError(t, err)
+	assert.Equal(t, `"replay"`, string(b))
+
+	var state LiveState
+	assert.NoError(t, json.Unmarshal([]byte(`"banned"`), &state))
+	assert.Equal(t, StateBanned, state)
+	assert.Error(t, json.Unmarshal([]byte(`"foo"`), &state))
+}
+
+func TestInfoGetState(t *testing.T) {
+	assert.Equal(t, StateOffline, (&Info{}).GetState())
+	assert.Equal(t, StateLive, (&Info{Status: true}).GetState())
+	assert.Equal(t, StateReplay, (&Info{State: StateReplay}).GetState())
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus"
 
+	"github.com/yuhaohwang/bililive-go/src/disk"
 	"github.com/yuhaohwang/bililive-go/src/instance"
 	"github.com/yuhaohwang/bililive-go/src/interfaces"
 	"github.com/yuhaohwang/bililive-go/src/listeners"
@@ -25,6 +26,13 @@ var (
 		[]string{"live_id", "live_url", "live_host_name", "live_room_name", "live_listening"},
 		nil,
 	)
+	liveState = prometheus.NewDesc(
+		// 定义 liveState 指标的描述符，值为直播间状态的枚举值，状态变化时不产生新的时间序列
+		prometheus.BuildFQName("bgo", "live", "state"),
+		"live state (0: offline, 1: live, 2: replay, 3: banned, 4: locked)",
+		[]string{"live_id", "live_url", "live_host_name", "live_room_name"},
+		nil,
+	)
 	liveDurationSeconds = prometheus.NewDesc(
 		// 定义 liveDurationSeconds 指标的描述符
 		prometheus.BuildFQName("bgo", "live", "duration_seconds"),
@@ -35,10 +43,66 @@ var (
 	recorderTotalBytes = prometheus.NewDesc(
 		// 定义 recorderTotalBytes 指标的描述符
 		prometheus.BuildFQName("bgo", "recorder", "total_bytes"),
-		"recorder total bytes",
+		"recorder bytes written to the current file",
 		[]string{"live_id", "live_url", "live_host_name", "live_room_name"},
 		nil,
 	)
+	recorderBitrateKbps = prometheus.NewDesc(
+		// 定义 recorderBitrateKbps 指标的描述符
+		prometheus.BuildFQName("bgo", "recorder", "bitrate_kbps"),
+		"recorder bitrate in kbit/s",
+		[]string{"live_id", "live_url", "live_host_name", "live_room_name", "parser"},
+		nil,
+	)
+	recorderFPS = prometheus.NewDesc(
+		// 定义 recorderFPS 指标的描述符
+		prometheus.BuildFQName("bgo", "recorder", "fps"),
+		"recorder video frames per second",
+		[]string{"live_id", "live_url", "live_host_name", "live_room_name", "parser"},
+		nil,
+	)
+	recorderRunning = prometheus.NewDesc(
+		// 定义 recorderRunning 指标的描述符
+		prometheus.BuildFQName("bgo", "recorder", "running"),
+		"number of running recorders",
+		nil,
+		nil,
+	)
+	recorderMaxRecordings = prometheus.NewDesc(
+		// 定义 recorderMaxRecordings 指标的描述符
+		prometheus.BuildFQName("bgo", "recorder", "max_recordings"),
+		"max number of simultaneous recordings (0: unlimited)",
+		nil,
+		nil,
+	)
+	recorderQueuedSeconds = prometheus.NewDesc(
+		// 定义 recorderQueuedSeconds 指标的描述符，值为直播间已等待录制的时间
+		prometheus.BuildFQName("bgo", "recorder", "queued_seconds"),
+		"seconds the live has been waiting for a recording slot",
+		[]string{"live_id", "live_url", "priority", "preempted"},
+		nil,
+	)
+	diskFreeBytes = prometheus.NewDesc(
+		// 定义 diskFreeBytes 指标的描述符
+		prometheus.BuildFQName("bgo", "disk", "free_bytes"),
+		"free bytes of the disk where the output path is located",
+		[]string{"path"},
+		nil,
+	)
+	diskTotalBytes = prometheus.NewDesc(
+		// 定义 diskTotalBytes 指标的描述符
+		prometheus.BuildFQName("bgo", "disk", "total_bytes"),
+		"total bytes of the disk where the output path is located",
+		[]string{"path"},
+		nil,
+	)
+	diskLevel = prometheus.NewDesc(
+		// 定义 diskLevel 指标的描述符，值为剩余空间告警级别的枚举值，级别变化时不产生新的时间序列
+		prometheus.BuildFQName("bgo", "disk", "level"),
+		"free space level of the disk where the output path is located (0: ok, 1: warn, 2: critical, 3: stop)",
+		[]string{"path"},
+		nil,
+	)
 )
 
 // collector 结构表示 Prometheus 指标收集器
@@ -78,6 +142,10 @@ func (c collector) Collect(ch chan<- prometheus.Metric) {
 				liveStatus, prometheus.GaugeValue, bool2float64(info.Status),
 				string(id), l.GetRawUrl(), info.HostName, info.RoomName, fmt.Sprintf("%v", listening),
 			)
+			ch <- prometheus.MustNewConstMetric(
+				liveState, prometheus.GaugeValue, float64(info.GetState()),
+				string(id), l.GetRawUrl(), info.HostName, info.RoomName,
+			)
 
 			if info.Status && listening {
 				startTime := info.Live.GetLastStartTime()
@@ -89,24 +157,57 @@ func (c collector) Collect(ch chan<- prometheus.Metric) {
 				)
 
 				if r, err := c.inst.RecorderManager.(recorders.Manager).GetRecorder(context.Background(), id); err == nil {
-					if status, err := r.GetStatus(); err == nil {
-						if value, err := strconv.ParseFloat(status["total_size"], 64); err == nil {
-							ch <- prometheus.MustNewConstMetric(recorderTotalBytes, prometheus.CounterValue, value,
-								string(id), l.GetRawUrl(), info.HostName, info.RoomName)
-						}
+					if status := r.GetStatus(); status.Recording {
+						ch <- prometheus.MustNewConstMetric(recorderTotalBytes, prometheus.CounterValue, float64(status.Bytes),
+							string(id), l.GetRawUrl(), info.HostName, info.RoomName)
+						ch <- prometheus.MustNewConstMetric(recorderBitrateKbps, prometheus.GaugeValue, status.BitrateKbps,
+							string(id), l.GetRawUrl(), info.HostName, info.RoomName, status.Parser)
+						ch <- prometheus.MustNewConstMetric(recorderFPS, prometheus.GaugeValue, status.FPS,
+							string(id), l.GetRawUrl(), info.HostName, info.RoomName, status.Parser)
 					}
 				}
 			}
 		}(id, l)
 	}
 	wg.Wait()
+
+	if rm, ok := c.inst.RecorderManager.(recorders.Manager); ok {
+		queue := rm.GetQueueStatus(context.Background())
+		ch <- prometheus.MustNewConstMetric(recorderRunning, prometheus.GaugeValue, float64(queue.Running))
+		ch <- prometheus.MustNewConstMetric(recorderMaxRecordings, prometheus.GaugeValue, float64(queue.MaxRecordings))
+		for _, item := range queue.Waiting {
+			ch <- prometheus.MustNewConstMetric(recorderQueuedSeconds, prometheus.GaugeValue, time.Since(item.QueuedAt).Seconds(),
+				string(item.LiveId), item.LiveUrl, strconv.Itoa(item.Priority), strconv.FormatBool(item.Preempted))
+		}
+	}
+
+	if dm, ok := c.inst.DiskMonitor.(disk.Monitor); ok {
+		statuses, _ := dm.Statuses()
+		for _, status := range statuses {
+			ch <- prometheus.MustNewConstMetric(diskFreeBytes, prometheus.GaugeValue, float64(status.FreeBytes),
+				status.Path)
+			ch <- prometheus.MustNewConstMetric(diskTotalBytes, prometheus.GaugeValue, float64(status.TotalBytes),
+				status.Path)
+			ch <- prometheus.MustNewConstMetric(diskLevel, prometheus.GaugeValue, float64(status.Level),
+				status.Path)
+		}
+	}
 }
 
 // Describe 描述 Prometheus 指标
 func (collector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- liveStatus
+	ch <- liveState
 	ch <- liveDurationSeconds
 	ch <- recorderTotalBytes
+	ch <- recorderBitrateKbps
+	ch <- recorderFPS
+	ch <- recorderRunning
+	ch <- recorderMaxRecordings
+	ch <- recorderQueuedSeconds
+	ch <- diskFreeBytes
+	ch <- diskTotalBytes
+	ch <- diskLevel
 }
 
 // Start 启动收集器
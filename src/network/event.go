@@ -0,0 +1,11 @@
+package network
+
+import (
+	"github.com/yuhaohwang/bililive-go/src/pkg/events"
+)
+
+// NetworkDown 表示检测到网络中断的事件类型。
+const NetworkDown events.EventType = "NetworkDown"
+
+// NetworkUp 表示网络恢复的事件类型。
+const NetworkUp events.EventType = "NetworkUp"
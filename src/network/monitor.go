@@ -0,0 +1,170 @@
+// Package network 包含网络连通性检测相关的代码。
+package network
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yuhaohwang/bililive-go/src/configs"
+	"github.com/yuhaohwang/bililive-go/src/instance"
+	"github.com/yuhaohwang/bililive-go/src/interfaces"
+	"github.com/yuhaohwang/bililive-go/src/pkg/events"
+)
+
+// 定义状态常量用于标记检测器的状态。
+const (
+	begin uint32 = iota
+	pending
+	running
+	stopped
+)
+
+// Monitor 定义了网络检测器的接口，它实现了 interfaces.Module 接口。
+type Monitor interface {
+	interfaces.Module
+	IsDown() bool
+}
+
+// for test
+var probe = probeEndpoint
+
+// NewMonitor 创建一个新的网络检测器。
+func NewMonitor(ctx context.Context) Monitor {
+	// 1. 获取应用程序实例 inst。
+	inst := instance.GetInstance(ctx)
+
+	// 2. 创建网络检测器实例，并注册到应用程序实例中。
+	m := &monitor{
+		config: inst.Config,
+		logger: inst.Logger,
+		state:  begin,
+		stop:   make(chan struct{}),
+	}
+	inst.NetworkMonitor = m
+	return m
+}
+
+// monitor 实现了 Monitor 接口。
+type monitor struct {
+	config *configs.Config
+	ed     events.Dispatcher
+	logger *interfaces.Logger
+
+	down     uint32
+	failures int
+
+	state uint32
+	stop  chan struct{}
+}
+
+// Start 启动网络检测器。
+func (m *monitor) Start(ctx context.Context) error {
+	// 1. 未启用网络检测时直接返回。
+	if !m.config.NetworkMonitor.Enable || len(m.config.NetworkMonitor.Endpoints) == 0 {
+		return nil
+	}
+
+	// 2. 使用原子操作检查并设置检测器的状态为 running。
+	if !atomic.CompareAndSwapUint32(&m.state, begin, running) {
+		return nil
+	}
+	m.ed = instance.GetInstance(ctx).EventDispatcher.(events.Dispatcher)
+
+	// 3. 启动检测器的主循环。
+	go m.run()
+	return nil
+}
+
+// Close 关闭网络检测器。
+func (m *monitor) Close(ctx context.Context) {
+	if !atomic.CompareAndSwapUint32(&m.state, running, stopped) {
+		return
+	}
+	close(m.stop)
+}
+
+// IsDown 返回当前是否处于断网状态。
+func (m *monitor) IsDown() bool {
+	return atomic.LoadUint32(&m.down) == 1
+}
+
+// run 启动检测器的主循环。
+func (m *monitor) run() {
+	ticker := time.NewTicker(m.config.NetworkMonitor.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			m.check()
+		}
+	}
+}
+
+// check 探测所有地址，并根据结果切换网络状态。
+func (m *monitor) check() {
+	cfg := m.config.NetworkMonitor
+
+	// 1. 只要有一个地址可以连通就认为网络正常。
+	if probeAll(cfg.Endpoints, cfg.Timeout) {
+		m.failures = 0
+		if atomic.CompareAndSwapUint32(&m.down, 1, 0) {
+			m.logger.Info("Network is up")
+			m.ed.DispatchEvent(events.NewEvent(NetworkUp, nil))
+		}
+		return
+	}
+
+	// 2. 连续失败次数达到阈值时进入断网状态。
+	m.failures++
+	if m.failures < cfg.FailureThreshold {
+		return
+	}
+	if atomic.CompareAndSwapUint32(&m.down, 0, 1) {
+		m.logger.WithField("endpoints", cfg.Endpoints).Warn("Network is down")
+		m.ed.DispatchEvent(events.NewEvent(NetworkDown, nil))
+	}
+}
+
+// probeAll 并发探测所有地址，任意一个成功即返回 true。
+func probeAll(endpoints []string, timeout time.Duration) bool {
+	var (
+		wg sync.WaitGroup
+		ok uint32
+	)
+	for _, endpoint := range endpoints {
+		wg.Add(1)
+		go func(endpoint string) {
+			defer wg.Done()
+			if probe(endpoint, timeout) == nil {
+				atomic.StoreUint32(&ok, 1)
+			}
+		}(endpoint)
+	}
+	wg.Wait()
+	return ok == 1
+}
+
+// probeEndpoint 探测单个地址，URL 使用 HTTP 请求，其余按 host:port 建立 TCP 连接。
+func probeEndpoint(endpoint string, timeout time.Duration) error {
+	if !strings.Contains(endpoint, "://") {
+		conn, err := net.DialTimeout("tcp", endpoint, timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Head(endpoint)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
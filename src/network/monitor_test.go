@@ -0,0 +1,77 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yuhaohwang/bililive-go/src/configs"
+	"github.com/yuhaohwang/bililive-go/src/instance"
+	"github.com/yuhaohwang/bililive-go/src/log"
+	"github.com/yuhaohwang/bililive-go/src/pkg/events"
+	evtmock "github.com/yuhaohwang/bililive-go/src/pkg/events/mock"
+)
+
+func TestProbeEndpoint(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	assert.NoError(t, probeEndpoint(server.URL, time.Second))
+	assert.NoError(t, probeEndpoint(server.Listener.Addr().String(), time.Second))
+	assert.Error(t, probeEndpoint("127.0.0.1:1", time.Second))
+}
+
+func TestMonitorCheck(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ed := evtmock.NewMockDispatcher(ctrl)
+	cfg := configs.NewConfig()
+	cfg.NetworkMonitor.Endpoints = []string{"a", "b"}
+	cfg.NetworkMonitor.FailureThreshold = 2
+	cfg.OutPutPath = t.TempDir()
+	cfg.Log.OutPutFolder = t.TempDir()
+	ctx := context.WithValue(context.Background(), instance.Key, &instance.Instance{
+		EventDispatcher: ed,
+		Config:          cfg,
+	})
+	log.New(ctx)
+	m := NewMonitor(ctx).(*monitor)
+	m.ed = ed
+
+	backup := probe
+	defer func() { probe = backup }()
+	failed := map[string]bool{}
+	probe = func(endpoint string, timeout time.Duration) error {
+		if failed[endpoint] {
+			return errors.New("unreachable")
+		}
+		return nil
+	}
+
+	// 部分地址失败不视为断网
+	failed["a"] = true
+	m.check()
+	assert.False(t, m.IsDown())
+
+	// 连续失败次数达到阈值后进入断网状态
+	failed["b"] = true
+	m.check()
+	assert.False(t, m.IsDown())
+	ed.EXPECT().DispatchEvent(events.NewEvent(NetworkDown, nil))
+	m.check()
+	assert.True(t, m.IsDown())
+	m.check()
+
+	// 网络恢复
+	failed["a"] = false
+	ed.EXPECT().DispatchEvent(events.NewEvent(NetworkUp, nil))
+	m.check()
+	assert.False(t, m.IsDown())
+}
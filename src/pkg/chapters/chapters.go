@@ -0,0 +1,96 @@
+// Package chapters 读写录制文件附属的章节文件，并生成 FFmpeg 的元数据文件，用于在转封装时写入章节。
+package chapters
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Ext 是录制文件附属的章节文件的扩展名。
+const Ext = ".chapters.json"
+
+// 章节的类型。
+const (
+	KindTitle    = "title"    // 房间标题变化
+	KindCategory = "category" // 直播分区变化
+	KindMarker   = "marker"   // 手动添加的标记
+)
+
+// Chapter 是录制文件中的一个章节，从 StartMs 开始到下一个章节开始为止。
+type Chapter struct {
+	StartMs int64     `json:"start_ms"` // 章节开始的位置相对于文件开头的毫秒数
+	Kind    string    `json:"kind"`     // 章节的类型
+	Title   string    `json:"title"`    // 章节标题
+	Time    time.Time `json:"time"`     // 章节开始的时间
+}
+
+// file 是章节文件的内容。
+type file struct {
+	Chapters []Chapter `json:"chapters"`
+}
+
+// PathOf 返回录制文件对应的章节文件路径。
+func PathOf(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name)) + Ext
+}
+
+// Read 读取章节文件。
+func Read(path string) ([]Chapter, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f file
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, err
+	}
+	return f.Chapters, nil
+}
+
+// Write 写入章节文件，先写入临时文件再替换原文件。
+func Write(path string, chapters []Chapter) error {
+	b, err := json.MarshalIndent(file{Chapters: chapters}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// FFMetadata 生成 FFmpeg 的元数据文件内容，每个章节到下一个章节开始为止，最后一个章节到 durationMs 为止。
+func FFMetadata(chapters []Chapter, durationMs int64) string {
+	var b strings.Builder
+	b.WriteString(";FFMETADATA1\n")
+	for i, c := range chapters {
+		end := durationMs
+		if i+1 < len(chapters) {
+			end = chapters[i+1].StartMs
+		}
+		if end <= c.StartMs {
+			end = c.StartMs + 1
+		}
+		fmt.Fprintf(&b, "[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n", c.StartMs, end, escape(c.Title))
+	}
+	return b.String()
+}
+
+// escape 转义元数据文件中有特殊含义的字符。
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '=', ';', '#', '\\', '\n':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
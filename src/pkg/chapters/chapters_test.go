@@ -0,0 +1,35 @@
+package chapters
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadWrite(t *testing.T) {
+	path := PathOf(filepath.Join(t.TempDir(), "test.flv"))
+	assert.Equal(t, "test"+Ext, filepath.Base(path))
+	chapters := []Chapter{
+		{StartMs: 0, Kind: KindTitle, Title: "a", Time: time.Unix(100, 0).UTC()},
+		{StartMs: 1000, Kind: KindMarker, Title: "b", Time: time.Unix(101, 0).UTC()},
+	}
+	assert.NoError(t, Write(path, chapters))
+	read, err := Read(path)
+	assert.NoError(t, err)
+	assert.Equal(t, chapters, read)
+}
+
+func TestFFMetadata(t *testing.T) {
+	chapters := []Chapter{
+		{StartMs: 0, Title: "a=b;c"},
+		{StartMs: 1000, Title: "d"},
+		{StartMs: 1000, Title: "e"},
+	}
+	assert.Equal(t, ";FFMETADATA1\n"+
+		"[CHAPTER]\nTIMEBASE=1/1000\nSTART=0\nEND=1000\ntitle=a\\=b\\;c\n"+
+		"[CHAPTER]\nTIMEBASE=1/1000\nSTART=1000\nEND=1001\ntitle=d\n"+
+		"[CHAPTER]\nTIMEBASE=1/1000\nSTART=1000\nEND=5000\ntitle=e\n",
+		FFMetadata(chapters, 5000))
+}
@@ -0,0 +1,93 @@
+// Package concat 将同一场直播的多个录制文件无损拼接为一个文件。
+package concat
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ErrIncompatible 表示录制文件的格式、编码或参数不一致，不能无损拼接。
+var ErrIncompatible = errors.New("录制文件的编码或参数不一致")
+
+// muxerNames 将文件扩展名映射为 FFmpeg 的封装格式名称。
+var muxerNames = map[string]string{
+	"ts":  "mpegts",
+	"aac": "adts",
+	"mkv": "matroska",
+	"m4a": "ipod",
+}
+
+// Files 将 parts 按顺序无损拼接为 out，所有文件的扩展名必须相同。
+// FLV 文件使用内置的拼接器重新计算时间戳，其他格式使用 FFmpeg 的 concat 分离器。
+// 先写入临时文件，成功后再替换为 out。
+func Files(ctx context.Context, ffmpegPath, out string, parts []string) error {
+	if len(parts) == 0 {
+		return errors.New("没有需要拼接的文件")
+	}
+	ext := strings.ToLower(filepath.Ext(out))
+	for _, part := range parts {
+		if strings.ToLower(filepath.Ext(part)) != ext {
+			return fmt.Errorf("%w: %s", ErrIncompatible, part)
+		}
+	}
+	tmp := out + ".tmp"
+	var err error
+	if ext == ".flv" {
+		err = FLV(tmp, parts)
+	} else {
+		err = FFmpeg(ctx, ffmpegPath, tmp, muxerName(ext), parts)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, out)
+}
+
+// FFmpeg 使用 FFmpeg 的 concat 分离器拼接文件，format 为输出的封装格式。
+func FFmpeg(ctx context.Context, ffmpegPath, out, format string, parts []string) error {
+	// 1. 写入文件列表，路径中的单引号需要转义。
+	list := new(bytes.Buffer)
+	for _, part := range parts {
+		abs, err := filepath.Abs(part)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(list, "file '%s'\n", strings.ReplaceAll(abs, "'", `'\''`))
+	}
+	listFile := out + ".txt"
+	if err := os.WriteFile(listFile, list.Bytes(), 0644); err != nil {
+		return err
+	}
+	defer os.Remove(listFile)
+
+	// 2. 执行 FFmpeg。
+	stderr := new(bytes.Buffer)
+	cmd := exec.CommandContext(ctx, ffmpegPath, "-hide_banner", "-nostdin", "-y",
+		"-f", "concat", "-safe", "0", "-i", listFile,
+		"-map", "0", "-c", "copy", "-f", format, out)
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if idx := strings.LastIndex(msg, "\n"); idx >= 0 {
+			msg = msg[idx+1:]
+		}
+		return fmt.Errorf("%w: %s", err, msg)
+	}
+	return nil
+}
+
+// muxerName 返回扩展名对应的 FFmpeg 封装格式名称。
+func muxerName(ext string) string {
+	ext = strings.TrimPrefix(ext, ".")
+	if name, ok := muxerNames[ext]; ok {
+		return name
+	}
+	return ext
+}
@@ -0,0 +1,236 @@
+package concat
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	flvHeaderSize    = 9
+	flvTagHeaderSize = 11
+	flvPrevSizeLen   = 4
+
+	flvAudioTag  = 8
+	flvVideoTag  = 9
+	flvScriptTag = 18
+
+	flvHasVideo = 0x01
+	flvHasAudio = 0x04
+)
+
+// flvParams 是决定 FLV 文件能否无损拼接的参数。
+type flvParams struct {
+	flags       byte   // 文件头中的音视频标记
+	videoHeader []byte // 视频序列头
+	audioHeader []byte // 音频序列头
+}
+
+// FLV 将多个 FLV 文件拼接为一个文件，各文件的音视频标记和序列头必须相同，否则返回 ErrIncompatible。
+// 只保留第一个文件的脚本标签和序列头，之后每个文件的时间戳从上一个文件的最后一帧之后继续。
+// 文件尾部不完整的标签会被丢弃。
+func FLV(out string, parts []string) error {
+	// 1. 检查各文件的参数是否一致。
+	var first *flvParams
+	for _, part := range parts {
+		params, err := probeFLV(part)
+		if err != nil {
+			return err
+		}
+		if first == nil {
+			first = params
+			continue
+		}
+		if params.flags != first.flags || !bytes.Equal(params.videoHeader, first.videoHeader) ||
+			!bytes.Equal(params.audioHeader, first.audioHeader) {
+			return fmt.Errorf("%w: %s", ErrIncompatible, part)
+		}
+	}
+
+	// 2. 写入文件头，依次复制各文件的标签。
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	j := &flvJoiner{w: bufio.NewWriterSize(f, 1024*1024)}
+	if _, err := j.w.Write([]byte{'F', 'L', 'V', 0x01, first.flags, 0, 0, 0, flvHeaderSize, 0, 0, 0, 0}); err != nil {
+		return err
+	}
+	for i, part := range parts {
+		if err := j.copy(part, i == 0); err != nil {
+			return err
+		}
+	}
+	if err := j.w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// flvReader 依次读取 FLV 文件中的标签。
+type flvReader struct {
+	f      *os.File
+	r      *bufio.Reader
+	header []byte
+}
+
+// openFLV 打开 FLV 文件并跳过文件头。
+func openFLV(file string) (*flvReader, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	fr := &flvReader{f: f, r: bufio.NewReaderSize(f, 1024*1024), header: make([]byte, flvHeaderSize)}
+	if _, err := io.ReadFull(fr.r, fr.header); err != nil || !bytes.HasPrefix(fr.header, []byte("FLV")) {
+		f.Close()
+		return nil, fmt.Errorf("%w: %s 不是 FLV 文件", ErrIncompatible, file)
+	}
+	if _, err := fr.r.Discard(int(binary.BigEndian.Uint32(fr.header[5:])) - flvHeaderSize); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return fr, nil
+}
+
+// next 读取下一个标签的标签头和标签体，文件结束或遇到不完整、无法识别的标签时返回 io.EOF。
+func (fr *flvReader) next() ([]byte, []byte, error) {
+	h := make([]byte, flvPrevSizeLen+flvTagHeaderSize)
+	if _, err := io.ReadFull(fr.r, h); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, nil, io.EOF
+		}
+		return nil, nil, err
+	}
+	tag := h[flvPrevSizeLen:]
+	if typ := tag[0] & 0x1f; typ != flvAudioTag && typ != flvVideoTag && typ != flvScriptTag {
+		return nil, nil, io.EOF
+	}
+	body := make([]byte, int(tag[1])<<16|int(tag[2])<<8|int(tag[3]))
+	if _, err := io.ReadFull(fr.r, body); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, nil, io.EOF
+		}
+		return nil, nil, err
+	}
+	return tag, body, nil
+}
+
+// Close 关闭文件。
+func (fr *flvReader) Close() error {
+	return fr.f.Close()
+}
+
+// probeFLV 读取 FLV 文件的音视频标记和第一个序列头。
+func probeFLV(file string) (*flvParams, error) {
+	fr, err := openFLV(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fr.Close()
+	params := &flvParams{flags: fr.header[4] & (flvHasVideo | flvHasAudio)}
+	for (params.flags&flvHasVideo != 0 && params.videoHeader == nil) ||
+		(params.flags&flvHasAudio != 0 && params.audioHeader == nil) {
+		tag, body, err := fr.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch typ := tag[0] & 0x1f; {
+		case typ == flvVideoTag && params.videoHeader == nil && isSequenceHeader(typ, body):
+			params.videoHeader = body
+		case typ == flvAudioTag && params.audioHeader == nil && isSequenceHeader(typ, body):
+			params.audioHeader = body
+		}
+	}
+	return params, nil
+}
+
+// isSequenceHeader 返回标签是否为 AVC/HEVC 或 AAC 的序列头。
+func isSequenceHeader(typ byte, body []byte) bool {
+	switch {
+	case typ == flvVideoTag && len(body) >= 2 && body[0]&0x80 != 0:
+		// Enhanced RTMP 扩展，低 4 位为包类型
+		return body[0]&0x0f == 0
+	case typ == flvVideoTag && len(body) >= 2:
+		id := body[0] & 0x0f
+		return (id == 7 || id == 12) && body[1] == 0
+	case typ == flvAudioTag && len(body) >= 2:
+		return body[0]>>4 == 10 && body[1] == 0
+	}
+	return false
+}
+
+// flvJoiner 将多个 FLV 文件的标签写入同一个文件，并重新计算时间戳。
+type flvJoiner struct {
+	w      *bufio.Writer
+	offset int64 // 当前文件第一帧在输出文件中的时间戳
+	last   int64 // 已写入的最大时间戳
+	delta  int64 // 最近一次视频帧或音频帧的时间戳间隔
+}
+
+// copy 复制一个文件中的标签，之后的文件跳过脚本标签和重复的序列头。
+func (j *flvJoiner) copy(file string, first bool) error {
+	fr, err := openFLV(file)
+	if err != nil {
+		return err
+	}
+	defer fr.Close()
+	base := int64(-1)
+	prev := map[byte]int64{}
+	for {
+		tag, body, err := fr.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		typ := tag[0] & 0x1f
+		if !first && (typ == flvScriptTag || isSequenceHeader(typ, body)) {
+			continue
+		}
+
+		// 1. 以文件中第一个标签的时间戳为起点重新计算时间戳。
+		ts := int64(uint32(tag[7])<<24 | uint32(tag[4])<<16 | uint32(tag[5])<<8 | uint32(tag[6]))
+		if base < 0 {
+			base = ts
+		}
+		out := j.offset + ts - base
+		if out < j.offset {
+			out = j.offset
+		}
+		if p, ok := prev[typ]; ok && typ != flvScriptTag && out > p {
+			j.delta = out - p
+		}
+		prev[typ] = out
+		if out > j.last {
+			j.last = out
+		}
+
+		// 2. 写入标签及其长度。
+		tag[4], tag[5], tag[6], tag[7] = byte(out>>16), byte(out>>8), byte(out), byte(out>>24)
+		if _, err := j.w.Write(tag); err != nil {
+			return err
+		}
+		if _, err := j.w.Write(body); err != nil {
+			return err
+		}
+		if err := binary.Write(j.w, binary.BigEndian, uint32(flvTagHeaderSize+len(body))); err != nil {
+			return err
+		}
+	}
+
+	// 3. 下一个文件从最后一帧之后一个帧间隔开始。
+	delta := j.delta
+	if delta <= 0 {
+		delta = 1
+	}
+	j.offset = j.last + delta
+	return nil
+}
@@ -0,0 +1,91 @@
+package concat
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yuhaohwang/bililive-go/src/pkg/integrity"
+)
+
+// flvTag 是测试用的 FLV 标签。
+type flvTag struct {
+	typ  byte
+	ts   uint32
+	body []byte
+}
+
+// buildFLV 生成 FLV 文件内容。
+func buildFLV(tags []flvTag) []byte {
+	buf := bytes.NewBuffer([]byte{'F', 'L', 'V', 0x01, 0x05, 0, 0, 0, 9})
+	prev := uint32(0)
+	for _, tag := range tags {
+		b := make([]byte, 15)
+		binary.BigEndian.PutUint32(b, prev)
+		b[4] = tag.typ
+		b[5], b[6], b[7] = byte(len(tag.body)>>16), byte(len(tag.body)>>8), byte(len(tag.body))
+		b[8], b[9], b[10], b[11] = byte(tag.ts>>16), byte(tag.ts>>8), byte(tag.ts), byte(tag.ts>>24)
+		buf.Write(b)
+		buf.Write(tag.body)
+		prev = uint32(11 + len(tag.body))
+	}
+	binary.Write(buf, binary.BigEndian, prev)
+	return buf.Bytes()
+}
+
+// partTags 生成带序列头、从 start 开始、每 100 毫秒一帧的音视频标签。
+func partTags(start uint32, frames int, sps byte) []flvTag {
+	tags := []flvTag{
+		{flvScriptTag, 0, []byte("onMetaData")},
+		{flvVideoTag, start, []byte{0x17, 0x00, 0, 0, 0, sps}},
+		{flvAudioTag, start, []byte{0xaf, 0x00, 0x12, 0x10}},
+	}
+	for i := 0; i < frames; i++ {
+		ts := start + uint32(i*100)
+		tags = append(tags,
+			flvTag{flvVideoTag, ts, []byte{0x27, 0x01, 0, 0, 0, 1, 2}},
+			flvTag{flvAudioTag, ts, []byte{0xaf, 0x01, 1, 2}},
+		)
+	}
+	return tags
+}
+
+func writeFile(t *testing.T, dir, name string, b []byte) string {
+	file := filepath.Join(dir, name)
+	assert.NoError(t, os.WriteFile(file, b, 0644))
+	return file
+}
+
+func TestFLV(t *testing.T) {
+	dir := t.TempDir()
+	a := writeFile(t, dir, "a.flv", buildFLV(partTags(1000, 10, 1)))
+	// 第二个文件尾部截断
+	content := buildFLV(partTags(90000, 20, 1))
+	b := writeFile(t, dir, "b.flv", content[:len(content)-6])
+	out := filepath.Join(dir, "out.flv")
+
+	// 时间戳连续，只保留一份脚本标签和序列头，丢弃不完整的标签
+	assert.NoError(t, Files(context.Background(), "", out, []string{a, b}))
+	report, err := integrity.Verify(out)
+	assert.NoError(t, err)
+	assert.Equal(t, integrity.LevelOK, report.Integrity)
+	assert.Equal(t, int64(2900), report.DurationMs)
+	assert.Equal(t, 30, report.VideoFrames)
+	assert.Equal(t, 29, report.AudioFrames)
+	assert.NoFileExists(t, out+".tmp")
+
+	// 序列头不同时不能拼接
+	c := writeFile(t, dir, "c.flv", buildFLV(partTags(0, 10, 2)))
+	err = Files(context.Background(), "", out, []string{a, c})
+	assert.True(t, errors.Is(err, ErrIncompatible))
+
+	// 格式不同时不能拼接
+	err = Files(context.Background(), "", out, []string{a, filepath.Join(dir, "d.ts")})
+	assert.True(t, errors.Is(err, ErrIncompatible))
+}
@@ -2,9 +2,10 @@ package counter
 
 import (
 	"io"
+	"sync/atomic"
 )
 
-// Counter 定义了一个计数器接口，用于返回当前计数值。
+// Counter 定义了一个计数器接口，用于返回当前计数值，可以在其他协程中并发读取。
 type Counter interface {
 	Count() uint
 }
@@ -24,7 +25,7 @@ type CountWriter interface {
 // countReader 结构实现了 CountReader 接口。
 type countReader struct {
 	r     io.Reader // 嵌入的 io.Reader 接口
-	total uint      // 计数器总数
+	total uint64    // 计数器总数
 }
 
 // NewCountReader 创建一个新的 CountReader。
@@ -34,20 +35,20 @@ func NewCountReader(r io.Reader) CountReader {
 
 // Count 返回当前计数值。
 func (r *countReader) Count() uint {
-	return r.total
+	return uint(atomic.LoadUint64(&r.total))
 }
 
 // Read 从嵌入的 io.Reader 中读取数据，并更新计数值。
 func (r *countReader) Read(p []byte) (int, error) {
-	n, err := r.r.Read(p) // 调用嵌入的 io.Reader 的 Read 方法
-	r.total += uint(n)    // 更新计数器
-	return n, err         // 返回读取的字节数和错误
+	n, err := r.r.Read(p)                 // 调用嵌入的 io.Reader 的 Read 方法
+	atomic.AddUint64(&r.total, uint64(n)) // 更新计数器
+	return n, err                         // 返回读取的字节数和错误
 }
 
 // countWriter 结构实现了 CountWriter 接口。
 type countWriter struct {
 	w     io.Writer // 嵌入的 io.Writer 接口
-	total uint      // 计数器总数
+	total uint64    // 计数器总数
 }
 
 // NewCountWriter 创建一个新的 CountWriter。
@@ -57,12 +58,12 @@ func NewCountWriter(w io.Writer) CountWriter {
 
 // Count 返回当前计数值。
 func (w *countWriter) Count() uint {
-	return w.total
+	return uint(atomic.LoadUint64(&w.total))
 }
 
 // Write 将数据写入嵌入的 io.Writer，并更新计数值。
 func (w *countWriter) Write(p []byte) (int, error) {
-	n, err := w.w.Write(p) // 调用嵌入的 io.Writer 的 Write 方法
-	w.total += uint(n)     // 更新计数器
-	return n, err          // 返回写入的字节数和错误
+	n, err := w.w.Write(p)                // 调用嵌入的 io.Writer 的 Write 方法
+	atomic.AddUint64(&w.total, uint64(n)) // 更新计数器
+	return n, err                         // 返回写入的字节数和错误
 }
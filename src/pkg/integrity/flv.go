@@ -0,0 +1,138 @@
+package integrity
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	flvHeaderSize    = 9
+	flvTagHeaderSize = 11
+	flvPrevSizeLen   = 4
+
+	flvAudioTag  = 8
+	flvVideoTag  = 9
+	flvScriptTag = 18
+)
+
+var (
+	flvVideoCodecs = map[byte]string{2: "h263", 4: "vp6", 7: "avc", 12: "hevc"}
+	flvAudioCodecs = map[byte]string{2: "mp3", 10: "aac", 11: "speex", 14: "mp3"}
+)
+
+// scanFLV 依次读取 FLV 文件中的标签，只读取标签体的前几个字节用于判断帧类型和编码。
+func (s *scanner) scanFLV(r *bufio.Reader) error {
+	// 1. 跳过文件头。
+	header := make([]byte, flvHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		s.report.TruncatedBytes = s.report.Size
+		return nil
+	}
+	pos := int64(binary.BigEndian.Uint32(header[5:]))
+	if _, err := r.Discard(int(pos) - flvHeaderSize); err != nil {
+		s.report.TruncatedBytes = s.report.Size
+		return nil
+	}
+
+	// 2. 读取标签，遇到不完整或无法识别的标签时，将之后的内容计为截断。
+	h := make([]byte, flvPrevSizeLen+flvTagHeaderSize)
+	for {
+		n, err := io.ReadFull(r, h)
+		switch {
+		case err == io.EOF || (err == io.ErrUnexpectedEOF && n <= flvPrevSizeLen):
+			// 文件在 PreviousTagSize 处结束
+			if n > 0 && n < flvPrevSizeLen {
+				s.report.TruncatedBytes = int64(n)
+			}
+			return nil
+		case err == io.ErrUnexpectedEOF:
+			s.report.TruncatedBytes = int64(n - flvPrevSizeLen)
+			return nil
+		case err != nil:
+			return err
+		}
+		pos += flvPrevSizeLen
+		tag := h[flvPrevSizeLen:]
+		typ := tag[0] & 0x1f
+		size := int(tag[1])<<16 | int(tag[2])<<8 | int(tag[3])
+		ts := int64(uint32(tag[7])<<24 | uint32(tag[4])<<16 | uint32(tag[5])<<8 | uint32(tag[6]))
+		if typ != flvAudioTag && typ != flvVideoTag && typ != flvScriptTag {
+			s.report.TruncatedBytes = s.report.Size - pos
+			return nil
+		}
+
+		peek := size
+		if peek > 5 {
+			peek = 5
+		}
+		body, _ := r.Peek(peek)
+		body = append([]byte(nil), body...)
+		if n, err := r.Discard(size); err != nil {
+			if err != io.EOF {
+				return err
+			}
+			s.report.TruncatedBytes = int64(flvTagHeaderSize + n)
+			return nil
+		}
+		pos += int64(flvTagHeaderSize + size)
+
+		switch typ {
+		case flvVideoTag:
+			s.flvVideo(body, ts)
+		case flvAudioTag:
+			s.flvAudio(body, ts)
+		}
+	}
+}
+
+// flvVideo 处理视频标签，序列头和视频信息帧只用于判断编码，不参与时间戳检查。
+func (s *scanner) flvVideo(body []byte, ts int64) {
+	if len(body) < 2 {
+		return
+	}
+	var (
+		frameType = body[0] >> 4 & 0x07
+		codec     string
+		seqHeader bool
+	)
+	if body[0]&0x80 != 0 {
+		// Enhanced RTMP 扩展，低 4 位为包类型，其后为编码的 FourCC
+		if len(body) < 5 {
+			return
+		}
+		codec = string(body[1:5])
+		seqHeader = body[0]&0x0f == 0
+	} else {
+		id := body[0] & 0x0f
+		if codec = flvVideoCodecs[id]; codec == "" {
+			codec = fmt.Sprintf("video(%d)", id)
+		}
+		seqHeader = (id == 7 || id == 12) && body[1] == 0
+	}
+	if frameType == 5 {
+		return
+	}
+	s.setCodec(&s.video, codec)
+	if !seqHeader {
+		s.frame(&s.video, ts)
+	}
+}
+
+// flvAudio 处理音频标签，AAC 序列头只用于判断编码，不参与时间戳检查。
+func (s *scanner) flvAudio(body []byte, ts int64) {
+	if len(body) < 1 {
+		return
+	}
+	format := body[0] >> 4
+	codec := flvAudioCodecs[format]
+	if codec == "" {
+		codec = fmt.Sprintf("audio(%d)", format)
+	}
+	s.setCodec(&s.audio, codec)
+	if format == 10 && (len(body) < 2 || body[1] == 0) {
+		return
+	}
+	s.frame(&s.audio, ts)
+}
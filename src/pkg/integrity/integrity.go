@@ -0,0 +1,277 @@
+// Package integrity 检查录制完成的文件是否完整，报告时间戳断档与跳变、音画不同步、尾部截断和编码变化等问题。
+package integrity
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// Level 是文件完整性的总体评价。
+type Level string
+
+const (
+	LevelOK       Level = "ok"       // 没有发现问题
+	LevelDegraded Level = "degraded" // 可以播放，但存在断档、截断等问题
+	LevelBroken   Level = "broken"   // 无法识别或没有任何音视频数据
+
+	FormatFLV = "flv"
+	FormatTS  = "ts"
+)
+
+// 判断问题的阈值，可在测试中修改。
+var (
+	GapThreshold    = time.Second // 同一轨道相邻两帧的时间戳相差超过该值时视为断档
+	DesyncThreshold = time.Second // 音视频时间戳相差超过该值时视为不同步
+)
+
+var ErrUnsupportedFormat = errors.New("不支持检查的文件格式")
+
+// Gap 是同一轨道中时间戳的一次断档或回退。
+type Gap struct {
+	Track      string `json:"track"`       // 轨道，video 或 audio
+	OffsetMs   int64  `json:"offset_ms"`   // 发生位置的时间戳
+	DurationMs int64  `json:"duration_ms"` // 时间戳的变化量，回退时为负数
+}
+
+// CodecChange 是同一轨道中的一次编码变化。
+type CodecChange struct {
+	Track    string `json:"track"`     // 轨道，video 或 audio
+	OffsetMs int64  `json:"offset_ms"` // 发生位置的时间戳
+	From     string `json:"from"`      // 变化前的编码
+	To       string `json:"to"`        // 变化后的编码
+}
+
+// Report 是一个录制文件的检查结果。
+type Report struct {
+	Integrity        Level         `json:"integrity"`                   // 总体评价
+	Format           string        `json:"format"`                      // 文件格式
+	Size             int64         `json:"size"`                        // 文件大小
+	DurationMs       int64         `json:"duration_ms"`                 // 根据时间戳计算的实际时长
+	VideoFrames      int           `json:"video_frames"`                // 视频帧数
+	AudioFrames      int           `json:"audio_frames"`                // 音频帧数
+	VideoCodec       string        `json:"video_codec,omitempty"`       // 视频编码，发生变化时为最后的编码
+	AudioCodec       string        `json:"audio_codec,omitempty"`       // 音频编码，发生变化时为最后的编码
+	Gaps             []Gap         `json:"gaps,omitempty"`              // 时间戳断档
+	Jumps            []Gap         `json:"jumps,omitempty"`             // 时间戳回退
+	MaxAVDesyncMs    int64         `json:"max_av_desync_ms"`            // 音视频时间戳的最大差值
+	TruncatedBytes   int64         `json:"truncated_bytes,omitempty"`   // 文件尾部不完整的字节数
+	CodecChanges     []CodecChange `json:"codec_changes,omitempty"`     // 编码变化
+	ContinuityErrors int           `json:"continuity_errors,omitempty"` // TS 连续计数器错误次数
+	Problems         []string      `json:"problems,omitempty"`          // 评价的依据
+}
+
+// Verify 检查录制文件，目前支持 FLV 和 MPEG-TS 格式。
+// 文件无法读取或格式不受支持时返回错误，文件内容损坏时通过报告说明。
+func Verify(file string) (*Report, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. 根据文件头判断文件格式。
+	r := bufio.NewReaderSize(f, 1024*1024)
+	head, err := r.Peek(tsPacketSize + 1)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	s := newScanner(stat.Size())
+	switch {
+	case bytes.HasPrefix(head, []byte("FLV")):
+		s.report.Format = FormatFLV
+		err = s.scanFLV(r)
+	case len(head) > tsPacketSize && head[0] == tsSyncByte && head[tsPacketSize] == tsSyncByte:
+		s.report.Format = FormatTS
+		err = s.scanTS(r)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. 汇总检查结果。
+	s.finish()
+	return s.report, nil
+}
+
+// Repair 截掉文件尾部不完整的标签或数据包，使文件在最后一个完整的标签或数据包处结束，
+// 返回截掉后的检查结果和截掉的字节数。文件格式不受支持时返回 ErrUnsupportedFormat。
+func Repair(file string) (*Report, int64, error) {
+	report, err := Verify(file)
+	if err != nil {
+		return nil, 0, err
+	}
+	truncated := report.TruncatedBytes
+	if truncated == 0 {
+		return report, 0, nil
+	}
+	if err := os.Truncate(file, report.Size-truncated); err != nil {
+		return nil, 0, err
+	}
+	report, err = Verify(file)
+	return report, truncated, err
+}
+
+// String 返回报告的简要说明。
+func (r *Report) String() string {
+	if len(r.Problems) == 0 {
+		return fmt.Sprintf("%s, %s, %dms", r.Integrity, r.Format, r.DurationMs)
+	}
+	return fmt.Sprintf("%s, %s, %dms, %v", r.Integrity, r.Format, r.DurationMs, r.Problems)
+}
+
+// Compare 比较同一场直播的两个录制副本的检查结果，a 更好时返回负数，b 更好时返回正数。
+// 依次比较：是否可以播放、断档和回退次数、实际时长、尾部截断的字节数和文件大小，没有检查结果的副本最差。
+func Compare(a, b *Report) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	if ab, bb := a.Integrity == LevelBroken, b.Integrity == LevelBroken; ab != bb {
+		if ab {
+			return 1
+		}
+		return -1
+	}
+	if d := len(a.Gaps) + len(a.Jumps) - len(b.Gaps) - len(b.Jumps); d != 0 {
+		return d
+	}
+	if a.DurationMs != b.DurationMs {
+		return sign(b.DurationMs - a.DurationMs)
+	}
+	if a.TruncatedBytes != b.TruncatedBytes {
+		return sign(a.TruncatedBytes - b.TruncatedBytes)
+	}
+	return sign(b.Size - a.Size)
+}
+
+func sign(n int64) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// track 记录一个轨道的时间戳和编码。
+type track struct {
+	name    string
+	frames  int
+	last    int64 // 上一帧的时间戳（毫秒）
+	elapsed int64 // 正向增长的时间戳之和
+	codec   string
+}
+
+// scanner 在读取文件时累计各个轨道的信息。
+type scanner struct {
+	report *Report
+	video  track
+	audio  track
+}
+
+func newScanner(size int64) *scanner {
+	return &scanner{
+		report: &Report{Size: size},
+		video:  track{name: "video"},
+		audio:  track{name: "audio"},
+	}
+}
+
+// setCodec 记录轨道的编码，编码与之前不同时记录一次编码变化。
+func (s *scanner) setCodec(t *track, codec string) {
+	if t.codec != "" && t.codec != codec {
+		s.report.CodecChanges = append(s.report.CodecChanges, CodecChange{
+			Track:    t.name,
+			OffsetMs: t.last,
+			From:     t.codec,
+			To:       codec,
+		})
+	}
+	t.codec = codec
+}
+
+// frame 记录轨道中的一帧，ts 为毫秒时间戳。
+func (s *scanner) frame(t *track, ts int64) {
+	if t.frames > 0 {
+		switch delta := ts - t.last; {
+		case delta < 0:
+			s.report.Jumps = append(s.report.Jumps, Gap{Track: t.name, OffsetMs: t.last, DurationMs: delta})
+		case delta > GapThreshold.Milliseconds():
+			s.report.Gaps = append(s.report.Gaps, Gap{Track: t.name, OffsetMs: t.last, DurationMs: delta})
+			t.elapsed += delta
+		default:
+			t.elapsed += delta
+		}
+	}
+	t.frames++
+	t.last = ts
+
+	// 两个轨道都有数据后比较音视频的时间戳
+	if s.video.frames > 0 && s.audio.frames > 0 {
+		desync := s.video.last - s.audio.last
+		if desync < 0 {
+			desync = -desync
+		}
+		if desync > s.report.MaxAVDesyncMs {
+			s.report.MaxAVDesyncMs = desync
+		}
+	}
+}
+
+// finish 汇总各个轨道的信息并给出总体评价。
+func (s *scanner) finish() {
+	r := s.report
+	r.VideoFrames, r.AudioFrames = s.video.frames, s.audio.frames
+	r.VideoCodec, r.AudioCodec = s.video.codec, s.audio.codec
+	r.DurationMs = s.video.elapsed
+	if s.audio.elapsed > r.DurationMs {
+		r.DurationMs = s.audio.elapsed
+	}
+
+	if r.VideoFrames+r.AudioFrames == 0 {
+		r.Problems = append(r.Problems, "没有任何音视频数据")
+	}
+	if len(r.Gaps) > 0 {
+		r.Problems = append(r.Problems, fmt.Sprintf("时间戳断档%d次", len(r.Gaps)))
+	}
+	if len(r.Jumps) > 0 {
+		r.Problems = append(r.Problems, fmt.Sprintf("时间戳回退%d次", len(r.Jumps)))
+	}
+	if r.MaxAVDesyncMs > DesyncThreshold.Milliseconds() {
+		r.Problems = append(r.Problems, fmt.Sprintf("音视频不同步%dms", r.MaxAVDesyncMs))
+	}
+	if r.TruncatedBytes > 0 {
+		r.Problems = append(r.Problems, fmt.Sprintf("文件尾部截断%d字节", r.TruncatedBytes))
+	}
+	if len(r.CodecChanges) > 0 {
+		r.Problems = append(r.Problems, fmt.Sprintf("编码变化%d次", len(r.CodecChanges)))
+	}
+	if r.ContinuityErrors > 0 {
+		r.Problems = append(r.Problems, fmt.Sprintf("连续计数器错误%d次", r.ContinuityErrors))
+	}
+
+	switch {
+	case r.VideoFrames+r.AudioFrames == 0:
+		r.Integrity = LevelBroken
+	case len(r.Problems) > 0:
+		r.Integrity = LevelDegraded
+	default:
+		r.Integrity = LevelOK
+	}
+}
@@ -0,0 +1,215 @@
+package integrity
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flvTag 是测试用的 FLV 标签。
+type flvTag struct {
+	typ  byte
+	ts   uint32
+	body []byte
+}
+
+// buildFLV 生成 FLV 文件内容。
+func buildFLV(tags []flvTag) []byte {
+	buf := bytes.NewBuffer([]byte{'F', 'L', 'V', 0x01, 0x05, 0, 0, 0, 9})
+	prev := uint32(0)
+	for _, tag := range tags {
+		b := make([]byte, 15)
+		binary.BigEndian.PutUint32(b, prev)
+		b[4] = tag.typ
+		b[5], b[6], b[7] = byte(len(tag.body)>>16), byte(len(tag.body)>>8), byte(len(tag.body))
+		b[8], b[9], b[10], b[11] = byte(tag.ts>>16), byte(tag.ts>>8), byte(tag.ts), byte(tag.ts>>24)
+		buf.Write(b)
+		buf.Write(tag.body)
+		prev = uint32(11 + len(tag.body))
+	}
+	binary.Write(buf, binary.BigEndian, prev)
+	return buf.Bytes()
+}
+
+// avTags 生成从 start 开始、每 100 毫秒一帧的音视频标签。
+func avTags(start uint32, frames int, videoCodec byte) []flvTag {
+	var tags []flvTag
+	for i := 0; i < frames; i++ {
+		ts := start + uint32(i*100)
+		tags = append(tags,
+			flvTag{flvVideoTag, ts, []byte{0x20 | videoCodec, 0x01, 0, 0, 0, 1, 2}},
+			flvTag{flvAudioTag, ts, []byte{0xaf, 0x01, 1, 2}},
+		)
+	}
+	return tags
+}
+
+func writeFile(t *testing.T, name string, b []byte) string {
+	file := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(file, b, 0644))
+	return file
+}
+
+func TestVerifyFLV(t *testing.T) {
+	seqHeaders := []flvTag{
+		{flvScriptTag, 0, []byte("onMetaData")},
+		{flvVideoTag, 0, []byte{0x17, 0x00, 0, 0, 0, 1}},
+		{flvAudioTag, 0, []byte{0xaf, 0x00, 0x12, 0x10}},
+	}
+
+	// 完整的文件
+	file := writeFile(t, "ok.flv", buildFLV(append(seqHeaders, avTags(0, 50, 7)...)))
+	report, err := Verify(file)
+	assert.NoError(t, err)
+	assert.Equal(t, LevelOK, report.Integrity)
+	assert.Equal(t, FormatFLV, report.Format)
+	assert.Equal(t, int64(4900), report.DurationMs)
+	assert.Equal(t, 50, report.VideoFrames)
+	assert.Equal(t, 50, report.AudioFrames)
+	assert.Equal(t, "avc", report.VideoCodec)
+	assert.Equal(t, "aac", report.AudioCodec)
+	assert.Empty(t, report.Problems)
+
+	// 断档、回退、编码变化和尾部截断
+	tags := append(seqHeaders, avTags(0, 10, 7)...)
+	tags = append(tags, avTags(5000, 10, 7)...)
+	tags = append(tags, avTags(4000, 10, 12)...)
+	b := buildFLV(tags)
+	file = writeFile(t, "degraded.flv", b[:len(b)-6])
+	report, err = Verify(file)
+	assert.NoError(t, err)
+	assert.Equal(t, LevelDegraded, report.Integrity)
+	assert.Equal(t, []Gap{{"video", 900, 4100}, {"audio", 900, 4100}}, report.Gaps)
+	assert.Equal(t, []Gap{{"video", 5900, -1900}, {"audio", 5900, -1900}}, report.Jumps)
+	assert.Equal(t, []CodecChange{{"video", 5900, "avc", "hevc"}}, report.CodecChanges)
+	assert.Equal(t, int64(13), report.TruncatedBytes)
+	assert.Equal(t, 30, report.VideoFrames)
+	assert.Equal(t, 29, report.AudioFrames)
+
+	// 音视频不同步
+	tags = append([]flvTag(nil), seqHeaders...)
+	for i := 0; i < 30; i++ {
+		tags = append(tags,
+			flvTag{flvVideoTag, uint32(i * 100), []byte{0x27, 0x01, 0, 0, 0}},
+			flvTag{flvAudioTag, uint32(i*100 + 3000), []byte{0xaf, 0x01}},
+		)
+	}
+	report, err = Verify(writeFile(t, "desync.flv", buildFLV(tags)))
+	assert.NoError(t, err)
+	assert.Equal(t, LevelDegraded, report.Integrity)
+	assert.Equal(t, int64(3000), report.MaxAVDesyncMs)
+
+	// 没有任何音视频数据
+	report, err = Verify(writeFile(t, "broken.flv", buildFLV(seqHeaders[:1])))
+	assert.NoError(t, err)
+	assert.Equal(t, LevelBroken, report.Integrity)
+}
+
+// tsPacketOf 生成一个负载以 payload 开头、其余用 0xff 填充的 TS 包。
+func tsPacketOf(pid uint16, unitStart bool, cc byte, payload []byte) []byte {
+	pkt := bytes.Repeat([]byte{0xff}, tsPacketSize)
+	pkt[0], pkt[1], pkt[2], pkt[3] = tsSyncByte, byte(pid>>8)&0x1f, byte(pid), 0x10|cc&0x0f
+	if unitStart {
+		pkt[1] |= 0x40
+	}
+	copy(pkt[4:], payload)
+	return pkt
+}
+
+// pesHeader 生成只带 PTS 的 PES 头，pts 单位为毫秒。
+func pesHeader(streamID byte, pts int64) []byte {
+	pts *= 90
+	return []byte{0, 0, 1, streamID, 0, 0, 0x80, 0x80, 5,
+		byte(0x21 | pts>>29&0x0e), byte(pts >> 22), byte(pts>>14 | 1), byte(pts >> 7), byte(pts<<1 | 1)}
+}
+
+func TestVerifyTS(t *testing.T) {
+	pat := []byte{0, 0x00, 0xb0, 13, 0, 1, 0xc1, 0, 0, 0, 1, 0xf0, 0x00, 0, 0, 0, 0}
+	pmt := []byte{0, 0x02, 0xb0, 23, 0, 1, 0xc1, 0, 0, 0xe1, 0x00, 0xf0, 0,
+		0x1b, 0xe1, 0x00, 0xf0, 0,
+		0x0f, 0xe1, 0x01, 0xf0, 0,
+		0, 0, 0, 0}
+
+	var buf bytes.Buffer
+	buf.Write(tsPacketOf(0, true, 0, pat))
+	buf.Write(tsPacketOf(0x1000, true, 0, pmt))
+	cc := byte(0)
+	for i := 0; i < 30; i++ {
+		ts := int64(i * 100)
+		if i >= 20 {
+			ts += 2000
+		}
+		buf.Write(tsPacketOf(0x100, true, cc, pesHeader(0xe0, ts)))
+		buf.Write(tsPacketOf(0x101, true, cc, pesHeader(0xc0, ts)))
+		cc++
+		// 视频流的连续计数器跳过一个值，之后的音频包也会因此不连续
+		if i == 10 {
+			buf.Write(tsPacketOf(0x100, false, cc+1, nil))
+			cc += 2
+		}
+	}
+
+	report, err := Verify(writeFile(t, "record.ts", append(buf.Bytes(), 0x47, 0x00)))
+	assert.NoError(t, err)
+	assert.Equal(t, FormatTS, report.Format)
+	assert.Equal(t, LevelDegraded, report.Integrity)
+	assert.Equal(t, 30, report.VideoFrames)
+	assert.Equal(t, 30, report.AudioFrames)
+	assert.Equal(t, int64(4900), report.DurationMs)
+	assert.Equal(t, []Gap{{"video", 1900, 2100}, {"audio", 1900, 2100}}, report.Gaps)
+	assert.Equal(t, int64(2), report.TruncatedBytes)
+	assert.Equal(t, 2, report.ContinuityErrors)
+}
+
+func TestVerifyUnsupported(t *testing.T) {
+	_, err := Verify(writeFile(t, "record.mp4", []byte("\x00\x00\x00\x18ftypmp42")))
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+}
+
+func TestCompare(t *testing.T) {
+	ok := &Report{Integrity: LevelOK, DurationMs: 1000, Size: 100}
+	gap := &Report{Integrity: LevelDegraded, DurationMs: 1000, Size: 100, Gaps: []Gap{{"video", 0, 2000}}}
+	shorter := &Report{Integrity: LevelOK, DurationMs: 900, Size: 100}
+	truncated := &Report{Integrity: LevelDegraded, DurationMs: 1000, Size: 100, TruncatedBytes: 10}
+	larger := &Report{Integrity: LevelOK, DurationMs: 1000, Size: 200}
+	broken := &Report{Integrity: LevelBroken}
+
+	assert.Equal(t, 0, Compare(ok, ok))
+	assert.Negative(t, Compare(ok, gap))
+	assert.Positive(t, Compare(gap, ok))
+	assert.Negative(t, Compare(ok, shorter))
+	assert.Negative(t, Compare(ok, truncated))
+	assert.Negative(t, Compare(larger, ok))
+	assert.Negative(t, Compare(gap, broken))
+	assert.Negative(t, Compare(broken, nil))
+	assert.Equal(t, 0, Compare(nil, nil))
+}
+
+func TestRepair(t *testing.T) {
+	b := buildFLV(append([]flvTag{{flvScriptTag, 0, []byte("onMetaData")}}, avTags(0, 10, 7)...))
+
+	// 截掉不完整的最后一个标签，文件在上一个标签的 PreviousTagSize 处结束
+	file := writeFile(t, "truncated.flv", b[:len(b)-6])
+	report, truncated, err := Repair(file)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(13), truncated)
+	assert.Equal(t, LevelOK, report.Integrity)
+	assert.Equal(t, int64(len(b)-6-13), report.Size)
+	assert.Equal(t, 9, report.AudioFrames)
+	repaired, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, b[:len(b)-19], repaired)
+
+	// 完整的文件不做修改
+	file = writeFile(t, "ok.flv", b)
+	_, truncated, err = Repair(file)
+	assert.NoError(t, err)
+	assert.Zero(t, truncated)
+
+	_, _, err = Repair(writeFile(t, "record.mp4", []byte("\x00\x00\x00\x18ftypmp42")))
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+}
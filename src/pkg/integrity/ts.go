@@ -0,0 +1,207 @@
+package integrity
+
+import (
+	"bufio"
+	"io"
+)
+
+const (
+	tsPacketSize = 188
+	tsSyncByte   = 0x47
+	tsPATPID     = 0
+
+	ptsWrap = int64(1) << 33 // PTS/DTS 为 33 位，单位为 1/90000 秒
+)
+
+var (
+	tsVideoCodecs = map[byte]string{0x01: "mpeg1", 0x02: "mpeg2", 0x10: "mpeg4", 0x1b: "avc", 0x24: "hevc"}
+	tsAudioCodecs = map[byte]string{0x03: "mp3", 0x04: "mp3", 0x0f: "aac", 0x11: "aac", 0x81: "ac3"}
+)
+
+// tsStream 记录 TS 中一个基本流的状态。
+type tsStream struct {
+	track *track
+	cc    byte  // 上一个包的连续计数器
+	hasCC bool  // 是否已收到带负载的包
+	prev  int64 // 上一个时间戳，已处理回绕
+	wraps int64 // 时间戳回绕累计的偏移
+	hasTS bool
+}
+
+// tsDemuxer 记录解析 PAT/PMT 得到的节目信息。
+type tsDemuxer struct {
+	pmts    map[uint16]bool
+	streams map[uint16]*tsStream
+}
+
+// scanTS 依次读取 TS 包，从 PAT/PMT 中获取音视频流，从 PES 头中读取时间戳。
+func (s *scanner) scanTS(r *bufio.Reader) error {
+	d := &tsDemuxer{
+		pmts:    make(map[uint16]bool),
+		streams: make(map[uint16]*tsStream),
+	}
+	pkt := make([]byte, tsPacketSize)
+	for pos := int64(0); ; pos += tsPacketSize {
+		n, err := io.ReadFull(r, pkt)
+		switch {
+		case err == io.EOF:
+			return nil
+		case err == io.ErrUnexpectedEOF:
+			s.report.TruncatedBytes = int64(n)
+			return nil
+		case err != nil:
+			return err
+		}
+		// 同步字节错误时之后的内容无法可靠解析，计为截断
+		if pkt[0] != tsSyncByte {
+			s.report.TruncatedBytes = s.report.Size - pos
+			return nil
+		}
+		s.tsPacket(d, pkt)
+	}
+}
+
+// tsPacket 处理一个 TS 包。
+func (s *scanner) tsPacket(d *tsDemuxer, pkt []byte) {
+	var (
+		pid           = uint16(pkt[1]&0x1f)<<8 | uint16(pkt[2])
+		unitStart     = pkt[1]&0x40 != 0
+		control       = pkt[3] >> 4 & 0x03
+		cc            = pkt[3] & 0x0f
+		payload       []byte
+		discontinuity bool
+	)
+	offset := 4
+	if control&0x02 != 0 {
+		length := int(pkt[4])
+		if length > 0 {
+			discontinuity = pkt[5]&0x80 != 0
+		}
+		offset += 1 + length
+	}
+	if control&0x01 != 0 && offset < tsPacketSize {
+		payload = pkt[offset:]
+	}
+	if payload == nil {
+		return
+	}
+
+	switch {
+	case pid == tsPATPID:
+		if unitStart {
+			d.parsePAT(payload)
+		}
+	case d.pmts[pid]:
+		if unitStart {
+			s.parsePMT(d, payload)
+		}
+	case d.streams[pid] != nil:
+		st := d.streams[pid]
+		// 重复发送的包使用相同的计数器，不视为错误
+		if st.hasCC && !discontinuity && cc != (st.cc+1)&0x0f && cc != st.cc {
+			s.report.ContinuityErrors++
+		}
+		st.cc, st.hasCC = cc, true
+		if unitStart {
+			s.parsePES(st, payload)
+		}
+	}
+}
+
+// section 返回负载中的表数据，去掉指针字段和 CRC。
+func section(payload []byte) []byte {
+	if len(payload) < 1 || int(payload[0])+1 > len(payload) {
+		return nil
+	}
+	sec := payload[payload[0]+1:]
+	if len(sec) < 3 {
+		return nil
+	}
+	length := int(sec[1]&0x0f)<<8 | int(sec[2])
+	if length < 4 || 3+length > len(sec) {
+		return nil
+	}
+	return sec[:3+length-4]
+}
+
+// parsePAT 从 PAT 中获取 PMT 的 PID。
+func (d *tsDemuxer) parsePAT(payload []byte) {
+	sec := section(payload)
+	if len(sec) < 8 || sec[0] != 0x00 {
+		return
+	}
+	for i := 8; i+4 <= len(sec); i += 4 {
+		program := uint16(sec[i])<<8 | uint16(sec[i+1])
+		if program != 0 {
+			d.pmts[uint16(sec[i+2]&0x1f)<<8|uint16(sec[i+3])] = true
+		}
+	}
+}
+
+// parsePMT 从 PMT 中获取音视频流，每种轨道只检查第一个流。
+func (s *scanner) parsePMT(d *tsDemuxer, payload []byte) {
+	sec := section(payload)
+	if len(sec) < 12 || sec[0] != 0x02 {
+		return
+	}
+	streams := make(map[uint16]*tsStream)
+	i := 12 + (int(sec[10]&0x0f)<<8 | int(sec[11]))
+	for ; i+5 <= len(sec); i += 5 + (int(sec[i+3]&0x0f)<<8 | int(sec[i+4])) {
+		var (
+			typ   = sec[i]
+			pid   = uint16(sec[i+1]&0x1f)<<8 | uint16(sec[i+2])
+			t     *track
+			codec string
+		)
+		if c, ok := tsVideoCodecs[typ]; ok {
+			t, codec = &s.video, c
+		} else if c, ok := tsAudioCodecs[typ]; ok {
+			t, codec = &s.audio, c
+		} else {
+			continue
+		}
+		used := false
+		for _, st := range streams {
+			used = used || st.track == t
+		}
+		if used {
+			continue
+		}
+		s.setCodec(t, codec)
+		if st := d.streams[pid]; st != nil && st.track == t {
+			streams[pid] = st
+		} else {
+			streams[pid] = &tsStream{track: t}
+		}
+	}
+	d.streams = streams
+}
+
+// parsePES 从 PES 头中读取时间戳，有 DTS 时使用 DTS。
+func (s *scanner) parsePES(st *tsStream, payload []byte) {
+	if len(payload) < 14 || payload[0] != 0 || payload[1] != 0 || payload[2] != 1 {
+		return
+	}
+	flags := payload[7] >> 6
+	if flags&0x02 == 0 {
+		return
+	}
+	ts := readTimestamp(payload[9:14])
+	if flags&0x01 != 0 && len(payload) >= 19 {
+		ts = readTimestamp(payload[14:19])
+	}
+
+	// 处理 33 位时间戳的回绕
+	ts += st.wraps
+	if st.hasTS && ts-st.prev < -ptsWrap/2 {
+		st.wraps += ptsWrap
+		ts += ptsWrap
+	}
+	st.prev, st.hasTS = ts, true
+	s.frame(st.track, ts/90)
+}
+
+// readTimestamp 读取 PES 头中 5 字节的 PTS 或 DTS。
+func readTimestamp(b []byte) int64 {
+	return int64(b[0]>>1&0x07)<<30 | int64(b[1])<<22 | int64(b[2]>>1)<<15 | int64(b[3])<<7 | int64(b[4]>>1)
+}
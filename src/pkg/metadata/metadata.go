@@ -0,0 +1,168 @@
+// Package metadata 包含录制文件附属的 .metadata.json 文件的读写。
+package metadata
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/yuhaohwang/bililive-go/src/pkg/integrity"
+)
+
+const (
+	// Ext 是录制文件附属的元数据文件的扩展名。
+	Ext = ".metadata.json"
+	// PartExt 是正在录制的文件的扩展名，录制结束后去掉该扩展名，异常退出时留下的该扩展名的文件需要修复。
+	PartExt = ".part"
+)
+
+// Metadata 是元数据文件中与录制文件管理相关的字段。
+type Metadata struct {
+	Id                string      `json:"id"`                             // 直播唯一标识
+	LiveUrl           string      `json:"live_url"`                       // 直播原始 URL
+	PlatformCNName    string      `json:"platform_cn_name"`               // 平台中文名称
+	HostName          string      `json:"host_name"`                      // 主播名
+	RoomName          string      `json:"room_name"`                      // 房间名
+	Recording         bool        `json:"recording"`                      // 是否正在录制
+	LastStartTimeUnix int64       `json:"last_start_time_unix,omitempty"` // 本场直播开始时间的 UNIX 时间戳
+	StartTimeUnix     int64       `json:"start_time_unix,omitempty"`      // 本文件开始录制的 UNIX 时间戳
+	EndTimeUnix       int64       `json:"end_time_unix,omitempty"`        // 本文件结束录制的 UNIX 时间戳
+	Pinned            bool        `json:"pinned,omitempty"`               // 是否已固定，固定的录制不会被保留策略删除
+	Split             *Split      `json:"split,omitempty"`                // 无缝切分的分段信息
+	Backlog           *Backlog    `json:"backlog,omitempty"`              // 录制开始时从直播回看窗口中补录的内容
+	Integrity         string      `json:"integrity,omitempty"`            // 录制完成后的完整性检查结果：ok、degraded 或 broken
+	Stall             *Stall      `json:"stall,omitempty"`                // 录制因直播流停滞而结束
+	Copies            []string    `json:"copies,omitempty"`               // 冗余录制的其他副本，为相对于元数据文件所在目录的路径
+	CopyOf            string      `json:"copy_of,omitempty"`              // 本文件是哪个录制文件的冗余副本，为相对于元数据文件所在目录的路径
+	Session           *SessionRef `json:"session,omitempty"`              // 本文件所属的直播场次
+	ConcatOf          []string    `json:"concat_of,omitempty"`            // 本文件由哪些分段拼接而成，为拼接前的文件名
+	ClipOf            *Clip       `json:"clip_of,omitempty"`              // 本文件是从哪个录制文件中截取的片段
+	Recovery          *Recovery   `json:"recovery,omitempty"`             // 本文件在程序异常退出后被修复
+
+	IntegrityReport *integrity.Report `json:"integrity_report,omitempty"` // 完整性检查的详细结果
+}
+
+// Backlog 记录录制开始时从直播回看窗口中补录的内容。
+type Backlog struct {
+	Segments   int   `json:"segments"`    // 补录的分片数
+	DurationMs int64 `json:"duration_ms"` // 补录的时长
+}
+
+// Stall 记录导致录制结束的直播流停滞。
+type Stall struct {
+	Bytes            uint64 `json:"bytes"`              // 停滞时已接收的字节数
+	LastProgressUnix int64  `json:"last_progress_unix"` // 最后一次接收到数据的 UNIX 时间戳
+	DetectedUnix     int64  `json:"detected_unix"`      // 检测到停滞的 UNIX 时间戳
+}
+
+// Clip 记录从录制文件中截取的片段。
+type Clip struct {
+	File    string `json:"file"`     // 源录制文件，为相对于元数据文件所在目录的路径
+	StartMs int64  `json:"start_ms"` // 片段起点相对于源文件开头的毫秒数
+	EndMs   int64  `json:"end_ms"`   // 片段终点相对于源文件开头的毫秒数
+	Precise bool   `json:"precise"`  // 是否重新编码以精确截取，否则从起点之前的关键帧开始无损截取
+}
+
+// Recovery 记录程序异常退出后对未正常结束的录制文件的修复。
+type Recovery struct {
+	TruncatedBytes int64 `json:"truncated_bytes"` // 从文件尾部截掉的不完整内容的字节数
+	TimeUnix       int64 `json:"time_unix"`       // 修复的 UNIX 时间戳
+}
+
+// SessionRef 记录录制文件在直播场次中的位置。
+type SessionRef struct {
+	ID    string `json:"id"`    // 直播场次唯一标识
+	Index int    `json:"index"` // 在直播场次中的分段序号，从 0 开始
+}
+
+// Split 记录无缝切分产生的录制文件在本次录制中的位置，文件名为相对于元数据文件所在目录的路径。
+type Split struct {
+	Index         int    `json:"index"`                   // 分段序号，从 0 开始
+	PrevFile      string `json:"prev_file,omitempty"`     // 上一个分段的文件
+	NextFile      string `json:"next_file,omitempty"`     // 下一个分段的文件
+	Reason        string `json:"reason,omitempty"`        // 本分段结束的原因
+	StartOffsetMs int64  `json:"start_offset_ms"`         // 本分段起点在直播流中的时间戳
+	EndOffsetMs   int64  `json:"end_offset_ms,omitempty"` // 本分段终点在直播流中的时间戳
+	StartTimeUnix int64  `json:"start_time_unix"`         // 本分段开始写入的 UNIX 时间戳
+	EndTimeUnix   int64  `json:"end_time_unix,omitempty"` // 本分段结束写入的 UNIX 时间戳
+}
+
+// lock 保证同一进程内对元数据文件的读写互斥。
+var lock sync.Mutex
+
+// PathOf 返回录制文件对应的元数据文件路径，正在录制的文件与录制结束后的文件使用同一个元数据文件。
+func PathOf(file string) string {
+	if strings.HasSuffix(file, Ext) {
+		return file
+	}
+	file = strings.TrimSuffix(file, PartExt)
+	return strings.TrimSuffix(file, filepath.Ext(file)) + Ext
+}
+
+// PartOf 返回录制文件在录制过程中写入的文件路径。
+func PartOf(file string) string {
+	return file + PartExt
+}
+
+// Read 读取元数据文件。
+func Read(path string) (*Metadata, error) {
+	lock.Lock()
+	defer lock.Unlock()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	md := new(Metadata)
+	if err := json.Unmarshal(b, md); err != nil {
+		return nil, err
+	}
+	return md, nil
+}
+
+// Update 将字段合并写入元数据文件，保留文件中已有的其他字段，值为 nil 的字段会被删除，文件不存在时创建。
+func Update(path string, fields map[string]interface{}) error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	// 1. 读取已有的字段。
+	data := make(map[string]interface{})
+	b, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(b, &data); err != nil {
+			return err
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return err
+	}
+
+	// 2. 合并字段后写入临时文件，再替换原文件。
+	for k, v := range fields {
+		if v == nil {
+			delete(data, k)
+			continue
+		}
+		data[k] = v
+	}
+	if b, err = json.MarshalIndent(data, "", "  "); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// UpdateWithJSON 将 JSON 对象中的字段合并写入元数据文件。
+func UpdateWithJSON(path string, b []byte) error {
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return err
+	}
+	return Update(path, fields)
+}
@@ -0,0 +1,44 @@
+package metadata
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPathOf(t *testing.T) {
+	assert.Equal(t, "a/b.metadata.json", PathOf("a/b.flv"))
+	assert.Equal(t, "a/b.metadata.json", PathOf("a/b"))
+	assert.Equal(t, "a/b.metadata.json", PathOf("a/b.metadata.json"))
+	assert.Equal(t, "a/b.metadata.json", PathOf(PartOf("a/b.flv")))
+}
+
+func TestUpdate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.metadata.json")
+
+	// 文件不存在时创建
+	assert.NoError(t, UpdateWithJSON(path, []byte(`{"host_name":"host","recording":true,"custom":1}`)))
+	md, err := Read(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "host", md.HostName)
+	assert.True(t, md.Recording)
+
+	// 合并时保留已有字段
+	assert.NoError(t, Update(path, map[string]interface{}{"recording": false, "pinned": true}))
+	md, err = Read(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "host", md.HostName)
+	assert.False(t, md.Recording)
+	assert.True(t, md.Pinned)
+	b, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), `"custom": 1`)
+
+	// 值为 nil 的字段被删除
+	assert.NoError(t, Update(path, map[string]interface{}{"custom": nil}))
+	b, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), `"custom"`)
+}
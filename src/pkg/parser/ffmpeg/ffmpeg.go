@@ -4,8 +4,10 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/url"
 	"os"
 	"os/exec"
@@ -13,17 +15,21 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/yuhaohwang/bililive-go/src/instance"
 	"github.com/yuhaohwang/bililive-go/src/live"
 	"github.com/yuhaohwang/bililive-go/src/pkg/parser"
+	"github.com/yuhaohwang/bililive-go/src/pkg/parser/native/flv"
 	"github.com/yuhaohwang/bililive-go/src/pkg/utils"
 )
 
 const (
 	Name = "ffmpeg"
 
+	stopTimeout = 5 * time.Second // 发送退出指令后等待 FFmpeg 退出的时间
+
 	userAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_12_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/59.0.3071.115 Safari/537.36"
 )
 
@@ -43,6 +49,7 @@ func (b *builder) Build(cfg map[string]string) (parser.Parser, error) {
 		closeOnce:   new(sync.Once),
 		statusReq:   make(chan struct{}, 1),
 		statusResp:  make(chan map[string]string, 1),
+		done:        make(chan struct{}),
 		timeoutInUs: cfg["timeout_in_us"],
 	}, nil
 }
@@ -51,12 +58,22 @@ type Parser struct {
 	cmd         *exec.Cmd
 	cmdStdIn    io.WriteCloser
 	cmdStdout   io.ReadCloser
+	lock        sync.Mutex // 保护 started 和 stopped，保证 Stop 与 FFmpeg 的启动不会交错
+	started     bool       // FFmpeg 已启动
+	stopped     bool       // 已调用 Stop
 	closeOnce   *sync.Once
 	debug       bool
 	timeoutInUs string
+	split       parser.SplitOptions
 
 	statusReq  chan struct{}
 	statusResp chan map[string]string
+	totalSize  uint64        // FFmpeg 进度信息中的 total_size
+	outTimeUs  int64         // FFmpeg 进度信息中的 out_time_us
+	progress   atomic.Value  // 最近一次的进度信息
+	file       atomic.Value  // 录制文件
+	writer     atomic.Value  // 切分文件时写入文件的 *flv.Parser
+	done       chan struct{} // FFmpeg 退出时关闭
 }
 
 // scanFFmpegStatus 扫描FFmpeg的状态输出
@@ -112,18 +129,70 @@ func (p *Parser) scheduler() {
 				if !ok {
 					return
 				}
-				p.statusResp <- p.decodeFFmpegStatus(b)
+				status := p.decodeFFmpegStatus(b)
+				p.updateProgress(status)
+				p.statusResp <- status
 			case <-time.After(time.Second * 3):
 				p.statusResp <- nil
 			}
 		default:
-			if _, ok := <-statusCh; !ok {
+			b, ok := <-statusCh
+			if !ok {
 				return
 			}
+			p.updateProgress(p.decodeFFmpegStatus(b))
 		}
 	}
 }
 
+// updateProgress 记录进度信息中已输出的字节数和时长。
+func (p *Parser) updateProgress(status map[string]string) {
+	if size, err := strconv.ParseUint(status["total_size"], 10, 64); err == nil {
+		atomic.StoreUint64(&p.totalSize, size)
+	}
+	if us, err := strconv.ParseInt(status["out_time_us"], 10, 64); err == nil {
+		atomic.StoreInt64(&p.outTimeUs, us)
+	}
+	p.progress.Store(status)
+}
+
+// Count 返回 FFmpeg 已输出的字节数，用于检测直播流是否停滞。
+func (p *Parser) Count() uint {
+	return uint(atomic.LoadUint64(&p.totalSize))
+}
+
+// Progress 返回当前文件已写入的时长，切分文件时为当前分段的时长。
+func (p *Parser) Progress() time.Duration {
+	if w, ok := p.writer.Load().(*flv.Parser); ok {
+		return w.Progress()
+	}
+	return time.Duration(atomic.LoadInt64(&p.outTimeUs)) * time.Microsecond
+}
+
+// Stats 返回当前文件的写入统计，码率和帧率使用 FFmpeg 进度信息中的实时值。
+func (p *Parser) Stats() parser.Stats {
+	var s parser.Stats
+	status, _ := p.progress.Load().(map[string]string)
+	if w, ok := p.writer.Load().(*flv.Parser); ok {
+		s = w.Stats()
+	} else {
+		s.File, _ = p.file.Load().(string)
+		s.Bytes = int64(atomic.LoadUint64(&p.totalSize))
+		s.MediaDuration = time.Duration(atomic.LoadInt64(&p.outTimeUs)) * time.Microsecond
+		s.Frames, _ = strconv.ParseUint(status["frame"], 10, 64)
+	}
+	s.Parser = Name
+	if fps, err := strconv.ParseFloat(status["fps"], 64); err == nil && fps > 0 {
+		s.FPS = fps
+	}
+	if kbps, err := strconv.ParseFloat(strings.TrimSuffix(status["bitrate"], "kbits/s"), 64); err == nil && kbps > 0 {
+		s.BitrateKbps = kbps
+	} else if seconds := s.MediaDuration.Seconds(); seconds > 0 && s.BitrateKbps == 0 {
+		s.BitrateKbps = float64(s.Bytes) * 8 / 1000 / seconds
+	}
+	return s
+}
+
 // Status 获取FFmpeg的状态信息
 func (p *Parser) Status() (map[string]string, error) {
 	// TODO: 检查解析器是否正在运行
@@ -137,6 +206,7 @@ func (p *Parser) ParseLiveStream(ctx context.Context, url *url.URL, live live.Li
 	if err != nil {
 		return err
 	}
+	p.file.Store(file)
 
 	encoder := "no"
 
@@ -209,45 +279,121 @@ func (p *Parser) ParseLiveStream(ctx context.Context, url *url.URL, live live.Li
 		args = append(args, "-buffer_size", "250M") // 缓存
 	}
 
-	if encoder != "cache" {
-		inst := instance.GetInstance(ctx)
-		MaxFileSize := inst.Config.VideoSplitStrategies.MaxFileSize
-		if MaxFileSize < 0 {
-			inst.Logger.Infof("无效的MaxFileSize：%d", MaxFileSize)
-		} else if MaxFileSize > 0 {
-			args = append(args, "-fs", strconv.Itoa(MaxFileSize))
+	// 获取直播间生效的配置
+	cfg := instance.GetInstance(ctx).Config.EffectiveConfig(live.GetRawUrl())
+
+	// 添加额外的 FFmpeg 参数，输入参数需位于 -i 之前
+	if inputArgs := cfg.FfmpegOptions.InputArgs; len(inputArgs) > 0 {
+		args = append(append([]string{}, inputArgs...), args...)
+	}
+	args = append(args, cfg.FfmpegOptions.OutputArgs...)
+
+	// 需要切分文件时，FFmpeg 将 FLV 数据输出到本地 TCP 连接，由 FLV 解析器写入文件并在关键帧处切分
+	var ln net.Listener
+	if p.split.Enabled() && encoder == "no" {
+		if ln, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+			return err
 		}
+		defer ln.Close()
+		args = append(args, "tcp://"+ln.Addr().String())
+	} else {
+		args = append(args, file)
 	}
 
-	args = append(args, file)
+	// 启动前已调用 Stop 时不再启动 FFmpeg
+	if started, err := p.start(ffmpegPath, args); !started {
+		return err
+	}
+	go p.scheduler()
+	defer close(p.done)
+	if ln == nil {
+		return p.cmd.Wait()
+	}
+
+	splitErr := make(chan error, 1)
+	go func() {
+		splitErr <- p.writeSplitFiles(ctx, ln, file)
+	}()
+	err = p.cmd.Wait()
+	// FFmpeg 未能建立连接时结束等待
+	ln.Close()
+	if e := <-splitErr; err == nil {
+		err = e
+	}
+	return err
+}
+
+// SetSplitOptions 设置切分文件的条件。
+func (p *Parser) SetSplitOptions(opts parser.SplitOptions) {
+	p.split = opts
+}
+
+// writeSplitFiles 接收 FFmpeg 输出的 FLV 数据，写入文件并按切分条件切分。
+func (p *Parser) writeSplitFiles(ctx context.Context, ln net.Listener, file string) error {
+	conn, err := ln.Accept()
+	if err != nil {
+		return nil
+	}
+	defer conn.Close()
+
+	w := flv.New()
+	w.SetSplitOptions(p.split)
+	p.writer.Store(w)
+	err = w.ParseStream(ctx, conn, file)
+	// FFmpeg 退出时会关闭连接
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil
+	}
+	return err
+}
+
+// start 启动 FFmpeg，已调用 Stop 时不启动并返回 false。
+func (p *Parser) start(ffmpegPath string, args []string) (bool, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.stopped {
+		return false, nil
+	}
 
 	p.cmd = exec.Command(ffmpegPath, args...)
 	// 打印执行的命令
 	fmt.Printf("Command to be executed: %s\n", p.cmd.String())
 
+	var err error
 	if p.cmdStdIn, err = p.cmd.StdinPipe(); err != nil {
-		return err
+		return false, err
 	}
 	if p.cmdStdout, err = p.cmd.StdoutPipe(); err != nil {
-		return err
+		return false, err
 	}
 	if p.debug {
 		p.cmd.Stderr = os.Stderr
 	}
 	if err = p.cmd.Start(); err != nil {
-		p.cmd.Process.Kill()
-		return err
+		return false, err
 	}
-	go p.scheduler()
-	return p.cmd.Wait()
+	p.started = true
+	return true, nil
 }
 
-// Stop 停止解析器
+// Stop 停止解析器，FFmpeg 阻塞在读取直播流时不会响应退出指令，超时后强制结束进程。
+// FFmpeg 启动前调用时不再启动 FFmpeg。
 func (p *Parser) Stop() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.stopped = true
+	if !p.started {
+		return nil
+	}
 	p.closeOnce.Do(func() {
-		if p.cmd.ProcessState == nil {
-			p.cmdStdIn.Write([]byte("q"))
-		}
+		p.cmdStdIn.Write([]byte("q"))
+		go func() {
+			select {
+			case <-p.done:
+			case <-time.After(stopTimeout):
+				p.cmd.Process.Kill()
+			}
+		}()
 	})
 	return nil
 }
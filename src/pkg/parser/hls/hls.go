@@ -0,0 +1,440 @@
+package hls
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/yuhaohwang/bililive-go/src/instance"
+	"github.com/yuhaohwang/bililive-go/src/live"
+	"github.com/yuhaohwang/bililive-go/src/pkg/parser"
+)
+
+const (
+	Name = "hls"
+
+	userAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_12_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/59.0.3071.115 Safari/537.36"
+
+	defaultWorkers = 3
+	defaultRetries = 3
+
+	liveEdgeSegments = 3 // 默认从倒数第几个分片开始录制
+)
+
+// 用于测试的变量
+var (
+	retryInterval = time.Second
+	now           = time.Now
+)
+
+func init() {
+	parser.Register(Name, new(builder))
+}
+
+type builder struct{}
+
+func (b *builder) Build(cfg map[string]string) (parser.Parser, error) {
+	timeout := time.Minute
+	if us, err := strconv.ParseInt(cfg["timeout_in_us"], 10, 64); err == nil && us > 0 {
+		timeout = time.Duration(us) * time.Microsecond
+	}
+	return New(timeout), nil
+}
+
+// New 创建一个新的 HLS 解析器，timeout 为单次请求的超时时间。
+func New(timeout time.Duration) *Parser {
+	return &Parser{
+		hc:        &http.Client{Timeout: timeout},
+		workers:   defaultWorkers,
+		retries:   defaultRetries,
+		stopCh:    make(chan struct{}),
+		closeOnce: new(sync.Once),
+		initCache: make(map[string][]byte),
+	}
+}
+
+// Parser 拉取 HLS 媒体播放列表，并发下载 TS 或 fMP4 分片后按顺序写入文件。
+type Parser struct {
+	hc        *http.Client
+	workers   int
+	retries   int
+	referer   string
+	stopCh    chan struct{}
+	closeOnce *sync.Once
+	logger    *logrus.Entry
+
+	split     parser.SplitOptions
+	backlog   parser.BacklogOptions
+	out       output
+	offset    time.Duration       // 已写入的分片总时长
+	lastSeq   uint64              // 最后一个处理过的媒体序列号
+	hasSeq    bool                // 是否处理过分片
+	started   bool                // 是否已获取过媒体播放列表
+	initCache map[string][]byte   // 已下载的 fMP4 初始化分片
+	stats     parser.StatsTracker // 当前文件的写入统计
+
+	segments        uint64
+	gaps            uint64
+	discontinuities uint64
+	bytes           uint64
+}
+
+// output 记录当前写入的文件的状态。
+type output struct {
+	file     *os.File
+	name     string
+	size     int64
+	duration time.Duration
+	segments int
+	lastSize int64     // 上一个分片的大小
+	initURL  string    // 已写入的 fMP4 初始化分片
+	splitAt  time.Time // 下一个按时钟对齐的切分时间
+}
+
+// segmentResult 是分片的下载结果。
+type segmentResult struct {
+	data []byte
+	err  error
+}
+
+// SetSplitOptions 设置切分文件的条件，HLS 在分片边界处切分文件。
+func (p *Parser) SetSplitOptions(opts parser.SplitOptions) {
+	p.split = opts
+}
+
+// SetBacklogOptions 设置录制开始时从回看窗口中补录的方式。
+func (p *Parser) SetBacklogOptions(opts parser.BacklogOptions) {
+	p.backlog = opts
+}
+
+// Status 返回解析器的状态。
+func (p *Parser) Status() (map[string]string, error) {
+	return map[string]string{
+		"parser":          Name,
+		"segments":        strconv.FormatUint(atomic.LoadUint64(&p.segments), 10),
+		"gaps":            strconv.FormatUint(atomic.LoadUint64(&p.gaps), 10),
+		"discontinuities": strconv.FormatUint(atomic.LoadUint64(&p.discontinuities), 10),
+		"bytes":           strconv.FormatUint(atomic.LoadUint64(&p.bytes), 10),
+	}, nil
+}
+
+// Stats 返回当前文件的写入统计，媒体时长为已写入的分片时长之和，无法统计帧率。
+func (p *Parser) Stats() parser.Stats {
+	return p.stats.Stats(Name)
+}
+
+// Progress 返回当前文件已写入的分片时长之和。
+func (p *Parser) Progress() time.Duration {
+	return p.stats.Duration()
+}
+
+// Count 返回已写入的字节数，用于检测直播流是否停滞。
+func (p *Parser) Count() uint {
+	return uint(atomic.LoadUint64(&p.bytes))
+}
+
+// Stop 停止解析器。
+func (p *Parser) Stop() error {
+	p.closeOnce.Do(func() {
+		close(p.stopCh)
+	})
+	return nil
+}
+
+// ParseLiveStream 解析直播流，直到播放列表结束或解析器被停止。
+func (p *Parser) ParseLiveStream(ctx context.Context, url *url.URL, live live.Live, file string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-p.stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	p.referer = live.GetRawUrl()
+	p.logger = instance.GetInstance(ctx).Logger.WithField("parser", Name)
+
+	// 初始化输出文件
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	p.setOutput(f, file)
+	defer func() { p.out.file.Close() }()
+
+	err = p.run(ctx, url)
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// run 循环刷新播放列表并下载新的分片。
+func (p *Parser) run(ctx context.Context, playlistURL *url.URL) error {
+	for {
+		// 1. 获取播放列表，主播放列表选择码率最高的媒体播放列表。
+		pl, err := p.fetchPlaylist(ctx, playlistURL)
+		if err != nil {
+			return err
+		}
+		if pl.IsMaster() {
+			variant, err := pl.BestVariant()
+			if err != nil {
+				return err
+			}
+			if pl, err = p.fetchPlaylist(ctx, variant.URL); err != nil {
+				return err
+			}
+			if pl.IsMaster() {
+				return ErrNotPlaylist
+			}
+			playlistURL = variant.URL
+		}
+
+		// 2. 下载新的分片并写入文件。
+		segments := p.newSegments(pl)
+		if err := p.downloadAndWrite(ctx, segments); err != nil {
+			return err
+		}
+		if pl.EndList {
+			return nil
+		}
+
+		// 3. 播放列表有更新时等待一个目标时长，否则等待半个目标时长后刷新。
+		wait := pl.TargetDuration
+		if wait <= 0 {
+			wait = time.Second
+		}
+		if len(segments) == 0 {
+			wait /= 2
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+// newSegments 返回播放列表中尚未处理的分片，按媒体序列号去重并统计丢失的分片。
+func (p *Parser) newSegments(pl *Playlist) []Segment {
+	n := len(pl.Segments)
+	if n == 0 {
+		return nil
+	}
+	// 媒体序列号整体回退，说明直播流被重置，重新开始计数
+	if p.hasSeq && pl.Segments[n-1].Sequence+uint64(n) < p.lastSeq {
+		p.logger.Warnf("媒体序列号从 %d 回退到 %d，视为不连续", p.lastSeq, pl.Segments[n-1].Sequence)
+		atomic.AddUint64(&p.discontinuities, 1)
+		p.hasSeq = false
+	}
+
+	// 第一次获取播放列表时从直播边缘开始录制，配置了补录时从更早的分片开始
+	all := pl.Segments
+	if !p.started {
+		p.started = true
+		all = all[p.startIndex(pl):]
+	}
+
+	var segments []Segment
+	for _, seg := range all {
+		if p.hasSeq && seg.Sequence <= p.lastSeq {
+			continue
+		}
+		if p.hasSeq && seg.Sequence > p.lastSeq+1 {
+			lost := seg.Sequence - p.lastSeq - 1
+			p.logger.Warnf("丢失了 %d 个分片(%d-%d)", lost, p.lastSeq+1, seg.Sequence-1)
+			atomic.AddUint64(&p.gaps, lost)
+		}
+		p.lastSeq, p.hasSeq = seg.Sequence, true
+		segments = append(segments, seg)
+	}
+	return segments
+}
+
+// startIndex 返回第一次录制时开始下载的分片下标，并通知从回看窗口中补录的内容。
+func (p *Parser) startIndex(pl *Playlist) int {
+	n := len(pl.Segments)
+	if pl.EndList {
+		return 0
+	}
+	edge := n - liveEdgeSegments
+	if edge < 0 {
+		edge = 0
+	}
+	start := edge
+	switch {
+	case p.backlog.FromOldest:
+		start = 0
+	case p.backlog.Lookback > 0:
+		var d time.Duration
+		i := n
+		for i > 0 && d < p.backlog.Lookback {
+			i--
+			d += pl.Segments[i].Duration
+		}
+		if i < start {
+			start = i
+		}
+	}
+
+	if start < edge && p.backlog.OnBacklog != nil {
+		backlog := parser.Backlog{Segments: edge - start}
+		for _, seg := range pl.Segments[start:edge] {
+			backlog.Duration += seg.Duration
+		}
+		p.logger.Infof("从回看窗口中补录 %d 个分片，共 %s", backlog.Segments, backlog.Duration)
+		p.backlog.OnBacklog(backlog)
+	}
+	return start
+}
+
+// downloadAndWrite 并发下载分片，并按顺序写入文件。
+func (p *Parser) downloadAndWrite(ctx context.Context, segments []Segment) error {
+	results := make([]chan segmentResult, len(segments))
+	sem := make(chan struct{}, p.workers)
+	for i, seg := range segments {
+		results[i] = make(chan segmentResult, 1)
+		go func(seg Segment, ch chan<- segmentResult) {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			data, _, err := p.fetch(ctx, seg.URL)
+			ch <- segmentResult{data, err}
+		}(seg, results[i])
+	}
+
+	for i, seg := range segments {
+		res := <-results[i]
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if res.err != nil {
+			p.logger.WithError(res.err).Warnf("下载分片 %d 失败", seg.Sequence)
+			atomic.AddUint64(&p.gaps, 1)
+			continue
+		}
+		if err := p.writeSegment(ctx, seg, res.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSegment 将分片写入文件，满足切分条件时先切分文件。
+func (p *Parser) writeSegment(ctx context.Context, seg Segment, data []byte) error {
+	if seg.Discontinuity {
+		atomic.AddUint64(&p.discontinuities, 1)
+	}
+	if reason := p.splitReason(); reason != "" {
+		if err := p.rotate(reason); err != nil {
+			return err
+		}
+	}
+
+	// fMP4 分片需要先写入初始化分片，切分后的新文件也需要重新写入
+	if seg.Map != nil && seg.Map.String() != p.out.initURL {
+		init, err := p.fetchInit(ctx, seg.Map)
+		if err != nil {
+			return err
+		}
+		if err := p.write(init); err != nil {
+			return err
+		}
+		p.out.initURL = seg.Map.String()
+	}
+
+	if err := p.write(data); err != nil {
+		return err
+	}
+	p.out.duration += seg.Duration
+	p.stats.AddDuration(seg.Duration)
+	p.out.segments++
+	p.out.lastSize = int64(len(data))
+	p.offset += seg.Duration
+	atomic.AddUint64(&p.segments, 1)
+	return nil
+}
+
+// write 写入数据并统计大小。
+func (p *Parser) write(b []byte) error {
+	n, err := p.out.file.Write(b)
+	p.out.size += int64(n)
+	p.stats.AddBytes(n)
+	atomic.AddUint64(&p.bytes, uint64(n))
+	return err
+}
+
+// fetchInit 下载 fMP4 初始化分片，同一地址只下载一次。
+func (p *Parser) fetchInit(ctx context.Context, u *url.URL) ([]byte, error) {
+	if data, ok := p.initCache[u.String()]; ok {
+		return data, nil
+	}
+	data, _, err := p.fetch(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	p.initCache[u.String()] = data
+	return data, nil
+}
+
+// fetchPlaylist 下载并解析播放列表。
+func (p *Parser) fetchPlaylist(ctx context.Context, u *url.URL) (*Playlist, error) {
+	data, base, err := p.fetch(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePlaylist(bytes.NewReader(data), base)
+}
+
+// fetch 下载地址的内容，失败时重试，返回内容和重定向后的地址。
+func (p *Parser) fetch(ctx context.Context, u *url.URL) (data []byte, final *url.URL, err error) {
+	for i := 0; i <= p.retries; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, nil, ctx.Err()
+			case <-time.After(retryInterval * time.Duration(i)):
+			}
+		}
+		if data, final, err = p.get(ctx, u); err == nil || ctx.Err() != nil {
+			return
+		}
+	}
+	return
+}
+
+// get 发送一次 GET 请求。
+func (p *Parser) get(ctx context.Context, u *url.URL) ([]byte, *url.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	if p.referer != "" {
+		req.Header.Set("Referer", p.referer)
+	}
+	resp, err := p.hc.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("请求 %s 失败，状态码：%d", u, resp.StatusCode)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, resp.Request.URL, nil
+}
@@ -0,0 +1,222 @@
+package hls
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yuhaohwang/bililive-go/src/instance"
+	"github.com/yuhaohwang/bililive-go/src/interfaces"
+	livemock "github.com/yuhaohwang/bililive-go/src/live/mock"
+	"github.com/yuhaohwang/bililive-go/src/pkg/parser"
+)
+
+// testServer 是测试用的 HLS 服务器，每次请求媒体播放列表时返回下一个版本。
+type testServer struct {
+	lock      sync.Mutex
+	playlists []string
+	requests  int
+	failures  map[string]int // 分片在成功前需要失败的次数
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	switch name := strings.TrimPrefix(r.URL.Path, "/"); {
+	case name == "master.m3u8":
+		fmt.Fprint(w, "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=100\nlow.m3u8\n#EXT-X-STREAM-INF:BANDWIDTH=200,RESOLUTION=1920x1080\nlive/index.m3u8\n")
+	case name == "live/index.m3u8":
+		i := s.requests
+		if i >= len(s.playlists) {
+			i = len(s.playlists) - 1
+		}
+		s.requests++
+		fmt.Fprint(w, s.playlists[i])
+	case s.failures[name] > 0:
+		s.failures[name]--
+		w.WriteHeader(http.StatusInternalServerError)
+	default:
+		fmt.Fprint(w, name+";")
+	}
+}
+
+// mediaPlaylist 生成目标时长为 10 毫秒的媒体播放列表。
+func mediaPlaylist(first int, lines ...string) string {
+	return fmt.Sprintf("#EXTM3U\n#EXT-X-TARGETDURATION:0.01\n#EXT-X-MEDIA-SEQUENCE:%d\n%s\n", first, strings.Join(lines, "\n"))
+}
+
+func newTestContext(t *testing.T) (context.Context, *livemock.MockLive) {
+	retryInterval = time.Millisecond
+	l := livemock.NewMockLive(gomock.NewController(t))
+	l.EXPECT().GetRawUrl().Return("https://example.com/live").AnyTimes()
+	ctx := context.WithValue(context.Background(), instance.Key, &instance.Instance{
+		Logger: &interfaces.Logger{Logger: logrus.New()},
+	})
+	return ctx, l
+}
+
+func TestParseLiveStream(t *testing.T) {
+	ts := &testServer{
+		playlists: []string{
+			mediaPlaylist(0, "#EXTINF:1,", "0.ts", "#EXTINF:1,", "1.ts", "#EXTINF:1,", "2.ts"),
+			// 与上一次有重叠
+			mediaPlaylist(1, "#EXTINF:1,", "1.ts", "#EXTINF:1,", "2.ts", "#EXTINF:1,", "3.ts"),
+			// 丢失了序列号为 4 的分片
+			mediaPlaylist(5, "#EXTINF:1,", "5.ts", "#EXTINF:1,", "6.ts", "#EXTINF:1,", "7.ts"),
+			mediaPlaylist(6, "#EXTINF:1,", "6.ts", "#EXTINF:1,", "7.ts", "#EXT-X-DISCONTINUITY", "#EXTINF:1,", "8.ts", "#EXTINF:1,", "9.ts", "#EXT-X-ENDLIST"),
+		},
+		failures: map[string]int{"live/6.ts": 2},
+	}
+	server := httptest.NewServer(ts)
+	defer server.Close()
+
+	ctx, l := newTestContext(t)
+	u, _ := url.Parse(server.URL + "/master.m3u8")
+	file := filepath.Join(t.TempDir(), "record.ts")
+	p := New(time.Second)
+	assert.NoError(t, p.ParseLiveStream(ctx, u, l, file))
+
+	// 按顺序写入，重复的分片只写入一次，下载失败的分片会重试
+	b, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "live/0.ts;live/1.ts;live/2.ts;live/3.ts;live/5.ts;live/6.ts;live/7.ts;live/8.ts;live/9.ts;", string(b))
+
+	status, err := p.Status()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"parser":          Name,
+		"segments":        "9",
+		"gaps":            "1",
+		"discontinuities": "1",
+		"bytes":           fmt.Sprint(len(b)),
+	}, status)
+
+	stats := p.Stats()
+	assert.Equal(t, file, stats.File)
+	assert.Equal(t, int64(len(b)), stats.Bytes)
+	assert.Equal(t, 9*time.Second, stats.MediaDuration)
+}
+
+func TestParseLiveStreamFMP4WithSplit(t *testing.T) {
+	ts := &testServer{
+		playlists: []string{
+			mediaPlaylist(0, `#EXT-X-MAP:URI="init.mp4"`,
+				"#EXTINF:1,", "0.m4s", "#EXTINF:1,", "1.m4s", "#EXTINF:1,", "2.m4s", "#EXT-X-ENDLIST"),
+		},
+	}
+	server := httptest.NewServer(ts)
+	defer server.Close()
+
+	ctx, l := newTestContext(t)
+	u, _ := url.Parse(server.URL + "/live/index.m3u8")
+	file := filepath.Join(t.TempDir(), "record.mp4")
+	var splits []parser.Split
+	p := New(time.Second)
+	p.SetSplitOptions(parser.SplitOptions{
+		MaxDuration: 2 * time.Second,
+		OnSplit:     func(split parser.Split) { splits = append(splits, split) },
+	})
+	assert.NoError(t, p.ParseLiveStream(ctx, u, l, file))
+
+	// 在分片边界处切分，每个文件都以初始化分片开头
+	if assert.Len(t, splits, 1) {
+		assert.Equal(t, parser.SplitReasonMaxDuration, splits[0].Reason)
+		assert.Equal(t, 2*time.Second, splits[0].Offset)
+		b, err := os.ReadFile(file)
+		assert.NoError(t, err)
+		assert.Equal(t, "live/init.mp4;live/0.m4s;live/1.m4s;", string(b))
+		b, err = os.ReadFile(splits[0].NextFile)
+		assert.NoError(t, err)
+		assert.Equal(t, "live/init.mp4;live/2.m4s;", string(b))
+	}
+}
+
+func TestParseLiveStreamStop(t *testing.T) {
+	ts := &testServer{
+		playlists: []string{mediaPlaylist(0, "#EXTINF:1,", "0.ts")},
+	}
+	server := httptest.NewServer(ts)
+	defer server.Close()
+
+	ctx, l := newTestContext(t)
+	u, _ := url.Parse(server.URL + "/live/index.m3u8")
+	p := New(time.Second)
+	done := make(chan error)
+	go func() {
+		done <- p.ParseLiveStream(ctx, u, l, filepath.Join(t.TempDir(), "record.ts"))
+	}()
+	time.Sleep(50 * time.Millisecond)
+	assert.NoError(t, p.Stop())
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("解析器未能停止")
+	}
+}
+
+func TestParseLiveStreamBacklog(t *testing.T) {
+	var lines []string
+	for i := 0; i < 10; i++ {
+		lines = append(lines, "#EXTINF:1,", fmt.Sprintf("%d.ts", i))
+	}
+	for _, c := range []struct {
+		name     string
+		opts     parser.BacklogOptions
+		first    int
+		segments int
+	}{
+		{"live edge", parser.BacklogOptions{}, 7, 0},
+		{"lookback", parser.BacklogOptions{Lookback: 5 * time.Second}, 5, 2},
+		{"oldest", parser.BacklogOptions{FromOldest: true, Lookback: 5 * time.Second}, 0, 7},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			ts := &testServer{
+				playlists: []string{
+					mediaPlaylist(0, lines...),
+					mediaPlaylist(0, append(lines, "#EXT-X-ENDLIST")...),
+				},
+			}
+			server := httptest.NewServer(ts)
+			defer server.Close()
+
+			ctx, l := newTestContext(t)
+			u, _ := url.Parse(server.URL + "/live/index.m3u8")
+			file := filepath.Join(t.TempDir(), "record.ts")
+			var backlogs []parser.Backlog
+			c.opts.OnBacklog = func(b parser.Backlog) { backlogs = append(backlogs, b) }
+			p := New(time.Second)
+			p.SetBacklogOptions(c.opts)
+			assert.NoError(t, p.ParseLiveStream(ctx, u, l, file))
+
+			// 从指定的分片开始录制，补录的内容不包含直播边缘的分片
+			var want string
+			for i := c.first; i < 10; i++ {
+				want += fmt.Sprintf("live/%d.ts;", i)
+			}
+			b, err := os.ReadFile(file)
+			assert.NoError(t, err)
+			assert.Equal(t, want, string(b))
+			if c.segments == 0 {
+				assert.Empty(t, backlogs)
+			} else {
+				assert.Equal(t, []parser.Backlog{{
+					Segments: c.segments,
+					Duration: time.Duration(c.segments) * time.Second,
+				}}, backlogs)
+			}
+		})
+	}
+}
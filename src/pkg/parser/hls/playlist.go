@@ -0,0 +1,162 @@
+package hls
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotPlaylist   = errors.New("非 m3u8 播放列表")
+	ErrEmptyPlaylist = errors.New("播放列表中没有可用的码率")
+)
+
+// Variant 是主播放列表中的一个码率。
+type Variant struct {
+	URL       *url.URL
+	Bandwidth int
+}
+
+// Segment 是媒体播放列表中的一个分片。
+type Segment struct {
+	URL           *url.URL
+	Sequence      uint64        // 媒体序列号
+	Duration      time.Duration // 分片时长
+	Discontinuity bool          // 分片前是否有 EXT-X-DISCONTINUITY
+	Map           *url.URL      // fMP4 分片的初始化分片
+}
+
+// Playlist 是解析后的播放列表，主播放列表只包含 Variants。
+type Playlist struct {
+	Variants       []Variant
+	TargetDuration time.Duration
+	MediaSequence  uint64
+	Segments       []Segment
+	EndList        bool
+}
+
+// IsMaster 返回是否为主播放列表。
+func (p *Playlist) IsMaster() bool {
+	return len(p.Variants) > 0
+}
+
+// BestVariant 返回码率最高的播放列表。
+func (p *Playlist) BestVariant() (Variant, error) {
+	if len(p.Variants) == 0 {
+		return Variant{}, ErrEmptyPlaylist
+	}
+	best := p.Variants[0]
+	for _, v := range p.Variants[1:] {
+		if v.Bandwidth > best.Bandwidth {
+			best = v
+		}
+	}
+	return best, nil
+}
+
+// ParsePlaylist 解析 m3u8 播放列表，相对地址基于 base 解析。
+func ParsePlaylist(r io.Reader, base *url.URL) (*Playlist, error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	if !s.Scan() || strings.TrimSpace(strings.TrimPrefix(s.Text(), "\ufeff")) != "#EXTM3U" {
+		return nil, ErrNotPlaylist
+	}
+
+	var (
+		pl            = new(Playlist)
+		duration      time.Duration
+		discontinuity bool
+		mapURL        *url.URL
+		bandwidth     = -1
+	)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			bandwidth, _ = strconv.Atoi(parseAttributes(line)["BANDWIDTH"])
+		case strings.HasPrefix(line, "#EXT-X-TARGETDURATION:"):
+			sec, _ := strconv.ParseFloat(strings.TrimPrefix(line, "#EXT-X-TARGETDURATION:"), 64)
+			pl.TargetDuration = time.Duration(sec * float64(time.Second))
+		case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"):
+			pl.MediaSequence, _ = strconv.ParseUint(strings.TrimPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"), 10, 64)
+		case strings.HasPrefix(line, "#EXTINF:"):
+			value := strings.TrimPrefix(line, "#EXTINF:")
+			if i := strings.IndexByte(value, ','); i >= 0 {
+				value = value[:i]
+			}
+			sec, _ := strconv.ParseFloat(value, 64)
+			duration = time.Duration(sec * float64(time.Second))
+		case line == "#EXT-X-DISCONTINUITY":
+			discontinuity = true
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			u, err := base.Parse(parseAttributes(line)["URI"])
+			if err != nil {
+				return nil, err
+			}
+			mapURL = u
+		case line == "#EXT-X-ENDLIST":
+			pl.EndList = true
+		case strings.HasPrefix(line, "#"):
+			// 忽略其他标签
+		default:
+			u, err := base.Parse(line)
+			if err != nil {
+				return nil, err
+			}
+			if bandwidth >= 0 {
+				pl.Variants = append(pl.Variants, Variant{URL: u, Bandwidth: bandwidth})
+				bandwidth = -1
+				continue
+			}
+			pl.Segments = append(pl.Segments, Segment{
+				URL:           u,
+				Sequence:      pl.MediaSequence + uint64(len(pl.Segments)),
+				Duration:      duration,
+				Discontinuity: discontinuity,
+				Map:           mapURL,
+			})
+			duration, discontinuity = 0, false
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return pl, nil
+}
+
+// parseAttributes 解析标签中的属性列表，如 BANDWIDTH=1280000,URI="init.mp4"。
+func parseAttributes(line string) map[string]string {
+	attrs := make(map[string]string)
+	if i := strings.IndexByte(line, ':'); i >= 0 {
+		line = line[i+1:]
+	}
+	for line != "" {
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.TrimSpace(line[:eq])
+		line = line[eq+1:]
+		var value string
+		if strings.HasPrefix(line, `"`) {
+			end := strings.IndexByte(line[1:], '"')
+			if end < 0 {
+				value, line = line[1:], ""
+			} else {
+				value, line = line[1:end+1], line[end+2:]
+			}
+		} else if comma := strings.IndexByte(line, ','); comma >= 0 {
+			value, line = line[:comma], line[comma:]
+		} else {
+			value, line = line, ""
+		}
+		attrs[key] = value
+		line = strings.TrimPrefix(line, ",")
+	}
+	return attrs
+}
@@ -0,0 +1,54 @@
+package hls
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePlaylist(t *testing.T) {
+	base, _ := url.Parse("https://cdn.example.com/live/index.m3u8?token=1")
+
+	// 主播放列表
+	pl, err := ParsePlaylist(strings.NewReader("#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=800000,CODECS=\"avc1.64001f,mp4a.40.2\"\nlow.m3u8\n#EXT-X-STREAM-INF:BANDWIDTH=2500000\n/high/index.m3u8\n"), base)
+	assert.NoError(t, err)
+	assert.True(t, pl.IsMaster())
+	best, err := pl.BestVariant()
+	assert.NoError(t, err)
+	assert.Equal(t, "https://cdn.example.com/high/index.m3u8", best.URL.String())
+	assert.Equal(t, 2500000, best.Bandwidth)
+
+	// 媒体播放列表
+	pl, err = ParsePlaylist(strings.NewReader(`#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:2
+#EXT-X-MEDIA-SEQUENCE:100
+#EXT-X-MAP:URI="init.mp4"
+#EXTINF:2.000,title
+100.m4s
+#EXT-X-DISCONTINUITY
+#EXTINF:1.5,
+https://other.example.com/101.m4s
+#EXT-X-ENDLIST
+`), base)
+	assert.NoError(t, err)
+	assert.False(t, pl.IsMaster())
+	assert.Equal(t, 2*time.Second, pl.TargetDuration)
+	assert.True(t, pl.EndList)
+	if assert.Len(t, pl.Segments, 2) {
+		assert.Equal(t, uint64(100), pl.Segments[0].Sequence)
+		assert.Equal(t, "https://cdn.example.com/live/100.m4s", pl.Segments[0].URL.String())
+		assert.Equal(t, "https://cdn.example.com/live/init.mp4", pl.Segments[0].Map.String())
+		assert.False(t, pl.Segments[0].Discontinuity)
+		assert.Equal(t, uint64(101), pl.Segments[1].Sequence)
+		assert.Equal(t, 1500*time.Millisecond, pl.Segments[1].Duration)
+		assert.True(t, pl.Segments[1].Discontinuity)
+	}
+
+	// 非播放列表
+	_, err = ParsePlaylist(strings.NewReader("<html>"), base)
+	assert.ErrorIs(t, err, ErrNotPlaylist)
+}
@@ -0,0 +1,77 @@
+package hls
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yuhaohwang/bililive-go/src/pkg/parser"
+)
+
+// setOutput 设置当前写入的文件。
+func (p *Parser) setOutput(f *os.File, name string) {
+	p.out = output{file: f, name: name}
+	p.stats.Reset(name)
+	if p.split.NextSplitTime != nil {
+		p.out.splitAt = p.split.NextSplitTime(now())
+	}
+}
+
+// splitReason 返回在下一个分片前切分文件的原因，不需要切分时返回空字符串。
+func (p *Parser) splitReason() string {
+	if !p.split.Enabled() || p.out.segments == 0 {
+		return ""
+	}
+	if at := p.out.splitAt; !at.IsZero() && !now().Before(at) {
+		return parser.SplitReasonClock
+	}
+	if d := p.split.MaxDuration; d > 0 && p.out.duration >= d {
+		return parser.SplitReasonMaxDuration
+	}
+	// 预计写入下一个分片后会超过大小限制时提前切分
+	if s := p.split.MaxFileSize; s > 0 && p.out.size+p.out.lastSize > s {
+		return parser.SplitReasonMaxFileSize
+	}
+	return ""
+}
+
+// rotate 结束当前文件，并将后续的分片写入新的文件。
+func (p *Parser) rotate(reason string) error {
+	next := p.nextFile()
+	f, err := os.OpenFile(next, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	split := parser.Split{
+		Reason:   reason,
+		PrevFile: p.out.name,
+		NextFile: next,
+		PrevSize: p.out.size,
+		Offset:   p.offset,
+		Time:     now(),
+	}
+	p.out.file.Close()
+	p.setOutput(f, next)
+	if p.split.OnSplit != nil {
+		p.split.OnSplit(split)
+	}
+	return nil
+}
+
+// nextFile 返回下一个文件的文件名。
+func (p *Parser) nextFile() string {
+	if p.split.NextFile != nil {
+		if next := p.split.NextFile(); next != "" && next != p.out.name {
+			return next
+		}
+	}
+	ext := filepath.Ext(p.out.name)
+	base := strings.TrimSuffix(p.out.name, ext)
+	for i := 1; ; i++ {
+		name := fmt.Sprintf("%s_%03d%s", base, i, ext)
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			return name
+		}
+	}
+}
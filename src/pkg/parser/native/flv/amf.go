@@ -0,0 +1,210 @@
+package flv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// AMF0 中的复合类型，用于在解码和重新编码时保留属性的顺序和原有的类型。
+type (
+	amfProperty struct {
+		Name  string
+		Value interface{}
+	}
+	amfObject      []amfProperty
+	amfECMAArray   []amfProperty
+	amfStrictArray []interface{}
+	amfDate        struct {
+		Ms       float64
+		TimeZone int16
+	}
+	amfUndefined struct{}
+)
+
+var errAMFUnsupported = errors.New("不支持的 AMF0 类型")
+
+// get 返回指定名称的属性值。
+func (a amfECMAArray) get(name string) (interface{}, bool) {
+	for _, p := range a {
+		if p.Name == name {
+			return p.Value, true
+		}
+	}
+	return nil, false
+}
+
+// readAMF 读取一个 AMF0 值。
+func readAMF(r *bytes.Reader) (interface{}, error) {
+	t, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch DataType(t) {
+	case Number:
+		var v float64
+		err := binary.Read(r, binary.BigEndian, &v)
+		return v, err
+	case Boolean:
+		b, err := r.ReadByte()
+		return b != 0, err
+	case String:
+		return readAMFString(r, 2)
+	case LongString:
+		return readAMFString(r, 4)
+	case Object:
+		props, err := readAMFProperties(r)
+		return amfObject(props), err
+	case ECMAArray:
+		// 元素个数只是参考值，以结束标记为准
+		if _, err := r.Seek(4, io.SeekCurrent); err != nil {
+			return nil, err
+		}
+		props, err := readAMFProperties(r)
+		return amfECMAArray(props), err
+	case StrictArray:
+		var n uint32
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return nil, err
+		}
+		if int64(n) > int64(r.Len()) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		arr := make(amfStrictArray, 0, n)
+		for i := uint32(0); i < n; i++ {
+			v, err := readAMF(r)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, nil
+	case Date:
+		var d amfDate
+		if err := binary.Read(r, binary.BigEndian, &d.Ms); err != nil {
+			return nil, err
+		}
+		err := binary.Read(r, binary.BigEndian, &d.TimeZone)
+		return d, err
+	case Null:
+		return nil, nil
+	case Undefined:
+		return amfUndefined{}, nil
+	default:
+		return nil, fmt.Errorf("%w: %d", errAMFUnsupported, t)
+	}
+}
+
+// readAMFString 读取长度占 n 个字节的字符串。
+func readAMFString(r *bytes.Reader, n int) (string, error) {
+	b := make([]byte, 4)
+	if _, err := io.ReadFull(r, b[4-n:]); err != nil {
+		return "", err
+	}
+	size := binary.BigEndian.Uint32(b)
+	if int64(size) > int64(r.Len()) {
+		return "", io.ErrUnexpectedEOF
+	}
+	s := make([]byte, size)
+	_, err := io.ReadFull(r, s)
+	return string(s), err
+}
+
+// readAMFProperties 读取对象的属性，直到结束标记。
+func readAMFProperties(r *bytes.Reader) ([]amfProperty, error) {
+	var props []amfProperty
+	for {
+		name, err := readAMFString(r, 2)
+		if err != nil {
+			return nil, err
+		}
+		if name == "" {
+			t, err := r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if DataType(t) == ObjectEndMarker {
+				return props, nil
+			}
+			r.UnreadByte()
+		}
+		v, err := readAMF(r)
+		if err != nil {
+			return nil, err
+		}
+		props = append(props, amfProperty{name, v})
+	}
+}
+
+// writeAMF 写入一个 AMF0 值，整数按 Number 类型写入。
+func writeAMF(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case float64:
+		buf.WriteByte(byte(Number))
+		binary.Write(buf, binary.BigEndian, v)
+	case int:
+		return writeAMF(buf, float64(v))
+	case int64:
+		return writeAMF(buf, float64(v))
+	case uint32:
+		return writeAMF(buf, float64(v))
+	case bool:
+		buf.WriteByte(byte(Boolean))
+		if v {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+	case string:
+		if len(v) > math.MaxUint16 {
+			buf.WriteByte(byte(LongString))
+			binary.Write(buf, binary.BigEndian, uint32(len(v)))
+		} else {
+			buf.WriteByte(byte(String))
+			binary.Write(buf, binary.BigEndian, uint16(len(v)))
+		}
+		buf.WriteString(v)
+	case amfObject:
+		buf.WriteByte(byte(Object))
+		return writeAMFProperties(buf, v)
+	case amfECMAArray:
+		buf.WriteByte(byte(ECMAArray))
+		binary.Write(buf, binary.BigEndian, uint32(len(v)))
+		return writeAMFProperties(buf, v)
+	case amfStrictArray:
+		buf.WriteByte(byte(StrictArray))
+		binary.Write(buf, binary.BigEndian, uint32(len(v)))
+		for _, e := range v {
+			if err := writeAMF(buf, e); err != nil {
+				return err
+			}
+		}
+	case amfDate:
+		buf.WriteByte(byte(Date))
+		binary.Write(buf, binary.BigEndian, v.Ms)
+		binary.Write(buf, binary.BigEndian, v.TimeZone)
+	case nil:
+		buf.WriteByte(byte(Null))
+	case amfUndefined:
+		buf.WriteByte(byte(Undefined))
+	default:
+		return fmt.Errorf("%w: %T", errAMFUnsupported, v)
+	}
+	return nil
+}
+
+// writeAMFProperties 写入对象的属性和结束标记。
+func writeAMFProperties(buf *bytes.Buffer, props []amfProperty) error {
+	for _, p := range props {
+		binary.Write(buf, binary.BigEndian, uint16(len(p.Name)))
+		buf.WriteString(p.Name)
+		if err := writeAMF(buf, p.Value); err != nil {
+			return err
+		}
+	}
+	buf.Write([]byte{0, 0, byte(ObjectEndMarker)})
+	return nil
+}
@@ -12,9 +12,12 @@ import (
 	"os"
 	"runtime/debug"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/yuhaohwang/bililive-go/src/instance"
 	"github.com/yuhaohwang/bililive-go/src/live"
+	"github.com/yuhaohwang/bililive-go/src/pkg/counter"
 	"github.com/yuhaohwang/bililive-go/src/pkg/parser"
 	"github.com/yuhaohwang/bililive-go/src/pkg/reader"
 	"github.com/yuhaohwang/bililive-go/src/pkg/utils"
@@ -48,12 +51,17 @@ func (b *builder) Build(cfg map[string]string) (parser.Parser, error) {
 	// if err != nil {
 	// 	timeout = time.Minute
 	// }
+	return New(), nil
+}
+
+// New 创建一个新的 FLV 解析器。
+func New() *Parser {
 	return &Parser{
 		Metadata:  Metadata{},
 		hc:        &http.Client{},
 		stopCh:    make(chan struct{}),
 		closeOnce: new(sync.Once),
-	}, nil
+	}
 }
 
 type Metadata struct {
@@ -68,15 +76,33 @@ type Parser struct {
 	avcHeaderCount uint8
 	tagCount       uint32
 
+	split    parser.SplitOptions
+	out      output
+	seqTags  seqTags
+	hasVideo bool
+	started  bool                // 是否已写入过音视频标签
+	first    uint32              // 第一个音视频标签的时间戳
+	stats    parser.StatsTracker // 当前文件的写入统计
+
 	hc        *http.Client
+	counter   atomic.Value // 输入流的 counter.Counter
 	stopCh    chan struct{}
 	closeOnce *sync.Once
 }
 
 // ParseLiveStream 解析直播流
 func (p *Parser) ParseLiveStream(ctx context.Context, url *url.URL, live live.Live, file string) error {
-	// 初始化输入流
-	req, err := http.NewRequest("GET", url.String(), nil)
+	// 初始化输入流，停止解析时中断读取，避免 CDN 不再发送数据时一直阻塞
+	reqCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-p.stopCh:
+			cancel()
+		case <-reqCtx.Done():
+		}
+	}()
+	req, err := http.NewRequestWithContext(reqCtx, "GET", url.String(), nil)
 	if err != nil {
 		return err
 	}
@@ -86,7 +112,16 @@ func (p *Parser) ParseLiveStream(ctx context.Context, url *url.URL, live live.Li
 		return err
 	}
 	defer resp.Body.Close()
-	p.i = reader.New(resp.Body)
+
+	return p.ParseStream(ctx, resp.Body, file)
+}
+
+// ParseStream 从 r 中读取 FLV 数据并写入文件，配置了切分条件时会在关键帧处切分文件。
+func (p *Parser) ParseStream(ctx context.Context, r io.Reader, file string) error {
+	// 初始化输入流
+	cr := counter.NewCountReader(r)
+	p.counter.Store(counter.Counter(cr))
+	p.i = reader.New(cr)
 	defer p.i.Free()
 
 	// 初始化输出流
@@ -94,11 +129,32 @@ func (p *Parser) ParseLiveStream(ctx context.Context, url *url.URL, live live.Li
 	if err != nil {
 		return err
 	}
-	p.o = f
-	defer f.Close()
+	p.setOutput(f, file)
+	defer func() { p.out.file.Close() }()
 
-	// 开始解析
-	return p.doParse(ctx)
+	// 开始解析，停止解析导致的读取错误不视为失败
+	if err := p.doParse(ctx); err != nil && !p.isStopped() {
+		return err
+	}
+	return nil
+}
+
+// Count 返回已从直播流中读取的字节数，用于检测直播流是否停滞。
+func (p *Parser) Count() uint {
+	if c, ok := p.counter.Load().(counter.Counter); ok {
+		return c.Count()
+	}
+	return 0
+}
+
+// Progress 返回当前文件中最后写入的标签的时间戳。
+func (p *Parser) Progress() time.Duration {
+	return p.stats.Duration()
+}
+
+// Stats 返回当前文件的写入统计，帧率和码率根据视频标签数和时间戳计算。
+func (p *Parser) Stats() parser.Stats {
+	return p.stats.Stats(Name)
 }
 
 // Stop 停止解析
@@ -109,6 +165,16 @@ func (p *Parser) Stop() error {
 	return nil
 }
 
+// isStopped 返回解析器是否已被停止。
+func (p *Parser) isStopped() bool {
+	select {
+	case <-p.stopCh:
+		return true
+	default:
+		return false
+	}
+}
+
 // doParse 执行解析
 func (p *Parser) doParse(ctx context.Context) error {
 	// 解析FLV文件头
@@ -129,7 +195,8 @@ func (p *Parser) doParse(ctx context.Context) error {
 		return ErrNotFlvStream
 	}
 
-	// 写入FLV文件头
+	// 写入FLV文件头，切分文件时新文件使用同样的文件头
+	p.out.header = append([]byte(nil), p.i.AllBytes()...)
 	if err := p.doWrite(ctx, p.i.AllBytes()); err != nil {
 		return err
 	}
@@ -139,7 +206,7 @@ func (p *Parser) doParse(ctx context.Context) error {
 	for {
 		select {
 		case <-p.stopCh:
-			return nil
+			return p.writeTrailer(ctx)
 		default:
 			if err := p.parseTag(ctx); err != nil {
 				return err
@@ -150,7 +217,10 @@ func (p *Parser) doParse(ctx context.Context) error {
 
 // doCopy 复制数据
 func (p *Parser) doCopy(ctx context.Context, n uint32) error {
-	if writtenCount, err := io.CopyN(p.o, p.i, int64(n)); err != nil || writtenCount != int64(writtenCount) {
+	writtenCount, err := io.CopyN(p.o, p.i, int64(n))
+	p.out.size += writtenCount
+	p.stats.AddBytes(int(writtenCount))
+	if err != nil || writtenCount != int64(n) {
 		utils.PrintStack(ctx)
 		if err == nil {
 			err = fmt.Errorf("doCopy(%d), %d 字节已写入", n, writtenCount)
@@ -168,6 +238,8 @@ func (p *Parser) doWrite(ctx context.Context, b []byte) error {
 	for retryLeft := ioRetryCount; retryLeft > 0 && leftInputSize > 0; retryLeft-- {
 		writtenCount, err := p.o.Write(b[len(b)-leftInputSize:])
 		leftInputSize -= writtenCount
+		p.out.size += int64(writtenCount)
+		p.stats.AddBytes(writtenCount)
 		if err != nil {
 			logger.Debugf(string(debug.Stack()))
 			return err
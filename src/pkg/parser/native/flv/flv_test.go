@@ -0,0 +1,43 @@
+package flv
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	livemock "github.com/yuhaohwang/bililive-go/src/live/mock"
+)
+
+func TestParseLiveStreamStopWhenStalled(t *testing.T) {
+	// 服务器发送部分数据后不再发送，也不关闭连接
+	stream, _ := buildStream(1, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(stream)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	u, _ := url.Parse(server.URL + "/live.flv")
+	p := New()
+	done := make(chan error)
+	go func() {
+		done <- p.ParseLiveStream(newTestContext(), u, livemock.NewMockLive(gomock.NewController(t)), filepath.Join(t.TempDir(), "record.flv"))
+	}()
+	assert.Eventually(t, func() bool { return p.Count() == uint(len(stream)) }, time.Second, 10*time.Millisecond)
+
+	// 停止解析器时中断阻塞的读取
+	assert.NoError(t, p.Stop())
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("解析器未能停止")
+	}
+}
@@ -0,0 +1,396 @@
+package flv
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/yuhaohwang/bililive-go/src/consts"
+)
+
+const (
+	headerSize = 9 // 文件头的长度
+
+	// maxTimestampGap 是同一路音频或视频相邻两帧之间允许的最大时间戳间隔，单位为毫秒，超过时视为时间戳跳变。
+	maxTimestampGap = 5000
+)
+
+// ErrNoMediaTag 表示文件中没有可用的音视频标签。
+var ErrNoMediaTag = errors.New("没有可用的音视频标签")
+
+// metadataKeys 是重新生成的 onMetaData 属性，原有的同名属性会被替换。
+var metadataKeys = map[string]bool{
+	"duration": true, "filesize": true, "hasVideo": true, "hasAudio": true, "hasKeyframes": true,
+	"hasMetadata": true, "canSeekToEnd": true, "lasttimestamp": true, "lastkeyframetimestamp": true,
+	"lastkeyframelocation": true, "videosize": true, "audiosize": true, "datasize": true,
+	"metadatacreator": true, "keyframes": true,
+}
+
+// InjectResult 是写入元数据的结果。
+type InjectResult struct {
+	Duration        time.Duration // 时长
+	Size            int64         // 输出文件的大小
+	Keyframes       int           // 关键帧数量
+	DroppedTags     int           // 丢弃的损坏标签数量
+	Discontinuities int           // 修正的时间戳跳变次数
+}
+
+// InjectMetadata 读取 FLV 文件 in，写入带有时长、文件大小和关键帧索引的 onMetaData 后输出到 out，使其可以拖动播放。
+// 同时将时间戳修正为从 0 开始、单调递增，并丢弃损坏的标签，in 和 out 不能是同一个文件。
+func InjectMetadata(in, out string) (*InjectResult, error) {
+	f, err := os.Open(in)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	inj := &injector{f: f, size: stat.Size()}
+
+	// 1. 第一遍读取统计关键帧的位置和时间戳。
+	if err := inj.walk(inj.scan); err != nil {
+		return nil, err
+	}
+	if !inj.hasVideo && !inj.hasAudio {
+		return nil, ErrNoMediaTag
+	}
+
+	// 2. 生成 onMetaData，数值都以固定长度写入，先确定其长度再计算关键帧在输出文件中的位置。
+	body, err := inj.metadata(0)
+	if err != nil {
+		return nil, err
+	}
+	start := int64(headerSize + prevSizeLen + tagHeaderSize + len(body) + prevSizeLen)
+	if body, err = inj.metadata(start); err != nil {
+		return nil, err
+	}
+
+	// 3. 第二遍读取写入输出文件。
+	o, err := os.Create(out)
+	if err != nil {
+		return nil, err
+	}
+	defer o.Close()
+	w := bufio.NewWriterSize(o, 1024*1024)
+	var flags byte
+	if inj.hasVideo {
+		flags |= 0x01
+	}
+	if inj.hasAudio {
+		flags |= 0x04
+	}
+	w.Write(append(append([]byte(nil), flvSign...), flags, 0, 0, 0, headerSize, 0, 0, 0, 0))
+	if err := writeFLVTag(w, scriptTag, 0, body); err != nil {
+		return nil, err
+	}
+	if err := inj.walk(func(h, body []byte) error {
+		return writeFLVTag(w, h[0], getTimestamp(h), body)
+	}); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	if err := o.Close(); err != nil {
+		return nil, err
+	}
+	return &InjectResult{
+		Duration:        time.Duration(inj.lastTs) * time.Millisecond,
+		Size:            start + inj.dataSize,
+		Keyframes:       len(inj.times),
+		DroppedTags:     inj.dropped,
+		Discontinuities: inj.jumps,
+	}, nil
+}
+
+// writeFLVTag 写入一个标签及其 PreviousTagSize。
+func writeFLVTag(w io.Writer, typ uint8, ts uint32, body []byte) error {
+	h := make([]byte, tagHeaderSize)
+	h[0] = typ
+	h[1], h[2], h[3] = byte(len(body)>>16), byte(len(body)>>8), byte(len(body))
+	setTimestamp(h, ts)
+	if _, err := w.Write(h); err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.BigEndian, uint32(tagHeaderSize+len(body)))
+}
+
+// injector 记录第一遍读取时统计的信息。
+type injector struct {
+	f    *os.File
+	size int64
+
+	meta      amfECMAArray // 原有的 onMetaData 属性
+	hasVideo  bool
+	hasAudio  bool
+	times     []float64 // 关键帧的时间戳，单位为秒
+	positions []int64   // 关键帧相对于第一个音视频标签的位置
+	lastTs    uint32
+	lastKeyTs uint32
+	videoSize int64
+	audioSize int64
+	dataSize  int64 // 所有标签及其 PreviousTagSize 的总长度
+	dropped   int
+	jumps     int
+}
+
+// scan 统计一个标签的信息。
+func (inj *injector) scan(h, body []byte) error {
+	ts := getTimestamp(h)
+	if ts > inj.lastTs {
+		inj.lastTs = ts
+	}
+	switch h[0] {
+	case videoTag:
+		inj.hasVideo = true
+		inj.videoSize += int64(tagHeaderSize + len(body))
+		if FrameType(body[0]>>4&0x07) == KeyFrame && !isVideoSeqHeader(body) {
+			inj.times = append(inj.times, float64(ts)/1000)
+			inj.positions = append(inj.positions, inj.dataSize)
+			inj.lastKeyTs = ts
+		}
+	case audioTag:
+		inj.hasAudio = true
+		inj.audioSize += int64(tagHeaderSize + len(body))
+	}
+	inj.dataSize += int64(tagHeaderSize + len(body) + prevSizeLen)
+	return nil
+}
+
+// metadata 生成 onMetaData 脚本标签的内容，start 为第一个音视频标签在输出文件中的位置。
+func (inj *injector) metadata(start int64) ([]byte, error) {
+	var (
+		positions = make(amfStrictArray, len(inj.positions))
+		times     = make(amfStrictArray, len(inj.times))
+		lastPos   int64
+	)
+	for i := range inj.positions {
+		positions[i] = start + inj.positions[i]
+		times[i] = inj.times[i]
+		lastPos = start + inj.positions[i]
+	}
+	meta := amfECMAArray{
+		{"duration", float64(inj.lastTs) / 1000},
+		{"filesize", start + inj.dataSize},
+		{"hasVideo", inj.hasVideo},
+		{"hasAudio", inj.hasAudio},
+		{"hasKeyframes", len(times) > 0},
+		{"hasMetadata", true},
+		{"canSeekToEnd", len(times) > 0 && inj.lastKeyTs == inj.lastTs},
+		{"lasttimestamp", float64(inj.lastTs) / 1000},
+		{"lastkeyframetimestamp", float64(inj.lastKeyTs) / 1000},
+		{"lastkeyframelocation", lastPos},
+		{"videosize", inj.videoSize},
+		{"audiosize", inj.audioSize},
+		{"datasize", inj.videoSize + inj.audioSize},
+		{"metadatacreator", consts.AppName},
+	}
+	for _, p := range inj.meta {
+		if !metadataKeys[p.Name] {
+			meta = append(meta, p)
+		}
+	}
+	meta = append(meta, amfProperty{"keyframes", amfObject{
+		{"times", times},
+		{"filepositions", positions},
+	}})
+
+	buf := new(bytes.Buffer)
+	if err := writeAMF(buf, "onMetaData"); err != nil {
+		return nil, err
+	}
+	if err := writeAMF(buf, meta); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// walk 依次读取文件中的标签，丢弃损坏的标签和原有的 onMetaData，修正时间戳后交给 fn 处理。
+// 每次读取的结果都相同，第一遍和第二遍读取得到的标签一致。
+func (inj *injector) walk(fn func(h, body []byte) error) error {
+	// 1. 读取文件头。
+	if _, err := inj.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReaderSize(inj.f, 1024*1024)
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil || !bytes.Equal(header[:3], flvSign[:3]) {
+		return ErrNotFlvStream
+	}
+	pos := int64(binary.BigEndian.Uint32(header[5:])) + prevSizeLen
+	if _, err := r.Discard(int(pos) - len(header)); err != nil {
+		return ErrNotFlvStream
+	}
+
+	ts := newTimestamps()
+	inj.dropped, inj.jumps = 0, 0
+	h := make([]byte, tagHeaderSize)
+	for pos+tagHeaderSize <= inj.size {
+		// 2. 遇到损坏的标签时，向后查找下一个完整的标签。
+		if _, err := io.ReadFull(r, h); err != nil {
+			return err
+		}
+		size := int64(getDataSize(h))
+		if !isTagHeader(h) || pos+tagHeaderSize+size > inj.size {
+			inj.dropped++
+			if pos = inj.resync(pos + 1); pos < 0 {
+				break
+			}
+			if _, err := inj.f.Seek(pos, io.SeekStart); err != nil {
+				return err
+			}
+			r.Reset(inj.f)
+			continue
+		}
+		body := make([]byte, size)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return err
+		}
+		n, _ := r.Discard(prevSizeLen)
+		pos += tagHeaderSize + size + int64(n)
+
+		// 3. 丢弃空的音视频标签，原有的 onMetaData 只保留其属性。
+		switch h[0] {
+		case audioTag, videoTag:
+			if size == 0 {
+				inj.dropped++
+				continue
+			}
+		case scriptTag:
+			if meta, ok := parseOnMetaData(body); ok {
+				if inj.meta == nil {
+					inj.meta = meta
+				}
+				continue
+			}
+		}
+
+		// 4. 修正时间戳。
+		tag := append([]byte(nil), h...)
+		t, jumped := ts.fix(h[0], getTimestamp(h))
+		if jumped {
+			inj.jumps++
+		}
+		setTimestamp(tag, t)
+		if err := fn(tag, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resync 从 from 开始查找下一个完整的标签，返回其位置，找不到时返回 -1。
+// 候选标签的 PreviousTagSize 必须与其长度一致，或者正好位于文件末尾。
+func (inj *injector) resync(from int64) int64 {
+	r := bufio.NewReaderSize(io.NewSectionReader(inj.f, from, inj.size-from), 64*1024)
+	h := make([]byte, tagHeaderSize)
+	prev := make([]byte, prevSizeLen)
+	for pos := from; pos+tagHeaderSize <= inj.size; pos++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return -1
+		}
+		if b != audioTag && b != videoTag && b != scriptTag {
+			continue
+		}
+		if _, err := inj.f.ReadAt(h, pos); err != nil || !isTagHeader(h) {
+			continue
+		}
+		end := pos + tagHeaderSize + int64(getDataSize(h))
+		if end == inj.size {
+			return pos
+		}
+		if _, err := inj.f.ReadAt(prev, end); err == nil && binary.BigEndian.Uint32(prev) == uint32(end-pos) {
+			return pos
+		}
+	}
+	return -1
+}
+
+// isTagHeader 返回标签头的类型和 StreamID 是否有效。
+func isTagHeader(h []byte) bool {
+	return (h[0] == audioTag || h[0] == videoTag || h[0] == scriptTag) && h[8] == 0 && h[9] == 0 && h[10] == 0
+}
+
+// isVideoSeqHeader 返回视频标签是否为序列头。
+func isVideoSeqHeader(body []byte) bool {
+	if body[0]&0x80 != 0 {
+		// Enhanced RTMP 扩展，低 4 位为包类型
+		return body[0]&0x0f == 0
+	}
+	id := CodeID(body[0] & 0x0f)
+	return (id == AVCCode || id == HEVCCode) && len(body) > 1 && AVCPacketType(body[1]) == AVCSeqHeader
+}
+
+// parseOnMetaData 解析 onMetaData 脚本标签的属性，不是 onMetaData 时返回 false。
+// 属性无法解析时仍然返回 true，丢弃原有的属性。
+func parseOnMetaData(body []byte) (amfECMAArray, bool) {
+	r := bytes.NewReader(body)
+	if name, err := readAMF(r); err != nil || name != "onMetaData" {
+		return nil, false
+	}
+	switch v, _ := readAMF(r); v := v.(type) {
+	case amfECMAArray:
+		return v, true
+	case amfObject:
+		return amfECMAArray(v), true
+	}
+	return amfECMAArray{}, true
+}
+
+// timestamps 将时间戳修正为从第一个音视频标签开始、每一路单调递增，并消除时间戳跳变。
+type timestamps struct {
+	started bool
+	offset  int64           // 加到原时间戳上的偏移
+	last    map[uint8]int64 // 每一路最后一帧修正后的时间戳
+	delta   map[uint8]int64 // 每一路最近一次的帧间隔
+	max     int64
+}
+
+func newTimestamps() *timestamps {
+	return &timestamps{last: make(map[uint8]int64), delta: make(map[uint8]int64)}
+}
+
+// fix 返回修正后的时间戳，以及是否修正了时间戳跳变。脚本标签使用当前最大的时间戳。
+func (t *timestamps) fix(typ uint8, ts uint32) (uint32, bool) {
+	if typ == scriptTag {
+		return uint32(t.max), false
+	}
+	if !t.started {
+		t.started = true
+		t.offset = -int64(ts)
+	}
+	out := int64(ts) + t.offset
+	jumped := false
+	if last, ok := t.last[typ]; ok {
+		if out < last || out > last+maxTimestampGap {
+			// 时间戳回退或跳变，从上一帧之后一个帧间隔继续
+			delta := t.delta[typ]
+			if delta <= 0 {
+				delta = 1
+			}
+			t.offset += last + delta - out
+			out = last + delta
+			jumped = true
+		} else if out > last {
+			t.delta[typ] = out - last
+		}
+	}
+	if out < 0 {
+		out = 0
+	}
+	t.last[typ] = out
+	if out > t.max {
+		t.max = out
+	}
+	return uint32(out), jumped
+}
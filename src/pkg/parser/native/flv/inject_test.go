@@ -0,0 +1,102 @@
+package flv
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInjectMetadata(t *testing.T) {
+	// 1. 原有的 onMetaData 没有时长，第 16 帧之后时间戳跳变，中间有空的音频标签和损坏的数据，最后一个标签不完整。
+	meta := new(bytes.Buffer)
+	writeAMF(meta, "onMetaData")
+	writeAMF(meta, amfECMAArray{{"duration", 0}, {"width", 1280}, {"encoder", "obs"}})
+	tags := []testTag{
+		{scriptTag, 0, meta.Bytes()},
+		{videoTag, 1000, []byte{0x17, 0x00, 0, 0, 0, 1, 2, 3}},
+		{audioTag, 1000, []byte{0xaf, 0x00, 0x12, 0x10}},
+	}
+	var garbageAt int
+	for i := 0; i < 30; i++ {
+		ts := 1000 + uint32(i*100)
+		if i > 15 {
+			ts += 60000
+		}
+		frame := byte(0x27)
+		if i%10 == 0 {
+			frame = 0x17
+		}
+		tags = append(tags,
+			testTag{videoTag, ts, append([]byte{frame, 0x01, 0, 0, 0}, make([]byte, 200)...)},
+			testTag{audioTag, ts, append([]byte{0xaf, 0x01}, make([]byte, 20)...)},
+		)
+		if i == 5 {
+			tags = append(tags, testTag{audioTag, ts, nil})
+		}
+		if i == 20 {
+			garbageAt = len(encodeTags(tags)) + prevSizeLen
+		}
+	}
+	stream := encodeTags(tags)
+	stream = append(stream[:garbageAt], append(bytes.Repeat([]byte{0xff}, 7), stream[garbageAt:]...)...)
+	stream = stream[:len(stream)-3]
+
+	dir := t.TempDir()
+	in, out := filepath.Join(dir, "in.flv"), filepath.Join(dir, "out.flv")
+	assert.NoError(t, os.WriteFile(in, stream, 0644))
+	result, err := InjectMetadata(in, out)
+	assert.NoError(t, err)
+	assert.Equal(t, &InjectResult{
+		Duration:        2900 * time.Millisecond,
+		Size:            result.Size,
+		Keyframes:       3,
+		DroppedTags:     3,
+		Discontinuities: 1,
+	}, result)
+
+	// 2. 时间戳从 0 开始连续递增，丢弃了损坏的标签。
+	b, err := os.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(b)), result.Size)
+	got := readTags(t, out)
+	assert.Len(t, got, 1+2+30*2-1)
+	assert.Equal(t, scriptTag, got[0].typ)
+	for i, tag := range got[3:] {
+		assert.Equal(t, uint32(i/2*100), tag.ts)
+	}
+
+	// 3. onMetaData 包含时长、文件大小和关键帧索引，保留原有的其他属性。
+	props, ok := parseOnMetaData(got[0].body)
+	assert.True(t, ok)
+	get := func(name string) interface{} {
+		v, _ := props.get(name)
+		return v
+	}
+	assert.Equal(t, 2.9, get("duration"))
+	assert.Equal(t, float64(len(b)), get("filesize"))
+	assert.Equal(t, float64(1280), get("width"))
+	assert.Equal(t, "obs", get("encoder"))
+	assert.Equal(t, true, get("hasKeyframes"))
+	keyframes, ok := get("keyframes").(amfObject)
+	if assert.True(t, ok) {
+		index := amfECMAArray(keyframes)
+		times, _ := index.get("times")
+		positions, _ := index.get("filepositions")
+		assert.Equal(t, amfStrictArray{0.0, 1.0, 2.0}, times)
+		for i, pos := range positions.(amfStrictArray) {
+			h := b[int(pos.(float64)):]
+			assert.Equal(t, videoTag, h[0])
+			assert.Equal(t, byte(0x17), h[tagHeaderSize])
+			assert.Equal(t, uint32(i*1000), getTimestamp(h))
+		}
+	}
+
+	// 4. 不是 FLV 文件时返回错误。
+	assert.NoError(t, os.WriteFile(in, []byte("not a flv file"), 0644))
+	_, err = InjectMetadata(in, out)
+	assert.ErrorIs(t, err, ErrNotFlvStream)
+}
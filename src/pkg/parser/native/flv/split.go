@@ -0,0 +1,249 @@
+package flv
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yuhaohwang/bililive-go/src/pkg/parser"
+)
+
+// 用于测试的变量
+var now = time.Now
+
+const (
+	tagHeaderSize = 11 // 标签头的长度
+	prevSizeLen   = 4  // PreviousTagSize 的长度
+)
+
+// output 记录当前写入的文件的状态。
+type output struct {
+	file     *os.File
+	name     string
+	header   []byte    // FLV 文件头
+	size     int64     // 已写入的字节数
+	index    int       // 文件序号，从 0 开始
+	lastTag  uint32    // 上一个写入的标签的长度，用于生成 PreviousTagSize
+	hasTag   bool      // 是否已写入过音视频标签
+	start    uint32    // 文件第一个标签在直播流中的时间戳
+	offset   uint32    // 写入文件时需要减去的时间戳偏移
+	gopStart int64     // 当前 GOP 开始时的文件大小
+	lastGop  int64     // 上一个 GOP 的大小
+	splitAt  time.Time // 下一个按时钟对齐的切分时间
+}
+
+// seqTags 缓存的脚本标签和序列头，切分文件时会写入新文件的开头，保证每个文件都可以单独播放。
+type seqTags struct {
+	script, video, audio []byte
+}
+
+// SetSplitOptions 设置切分文件的条件。
+func (p *Parser) SetSplitOptions(opts parser.SplitOptions) {
+	p.split = opts
+}
+
+// setOutput 设置当前写入的文件。
+func (p *Parser) setOutput(f *os.File, name string) {
+	p.o = f
+	p.out.file = f
+	p.out.name = name
+	p.out.size = 0
+	p.stats.Reset(name)
+	p.out.lastTag = 0
+	p.out.hasTag = false
+	p.out.gopStart = 0
+	p.out.splitAt = time.Time{}
+	if p.split.NextSplitTime != nil {
+		p.out.splitAt = p.split.NextSplitTime(now())
+	}
+}
+
+// writeTag 在写入音视频标签前检查是否需要切分文件，然后写入标签头。
+// b 为 PreviousTagSize、标签头以及已读取的标签数据，canSplit 表示该标签能否作为新文件的第一个标签。
+func (p *Parser) writeTag(ctx context.Context, b []byte, canSplit bool) error {
+	ts := getTimestamp(b[prevSizeLen:])
+	if canSplit {
+		if p.out.hasTag {
+			p.out.lastGop = p.out.size - p.out.gopStart
+		}
+		if reason := p.splitReason(ts); reason != "" {
+			if err := p.rotate(ctx, reason, ts); err != nil {
+				return err
+			}
+		}
+		p.out.gopStart = p.out.size
+	}
+	if !p.out.hasTag {
+		p.out.hasTag = true
+		p.out.start = ts
+	}
+	if !p.started {
+		p.started = true
+		p.first = ts
+	}
+	return p.writeTagHeader(ctx, b)
+}
+
+// writeSeqTag 写入脚本标签或序列头，并缓存完整的标签用于切分后的新文件。
+func (p *Parser) writeSeqTag(ctx context.Context, b []byte, n uint32, cache *[]byte) error {
+	if err := p.writeTagHeader(ctx, b); err != nil {
+		return err
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(p.i, body); err != nil {
+		return err
+	}
+	if err := p.doWrite(ctx, body); err != nil {
+		return err
+	}
+	tag := make([]byte, 0, len(b)-prevSizeLen+len(body))
+	tag = append(tag, b[prevSizeLen:]...)
+	*cache = append(tag, body...)
+	return nil
+}
+
+// writeTagHeader 改写 PreviousTagSize 和时间戳后写入标签头。
+func (p *Parser) writeTagHeader(ctx context.Context, b []byte) error {
+	binary.BigEndian.PutUint32(b, p.out.lastTag)
+	ts := p.rebase(getTimestamp(b[prevSizeLen:]))
+	setTimestamp(b[prevSizeLen:], ts)
+	p.stats.SetDuration(time.Duration(ts) * time.Millisecond)
+	p.out.lastTag = tagHeaderSize + getDataSize(b[prevSizeLen:])
+	return p.doWrite(ctx, b)
+}
+
+// splitReason 返回在时间戳为 ts 的关键帧处切分文件的原因，不需要切分时返回空字符串。
+func (p *Parser) splitReason(ts uint32) string {
+	if !p.split.Enabled() || !p.out.hasTag {
+		return ""
+	}
+	if at := p.out.splitAt; !at.IsZero() && !now().Before(at) {
+		return parser.SplitReasonClock
+	}
+	if d := p.split.MaxDuration; d > 0 && ts >= p.out.start &&
+		time.Duration(ts-p.out.start)*time.Millisecond >= d {
+		return parser.SplitReasonMaxDuration
+	}
+	// 预计写入下一个 GOP 后会超过大小限制时提前切分，尽量保证文件不超过限制
+	if s := p.split.MaxFileSize; s > 0 && p.out.size+p.out.lastGop >= s {
+		return parser.SplitReasonMaxFileSize
+	}
+	return ""
+}
+
+// rotate 结束当前文件，并将后续的标签写入新的文件。
+func (p *Parser) rotate(ctx context.Context, reason string, ts uint32) error {
+	// 1. 创建新文件。
+	next := p.nextFile()
+	f, err := os.OpenFile(next, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	// 2. 结束当前文件。
+	split := parser.Split{
+		Reason:   reason,
+		PrevFile: p.out.name,
+		NextFile: next,
+		Offset:   time.Duration(p.rebaseFirst(ts)) * time.Millisecond,
+		Time:     time.Now(),
+	}
+	if err := p.writeTrailer(ctx); err != nil {
+		f.Close()
+		return err
+	}
+	split.PrevSize = p.out.size
+	p.out.file.Close()
+
+	// 3. 写入文件头、脚本标签和序列头，时间戳从 0 开始。
+	p.setOutput(f, next)
+	p.out.index++
+	p.out.offset = ts
+	if err := p.doWrite(ctx, p.out.header); err != nil {
+		return err
+	}
+	for _, tag := range [][]byte{p.seqTags.script, p.seqTags.video, p.seqTags.audio} {
+		if tag == nil {
+			continue
+		}
+		b := make([]byte, prevSizeLen, prevSizeLen+len(tag))
+		binary.BigEndian.PutUint32(b, p.out.lastTag)
+		b = append(b, tag...)
+		setTimestamp(b[prevSizeLen:], 0)
+		if err := p.doWrite(ctx, b); err != nil {
+			return err
+		}
+		p.out.lastTag = uint32(len(tag))
+	}
+
+	// 4. 通知切分完成。
+	if p.split.OnSplit != nil {
+		p.split.OnSplit(split)
+	}
+	return nil
+}
+
+// writeTrailer 写入最后一个标签的 PreviousTagSize。
+func (p *Parser) writeTrailer(ctx context.Context) error {
+	if p.out.lastTag == 0 {
+		return nil
+	}
+	b := make([]byte, prevSizeLen)
+	binary.BigEndian.PutUint32(b, p.out.lastTag)
+	p.out.lastTag = 0
+	return p.doWrite(ctx, b)
+}
+
+// nextFile 返回下一个文件的文件名。
+func (p *Parser) nextFile() string {
+	if p.split.NextFile != nil {
+		if next := p.split.NextFile(); next != "" && next != p.out.name {
+			return next
+		}
+	}
+	ext := filepath.Ext(p.out.name)
+	base := strings.TrimSuffix(p.out.name, ext)
+	if p.out.index > 0 {
+		base = strings.TrimSuffix(base, fmt.Sprintf("_%03d", p.out.index))
+	}
+	return fmt.Sprintf("%s_%03d%s", base, p.out.index+1, ext)
+}
+
+// rebase 返回写入当前文件时使用的时间戳。
+func (p *Parser) rebase(ts uint32) uint32 {
+	if ts < p.out.offset {
+		return 0
+	}
+	return ts - p.out.offset
+}
+
+// rebaseFirst 返回相对于第一个音视频标签的时间戳。
+func (p *Parser) rebaseFirst(ts uint32) uint32 {
+	if ts < p.first {
+		return 0
+	}
+	return ts - p.first
+}
+
+// getTimestamp 返回标签头中的时间戳。
+func getTimestamp(h []byte) uint32 {
+	return uint32(h[4])<<16 | uint32(h[5])<<8 | uint32(h[6]) | uint32(h[7])<<24
+}
+
+// setTimestamp 设置标签头中的时间戳。
+func setTimestamp(h []byte, ts uint32) {
+	h[4] = byte(ts >> 16)
+	h[5] = byte(ts >> 8)
+	h[6] = byte(ts)
+	h[7] = byte(ts >> 24)
+}
+
+// getDataSize 返回标签头中的数据长度。
+func getDataSize(h []byte) uint32 {
+	return uint32(h[1])<<16 | uint32(h[2])<<8 | uint32(h[3])
+}
@@ -0,0 +1,201 @@
+package flv
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yuhaohwang/bililive-go/src/instance"
+	"github.com/yuhaohwang/bililive-go/src/interfaces"
+	"github.com/yuhaohwang/bililive-go/src/pkg/parser"
+)
+
+// testTag 是测试用的 FLV 标签。
+type testTag struct {
+	typ  uint8
+	ts   uint32
+	body []byte
+}
+
+// buildStream 生成一段 FLV 直播流：脚本标签、序列头，以及每 100 毫秒一帧的音视频数据，每秒一个关键帧。
+func buildStream(seconds int, startTs uint32) (stream []byte, mediaTags int) {
+	tags := []testTag{
+		{scriptTag, 0, []byte("onMetaData")},
+		{videoTag, 0, []byte{0x17, 0x00, 0, 0, 0, 1, 2, 3}},
+		{audioTag, 0, []byte{0xaf, 0x00, 0x12, 0x10}},
+	}
+	for i := 0; i < seconds*10; i++ {
+		ts := startTs + uint32(i*100)
+		frame := byte(0x27)
+		if i%10 == 0 {
+			frame = 0x17
+		}
+		tags = append(tags,
+			testTag{videoTag, ts, append([]byte{frame, 0x01, 0, 0, 0}, bytes.Repeat([]byte{byte(i)}, 200)...)},
+			testTag{audioTag, ts, append([]byte{0xaf, 0x01}, bytes.Repeat([]byte{byte(i)}, 20)...)},
+		)
+		mediaTags += 2
+	}
+	return encodeTags(tags), mediaTags
+}
+
+// encodeTags 将标签编码为 FLV 数据，最后一个标签之后没有 PreviousTagSize。
+func encodeTags(tags []testTag) []byte {
+	buf := bytes.NewBuffer([]byte{'F', 'L', 'V', 0x01, 0x05, 0, 0, 0, 9})
+	prev := uint32(0)
+	for _, tag := range tags {
+		b := make([]byte, prevSizeLen+tagHeaderSize)
+		binary.BigEndian.PutUint32(b, prev)
+		b[4] = tag.typ
+		b[5], b[6], b[7] = byte(len(tag.body)>>16), byte(len(tag.body)>>8), byte(len(tag.body))
+		setTimestamp(b[prevSizeLen:], tag.ts)
+		buf.Write(b)
+		buf.Write(tag.body)
+		prev = uint32(tagHeaderSize + len(tag.body))
+	}
+	return buf.Bytes()
+}
+
+// readTags 读取 FLV 文件中的所有标签，并校验文件头和 PreviousTagSize。
+func readTags(t *testing.T, file string) []testTag {
+	b, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{'F', 'L', 'V', 0x01, 0x05, 0, 0, 0, 9}, b[:9])
+	b = b[9:]
+
+	var (
+		tags []testTag
+		prev uint32
+	)
+	for len(b) >= prevSizeLen+tagHeaderSize {
+		assert.Equal(t, prev, binary.BigEndian.Uint32(b))
+		h := b[prevSizeLen:]
+		size := getDataSize(h)
+		tags = append(tags, testTag{h[0], getTimestamp(h), h[tagHeaderSize : tagHeaderSize+size]})
+		prev = tagHeaderSize + size
+		b = b[prevSizeLen+tagHeaderSize+int(size):]
+	}
+	return tags
+}
+
+func newTestContext() context.Context {
+	return context.WithValue(context.Background(), instance.Key, &instance.Instance{
+		Logger: &interfaces.Logger{Logger: logrus.New()},
+	})
+}
+
+func TestParseStreamSplitByDuration(t *testing.T) {
+	stream, mediaTags := buildStream(5, 10000)
+	file := filepath.Join(t.TempDir(), "record.flv")
+
+	var splits []parser.Split
+	p := New()
+	p.SetSplitOptions(parser.SplitOptions{
+		MaxDuration: 2 * time.Second,
+		OnSplit:     func(split parser.Split) { splits = append(splits, split) },
+	})
+	assert.ErrorIs(t, p.ParseStream(newTestContext(), bytes.NewReader(stream), file), io.EOF)
+
+	// 在第 2 秒和第 4 秒的关键帧处切分
+	if assert.Len(t, splits, 2) {
+		assert.Equal(t, parser.SplitReasonMaxDuration, splits[0].Reason)
+		assert.Equal(t, file, splits[0].PrevFile)
+		assert.Equal(t, 2*time.Second, splits[0].Offset)
+		assert.Equal(t, 4*time.Second, splits[1].Offset)
+		assert.Equal(t, splits[0].NextFile, splits[1].PrevFile)
+	}
+
+	// 每个文件都以脚本标签、序列头和时间戳为 0 的关键帧开始，且没有丢失任何标签
+	total := 0
+	for _, f := range []string{file, splits[0].NextFile, splits[1].NextFile} {
+		tags := readTags(t, f)
+		assert.Equal(t, scriptTag, tags[0].typ)
+		assert.Equal(t, []byte{0x17, 0x00, 0, 0, 0, 1, 2, 3}, tags[1].body)
+		assert.Equal(t, []byte{0xaf, 0x00, 0x12, 0x10}, tags[2].body)
+		assert.Equal(t, byte(0x17), tags[3].body[0])
+		if f != file {
+			assert.Equal(t, uint32(0), tags[3].ts)
+		}
+		total += len(tags) - 3
+	}
+	assert.Equal(t, mediaTags, total)
+
+	// 写入统计只包含最后一个文件
+	info, err := os.Stat(splits[1].NextFile)
+	assert.NoError(t, err)
+	stats := p.Stats()
+	assert.Equal(t, splits[1].NextFile, stats.File)
+	assert.Equal(t, info.Size(), stats.Bytes)
+	assert.Equal(t, uint64(10), stats.Frames)
+	assert.Equal(t, 900*time.Millisecond, stats.MediaDuration)
+	assert.InDelta(t, 10/0.9, stats.FPS, 0.01)
+}
+
+func TestParseStreamSplitBySize(t *testing.T) {
+	stream, mediaTags := buildStream(10, 0)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "record.flv")
+
+	var files []string
+	p := New()
+	p.SetSplitOptions(parser.SplitOptions{
+		MaxFileSize: 8 * 1024,
+		NextFile: func() string {
+			return filepath.Join(dir, time.Now().Format("150405.000000")+".flv")
+		},
+		OnSplit: func(split parser.Split) {
+			assert.Equal(t, parser.SplitReasonMaxFileSize, split.Reason)
+			files = append(files, split.NextFile)
+		},
+	})
+	assert.ErrorIs(t, p.ParseStream(newTestContext(), bytes.NewReader(stream), file), io.EOF)
+	assert.NotEmpty(t, files)
+
+	// 除最后一个文件外，文件大小不超过限制
+	total := 0
+	for i, f := range append([]string{file}, files...) {
+		if i < len(files) {
+			stat, err := os.Stat(f)
+			assert.NoError(t, err)
+			assert.LessOrEqual(t, stat.Size(), int64(8*1024))
+		}
+		total += len(readTags(t, f)) - 3
+	}
+	assert.Equal(t, mediaTags, total)
+}
+
+func TestParseStreamSplitByClock(t *testing.T) {
+	stream, mediaTags := buildStream(3, 0)
+	file := filepath.Join(t.TempDir(), "record.flv")
+
+	// 第一个文件的对齐时间已经到达，之后的对齐时间还很远
+	calls := 0
+	var splits []parser.Split
+	p := New()
+	p.SetSplitOptions(parser.SplitOptions{
+		NextSplitTime: func(t time.Time) time.Time {
+			calls++
+			if calls == 1 {
+				return t
+			}
+			return t.Add(time.Hour)
+		},
+		OnSplit: func(split parser.Split) { splits = append(splits, split) },
+	})
+	assert.ErrorIs(t, p.ParseStream(newTestContext(), bytes.NewReader(stream), file), io.EOF)
+
+	// 在第一个文件写入数据后的第一个关键帧处切分
+	if assert.Len(t, splits, 1) {
+		assert.Equal(t, parser.SplitReasonClock, splits[0].Reason)
+		assert.Equal(t, time.Second, splits[0].Offset)
+		assert.Equal(t, mediaTags, len(readTags(t, file))-3+len(readTags(t, splits[0].NextFile))-3)
+	}
+}
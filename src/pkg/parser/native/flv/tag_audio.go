@@ -70,8 +70,14 @@ func (p *Parser) parseAudioTag(ctx context.Context, length, timestamp uint32) (*
 		tag.AACPacketType = AACPacketType(b)
 	}
 
-	// 写入标签头 && 音频标签头 && AACPacketType
-	if err := p.doWrite(ctx, p.i.AllBytes()); err != nil {
+	// AAC序列头需要缓存，切分文件时写入新文件
+	if tag.SoundFormat == AAC && tag.AACPacketType == AACSeqHeader {
+		defer p.i.Reset()
+		return tag, p.writeSeqTag(ctx, p.i.AllBytes(), l, &p.seqTags.audio)
+	}
+
+	// 写入标签头 && 音频标签头 && AACPacketType，没有视频时可以在任意音频帧处切分文件
+	if err := p.writeTag(ctx, p.i.AllBytes(), !p.hasVideo); err != nil {
 		return nil, err
 	}
 	p.i.Reset()
@@ -21,14 +21,7 @@ const (
 
 func (p *Parser) parseScriptTag(ctx context.Context, length uint32) error {
 	// TODO: 解析脚本标签内容
-	// 写入标签头
-	if err := p.doWrite(ctx, p.i.AllBytes()); err != nil {
-		return err
-	}
-	p.i.Reset()
-	// 写入内容
-	if err := p.doCopy(ctx, length); err != nil {
-		return err
-	}
-	return nil
+	// 写入标签头和内容，并缓存用于切分后的新文件
+	defer p.i.Reset()
+	return p.writeSeqTag(ctx, p.i.AllBytes(), length, &p.seqTags.script)
 }
@@ -27,12 +27,13 @@ const (
 	VideoInfoFrame       FrameType = 5 // 视频信息/命令帧
 
 	// 编码标识
-	H263Code          CodeID = 2 // Sorenson H.263
-	ScreenVideoCode   CodeID = 3 // 屏幕视频
-	VP6Code           CodeID = 4 // On2 VP6
-	VP6AlphaCode      CodeID = 5 // 带Alpha通道的On2 VP6
-	ScreenVideoV2Code CodeID = 6 // 屏幕视频版本2
-	AVCCode           CodeID = 7 // AVC
+	H263Code          CodeID = 2  // Sorenson H.263
+	ScreenVideoCode   CodeID = 3  // 屏幕视频
+	VP6Code           CodeID = 4  // On2 VP6
+	VP6AlphaCode      CodeID = 5  // 带Alpha通道的On2 VP6
+	ScreenVideoV2Code CodeID = 6  // 屏幕视频版本2
+	AVCCode           CodeID = 7  // AVC
+	HEVCCode          CodeID = 12 // HEVC，国内平台使用的非标准扩展
 
 	// AVC包类型
 	AVCSeqHeader AVCPacketType = 0 // AVC序列头
@@ -50,8 +51,9 @@ func (p *Parser) parseVideoTag(ctx context.Context, length, timestamp uint32) (*
 	tag := new(VideoTagHeader)
 	tag.FrameType = FrameType(b >> 4 & 15)
 	tag.CodeID = CodeID(b & 15)
+	p.hasVideo = true
 
-	if tag.CodeID == AVCCode {
+	if tag.CodeID == AVCCode || tag.CodeID == HEVCCode {
 		// 读取AVCPacketType
 		b, err := p.i.ReadByte()
 		l -= 1
@@ -77,8 +79,15 @@ func (p *Parser) parseVideoTag(ctx context.Context, length, timestamp uint32) (*
 		}
 	}
 
-	// 写入标签头、视频标签头、AVCPacketType和CompositionTime
-	if err := p.doWrite(ctx, p.i.AllBytes()); err != nil {
+	// 序列头需要缓存，切分文件时写入新文件
+	hasPacketType := tag.CodeID == AVCCode || tag.CodeID == HEVCCode
+	if hasPacketType && tag.AVCPacketType == AVCSeqHeader {
+		defer p.i.Reset()
+		return tag, p.writeSeqTag(ctx, p.i.AllBytes(), l, &p.seqTags.video)
+	}
+
+	// 写入标签头、视频标签头、AVCPacketType和CompositionTime，只在关键帧处切分文件
+	if err := p.writeTag(ctx, p.i.AllBytes(), tag.FrameType == KeyFrame); err != nil {
 		return nil, err
 	}
 	p.i.Reset()
@@ -86,6 +95,7 @@ func (p *Parser) parseVideoTag(ctx context.Context, length, timestamp uint32) (*
 	if err := p.doCopy(ctx, l); err != nil {
 		return nil, err
 	}
+	p.stats.AddFrame()
 
 	return tag, nil
 }
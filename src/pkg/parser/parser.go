@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"net/url"
+	"time"
 
 	"github.com/yuhaohwang/bililive-go/src/live"
 )
@@ -26,6 +27,69 @@ type StatusParser interface {
 	Status() (map[string]string, error)
 }
 
+// ProgressParser 扩展了Parser接口，返回当前文件已写入的时长。
+type ProgressParser interface {
+	Parser
+	Progress() time.Duration
+}
+
+// SplitOptions 描述在关键帧处无缝切分录制文件的条件。
+type SplitOptions struct {
+	MaxDuration time.Duration // 单个文件的最大时长
+	MaxFileSize int64         // 单个文件的最大字节数
+	// NextSplitTime 返回 t 之后下一个按时钟对齐的切分时间，返回零值表示不再切分
+	NextSplitTime func(t time.Time) time.Time
+	NextFile      func() string     // 返回下一个文件的文件名
+	OnSplit       func(split Split) // 每次切分完成后调用
+}
+
+// Enabled 返回是否配置了切分条件。
+func (o SplitOptions) Enabled() bool {
+	return o.MaxDuration > 0 || o.MaxFileSize > 0 || o.NextSplitTime != nil
+}
+
+// 切分原因
+const (
+	SplitReasonMaxDuration = "max_duration"
+	SplitReasonMaxFileSize = "max_file_size"
+	SplitReasonClock       = "clock_aligned"
+)
+
+// Split 描述一次无缝切分。
+type Split struct {
+	Reason   string        // 切分原因
+	PrevFile string        // 切分前的文件
+	NextFile string        // 切分后的文件
+	PrevSize int64         // 切分前的文件大小
+	Offset   time.Duration // 切分点相对于本次录制开始的时间
+	Time     time.Time     // 切分的时间
+}
+
+// SplitParser 扩展了Parser接口，支持在不中断录制的情况下切分录制文件。
+type SplitParser interface {
+	Parser
+	SetSplitOptions(opts SplitOptions)
+}
+
+// BacklogOptions 描述从直播回看窗口中较早的分片开始录制的方式。
+type BacklogOptions struct {
+	FromOldest bool                  // 从最早的可用分片开始录制
+	Lookback   time.Duration         // 从最新分片往前回看的时长
+	OnBacklog  func(backlog Backlog) // 确定补录的内容后调用
+}
+
+// Backlog 描述录制开始时从回看窗口中补录的内容。
+type Backlog struct {
+	Segments int           // 补录的分片数
+	Duration time.Duration // 补录的时长
+}
+
+// BacklogParser 扩展了Parser接口，支持从直播回看窗口中补录开播时错过的内容。
+type BacklogParser interface {
+	Parser
+	SetBacklogOptions(opts BacklogOptions)
+}
+
 var m = make(map[string]Builder)
 
 // Register 用于注册解析器构建器。
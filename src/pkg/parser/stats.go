@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats 是解析器统计的当前文件的写入状态。
+type Stats struct {
+	Parser        string        // 解析器名称
+	File          string        // 当前写入的文件
+	Bytes         int64         // 当前文件已写入的字节数
+	Frames        uint64        // 当前文件已写入的视频帧数，无法统计时为 0
+	MediaDuration time.Duration // 当前文件已写入的媒体时长
+	BitrateKbps   float64       // 码率，解析器没有实时统计时为当前文件的平均码率
+	FPS           float64       // 帧率，解析器没有实时统计时为当前文件的平均帧率
+}
+
+// StatsParser 扩展了Parser接口，返回当前文件的写入状态。
+type StatsParser interface {
+	Parser
+	Stats() Stats
+}
+
+// StatsTracker 记录当前文件的写入统计，由写入文件的协程更新，其他协程可以并发读取。
+type StatsTracker struct {
+	file     atomic.Value // 当前写入的文件
+	bytes    int64
+	frames   uint64
+	duration int64 // 媒体时长，单位为纳秒
+}
+
+// Reset 开始统计新的文件。
+func (t *StatsTracker) Reset(file string) {
+	t.file.Store(file)
+	atomic.StoreInt64(&t.bytes, 0)
+	atomic.StoreUint64(&t.frames, 0)
+	atomic.StoreInt64(&t.duration, 0)
+}
+
+// AddBytes 记录写入的字节数。
+func (t *StatsTracker) AddBytes(n int) {
+	atomic.AddInt64(&t.bytes, int64(n))
+}
+
+// AddFrame 记录写入了一个视频帧。
+func (t *StatsTracker) AddFrame() {
+	atomic.AddUint64(&t.frames, 1)
+}
+
+// AddDuration 增加已写入的媒体时长。
+func (t *StatsTracker) AddDuration(d time.Duration) {
+	atomic.AddInt64(&t.duration, int64(d))
+}
+
+// SetDuration 设置已写入的媒体时长。
+func (t *StatsTracker) SetDuration(d time.Duration) {
+	atomic.StoreInt64(&t.duration, int64(d))
+}
+
+// Duration 返回已写入的媒体时长。
+func (t *StatsTracker) Duration() time.Duration {
+	return time.Duration(atomic.LoadInt64(&t.duration))
+}
+
+// Stats 返回当前文件的写入统计，码率和帧率为整个文件的平均值。
+func (t *StatsTracker) Stats(name string) Stats {
+	file, _ := t.file.Load().(string)
+	s := Stats{
+		Parser:        name,
+		File:          file,
+		Bytes:         atomic.LoadInt64(&t.bytes),
+		Frames:        atomic.LoadUint64(&t.frames),
+		MediaDuration: t.Duration(),
+	}
+	if seconds := s.MediaDuration.Seconds(); seconds > 0 {
+		s.BitrateKbps = float64(s.Bytes) * 8 / 1000 / seconds
+		s.FPS = float64(s.Frames) / seconds
+	}
+	return s
+}
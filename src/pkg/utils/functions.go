@@ -2,6 +2,7 @@ package utils
 
 import (
 	"text/template"
+	"time"
 
 	"github.com/Masterminds/sprig"
 	"github.com/yuhaohwang/bililive-go/src/configs"
@@ -20,6 +21,10 @@ func getFunctionList(config *configs.Config) map[string]interface{} {
 		"replaceIllegalChar": ReplaceIllegalChar,
 		"unescapeHTMLEntity": UnescapeHTMLEntity,
 		"filenameFilter":     NewStringFilterChain(filenameFilters...).Do,
+		// alignedNow 返回最近一个按时钟对齐的切分时间（使用配置的时区），未配置对齐切分时返回当前时间
+		"alignedNow": func() time.Time {
+			return config.VideoSplitStrategies.LastAlignedTime(time.Now())
+		},
 	}
 }
 
@@ -0,0 +1,127 @@
+package postprocessors
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/yuhaohwang/bililive-go/src/configs"
+	"github.com/yuhaohwang/bililive-go/src/pkg/integrity"
+	"github.com/yuhaohwang/bililive-go/src/pkg/metadata"
+)
+
+// ClipDir 是截取的片段所在的目录，位于源录制文件所在的目录下。
+const ClipDir = "clips"
+
+// ClipSteps 返回从录制文件中截取片段的处理步骤。
+func ClipSteps(startMs, endMs int64, format string, precise bool) []configs.PostProcessStep {
+	return []configs.PostProcessStep{{
+		Name: StepClip,
+		Args: map[string]string{
+			"start_ms": strconv.FormatInt(startMs, 10),
+			"end_ms":   strconv.FormatInt(endMs, 10),
+			"format":   format,
+			"precise":  strconv.FormatBool(precise),
+		},
+	}}
+}
+
+// clipFileName 返回片段的文件名。
+func clipFileName(file string, startMs, endMs int64, format string) string {
+	dir, base := filepath.Split(trimExt(file))
+	return filepath.Join(dir, ClipDir, fmt.Sprintf("%s.clip_%d-%d.%s", base, startMs, endMs, format))
+}
+
+// formatSeconds 将毫秒数转换为 FFmpeg 时间参数使用的秒数。
+func formatSeconds(ms int64) string {
+	return strconv.FormatFloat(float64(ms)/1000, 'f', 3, 64)
+}
+
+// clip 从录制文件中截取片段，保存到 clips 目录并写入片段的元数据。
+// 默认不重新编码，从起点之前最近的关键帧开始截取；precise 为 true 时重新编码以精确截取。
+func clip(ctx context.Context, job *Job, args map[string]string) error {
+	// 1. 解析参数。
+	startMs, err := strconv.ParseInt(args["start_ms"], 10, 64)
+	if err != nil || startMs < 0 {
+		return fmt.Errorf("片段起点无效: %s", args["start_ms"])
+	}
+	endMs, err := strconv.ParseInt(args["end_ms"], 10, 64)
+	if err != nil || endMs <= startMs {
+		return fmt.Errorf("片段终点无效: %s", args["end_ms"])
+	}
+	format := stringArg(args, "format", strings.TrimPrefix(filepath.Ext(job.File), "."))
+	if strings.ContainsAny(format, `./\`) {
+		return fmt.Errorf("不支持的封装格式: %s", format)
+	}
+	precise := boolArg(args, "precise")
+
+	// 2. 截取片段。
+	out := clipFileName(job.File, startMs, endMs, format)
+	if err := os.MkdirAll(filepath.Dir(out), os.ModePerm); err != nil {
+		return err
+	}
+	ffArgs := []string{"-ss", formatSeconds(startMs), "-i", job.File, "-t", formatSeconds(endMs - startMs), "-map", "0"}
+	if precise {
+		ffArgs = append(ffArgs, "-c:v", "libx264", "-preset", "veryfast", "-crf", "18", "-c:a", "aac")
+	} else {
+		ffArgs = append(ffArgs, "-c", "copy")
+	}
+	tmp := out + tmpExt
+	ffArgs = append(ffArgs, "-avoid_negative_ts", "make_zero", "-f", muxerName(format), tmp)
+	if err := runFFmpeg(ctx, ffArgs...); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, out); err != nil {
+		return err
+	}
+
+	// 3. 写入片段的元数据。
+	if err := saveClipMetadata(job.File, out, startMs, endMs, precise); err != nil {
+		return err
+	}
+	job.File = out
+	return nil
+}
+
+// saveClipMetadata 以源录制文件的元数据为基础写入片段的元数据，去掉只与源文件有关的字段。
+func saveClipMetadata(source, out string, startMs, endMs int64, precise bool) error {
+	path := metadata.PathOf(out)
+	if b, err := os.ReadFile(metadata.PathOf(source)); err == nil {
+		if err := os.WriteFile(path, b, 0644); err != nil {
+			return err
+		}
+	}
+	rel, err := filepath.Rel(filepath.Dir(out), source)
+	if err != nil {
+		return err
+	}
+	fields := map[string]interface{}{
+		"recording":        false,
+		"pinned":           nil,
+		"split":            nil,
+		"backlog":          nil,
+		"stall":            nil,
+		"copies":           nil,
+		"copy_of":          nil,
+		"selected_copy":    nil,
+		"session":          nil,
+		"concat_of":        nil,
+		"integrity":        nil,
+		"integrity_report": nil,
+		"clip_of":          metadata.Clip{File: filepath.ToSlash(rel), StartMs: startMs, EndMs: endMs, Precise: precise},
+	}
+	if md, err := metadata.Read(metadata.PathOf(source)); err == nil && md.StartTimeUnix > 0 {
+		fields["start_time_unix"] = md.StartTimeUnix + startMs/1000
+		fields["end_time_unix"] = md.StartTimeUnix + endMs/1000
+	}
+	// 只有 FLV 和 TS 格式的片段可以检查完整性
+	if report, err := integrity.Verify(out); err == nil {
+		fields["integrity"] = report.Integrity
+		fields["integrity_report"] = report
+	}
+	return metadata.Update(path, fields)
+}
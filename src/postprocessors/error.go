@@ -0,0 +1,17 @@
+package postprocessors
+
+import "errors"
+
+var (
+	// ErrQueueFull 表示处理队列已满。
+	ErrQueueFull = errors.New("post process queue is full")
+
+	// ErrJobNotExist 表示处理任务不存在。
+	ErrJobNotExist = errors.New("job is not exist")
+
+	// ErrUnknownStep 表示未注册的处理步骤。
+	ErrUnknownStep = errors.New("unknown post process step")
+)
+
+// errInterrupted 表示任务因管理器关闭而中断，将在下次启动时恢复。
+var errInterrupted = errors.New("post process job is interrupted")
@@ -0,0 +1,6 @@
+package postprocessors
+
+import "github.com/yuhaohwang/bililive-go/src/pkg/events"
+
+// JobFinished 是一个事件类型，表示处理任务已结束（成功或失败）。
+const JobFinished events.EventType = "JobFinished"
@@ -0,0 +1,94 @@
+package postprocessors
+
+import (
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/yuhaohwang/bililive-go/src/configs"
+	"github.com/yuhaohwang/bililive-go/src/live"
+)
+
+// JobStatus 表示处理任务或步骤的状态。
+type JobStatus string
+
+const (
+	JobPending   JobStatus = "pending"   // 等待处理
+	JobRunning   JobStatus = "running"   // 正在处理
+	JobSucceeded JobStatus = "succeeded" // 处理成功
+	JobFailed    JobStatus = "failed"    // 处理失败
+	JobSkipped   JobStatus = "skipped"   // 不满足执行条件，步骤被跳过
+)
+
+// StepState 记录单个处理步骤的执行情况。
+type StepState struct {
+	Name     string            `json:"name"`            // 步骤名称
+	Args     map[string]string `json:"args,omitempty"`  // 步骤参数
+	Status   JobStatus         `json:"status"`          // 步骤状态
+	Attempts int               `json:"attempts"`        // 已尝试次数
+	Error    string            `json:"error,omitempty"` // 最后一次错误信息
+}
+
+// Job 表示一个录制完成后的处理任务。
+type Job struct {
+	ID          string      `json:"id"`                    // 任务唯一标识
+	LiveId      live.ID     `json:"live_id"`               // 直播唯一标识
+	LiveUrl     string      `json:"live_url"`              // 直播原始 URL
+	HostName    string      `json:"host_name"`             // 主播名
+	RoomName    string      `json:"room_name"`             // 房间名
+	SourceFile  string      `json:"source_file"`           // 录制得到的原始文件
+	File        string      `json:"file"`                  // 当前处理的文件，步骤可能会修改它
+	Integrity   string      `json:"integrity,omitempty"`   // 录制文件的完整性检查结果
+	Status      JobStatus   `json:"status"`                // 任务状态
+	Steps       []StepState `json:"steps"`                 // 处理步骤
+	CurrentStep int         `json:"current_step"`          // 当前步骤下标
+	Error       string      `json:"error,omitempty"`       // 失败原因
+	CreatedAt   time.Time   `json:"created_at"`            // 创建时间
+	StartedAt   time.Time   `json:"started_at,omitempty"`  // 开始处理时间
+	FinishedAt  time.Time   `json:"finished_at,omitempty"` // 结束处理时间
+	Info        *live.Info  `json:"-"`                     // 直播信息，用于渲染模板
+}
+
+// NewJob 根据录制文件和处理步骤创建一个新的任务。
+func NewJob(info *live.Info, file string, steps []configs.PostProcessStep) *Job {
+	id, _ := uuid.NewV4()
+	// 直播信息会随刷新而变化，保存录制结束时的副本
+	infoCopy := *info
+	info = &infoCopy
+	job := &Job{
+		ID:         id.String(),
+		HostName:   info.HostName,
+		RoomName:   info.RoomName,
+		SourceFile: file,
+		File:       file,
+		Status:     JobPending,
+		Steps:      make([]StepState, len(steps)),
+		CreatedAt:  time.Now(),
+		Info:       info,
+	}
+	if info.Live != nil {
+		job.LiveId = info.Live.GetLiveId()
+		job.LiveUrl = info.Live.GetRawUrl()
+	}
+	for i, step := range steps {
+		job.Steps[i] = StepState{
+			Name:   step.Name,
+			Args:   step.Args,
+			Status: JobPending,
+		}
+	}
+	return job
+}
+
+// isFinished 返回任务是否已经结束。
+func (j *Job) isFinished() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed
+}
+
+// snapshot 返回任务的副本，调用方需持有读锁。
+func (j *Job) snapshot() *Job {
+	job := *j
+	job.Steps = make([]StepState, len(j.Steps))
+	copy(job.Steps, j.Steps)
+	return &job
+}
@@ -0,0 +1,65 @@
+package postprocessors
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// journalFileName 是任务日志在输出目录中的文件名。
+const journalFileName = ".post_process_jobs.json"
+
+// journal 将未完成的任务记录到磁盘，用于在程序重启后恢复任务。
+type journal struct {
+	lock sync.Mutex
+	path string
+}
+
+// newJournal 创建一个任务日志。
+func newJournal(path string) *journal {
+	return &journal{path: path}
+}
+
+// load 读取任务日志中记录的任务，文件不存在时返回空列表。
+func (j *journal) load() ([]*Job, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	b, err := os.ReadFile(j.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var jobs []*Job
+	if err := json.Unmarshal(b, &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// save 将任务写入任务日志，先写入临时文件再替换，避免写入中断导致日志损坏。
+func (j *journal) save(jobs []*Job) error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if len(jobs) == 0 {
+		if err := os.Remove(j.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	b, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(j.path), os.ModePerm); err != nil {
+		return err
+	}
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.path)
+}
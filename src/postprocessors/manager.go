@@ -0,0 +1,497 @@
+package postprocessors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/yuhaohwang/bililive-go/src/configs"
+	"github.com/yuhaohwang/bililive-go/src/instance"
+	"github.com/yuhaohwang/bililive-go/src/interfaces"
+	"github.com/yuhaohwang/bililive-go/src/live"
+	"github.com/yuhaohwang/bililive-go/src/pkg/events"
+	"github.com/yuhaohwang/bililive-go/src/pkg/metadata"
+)
+
+// maxHistory 是保留的已结束任务数量。
+const maxHistory = 200
+
+// 管理器的状态
+const (
+	begin uint32 = iota
+	running
+	stopped
+)
+
+// 用于测试的变量
+var (
+	queueSize     = 1024 // 任务队列的长度
+	retryInterval = 10 * time.Second
+	drainInterval = time.Second
+)
+
+// Manager 定义了录制后处理管理器的接口。
+type Manager interface {
+	interfaces.Module
+	Submit(ctx context.Context, info *live.Info, file string) (*Job, error)
+	SubmitSteps(ctx context.Context, info *live.Info, file string, steps []configs.PostProcessStep) (*Job, error)
+	GetJobs(ctx context.Context) []*Job
+	GetJob(ctx context.Context, id string) (*Job, error)
+	Drain(ctx context.Context) error
+}
+
+// NewManager 创建一个新的录制后处理管理器。
+func NewManager(ctx context.Context) Manager {
+	inst := instance.GetInstance(ctx)
+	m := &manager{
+		cfg:    inst.Config,
+		logger: inst.Logger,
+		jobs:   make(map[string]*Job),
+		queue:  make(chan *Job, queueSize),
+		stop:   make(chan struct{}),
+		state:  begin,
+	}
+	m.journal = newJournal(filepath.Join(inst.Config.OutPutPath, journalFileName))
+	inst.PostProcessorManager = m
+	return m
+}
+
+// manager 是 Manager 接口的实现。
+type manager struct {
+	lock   sync.RWMutex
+	cfg    *configs.Config
+	logger *interfaces.Logger
+	jobs   map[string]*Job
+	queue  chan *Job
+
+	journal     *journal
+	persistLock sync.Mutex // 保证任务日志按快照的先后顺序写入
+
+	state   uint32
+	stop    chan struct{}
+	workers sync.WaitGroup
+}
+
+// Start 恢复上次未完成的任务，并启动处理任务的工作协程。
+func (m *manager) Start(ctx context.Context) error {
+	if !atomic.CompareAndSwapUint32(&m.state, begin, running) {
+		return nil
+	}
+	if err := m.resume(ctx); err != nil {
+		m.logger.WithError(err).Error("恢复录制后处理任务失败")
+	}
+	workers := m.cfg.PostProcess.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	m.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go m.work(ctx)
+	}
+	return nil
+}
+
+// Close 停止所有工作协程，正在执行的步骤会被取消，并在下次启动时重新执行。
+func (m *manager) Close(ctx context.Context) {
+	if !atomic.CompareAndSwapUint32(&m.state, running, stopped) {
+		return
+	}
+	close(m.stop)
+	m.workers.Wait()
+}
+
+// Drain 等待所有未结束的任务完成，用于退出前完成录制后处理。
+// ctx 结束时返回 ctx 的错误，未完成的任务保留在任务日志中，下次启动时继续执行。
+func (m *manager) Drain(ctx context.Context) error {
+	ticker := time.NewTicker(drainInterval)
+	defer ticker.Stop()
+	for m.unfinished() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// unfinished 返回未结束的任务数量。
+func (m *manager) unfinished() int {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	n := 0
+	for _, job := range m.jobs {
+		if !job.isFinished() {
+			n++
+		}
+	}
+	return n
+}
+
+// Submit 为录制完成的文件创建处理任务并加入队列。
+// 未配置任何处理步骤时返回 nil。
+func (m *manager) Submit(ctx context.Context, info *live.Info, file string) (*Job, error) {
+	// 1. 获取直播间生效的处理步骤。
+	url := ""
+	if info.Live != nil {
+		url = info.Live.GetRawUrl()
+	}
+	steps := m.cfg.GetPostProcessSteps(url)
+	md, _ := metadata.Read(metadata.PathOf(file))
+	// 冗余录制的文件总是先选出最佳副本，除非处理步骤中已经指定了选择的时机
+	if md != nil && len(md.Copies) > 0 && !hasStep(steps, StepSelectCopy) {
+		steps = append([]configs.PostProcessStep{{Name: StepSelectCopy}}, steps...)
+	}
+	if len(steps) == 0 {
+		return nil, nil
+	}
+
+	// 2. 创建任务并加入队列。
+	return m.submit(ctx, info, file, steps, md)
+}
+
+// SubmitSteps 使用指定的处理步骤为文件创建处理任务并加入队列，用于截取片段等手动发起的任务。
+func (m *manager) SubmitSteps(ctx context.Context, info *live.Info, file string, steps []configs.PostProcessStep) (*Job, error) {
+	md, _ := metadata.Read(metadata.PathOf(file))
+	return m.submit(ctx, info, file, steps, md)
+}
+
+// submit 创建任务并加入队列，录制文件的完整性检查结果决定哪些步骤需要执行。
+func (m *manager) submit(ctx context.Context, info *live.Info, file string, steps []configs.PostProcessStep, md *metadata.Metadata) (*Job, error) {
+	for _, step := range steps {
+		if _, ok := getStep(step.Name); !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownStep, step.Name)
+		}
+	}
+	job := NewJob(info, file, steps)
+	if md != nil {
+		job.Integrity = md.Integrity
+	}
+	m.lock.Lock()
+	select {
+	case m.queue <- job:
+	default:
+		m.lock.Unlock()
+		return nil, ErrQueueFull
+	}
+	m.jobs[job.ID] = job
+	m.pruneLocked()
+	snapshot := job.snapshot()
+	m.lock.Unlock()
+	m.persist()
+
+	m.getLogger(job).Infof("已创建处理任务[%s]", job.ID)
+	m.notify(ctx, job)
+	return snapshot, nil
+}
+
+// GetJobs 返回所有任务的快照，按创建时间倒序排列。
+func (m *manager) GetJobs(ctx context.Context) []*Job {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	jobs := make([]*Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		jobs = append(jobs, job.snapshot())
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.After(jobs[j].CreatedAt)
+	})
+	return jobs
+}
+
+// GetJob 根据任务 ID 返回任务的快照。
+func (m *manager) GetJob(ctx context.Context, id string) (*Job, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, ErrJobNotExist
+	}
+	return job.snapshot(), nil
+}
+
+// resume 从任务日志中恢复上次未完成的任务并重新加入队列。
+// 中断时正在执行的步骤会清理残留的临时文件后从头执行，已完成的步骤不会重复执行。
+func (m *manager) resume(ctx context.Context) error {
+	// 1. 读取任务日志。
+	jobs, err := m.journal.load()
+	if err != nil {
+		return err
+	}
+	lives := instance.GetInstance(ctx).Lives
+
+	// 2. 重置任务状态并加入队列，队列已满的任务保留在任务列表中，等待队列有空位时再加入。
+	var overflow []*Job
+	m.lock.Lock()
+	for _, job := range jobs {
+		if job.isFinished() {
+			continue
+		}
+		job.Status = JobPending
+		for i := range job.Steps {
+			if job.Steps[i].Status == JobRunning {
+				job.Steps[i].Status = JobPending
+			}
+		}
+		job.Info = &live.Info{HostName: job.HostName, RoomName: job.RoomName}
+		if l, ok := lives[job.LiveId]; ok {
+			job.Info.Live = l
+		}
+		removeTmpFiles(job.File)
+
+		m.jobs[job.ID] = job
+		select {
+		case m.queue <- job:
+			m.getLogger(job).Infof("已恢复处理任务[%s]", job.ID)
+		default:
+			overflow = append(overflow, job)
+		}
+	}
+	m.lock.Unlock()
+	if len(overflow) > 0 {
+		m.logger.Warnf("处理队列已满，%d个恢复的处理任务将在队列有空位时加入", len(overflow))
+		go m.enqueue(overflow)
+	}
+
+	// 3. 将恢复后的状态写回任务日志。
+	m.persist()
+	return nil
+}
+
+// enqueue 依次将任务加入队列，队列已满时等待，管理器关闭时停止。
+func (m *manager) enqueue(jobs []*Job) {
+	for _, job := range jobs {
+		select {
+		case m.queue <- job:
+			m.getLogger(job).Infof("已恢复处理任务[%s]", job.ID)
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// persist 将所有未完成的任务写入任务日志。
+// 获取快照和写入在同一把锁内完成，较早的快照不会覆盖较新的快照。
+func (m *manager) persist() {
+	m.persistLock.Lock()
+	defer m.persistLock.Unlock()
+	m.lock.RLock()
+	jobs := make([]*Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		if !job.isFinished() {
+			jobs = append(jobs, job.snapshot())
+		}
+	}
+	m.lock.RUnlock()
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt.Before(jobs[j].CreatedAt)
+	})
+	if err := m.journal.save(jobs); err != nil {
+		m.logger.WithError(err).Error("写入录制后处理任务日志失败")
+	}
+}
+
+// pruneLocked 清理过多的已结束任务，调用方需持有写锁。
+func (m *manager) pruneLocked() {
+	finished := make([]*Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		if job.isFinished() {
+			finished = append(finished, job)
+		}
+	}
+	if len(finished) <= maxHistory {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finished[i].FinishedAt.Before(finished[j].FinishedAt)
+	})
+	for _, job := range finished[:len(finished)-maxHistory] {
+		delete(m.jobs, job.ID)
+	}
+}
+
+// work 从队列中取出任务并依次执行。
+func (m *manager) work(ctx context.Context) {
+	defer m.workers.Done()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case job := <-m.queue:
+			m.runJob(ctx, job)
+		}
+	}
+}
+
+// runJob 依次执行任务中的各个步骤，失败的步骤会按配置重试。
+func (m *manager) runJob(ctx context.Context, job *Job) {
+	// 1. 将任务标记为正在处理。
+	m.update(ctx, job, func() {
+		job.Status = JobRunning
+		job.StartedAt = time.Now()
+	})
+
+	// 2. 依次执行各个步骤。
+	var jobErr error
+	for i := job.CurrentStep; i < len(job.Steps) && jobErr == nil; i++ {
+		// 恢复的任务中已完成或已跳过的步骤不再重复执行
+		if s := job.Steps[i].Status; s == JobSucceeded || s == JobSkipped {
+			continue
+		}
+		m.update(ctx, job, func() {
+			job.CurrentStep = i
+			job.Steps[i].Status = JobRunning
+		})
+		jobErr = m.runStep(ctx, job, i)
+	}
+	if errors.Is(jobErr, errInterrupted) {
+		// 保留任务日志中的记录，下次启动时继续执行。
+		m.getLogger(job).Infof("处理任务[%s]已中断", job.ID)
+		return
+	}
+
+	// 3. 记录任务的最终状态。
+	m.update(ctx, job, func() {
+		job.FinishedAt = time.Now()
+		if jobErr != nil {
+			job.Status = JobFailed
+			job.Error = jobErr.Error()
+		} else {
+			job.Status = JobSucceeded
+		}
+	})
+	if jobErr != nil {
+		m.getLogger(job).WithError(jobErr).Errorf("处理任务[%s]失败", job.ID)
+	} else {
+		m.getLogger(job).Infof("处理任务[%s]已完成，输出文件: %s", job.ID, job.File)
+	}
+	if ed, ok := instance.GetInstance(ctx).EventDispatcher.(events.Dispatcher); ok {
+		ed.DispatchEvent(events.NewEvent(JobFinished, job.snapshot()))
+	}
+}
+
+// runStep 执行单个步骤，失败时按配置重试。
+func (m *manager) runStep(ctx context.Context, job *Job, index int) error {
+	state := job.Steps[index]
+	step, ok := getStep(state.Name)
+	if !ok {
+		err := fmt.Errorf("%w: %s", ErrUnknownStep, state.Name)
+		m.update(ctx, job, func() {
+			job.Steps[index].Status = JobFailed
+			job.Steps[index].Error = err.Error()
+		})
+		return err
+	}
+	if !matchIntegrity(state.Args, job.Integrity) {
+		m.getLogger(job).Infof("录制文件完整性为[%s]，跳过处理步骤[%s]", job.Integrity, state.Name)
+		m.update(ctx, job, func() {
+			job.Steps[index].Status = JobSkipped
+		})
+		return nil
+	}
+
+	var err error
+	for attempt := 0; attempt <= m.cfg.PostProcess.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-m.stop:
+				return errInterrupted
+			case <-time.After(retryInterval):
+			}
+		}
+		m.getLogger(job).Debugf("开始执行处理步骤[%s]，第%d次尝试", state.Name, attempt+1)
+
+		// 步骤在任务的副本上执行，避免与状态查询产生数据竞争。
+		m.lock.RLock()
+		work := *job
+		m.lock.RUnlock()
+		err = m.execStep(ctx, step, &work, state.Args)
+		if err != nil && m.isStopped() {
+			return errInterrupted
+		}
+
+		m.update(ctx, job, func() {
+			job.Steps[index].Attempts = attempt + 1
+			if err == nil {
+				job.File = work.File
+				job.Steps[index].Status = JobSucceeded
+				job.Steps[index].Error = ""
+			} else {
+				job.Steps[index].Error = err.Error()
+			}
+		})
+		if err == nil {
+			return nil
+		}
+		m.getLogger(job).WithError(err).Warnf("处理步骤[%s]执行失败", state.Name)
+	}
+	m.update(ctx, job, func() {
+		job.Steps[index].Status = JobFailed
+	})
+	return fmt.Errorf("步骤[%s]执行失败: %w", state.Name, err)
+}
+
+// execStep 在超时时间内执行步骤，管理器关闭时取消执行。
+func (m *manager) execStep(ctx context.Context, step Step, job *Job, args map[string]string) error {
+	stepCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if timeout := m.cfg.PostProcess.Timeout; timeout > 0 {
+		stepCtx, cancel = context.WithTimeout(stepCtx, timeout)
+		defer cancel()
+	}
+	go func() {
+		select {
+		case <-m.stop:
+			cancel()
+		case <-stepCtx.Done():
+		}
+	}()
+	return step.Run(stepCtx, job, args)
+}
+
+// isStopped 返回管理器是否已经关闭。
+func (m *manager) isStopped() bool {
+	select {
+	case <-m.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// update 在锁内修改任务状态，写入任务日志，并通过 websocket 推送最新状态。
+func (m *manager) update(ctx context.Context, job *Job, fn func()) {
+	m.lock.Lock()
+	fn()
+	m.lock.Unlock()
+	m.persist()
+	m.notify(ctx, job)
+}
+
+// notify 通过 websocket 广播任务状态。
+func (m *manager) notify(ctx context.Context, job *Job) {
+	wsm := instance.GetInstance(ctx).WebsocketManager
+	if wsm == nil {
+		return
+	}
+	m.lock.RLock()
+	snapshot := job.snapshot()
+	m.lock.RUnlock()
+	wsm.BroadcastMessage("jobUpdated", snapshot)
+}
+
+// getLogger 返回带有任务信息的日志记录器。
+func (m *manager) getLogger(job *Job) *logrus.Entry {
+	return m.logger.WithFields(map[string]interface{}{
+		"host": job.HostName,
+		"room": job.RoomName,
+		"job":  job.ID,
+	})
+}
@@ -0,0 +1,279 @@
+package postprocessors
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yuhaohwang/bililive-go/src/configs"
+	"github.com/yuhaohwang/bililive-go/src/instance"
+	"github.com/yuhaohwang/bililive-go/src/interfaces"
+	"github.com/yuhaohwang/bililive-go/src/live"
+	"github.com/yuhaohwang/bililive-go/src/pkg/metadata"
+)
+
+func newTestContext(t *testing.T, steps ...configs.PostProcessStep) context.Context {
+	cfg := configs.NewConfig()
+	cfg.OutPutPath = t.TempDir()
+	cfg.PostProcess.Retries = 1
+	cfg.PostProcess.Steps = steps
+	return context.WithValue(context.Background(), instance.Key, &instance.Instance{
+		Config: cfg,
+		Logger: &interfaces.Logger{Logger: logrus.New()},
+	})
+}
+
+func waitJob(t *testing.T, ctx context.Context, m Manager, id string) *Job {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := m.GetJob(ctx, id)
+		assert.NoError(t, err)
+		if job.isFinished() {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s not finished", id)
+	return nil
+}
+
+func TestManagerRunJob(t *testing.T) {
+	backup := retryInterval
+	retryInterval = 0
+	defer func() { retryInterval = backup }()
+
+	attempts := 0
+	Register("test_flaky", StepFunc(func(ctx context.Context, job *Job, args map[string]string) error {
+		attempts++
+		if attempts == 1 {
+			return errors.New("flaky")
+		}
+		job.File += args["suffix"]
+		return os.Rename(job.File[:len(job.File)-len(args["suffix"])], job.File)
+	}))
+	Register("test_fail", StepFunc(func(ctx context.Context, job *Job, args map[string]string) error {
+		return errors.New("always fail")
+	}))
+
+	file := filepath.Join(t.TempDir(), "test.flv")
+	assert.NoError(t, os.WriteFile(file, []byte("flv"), 0644))
+
+	ctx := newTestContext(t, configs.PostProcessStep{Name: "test_flaky", Args: map[string]string{"suffix": ".done"}})
+	m := NewManager(ctx)
+	assert.NoError(t, m.Start(ctx))
+	defer m.Close(ctx)
+
+	// 第一次失败后重试成功，后续步骤能拿到新的文件名
+	job, err := m.Submit(ctx, &live.Info{HostName: "host", RoomName: "room"}, file)
+	assert.NoError(t, err)
+	job = waitJob(t, ctx, m, job.ID)
+	assert.Equal(t, JobSucceeded, job.Status)
+	assert.Equal(t, file+".done", job.File)
+	assert.Equal(t, 2, job.Steps[0].Attempts)
+	assert.FileExists(t, file+".done")
+
+	// 重试次数用尽后任务失败
+	inst := instance.GetInstance(ctx)
+	inst.Config.PostProcess.Steps = []configs.PostProcessStep{{Name: "test_fail"}}
+	job, err = m.Submit(ctx, &live.Info{}, file+".done")
+	assert.NoError(t, err)
+	job = waitJob(t, ctx, m, job.ID)
+	assert.Equal(t, JobFailed, job.Status)
+	assert.Equal(t, 2, job.Steps[0].Attempts)
+	assert.NotEmpty(t, job.Error)
+	assert.Len(t, m.GetJobs(ctx), 2)
+
+	// 未知的步骤无法提交
+	inst.Config.PostProcess.Steps = []configs.PostProcessStep{{Name: "not_exist"}}
+	_, err = m.Submit(ctx, &live.Info{}, file+".done")
+	assert.True(t, errors.Is(err, ErrUnknownStep))
+
+	// 未配置步骤时不创建任务
+	inst.Config.PostProcess.Steps = nil
+	job, err = m.Submit(ctx, &live.Info{}, file+".done")
+	assert.NoError(t, err)
+	assert.Nil(t, job)
+
+	_, err = m.GetJob(ctx, "not_exist")
+	assert.Equal(t, ErrJobNotExist, err)
+}
+
+func TestManagerSkipByIntegrity(t *testing.T) {
+	var runs []string
+	Register("test_integrity", StepFunc(func(ctx context.Context, job *Job, args map[string]string) error {
+		runs = append(runs, args["id"])
+		return nil
+	}))
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "test.flv")
+	assert.NoError(t, os.WriteFile(file, []byte("flv"), 0644))
+	assert.NoError(t, metadata.Update(metadata.PathOf(file), map[string]interface{}{"integrity": "degraded"}))
+
+	ctx := newTestContext(t,
+		configs.PostProcessStep{Name: "test_integrity", Args: map[string]string{"id": "1", "integrity": "ok"}},
+		configs.PostProcessStep{Name: "test_integrity", Args: map[string]string{"id": "2", "integrity": "ok, degraded"}},
+		configs.PostProcessStep{Name: "test_integrity", Args: map[string]string{"id": "3"}},
+	)
+	m := NewManager(ctx)
+	assert.NoError(t, m.Start(ctx))
+	defer m.Close(ctx)
+
+	// 完整性不满足条件的步骤被跳过，不影响任务的结果
+	job, err := m.Submit(ctx, &live.Info{}, file)
+	assert.NoError(t, err)
+	assert.Equal(t, "degraded", job.Integrity)
+	job = waitJob(t, ctx, m, job.ID)
+	assert.Equal(t, JobSucceeded, job.Status)
+	assert.Equal(t, JobSkipped, job.Steps[0].Status)
+	assert.Equal(t, JobSucceeded, job.Steps[1].Status)
+	assert.Equal(t, []string{"2", "3"}, runs)
+}
+
+func TestManagerResume(t *testing.T) {
+	var runs []string
+	Register("test_record", StepFunc(func(ctx context.Context, job *Job, args map[string]string) error {
+		runs = append(runs, args["id"])
+		return nil
+	}))
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "test.flv")
+	assert.NoError(t, os.WriteFile(file, []byte("flv"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "test.mp4.tmp"), []byte("half"), 0644))
+
+	ctx := newTestContext(t)
+	inst := instance.GetInstance(ctx)
+	steps := []configs.PostProcessStep{
+		{Name: "test_record", Args: map[string]string{"id": "1"}},
+		{Name: "test_record", Args: map[string]string{"id": "2"}},
+		{Name: "test_record", Args: map[string]string{"id": "3"}},
+	}
+
+	// 模拟上次运行时第一个步骤已完成、第二个步骤执行到一半
+	job := NewJob(&live.Info{HostName: "host"}, file, steps)
+	job.Status = JobRunning
+	job.Steps[0].Status = JobSucceeded
+	job.Steps[1].Status = JobRunning
+	job.CurrentStep = 1
+	journalPath := filepath.Join(inst.Config.OutPutPath, journalFileName)
+	assert.NoError(t, newJournal(journalPath).save([]*Job{job}))
+
+	m := NewManager(ctx)
+	assert.NoError(t, m.Start(ctx))
+	defer m.Close(ctx)
+
+	resumed := waitJob(t, ctx, m, job.ID)
+	assert.Equal(t, JobSucceeded, resumed.Status)
+	assert.Equal(t, []string{"2", "3"}, runs)
+	assert.NoFileExists(t, filepath.Join(dir, "test.mp4.tmp"))
+	// 所有任务完成后任务日志被清理
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(journalPath)
+		return os.IsNotExist(err)
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestManagerResumeQueueFull(t *testing.T) {
+	backup := queueSize
+	queueSize = 1
+	defer func() { queueSize = backup }()
+
+	release := make(chan struct{})
+	Register("test_queue", StepFunc(func(ctx context.Context, job *Job, args map[string]string) error {
+		<-release
+		return nil
+	}))
+
+	dir := t.TempDir()
+	ctx := newTestContext(t)
+	steps := []configs.PostProcessStep{{Name: "test_queue"}}
+	var jobs []*Job
+	for _, name := range []string{"a.flv", "b.flv", "c.flv"} {
+		file := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(file, []byte("flv"), 0644))
+		jobs = append(jobs, NewJob(&live.Info{}, file, steps))
+	}
+	journalPath := filepath.Join(instance.GetInstance(ctx).Config.OutPutPath, journalFileName)
+	assert.NoError(t, newJournal(journalPath).save(jobs))
+
+	// 队列放不下的任务仍然保留在任务日志中
+	m := NewManager(ctx)
+	assert.NoError(t, m.Start(ctx))
+	defer m.Close(ctx)
+	saved, err := newJournal(journalPath).load()
+	assert.NoError(t, err)
+	assert.Len(t, saved, 3)
+
+	// 队列有空位后依次执行
+	close(release)
+	for _, job := range jobs {
+		assert.Equal(t, JobSucceeded, waitJob(t, ctx, m, job.ID).Status)
+	}
+}
+
+func TestManagerCloseKeepsJournal(t *testing.T) {
+	started := make(chan struct{})
+	Register("test_block", StepFunc(func(ctx context.Context, job *Job, args map[string]string) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+
+	file := filepath.Join(t.TempDir(), "test.flv")
+	assert.NoError(t, os.WriteFile(file, []byte("flv"), 0644))
+	ctx := newTestContext(t, configs.PostProcessStep{Name: "test_block"})
+	m := NewManager(ctx)
+	assert.NoError(t, m.Start(ctx))
+	job, err := m.Submit(ctx, &live.Info{}, file)
+	assert.NoError(t, err)
+	<-started
+	m.Close(ctx)
+	// 重复关闭不会出错
+	m.Close(ctx)
+
+	// 中断的任务保留在任务日志中，等待下次启动时恢复
+	jobs, err := newJournal(filepath.Join(instance.GetInstance(ctx).Config.OutPutPath, journalFileName)).load()
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 1)
+	assert.Equal(t, job.ID, jobs[0].ID)
+	assert.Equal(t, JobRunning, jobs[0].Steps[0].Status)
+}
+
+func TestManagerDrain(t *testing.T) {
+	backup := drainInterval
+	drainInterval = 10 * time.Millisecond
+	defer func() { drainInterval = backup }()
+
+	release := make(chan struct{})
+	Register("test_wait", StepFunc(func(ctx context.Context, job *Job, args map[string]string) error {
+		<-release
+		return nil
+	}))
+
+	file := filepath.Join(t.TempDir(), "test.flv")
+	assert.NoError(t, os.WriteFile(file, []byte("flv"), 0644))
+	ctx := newTestContext(t, configs.PostProcessStep{Name: "test_wait"})
+	m := NewManager(ctx)
+	assert.NoError(t, m.Start(ctx))
+	defer m.Close(ctx)
+	_, err := m.Submit(ctx, &live.Info{}, file)
+	assert.NoError(t, err)
+
+	// 任务未完成时等到期限结束
+	drainCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, m.Drain(drainCtx), context.DeadlineExceeded)
+
+	// 任务完成后立即返回
+	close(release)
+	drainCtx, cancel = context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	assert.NoError(t, m.Drain(drainCtx))
+}
@@ -0,0 +1,78 @@
+package postprocessors
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/yuhaohwang/bililive-go/src/configs"
+)
+
+// integrityArg 是所有步骤通用的参数，用逗号分隔允许执行步骤的完整性检查结果，如 "ok,degraded"。
+const integrityArg = "integrity"
+
+// Step 定义了处理步骤的接口。
+// 步骤可以通过修改 job.File 将新生成的文件交给后续步骤处理。
+type Step interface {
+	Run(ctx context.Context, job *Job, args map[string]string) error
+}
+
+// StepFunc 是一个实现了 Step 接口的函数类型。
+type StepFunc func(ctx context.Context, job *Job, args map[string]string) error
+
+// Run 调用函数本身。
+func (f StepFunc) Run(ctx context.Context, job *Job, args map[string]string) error {
+	return f(ctx, job, args)
+}
+
+var steps = make(map[string]Step)
+
+// Register 用于注册处理步骤。
+func Register(name string, s Step) {
+	steps[name] = s
+}
+
+// getStep 根据名称获取处理步骤。
+func getStep(name string) (Step, bool) {
+	s, ok := steps[name]
+	return s, ok
+}
+
+// hasStep 返回处理步骤中是否包含指定名称的步骤。
+func hasStep(steps []configs.PostProcessStep, name string) bool {
+	for _, step := range steps {
+		if step.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// boolArg 读取布尔类型的步骤参数。
+func boolArg(args map[string]string, key string) bool {
+	b, _ := strconv.ParseBool(args[key])
+	return b
+}
+
+// stringArg 读取字符串类型的步骤参数，不存在时返回默认值。
+func stringArg(args map[string]string, key, def string) string {
+	if v, ok := args[key]; ok && v != "" {
+		return v
+	}
+	return def
+}
+
+// matchIntegrity 返回录制文件的完整性检查结果是否满足步骤的执行条件。
+// 未配置条件或文件没有检查结果时总是执行。
+func matchIntegrity(args map[string]string, level string) bool {
+	allowed := stringArg(args, integrityArg, "")
+	if allowed == "" || level == "" {
+		return true
+	}
+	for _, l := range strings.Split(allowed, ",") {
+		if strings.TrimSpace(l) == level {
+			return true
+		}
+	}
+	return false
+}
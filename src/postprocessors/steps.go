@@ -0,0 +1,475 @@
+package postprocessors
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+
+	"github.com/yuhaohwang/bililive-go/src/instance"
+	"github.com/yuhaohwang/bililive-go/src/live"
+	"github.com/yuhaohwang/bililive-go/src/pkg/chapters"
+	"github.com/yuhaohwang/bililive-go/src/pkg/integrity"
+	"github.com/yuhaohwang/bililive-go/src/pkg/metadata"
+	"github.com/yuhaohwang/bililive-go/src/pkg/parser/native/flv"
+	"github.com/yuhaohwang/bililive-go/src/pkg/utils"
+)
+
+// 内置处理步骤的名称。
+const (
+	StepRemux         = "remux"          // 无损转封装，参数：format、delete_source
+	StepFixTimestamps = "fix_timestamps" // 重新生成时间戳，无参数
+	StepThumbnail     = "thumbnail"      // 生成缩略图，参数：offset
+	StepChecksum      = "checksum"       // 计算校验和，参数：algorithm
+	StepCustomCommand = "custom_command" // 执行自定义命令，参数：commandline、delete_source
+	StepMove          = "move"           // 移动文件及其附属文件，参数：dest
+	StepSelectCopy    = "select_copy"    // 从冗余录制的副本中选出最佳副本，参数：keep_others
+	StepClip          = "clip"           // 截取片段，参数：start_ms、end_ms、format、precise
+	StepFLVMetadata   = "flv_metadata"   // 写入 FLV 的时长和关键帧索引，无参数
+)
+
+// tmpExt 是步骤写入临时文件时使用的扩展名，与录制中的 .part 文件区分，避免被当作未正常结束的录制文件。
+const tmpExt = ".tmp"
+
+func init() {
+	Register(StepRemux, StepFunc(remux))
+	Register(StepFixTimestamps, StepFunc(fixTimestamps))
+	Register(StepThumbnail, StepFunc(thumbnail))
+	Register(StepChecksum, StepFunc(checksum))
+	Register(StepCustomCommand, StepFunc(customCommand))
+	Register(StepMove, StepFunc(move))
+	Register(StepSelectCopy, StepFunc(selectCopy))
+	Register(StepClip, StepFunc(clip))
+	Register(StepFLVMetadata, StepFunc(flvMetadata))
+}
+
+// muxerNames 将文件扩展名映射为 FFmpeg 的封装格式名称。
+var muxerNames = map[string]string{
+	"mkv": "matroska",
+	"ts":  "mpegts",
+	"m4a": "ipod",
+}
+
+// muxerName 返回扩展名对应的 FFmpeg 封装格式名称。
+func muxerName(ext string) string {
+	ext = strings.TrimPrefix(ext, ".")
+	if name, ok := muxerNames[ext]; ok {
+		return name
+	}
+	return ext
+}
+
+// runFFmpeg 执行 FFmpeg 命令，失败时返回包含标准错误输出的错误信息。
+func runFFmpeg(ctx context.Context, args ...string) error {
+	ffmpegPath, err := utils.GetFFmpegPath(ctx)
+	if err != nil {
+		return err
+	}
+	stderr := new(bytes.Buffer)
+	cmd := exec.CommandContext(ctx, ffmpegPath, append([]string{"-hide_banner", "-nostdin", "-y"}, args...)...)
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if idx := strings.LastIndex(msg, "\n"); idx >= 0 {
+			msg = msg[idx+1:]
+		}
+		return fmt.Errorf("%w: %s", err, msg)
+	}
+	return nil
+}
+
+// trimExt 返回去掉扩展名的文件路径。
+func trimExt(file string) string {
+	return strings.TrimSuffix(file, filepath.Ext(file))
+}
+
+// chapterFormats 是转封装时可以写入章节的封装格式。
+var chapterFormats = map[string]bool{
+	"mp4": true,
+	"mkv": true,
+	"mov": true,
+}
+
+// writeChapterMetadata 将录制文件的章节写入 FFmpeg 的元数据文件，返回元数据文件路径，没有章节时返回空字符串。
+func writeChapterMetadata(file, out string) (string, error) {
+	list, err := chapters.Read(chapters.PathOf(file))
+	if err != nil || len(list) == 0 {
+		return "", nil
+	}
+	var durationMs int64
+	if md, err := metadata.Read(metadata.PathOf(file)); err == nil && md.IntegrityReport != nil {
+		durationMs = md.IntegrityReport.DurationMs
+	}
+	meta := out + ".ffmetadata"
+	if err := os.WriteFile(meta, []byte(chapters.FFMetadata(list, durationMs)), 0644); err != nil {
+		return "", err
+	}
+	return meta, nil
+}
+
+// remux 使用 FFmpeg 将文件无损转封装为指定格式，封装格式支持时写入章节文件中的章节。
+func remux(ctx context.Context, job *Job, args map[string]string) error {
+	format := stringArg(args, "format", "mp4")
+	out := trimExt(job.File) + "." + format
+	if out == job.File {
+		return nil
+	}
+	// 上次转封装完成并删除了源文件，但未来得及记录到任务日志
+	if !fileExists(job.File) && fileExists(out) {
+		job.File = out
+		return nil
+	}
+	ffArgs := []string{"-i", job.File}
+	if chapterFormats[format] {
+		meta, err := writeChapterMetadata(job.File, out)
+		if err != nil {
+			return err
+		}
+		if meta != "" {
+			defer os.Remove(meta)
+			ffArgs = append(ffArgs, "-f", "ffmetadata", "-i", meta, "-map_chapters", "1")
+		}
+	}
+	tmp := out + tmpExt
+	ffArgs = append(ffArgs, "-map", "0", "-c", "copy", "-f", muxerName(format), tmp)
+	if err := runFFmpeg(ctx, ffArgs...); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, out); err != nil {
+		return err
+	}
+	if boolArg(args, "delete_source") {
+		os.Remove(job.File)
+	}
+	job.File = out
+	return nil
+}
+
+// fixTimestamps 重新生成时间戳，修复直播流中常见的时间戳跳变问题。
+func fixTimestamps(ctx context.Context, job *Job, args map[string]string) error {
+	tmp := job.File + tmpExt
+	if err := runFFmpeg(ctx,
+		"-fflags", "+genpts", "-i", job.File,
+		"-map", "0", "-c", "copy", "-avoid_negative_ts", "make_zero",
+		"-f", muxerName(filepath.Ext(job.File)), tmp,
+	); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, job.File)
+}
+
+// flvMetadata 为 FLV 文件写入带有时长和关键帧索引的 onMetaData，使其可以拖动播放，
+// 同时修正时间戳并丢弃损坏的标签。其他格式的文件不做处理。
+func flvMetadata(ctx context.Context, job *Job, args map[string]string) error {
+	if !strings.EqualFold(filepath.Ext(job.File), ".flv") {
+		return nil
+	}
+	tmp := job.File + tmpExt
+	result, err := flv.InjectMetadata(job.File, tmp)
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, job.File); err != nil {
+		return err
+	}
+	instance.GetInstance(ctx).Logger.Infof("已写入FLV元数据: %s，时长%s，关键帧%d个，丢弃损坏的标签%d个，修正时间戳跳变%d次",
+		job.File, result.Duration, result.Keyframes, result.DroppedTags, result.Discontinuities)
+	return nil
+}
+
+// thumbnail 截取指定时间点的画面作为缩略图。
+func thumbnail(ctx context.Context, job *Job, args map[string]string) error {
+	return runFFmpeg(ctx,
+		"-ss", stringArg(args, "offset", "10"), "-i", job.File,
+		"-frames:v", "1", "-q:v", "2", trimExt(job.File)+".jpg",
+	)
+}
+
+// checksum 计算文件的校验和，并以 sha256sum 兼容的格式写入附属文件。
+func checksum(ctx context.Context, job *Job, args map[string]string) error {
+	algorithm := stringArg(args, "algorithm", "sha256")
+	var h hash.Hash
+	switch algorithm {
+	case "md5":
+		h = md5.New()
+	case "sha1":
+		h = sha1.New()
+	case "sha256":
+		h = sha256.New()
+	default:
+		return fmt.Errorf("不支持的校验算法: %s", algorithm)
+	}
+	f, err := os.Open(job.File)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.Copy(h, f); err != nil {
+		return err
+	}
+	line := fmt.Sprintf("%s  %s\n", hex.EncodeToString(h.Sum(nil)), filepath.Base(job.File))
+	return os.WriteFile(job.File+"."+algorithm, []byte(line), 0644)
+}
+
+// templateData 返回渲染命令行、路径模板时使用的数据。
+func templateData(ctx context.Context, job *Job) interface{} {
+	info := job.Info
+	if info == nil {
+		info = &live.Info{HostName: job.HostName, RoomName: job.RoomName}
+	}
+	ffmpegPath, _ := utils.GetFFmpegPath(ctx)
+	return struct {
+		*live.Info
+		FileName string
+		Ffmpeg   string
+	}{
+		Info:     info,
+		FileName: job.File,
+		Ffmpeg:   ffmpegPath,
+	}
+}
+
+// renderTemplate 使用任务数据渲染模板字符串。
+func renderTemplate(ctx context.Context, job *Job, name, text string) (string, error) {
+	config := instance.GetInstance(ctx).Config
+	tmpl, err := template.New(name).Funcs(utils.GetFuncMap(config)).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, templateData(ctx, job)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// customCommand 执行用户自定义的命令行。
+func customCommand(ctx context.Context, job *Job, args map[string]string) error {
+	cmdStr, err := renderTemplate(ctx, job, "custom_commandline", strings.TrimSpace(args["commandline"]))
+	if err != nil {
+		return err
+	}
+	if cmdStr == "" {
+		return nil
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", cmdStr)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", cmdStr)
+	}
+	if instance.GetInstance(ctx).Config.Debug {
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("自定义命令行执行失败(%s): %w", cmdStr, err)
+	}
+	if boolArg(args, "delete_source") {
+		os.Remove(job.File)
+	}
+	return nil
+}
+
+// relatedFiles 返回与文件同名的附属文件，例如 .metadata.json、缩略图和校验和文件。
+func relatedFiles(file string) []string {
+	dir, base := filepath.Split(trimExt(file))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	files := make([]string, 0, 4)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Join(dir, name) == file {
+			continue
+		}
+		if strings.HasPrefix(name, base+".") {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	return files
+}
+
+// fileExists 返回文件是否存在。
+func fileExists(file string) bool {
+	_, err := os.Stat(file)
+	return err == nil
+}
+
+// removeTmpFiles 清理中断的步骤留下的临时文件。
+func removeTmpFiles(file string) {
+	for _, f := range relatedFiles(file) {
+		if strings.HasSuffix(f, tmpExt) {
+			os.Remove(f)
+		}
+	}
+}
+
+// moveFile 移动文件，跨设备时退化为复制后删除。
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	in.Close()
+	return os.Remove(src)
+}
+
+// move 将文件及其附属文件移动到目标目录，目标目录支持模板，相对路径基于输出目录。
+func move(ctx context.Context, job *Job, args map[string]string) error {
+	dest, err := renderTemplate(ctx, job, "move_dest", args["dest"])
+	if err != nil {
+		return err
+	}
+	if dest == "" {
+		return fmt.Errorf("move 步骤缺少 dest 参数")
+	}
+	if !filepath.IsAbs(dest) {
+		dest = filepath.Join(instance.GetInstance(ctx).Config.EffectiveConfig(job.LiveUrl).OutPutPath, dest)
+	}
+	if err := os.MkdirAll(dest, os.ModePerm); err != nil {
+		return err
+	}
+	for _, file := range relatedFiles(job.File) {
+		if err := moveFile(file, filepath.Join(dest, filepath.Base(file))); err != nil {
+			return err
+		}
+	}
+	target := filepath.Join(dest, filepath.Base(job.File))
+	// 上次已经移动完成，但未来得及记录到任务日志
+	if !fileExists(job.File) && fileExists(target) {
+		job.File = target
+		return nil
+	}
+	if err := moveFile(job.File, target); err != nil {
+		return err
+	}
+	job.File = target
+	return nil
+}
+
+// copyReport 返回副本的完整性检查结果，没有检查结果时只比较文件大小。
+func copyReport(file string) *integrity.Report {
+	if md, err := metadata.Read(metadata.PathOf(file)); err == nil && md.IntegrityReport != nil {
+		return md.IntegrityReport
+	}
+	report := new(integrity.Report)
+	if stat, err := os.Stat(file); err == nil {
+		report.Size = stat.Size()
+	}
+	return report
+}
+
+// selectCopy 从冗余录制的多个副本中选出断档最少的副本，后续步骤处理选中的副本。
+// 参数 keep_others 未设置时使用直播间的冗余录制配置；不保留其他副本时删除其余副本，
+// 选中的副本改用主录制文件的文件名。
+func selectCopy(ctx context.Context, job *Job, args map[string]string) error {
+	// 1. 读取主录制文件记录的其他副本。
+	md, err := metadata.Read(metadata.PathOf(job.File))
+	if err != nil || len(md.Copies) == 0 {
+		return nil
+	}
+	keepOthers := instance.GetInstance(ctx).Config.EffectiveConfig(job.LiveUrl).Redundancy.KeepOthers
+	if _, ok := args["keep_others"]; ok {
+		keepOthers = boolArg(args, "keep_others")
+	}
+
+	// 2. 比较各个副本的完整性检查结果。
+	dir := filepath.Dir(job.File)
+	candidates := []string{job.File}
+	for _, name := range md.Copies {
+		candidates = append(candidates, filepath.Join(dir, name))
+	}
+	var (
+		best       string
+		bestReport *integrity.Report
+	)
+	for _, file := range candidates {
+		if !fileExists(file) {
+			continue
+		}
+		if report := copyReport(file); best == "" || integrity.Compare(report, bestReport) < 0 {
+			best, bestReport = file, report
+		}
+	}
+	if best == "" {
+		return fmt.Errorf("冗余录制的副本都不存在")
+	}
+	selected := filepath.Base(best)
+	instance.GetInstance(ctx).Logger.Infof("选择冗余录制的副本 %s: %s", selected, job.File)
+
+	// 3. 保留其他副本时只改为处理选中的副本。
+	job.Integrity = string(bestReport.Integrity)
+	if keepOthers {
+		job.File = best
+		return metadata.Update(metadata.PathOf(best), map[string]interface{}{"selected_copy": selected})
+	}
+
+	// 4. 删除其他副本，选中的副本覆盖主录制文件，并将其检查结果写入主录制文件的元数据。
+	for _, file := range candidates[1:] {
+		if file != best {
+			os.Remove(file)
+			os.Remove(metadata.PathOf(file))
+		}
+	}
+	fields := map[string]interface{}{
+		"copies":        nil,
+		"selected_copy": selected,
+	}
+	if best != job.File {
+		bestMd, err := metadata.Read(metadata.PathOf(best))
+		if err != nil {
+			return err
+		}
+		if err := moveFile(best, job.File); err != nil {
+			return err
+		}
+		// 主录制文件原有的检查结果和停滞信息不再适用
+		fields["integrity"], fields["integrity_report"], fields["stall"] = nil, nil, nil
+		if bestMd.IntegrityReport != nil {
+			fields["integrity"], fields["integrity_report"] = bestMd.Integrity, bestMd.IntegrityReport
+		}
+		if bestMd.Stall != nil {
+			fields["stall"] = bestMd.Stall
+		}
+	}
+	if err := metadata.Update(metadata.PathOf(job.File), fields); err != nil {
+		return err
+	}
+	if best != job.File {
+		os.Remove(metadata.PathOf(best))
+	}
+	return nil
+}
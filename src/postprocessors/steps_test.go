@@ -0,0 +1,171 @@
+package postprocessors
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yuhaohwang/bililive-go/src/pkg/chapters"
+	"github.com/yuhaohwang/bililive-go/src/pkg/integrity"
+	"github.com/yuhaohwang/bililive-go/src/pkg/metadata"
+	"github.com/yuhaohwang/bililive-go/src/pkg/parser/native/flv"
+)
+
+func TestChecksum(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "test.flv")
+	assert.NoError(t, os.WriteFile(file, []byte("hello"), 0644))
+
+	job := &Job{File: file}
+	assert.NoError(t, checksum(newTestContext(t), job, map[string]string{"algorithm": "md5"}))
+	b, err := os.ReadFile(file + ".md5")
+	assert.NoError(t, err)
+	assert.Equal(t, "5d41402abc4b2a76b9719d911017c592  test.flv\n", string(b))
+
+	assert.Error(t, checksum(newTestContext(t), job, map[string]string{"algorithm": "crc"}))
+}
+
+func TestFLVMetadata(t *testing.T) {
+	dir := t.TempDir()
+	ctx := newTestContext(t)
+
+	// 其他格式的文件不做处理
+	ts := filepath.Join(dir, "test.ts")
+	assert.NoError(t, os.WriteFile(ts, []byte("ts"), 0644))
+	assert.NoError(t, flvMetadata(ctx, &Job{File: ts}, nil))
+
+	// 无法解析时返回错误，保留原文件
+	file := filepath.Join(dir, "test.flv")
+	assert.NoError(t, os.WriteFile(file, []byte("not a flv file"), 0644))
+	assert.ErrorIs(t, flvMetadata(ctx, &Job{File: file}, nil), flv.ErrNotFlvStream)
+	assert.FileExists(t, file)
+	assert.NoFileExists(t, file+".tmp")
+}
+
+func TestMove(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "test.flv")
+	for _, name := range []string{"test.flv", "test.metadata.json", "test.jpg", "test2.flv"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(name), 0644))
+	}
+
+	ctx := newTestContext(t)
+	job := &Job{File: file, HostName: "host"}
+	dest := filepath.Join(dir, "archive")
+	assert.NoError(t, move(ctx, job, map[string]string{"dest": dest + "/{{ .HostName }}"}))
+	assert.Equal(t, filepath.Join(dest, "host", "test.flv"), job.File)
+	for _, name := range []string{"test.flv", "test.metadata.json", "test.jpg"} {
+		assert.FileExists(t, filepath.Join(dest, "host", name))
+		assert.NoFileExists(t, filepath.Join(dir, name))
+	}
+	assert.FileExists(t, filepath.Join(dir, "test2.flv"))
+
+	assert.Error(t, move(ctx, job, map[string]string{}))
+}
+
+func TestSelectCopy(t *testing.T) {
+	// writeCopy 写入一个副本及其完整性检查结果
+	writeCopy := func(file string, gaps int, copies ...string) {
+		assert.NoError(t, os.WriteFile(file, []byte(filepath.Base(file)), 0644))
+		report := &integrity.Report{Integrity: integrity.LevelOK, DurationMs: 1000}
+		for i := 0; i < gaps; i++ {
+			report.Integrity = integrity.LevelDegraded
+			report.Gaps = append(report.Gaps, integrity.Gap{Track: "video", OffsetMs: int64(i * 100), DurationMs: 2000})
+		}
+		fields := map[string]interface{}{"integrity": report.Integrity, "integrity_report": report}
+		if len(copies) > 0 {
+			fields["copies"] = copies
+		}
+		assert.NoError(t, metadata.Update(metadata.PathOf(file), fields))
+	}
+	ctx := newTestContext(t)
+
+	// 不保留其他副本时，断档最少的副本覆盖主录制文件
+	dir := t.TempDir()
+	file := filepath.Join(dir, "test.flv")
+	writeCopy(file, 2, "test.copy1.flv", "test.copy2.flv")
+	writeCopy(filepath.Join(dir, "test.copy1.flv"), 0)
+	writeCopy(filepath.Join(dir, "test.copy2.flv"), 1)
+	job := &Job{File: file}
+	assert.NoError(t, selectCopy(ctx, job, nil))
+	assert.Equal(t, file, job.File)
+	assert.Equal(t, "ok", job.Integrity)
+	b, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "test.copy1.flv", string(b))
+	for _, name := range []string{"test.copy1.flv", "test.copy1.metadata.json", "test.copy2.flv", "test.copy2.metadata.json"} {
+		assert.NoFileExists(t, filepath.Join(dir, name))
+	}
+	md, err := metadata.Read(metadata.PathOf(file))
+	assert.NoError(t, err)
+	assert.Empty(t, md.Copies)
+	assert.Equal(t, "ok", md.Integrity)
+	assert.Empty(t, md.IntegrityReport.Gaps)
+
+	// 再次执行时没有需要选择的副本
+	assert.NoError(t, selectCopy(ctx, job, nil))
+	assert.Equal(t, file, job.File)
+
+	// 保留其他副本时只改为处理选中的副本
+	dir = t.TempDir()
+	file = filepath.Join(dir, "test.flv")
+	writeCopy(file, 1, "test.copy1.flv")
+	writeCopy(filepath.Join(dir, "test.copy1.flv"), 0)
+	job = &Job{File: file}
+	assert.NoError(t, selectCopy(ctx, job, map[string]string{"keep_others": "true"}))
+	assert.Equal(t, filepath.Join(dir, "test.copy1.flv"), job.File)
+	assert.FileExists(t, file)
+	assert.FileExists(t, metadata.PathOf(file))
+}
+
+func TestWriteChapterMetadata(t *testing.T) {
+	dir := t.TempDir()
+	file, out := filepath.Join(dir, "test.flv"), filepath.Join(dir, "test.mp4")
+
+	// 没有章节文件时不生成元数据文件
+	meta, err := writeChapterMetadata(file, out)
+	assert.NoError(t, err)
+	assert.Empty(t, meta)
+
+	// 最后一个章节到录制文件的时长为止
+	assert.NoError(t, chapters.Write(chapters.PathOf(file), []chapters.Chapter{{Title: "a"}, {StartMs: 1000, Title: "b"}}))
+	report := &integrity.Report{Integrity: integrity.LevelOK, DurationMs: 3000}
+	assert.NoError(t, metadata.Update(metadata.PathOf(file), map[string]interface{}{"integrity_report": report}))
+	meta, err = writeChapterMetadata(file, out)
+	assert.NoError(t, err)
+	b, err := os.ReadFile(meta)
+	assert.NoError(t, err)
+	assert.Contains(t, string(b), "START=1000\nEND=3000\ntitle=b\n")
+}
+
+func TestClip(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "test.flv")
+	ctx := newTestContext(t)
+
+	// 起点和终点无效时不截取
+	job := &Job{File: file}
+	assert.Error(t, clip(ctx, job, map[string]string{"start_ms": "2000", "end_ms": "1000"}))
+	assert.Error(t, clip(ctx, job, map[string]string{"start_ms": "0", "end_ms": "1000", "format": "../mp4"}))
+	assert.Equal(t, file, job.File)
+
+	// 片段的元数据以源文件的元数据为基础，记录截取的位置
+	assert.NoError(t, metadata.Update(metadata.PathOf(file), map[string]interface{}{
+		"room_name":       "title",
+		"start_time_unix": 100,
+		"copies":          []string{"test.copy1.flv"},
+	}))
+	out := clipFileName(file, 1000, 61000, "mp4")
+	assert.Equal(t, filepath.Join(dir, ClipDir, "test.clip_1000-61000.mp4"), out)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(out), os.ModePerm))
+	assert.NoError(t, os.WriteFile(out, []byte("clip"), 0644))
+	assert.NoError(t, saveClipMetadata(file, out, 1000, 61000, false))
+	md, err := metadata.Read(metadata.PathOf(out))
+	assert.NoError(t, err)
+	assert.Equal(t, "title", md.RoomName)
+	assert.Empty(t, md.Copies)
+	assert.Equal(t, int64(101), md.StartTimeUnix)
+	assert.Equal(t, int64(161), md.EndTimeUnix)
+	assert.Equal(t, &metadata.Clip{File: "../test.flv", StartMs: 1000, EndMs: 61000}, md.ClipOf)
+}
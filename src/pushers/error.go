@@ -23,4 +23,7 @@ var (
 
 	// ErrPushNotEnabled 表示推送未启用
 	ErrPushNotEnabled = errors.New("push is not enabled")
+
+	// ErrShutdownTimeout 表示退出时有推送器未能在期限内结束
+	ErrShutdownTimeout = errors.New("pushers did not finish before shutdown deadline")
 )
@@ -2,6 +2,7 @@ package pushers
 
 import (
 	"context"
+	"fmt"
 	"sync"
 
 	"github.com/yuhaohwang/bililive-go/src/instance"
@@ -28,6 +29,7 @@ type Manager interface {
 	RemovePusher(ctx context.Context, liveId live.ID) error
 	GetPusher(ctx context.Context, liveId live.ID) (Pusher, error)
 	HasPusher(ctx context.Context, liveId live.ID) bool
+	Shutdown(ctx context.Context) error
 }
 
 // 用于测试的变量
@@ -80,6 +82,10 @@ func (m *manager) registryListener(ctx context.Context, ed events.Dispatcher) {
 		if !m.HasPusher(ctx, live.GetLiveId()) {
 			return
 		}
+		// 断网期间保留推送器，由推送器自行重试。
+		if lm, ok := instance.GetInstance(ctx).ListenerManager.(listeners.Manager); ok && lm.IsOutage() {
+			return
+		}
 		// 尝试移除录制器。
 		if err := m.RemovePusher(ctx, live.GetLiveId()); err != nil {
 			// 如果移除录制器失败，则记录错误。
@@ -116,6 +122,36 @@ func (m *manager) Close(ctx context.Context) {
 	inst.WaitGroup.Done()
 }
 
+// Shutdown 关闭 Pusher Manager，并等待所有推送进程退出。
+// ctx 结束时仍未结束的推送器会记录到日志中，并返回 ErrShutdownTimeout。
+func (m *manager) Shutdown(ctx context.Context) error {
+	// 1. 记录需要等待的推送器后关闭 Pusher Manager。
+	m.lock.RLock()
+	pushers := make(map[live.ID]Pusher, len(m.pushers))
+	for id, pusher := range m.pushers {
+		pushers[id] = pusher
+	}
+	m.lock.RUnlock()
+	m.Close(ctx)
+
+	// 2. 等待所有推送器结束。
+	for id, pusher := range pushers {
+		select {
+		case <-pusher.Done():
+			delete(pushers, id)
+		case <-ctx.Done():
+		}
+	}
+	if len(pushers) == 0 {
+		return nil
+	}
+	logger := instance.GetInstance(ctx).Logger
+	for id := range pushers {
+		logger.WithField("live_id", id).Warn("推送器未能在退出期限内结束")
+	}
+	return fmt.Errorf("%w: %d 个推送器未结束", ErrShutdownTimeout, len(pushers))
+}
+
 // AddPusher 添加一个录制器。
 func (m *manager) AddPusher(ctx context.Context, live live.Live) error {
 
@@ -32,6 +32,7 @@ type Pusher interface {
 	StartTime() time.Time
 	GetStatus() (map[string]string, error)
 	Close()
+	Done() <-chan struct{}
 }
 
 // pusher 是 Pusher 接口的实现。
@@ -51,6 +52,7 @@ type pusher struct {
 	parserLock *sync.RWMutex
 
 	stop  chan struct{}
+	done  chan struct{} // 主循环结束、推送进程退出后关闭
 	state uint32
 }
 
@@ -67,6 +69,7 @@ func NewPusher(ctx context.Context, live live.Live) (Pusher, error) {
 		logger:     inst.Logger,
 		state:      begin,
 		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
 		parserLock: new(sync.RWMutex),
 	}, nil
 }
@@ -92,7 +95,7 @@ func (r *pusher) tryPush(ctx context.Context) {
 
 	// 初始化解析器配置
 	parserCfg := map[string]string{
-		"timeout_in_us": strconv.Itoa(r.config.TimeoutInUs),
+		"timeout_in_us": strconv.Itoa(r.config.EffectiveConfig(r.Live.GetRawUrl()).TimeoutInUs),
 	}
 	if r.config.Debug {
 		parserCfg["debug"] = "true"
@@ -125,6 +128,7 @@ func (r *pusher) tryPush(ctx context.Context) {
 
 // run 启动录制器的主循环。
 func (r *pusher) run(ctx context.Context) {
+	defer close(r.done)
 	for {
 		select {
 		case <-r.stop:
@@ -183,6 +187,11 @@ func (r *pusher) Close() {
 	r.ed.DispatchEvent(events.NewEvent(PusherStop, r.Live))
 }
 
+// Done 返回一个通道，推送器关闭后推送进程退出时关闭。
+func (r *pusher) Done() <-chan struct{} {
+	return r.done
+}
+
 // getLogger 返回记录器实例。
 func (r *pusher) getLogger() *logrus.Entry {
 	return r.logger.WithFields(r.getFields())
@@ -0,0 +1,91 @@
+package recorders
+
+import (
+	"sync"
+	"time"
+
+	"github.com/yuhaohwang/bililive-go/src/live"
+	"github.com/yuhaohwang/bililive-go/src/pkg/chapters"
+)
+
+// Chapter 是添加到正在录制的文件中的章节。
+type Chapter struct {
+	chapters.Chapter
+	LiveId live.ID `json:"live_id"` // 直播唯一标识
+	File   string  `json:"file"`    // 章节所在的录制文件
+}
+
+// chapterTracker 记录正在写入的文件中的章节，每次变化都立即写入章节文件。
+// 未开启章节模式时只记录手动添加的标记，没有标记时不写入章节文件。
+type chapterTracker struct {
+	lock     sync.Mutex
+	r        *recorder
+	enabled  bool      // 是否记录房间名称和分区的变化
+	file     string    // 当前正在写入的文件
+	start    time.Time // 当前文件开始写入的时间
+	title    string    // 当前的房间名称
+	category string    // 当前的直播分区
+	chapters []chapters.Chapter
+}
+
+// newChapterTracker 创建一个新的 chapterTracker 实例，文件开头为当前房间名称的章节。
+func newChapterTracker(r *recorder, file string, start time.Time, info *live.Info, enabled bool) *chapterTracker {
+	t := &chapterTracker{
+		r:        r,
+		enabled:  enabled,
+		title:    info.RoomName,
+		category: info.Category,
+	}
+	t.reset(file, start)
+	return t
+}
+
+// reset 开始记录新文件的章节，新文件的开头为当前房间名称的章节，调用方需持有锁或独占访问。
+func (t *chapterTracker) reset(file string, start time.Time) {
+	t.file, t.start = file, start
+	t.chapters = []chapters.Chapter{{Kind: chapters.KindTitle, Title: t.title, Time: start}}
+	t.saveLocked()
+}
+
+// add 在 offset 处添加章节，offset 为负数时使用文件开始写入后经过的时间。
+// 房间名称或分区与当前相同时忽略并返回 nil。
+func (t *chapterTracker) add(kind, title string, now time.Time, offset time.Duration) *Chapter {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	switch kind {
+	case chapters.KindTitle:
+		if !t.enabled || title == t.title {
+			return nil
+		}
+		t.title = title
+	case chapters.KindCategory:
+		if !t.enabled || title == t.category {
+			return nil
+		}
+		t.category = title
+	}
+	if offset < 0 {
+		offset = now.Sub(t.start)
+	}
+	c := chapters.Chapter{StartMs: offset.Milliseconds(), Kind: kind, Title: title, Time: now}
+	t.chapters = append(t.chapters, c)
+	t.saveLocked()
+	return &Chapter{Chapter: c, File: t.file}
+}
+
+// split 在无缝切分时开始记录下一个文件的章节。
+func (t *chapterTracker) split(next string, at time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.reset(next, at)
+}
+
+// saveLocked 写入章节文件，调用方需持有锁。
+func (t *chapterTracker) saveLocked() {
+	if !t.enabled && len(t.chapters) <= 1 {
+		return
+	}
+	if err := chapters.Write(chapters.PathOf(t.file), t.chapters); err != nil {
+		t.r.getLogger().WithError(err).Error("写入章节文件失败")
+	}
+}
@@ -0,0 +1,55 @@
+package recorders
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yuhaohwang/bililive-go/src/live"
+	"github.com/yuhaohwang/bililive-go/src/pkg/chapters"
+)
+
+func TestChapterTracker(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.flv"), filepath.Join(dir, "b.flv")
+	start := time.Unix(100, 0)
+	info := &live.Info{RoomName: "title", Category: "game"}
+
+	// 1. 未开启章节模式时只记录标记。
+	tracker := newChapterTracker(&recorder{}, a, start, info, false)
+	assert.NoFileExists(t, chapters.PathOf(a))
+	ok := tracker.add(chapters.KindTitle, "title2", start.Add(time.Second), -1) != nil
+	assert.False(t, ok)
+	ok = tracker.add(chapters.KindMarker, "marker", start.Add(2*time.Second), -1) != nil
+	assert.True(t, ok)
+	list, err := chapters.Read(chapters.PathOf(a))
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.Equal(t, "title", list[0].Title)
+	assert.Equal(t, int64(2000), list[1].StartMs)
+
+	// 2. 开启章节模式时记录房间名称和分区的变化，与当前相同时忽略。
+	tracker = newChapterTracker(&recorder{}, b, start, info, true)
+	ok = tracker.add(chapters.KindCategory, "game", start.Add(time.Second), -1) != nil
+	assert.False(t, ok)
+	ok = tracker.add(chapters.KindCategory, "music", start.Add(3*time.Second), -1) != nil
+	assert.True(t, ok)
+	ok = tracker.add(chapters.KindTitle, "title2", start.Add(4*time.Second), -1) != nil
+	assert.True(t, ok)
+	list, err = chapters.Read(chapters.PathOf(b))
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{0, 3000, 4000}, []int64{list[0].StartMs, list[1].StartMs, list[2].StartMs})
+
+	// 3. 切分后新文件从当前房间名称的章节开始。
+	c := filepath.Join(dir, "c.flv")
+	tracker.split(c, start.Add(10*time.Second))
+	ok = tracker.add(chapters.KindMarker, "marker", start.Add(11*time.Second), -1) != nil
+	assert.True(t, ok)
+	list, err = chapters.Read(chapters.PathOf(c))
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.Equal(t, "title2", list[0].Title)
+	assert.Equal(t, int64(1000), list[1].StartMs)
+}
@@ -0,0 +1,285 @@
+package recorders
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/yuhaohwang/bililive-go/src/instance"
+	"github.com/yuhaohwang/bililive-go/src/live"
+	"github.com/yuhaohwang/bililive-go/src/pkg/chapters"
+	"github.com/yuhaohwang/bililive-go/src/pkg/concat"
+	"github.com/yuhaohwang/bililive-go/src/pkg/events"
+	"github.com/yuhaohwang/bililive-go/src/pkg/integrity"
+	"github.com/yuhaohwang/bililive-go/src/pkg/metadata"
+	"github.com/yuhaohwang/bililive-go/src/pkg/utils"
+	"github.com/yuhaohwang/bililive-go/src/postprocessors"
+)
+
+// concatDurationSlack 是拼接后的时长允许比各分段时长之和短的部分，用于容忍封装格式的时间戳取整。
+const concatDurationSlack int64 = 100
+
+// heldFile 是等待直播场次结束后拼接的录制文件。
+type heldFile struct {
+	file string
+	info *live.Info
+}
+
+// holds 返回录制文件是否需要等待直播场次结束后拼接。
+func (s *session) holds() bool {
+	return s != nil && s.concat.Enable
+}
+
+// hold 记录等待拼接的录制文件。
+func (s *session) hold(file string, info *live.Info) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.held = append(s.held, heldFile{file: file, info: info})
+}
+
+// concatFileName 返回拼接后的文件名。
+func concatFileName(first string) string {
+	ext := filepath.Ext(first)
+	return strings.TrimSuffix(first, ext) + ".concat" + ext
+}
+
+// finishConcat 拼接直播场次的所有分段，保存清单并通知场次结束，再提交录制后处理任务。
+func (s *session) finishConcat() {
+	// 1. 按分段顺序排列等待拼接的录制文件。
+	s.lock.Lock()
+	held := append([]heldFile(nil), s.held...)
+	index := make(map[string]int, len(s.manifest.Segments))
+	for _, seg := range s.manifest.Segments {
+		index[seg.File] = seg.Index
+	}
+	s.lock.Unlock()
+	sort.SliceStable(held, func(i, j int) bool {
+		a, aok := index[held[i].file]
+		b, bok := index[held[j].file]
+		return aok && (!bok || a < b)
+	})
+
+	// 2. 拼接分段，失败时保留原分段。
+	files, err := s.concatSegments(held)
+	if err != nil {
+		s.logger.WithError(err).Warnf("直播场次[%s]的录制文件未拼接，保留原分段", s.manifest.ID)
+	}
+
+	// 3. 保存清单，通知场次结束。
+	s.lock.Lock()
+	s.saveLocked()
+	s.logger.Infof("直播场次[%s]结束，共%d个录制文件", s.manifest.ID, len(s.manifest.Segments))
+	s.dispatchLocked(SessionEnd)
+	s.lock.Unlock()
+
+	// 4. 提交录制后处理任务。
+	ppm, ok := instance.GetInstance(s.ctx).PostProcessorManager.(postprocessors.Manager)
+	if !ok {
+		return
+	}
+	for _, h := range files {
+		if _, err := ppm.Submit(s.ctx, h.info, h.file); err != nil {
+			s.logger.WithError(err).Error("提交录制后处理任务失败")
+		}
+	}
+}
+
+// concatSegments 将分段无损拼接为一个文件，校验通过后按配置删除原分段，返回需要进行录制后处理的文件。
+// 分段少于两个时不拼接；分段有冗余副本、格式或编码不一致、拼接或校验失败时返回原分段和错误。
+func (s *session) concatSegments(held []heldFile) ([]heldFile, error) {
+	if len(held) < 2 {
+		return held, nil
+	}
+
+	// 1. 检查各个分段的完整性检查结果，编码一致时才能拼接。
+	parts := make([]string, len(held))
+	mds := make([]*metadata.Metadata, len(held))
+	for i, h := range held {
+		md, err := metadata.Read(metadata.PathOf(h.file))
+		if err != nil {
+			return held, err
+		}
+		if len(md.Copies) > 0 {
+			return held, fmt.Errorf("分段有冗余副本: %s", h.file)
+		}
+		if md.IntegrityReport == nil {
+			return held, fmt.Errorf("分段没有完整性检查结果: %s", h.file)
+		}
+		parts[i], mds[i] = h.file, md
+	}
+	if err := checkCompatible(mds); err != nil {
+		return held, err
+	}
+
+	// 2. 拼接并校验拼接后的文件。
+	ffmpegPath, _ := utils.GetFFmpegPath(s.ctx)
+	out := concatFileName(parts[0])
+	if err := concat.Files(s.ctx, ffmpegPath, out, parts); err != nil {
+		return held, err
+	}
+	report, err := verifyConcat(out, mds)
+	if err != nil {
+		os.Remove(out)
+		return held, err
+	}
+
+	// 3. 以第一个分段的元数据为基础写入拼接后文件的元数据。
+	if err := s.saveConcatMetadata(out, parts, mds, report); err != nil {
+		os.Remove(out)
+		os.Remove(metadata.PathOf(out))
+		return held, err
+	}
+	if err := mergeChapters(out, parts, mds); err != nil {
+		s.logger.WithError(err).Warn("合并分段的章节失败")
+	}
+
+	// 4. 删除原分段，拼接后的文件改用第一个分段的文件名。
+	if !s.concat.KeepParts {
+		for _, part := range parts {
+			os.Remove(part)
+			os.Remove(metadata.PathOf(part))
+			os.Remove(chapters.PathOf(part))
+		}
+		if err := os.Rename(metadata.PathOf(out), metadata.PathOf(parts[0])); err == nil {
+			if err := os.Rename(out, parts[0]); err == nil {
+				os.Rename(chapters.PathOf(out), chapters.PathOf(parts[0]))
+				out = parts[0]
+			} else {
+				os.Rename(metadata.PathOf(parts[0]), metadata.PathOf(out))
+			}
+		}
+	}
+	s.logger.Infof("直播场次[%s]的%d个分段已拼接为: %s", s.manifest.ID, len(parts), out)
+
+	// 5. 在清单中记录拼接后的文件，标记改为相对于拼接后文件的位置，并通知索引等模块。
+	offsets := make(map[string]int64, len(parts))
+	var offset int64
+	for i, part := range parts {
+		offsets[part] = offset
+		offset += mds[i].IntegrityReport.DurationMs
+	}
+	s.lock.Lock()
+	s.manifest.File = out
+	for _, c := range s.manifest.Markers {
+		if offset, ok := offsets[c.File]; ok {
+			c.File = out
+			c.StartMs += offset
+		}
+	}
+	s.lock.Unlock()
+	if s.ed != nil {
+		s.ed.DispatchEvent(events.NewEvent(RecordingFinished, out))
+	}
+	return []heldFile{{file: out, info: held[0].info}}, nil
+}
+
+// checkCompatible 检查各个分段的格式和编码是否一致且没有发生变化。
+func checkCompatible(mds []*metadata.Metadata) error {
+	first := mds[0].IntegrityReport
+	for _, md := range mds {
+		r := md.IntegrityReport
+		switch {
+		case r.Integrity == integrity.LevelBroken:
+			return fmt.Errorf("分段无法播放")
+		case len(r.CodecChanges) > 0:
+			return fmt.Errorf("分段中的编码发生了变化")
+		case r.Format != first.Format || r.VideoCodec != first.VideoCodec || r.AudioCodec != first.AudioCodec:
+			return fmt.Errorf("%w: %s/%s/%s, %s/%s/%s", concat.ErrIncompatible,
+				first.Format, first.VideoCodec, first.AudioCodec, r.Format, r.VideoCodec, r.AudioCodec)
+		}
+	}
+	return nil
+}
+
+// verifyConcat 检查拼接后的文件，帧数和时长不能少于各分段之和，也不能新增时间戳回退。
+func verifyConcat(out string, mds []*metadata.Metadata) (*integrity.Report, error) {
+	report, err := integrity.Verify(out)
+	if err != nil {
+		return nil, err
+	}
+	var frames, jumps int
+	var duration int64
+	for _, md := range mds {
+		r := md.IntegrityReport
+		frames += r.VideoFrames + r.AudioFrames
+		jumps += len(r.Jumps)
+		duration += r.DurationMs
+	}
+	switch {
+	case report.Integrity == integrity.LevelBroken:
+		return nil, fmt.Errorf("拼接后的文件无法播放")
+	case report.VideoFrames+report.AudioFrames < frames:
+		return nil, fmt.Errorf("拼接后的帧数%d少于各分段之和%d", report.VideoFrames+report.AudioFrames, frames)
+	case report.DurationMs < duration-concatDurationSlack*int64(len(mds)):
+		return nil, fmt.Errorf("拼接后的时长%dms少于各分段之和%dms", report.DurationMs, duration)
+	case len(report.Jumps) > jumps:
+		return nil, fmt.Errorf("拼接后的文件出现了时间戳回退")
+	}
+	return report, nil
+}
+
+// mergeChapters 按各分段的时长依次偏移各分段的章节，写入拼接后文件的章节文件。
+// 分段开头与当前房间名称相同的章节是切分时延续的章节，合并时忽略。
+func mergeChapters(out string, parts []string, mds []*metadata.Metadata) error {
+	var merged []chapters.Chapter
+	var offset int64
+	var title string
+	found := false
+	for i, part := range parts {
+		list, err := chapters.Read(chapters.PathOf(part))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		found = found || err == nil
+		for _, c := range list {
+			if c.Kind == chapters.KindTitle {
+				if i > 0 && c.StartMs == 0 && c.Title == title {
+					continue
+				}
+				title = c.Title
+			}
+			c.StartMs += offset
+			merged = append(merged, c)
+		}
+		offset += mds[i].IntegrityReport.DurationMs
+	}
+	if !found {
+		return nil
+	}
+	return chapters.Write(chapters.PathOf(out), merged)
+}
+
+// saveConcatMetadata 复制第一个分段的元数据，并更新为拼接后文件的时间和检查结果。
+func (s *session) saveConcatMetadata(out string, parts []string, mds []*metadata.Metadata, report *integrity.Report) error {
+	b, err := os.ReadFile(metadata.PathOf(parts[0]))
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(metadata.PathOf(out), b, 0644); err != nil {
+		return err
+	}
+	names := make([]string, len(parts))
+	for i, part := range parts {
+		names[i] = filepath.Base(part)
+	}
+	first, last := mds[0], mds[len(mds)-1]
+	fields := map[string]interface{}{
+		"recording":        false,
+		"split":            nil,
+		"stall":            nil,
+		"integrity":        report.Integrity,
+		"integrity_report": report,
+		"session":          metadata.SessionRef{ID: s.manifest.ID},
+		"concat_of":        names,
+	}
+	if first.Split != nil {
+		fields["start_time_unix"] = first.Split.StartTimeUnix
+	}
+	fields["end_time_unix"] = last.EndTimeUnix
+	if last.Split != nil && last.Split.EndTimeUnix > 0 {
+		fields["end_time_unix"] = last.Split.EndTimeUnix
+	}
+	return metadata.Update(metadata.PathOf(out), fields)
+}
@@ -0,0 +1,115 @@
+package recorders
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yuhaohwang/bililive-go/src/configs"
+	"github.com/yuhaohwang/bililive-go/src/instance"
+	"github.com/yuhaohwang/bililive-go/src/interfaces"
+	"github.com/yuhaohwang/bililive-go/src/live"
+	"github.com/yuhaohwang/bililive-go/src/pkg/chapters"
+	"github.com/yuhaohwang/bililive-go/src/pkg/integrity"
+	"github.com/yuhaohwang/bililive-go/src/pkg/metadata"
+)
+
+// writeFLVPart 写入一个带序列头、从 start 开始、每 100 毫秒一帧的 FLV 文件，并写入其完整性检查结果。
+func writeFLVPart(t *testing.T, file string, start uint32, frames int, sps byte) {
+	buf := bytes.NewBuffer([]byte{'F', 'L', 'V', 0x01, 0x05, 0, 0, 0, 9})
+	prev := uint32(0)
+	writeTag := func(typ byte, ts uint32, body []byte) {
+		b := make([]byte, 15)
+		binary.BigEndian.PutUint32(b, prev)
+		b[4] = typ
+		b[5], b[6], b[7] = byte(len(body)>>16), byte(len(body)>>8), byte(len(body))
+		b[8], b[9], b[10], b[11] = byte(ts>>16), byte(ts>>8), byte(ts), byte(ts>>24)
+		buf.Write(b)
+		buf.Write(body)
+		prev = uint32(11 + len(body))
+	}
+	writeTag(9, start, []byte{0x17, 0x00, 0, 0, 0, sps})
+	writeTag(8, start, []byte{0xaf, 0x00, 0x12, 0x10})
+	for i := 0; i < frames; i++ {
+		writeTag(9, start+uint32(i*100), []byte{0x27, 0x01, 0, 0, 0, 1, 2})
+		writeTag(8, start+uint32(i*100), []byte{0xaf, 0x01, 1, 2})
+	}
+	binary.Write(buf, binary.BigEndian, prev)
+	assert.NoError(t, os.WriteFile(file, buf.Bytes(), 0644))
+
+	report, err := integrity.Verify(file)
+	assert.NoError(t, err)
+	assert.NoError(t, metadata.Update(metadata.PathOf(file), map[string]interface{}{
+		"room_name":        "title",
+		"integrity":        report.Integrity,
+		"integrity_report": report,
+	}))
+}
+
+func TestSessionConcat(t *testing.T) {
+	ctx := context.WithValue(context.Background(), instance.Key, &instance.Instance{Config: configs.NewConfig()})
+	dir := t.TempDir()
+	s := &session{
+		ctx:      ctx,
+		manifest: &Session{ID: "test"},
+		logger:   &interfaces.Logger{Logger: logrus.New()},
+	}
+	info := &live.Info{}
+	a, b := filepath.Join(dir, "a.flv"), filepath.Join(dir, "b.flv")
+
+	// 1. 编码参数不一致时保留原分段。
+	writeFLVPart(t, a, 0, 10, 1)
+	writeFLVPart(t, b, 5000, 10, 2)
+	held := []heldFile{{a, info}, {b, info}}
+	files, err := s.concatSegments(held)
+	assert.Error(t, err)
+	assert.Equal(t, held, files)
+	assert.FileExists(t, b)
+	assert.NoFileExists(t, concatFileName(a))
+
+	// 2. 保留原分段时拼接为单独的文件。
+	writeFLVPart(t, b, 5000, 10, 1)
+	s.concat.KeepParts = true
+	files, err = s.concatSegments(held)
+	assert.NoError(t, err)
+	assert.Equal(t, []heldFile{{concatFileName(a), info}}, files)
+	assert.FileExists(t, b)
+	md, err := metadata.Read(metadata.PathOf(concatFileName(a)))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a.flv", "b.flv"}, md.ConcatOf)
+	assert.Equal(t, "title", md.RoomName)
+	assert.Equal(t, int64(1900), md.IntegrityReport.DurationMs)
+	assert.Equal(t, &metadata.SessionRef{ID: "test"}, md.Session)
+
+	// 3. 不保留原分段时删除原分段，拼接后的文件使用第一个分段的文件名，各分段的章节按时长偏移后合并。
+	assert.NoError(t, chapters.Write(chapters.PathOf(a), []chapters.Chapter{
+		{Kind: chapters.KindTitle, Title: "title"},
+		{StartMs: 500, Kind: chapters.KindTitle, Title: "title2"},
+	}))
+	assert.NoError(t, chapters.Write(chapters.PathOf(b), []chapters.Chapter{
+		{Kind: chapters.KindTitle, Title: "title2"},
+		{StartMs: 300, Kind: chapters.KindMarker, Title: "marker"},
+	}))
+	s.concat.KeepParts = false
+	files, err = s.concatSegments(held)
+	assert.NoError(t, err)
+	assert.Equal(t, []heldFile{{a, info}}, files)
+	assert.NoFileExists(t, b)
+	assert.NoFileExists(t, metadata.PathOf(b))
+	assert.NoFileExists(t, concatFileName(a))
+	assert.Equal(t, a, s.manifest.File)
+	md, err = metadata.Read(metadata.PathOf(a))
+	assert.NoError(t, err)
+	assert.Equal(t, 20, md.IntegrityReport.VideoFrames)
+	assert.NoFileExists(t, chapters.PathOf(b))
+	list, err := chapters.Read(chapters.PathOf(a))
+	assert.NoError(t, err)
+	assert.Len(t, list, 3)
+	assert.Equal(t, int64(1200), list[2].StartMs)
+}
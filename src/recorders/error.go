@@ -6,6 +6,9 @@ var (
 	// ErrRecorderExist 表示已存在的记录器错误。
 	ErrRecorderExist = errors.New("recorder is exist")
 
+	// ErrRecorderQueued 表示直播间已在等待录制。
+	ErrRecorderQueued = errors.New("recorder is queued")
+
 	// ErrRecorderNotExist 表示不存在的记录器错误。
 	ErrRecorderNotExist = errors.New("recorder is not exist")
 
@@ -20,4 +23,13 @@ var (
 
 	// ErrRecordNotEnabled 表示录制未启用
 	ErrRecordNotEnabled = errors.New("record is not enabled")
+
+	// ErrSessionNotExist 表示直播场次不存在
+	ErrSessionNotExist = errors.New("session is not exist")
+
+	// ErrNotRecording 表示当前没有正在录制的文件
+	ErrNotRecording = errors.New("recorder is not recording")
+
+	// ErrShutdownTimeout 表示退出时有录制器未能在期限内结束
+	ErrShutdownTimeout = errors.New("recorders did not finish before shutdown deadline")
 )
@@ -10,3 +10,24 @@ const RecorderStop events.EventType = "RecorderStop"
 
 // RecorderRestart 是一个事件类型，表示录制器重新启动录制。
 const RecorderRestart events.EventType = "RecorderRestart"
+
+// RecorderStalled 是一个事件类型，表示录制器因直播流停滞而重新拉流。
+const RecorderStalled events.EventType = "RecorderStalled"
+
+// RecordingVerified 是一个事件类型，表示录制文件已完成完整性检查。
+const RecordingVerified events.EventType = "RecordingVerified"
+
+// RecordingFinished 是一个事件类型，表示录制文件已写入完成并检查完毕，事件对象为文件路径。
+const RecordingFinished events.EventType = "RecordingFinished"
+
+// RecordingRecovered 是一个事件类型，表示启动时修复了上次异常退出时未正常结束的录制文件，事件对象为文件路径。
+const RecordingRecovered events.EventType = "RecordingRecovered"
+
+// SessionStart 是一个事件类型，表示一场直播开始，事件对象为直播场次清单 *Session。
+const SessionStart events.EventType = "SessionStart"
+
+// SessionEnd 是一个事件类型，表示一场直播的所有录制文件均已写入完成，事件对象为直播场次清单 *Session。
+const SessionEnd events.EventType = "SessionEnd"
+
+// MarkerAdded 是一个事件类型，表示在正在录制的文件中添加了标记，事件对象为 *Chapter。
+const MarkerAdded events.EventType = "MarkerAdded"
@@ -2,14 +2,18 @@ package recorders
 
 import (
 	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
 	"sync"
-	"time"
 
 	"github.com/yuhaohwang/bililive-go/src/configs"
+	"github.com/yuhaohwang/bililive-go/src/disk"
 	"github.com/yuhaohwang/bililive-go/src/instance"
 	"github.com/yuhaohwang/bililive-go/src/interfaces"
 	"github.com/yuhaohwang/bililive-go/src/listeners"
 	"github.com/yuhaohwang/bililive-go/src/live"
+	"github.com/yuhaohwang/bililive-go/src/pkg/chapters"
 	"github.com/yuhaohwang/bililive-go/src/pkg/events"
 )
 
@@ -17,7 +21,11 @@ import (
 func NewManager(ctx context.Context) Manager {
 	rm := &manager{
 		recorders: make(map[live.ID]Recorder),
+		closing:   make(map[Recorder]live.ID),
+		waiting:   make(map[live.ID]*QueueItem),
+		sessions:  newSessionRegistry(),
 		cfg:       instance.GetInstance(ctx).Config,
+		stop:      make(chan struct{}),
 	}
 	instance.GetInstance(ctx).RecorderManager = rm
 
@@ -32,6 +40,11 @@ type Manager interface {
 	RestartRecorder(ctx context.Context, liveId live.Live) error
 	GetRecorder(ctx context.Context, liveId live.ID) (Recorder, error)
 	HasRecorder(ctx context.Context, liveId live.ID) bool
+	GetQueueStatus(ctx context.Context) QueueStatus
+	AddMarker(ctx context.Context, liveId live.ID, label string) (*Chapter, error)
+	GetMarkers(ctx context.Context, liveId live.ID) []*Chapter
+	GetStatuses(ctx context.Context) []*Status
+	Shutdown(ctx context.Context) error
 }
 
 // 用于测试的变量
@@ -43,7 +56,11 @@ var (
 type manager struct {
 	lock      sync.RWMutex
 	recorders map[live.ID]Recorder
+	closing   map[Recorder]live.ID   // 已关闭但仍在写入文件的录制器，退出时需要等待它们结束
+	waiting   map[live.ID]*QueueItem // 因超过同时录制上限而等待录制的直播间
+	sessions  *sessionRegistry       // 各直播间当前的直播场次
 	cfg       *configs.Config
+	stop      chan struct{}
 }
 
 // registryListener 注册事件监听器以响应直播开始、房间名称更改、监听停止等事件。
@@ -71,10 +88,18 @@ func (m *manager) registryListener(ctx context.Context, ed events.Dispatcher) {
 			return
 		}
 
+		// 断网恢复后录制器仍在录制，沿用原来的直播场次，否则开始新的直播场次。
+		if !m.HasRecorder(ctx, live.GetLiveId()) && !m.isQueued(live.GetLiveId()) {
+			m.sessions.start(ctx, live)
+		}
+
 		// 尝试添加一个新的录制器。
 		if err := m.AddRecorder(ctx, live); err != nil {
-			// 如果添加录制器失败，则记录错误。
+			// 如果添加录制器失败，则记录错误并结束直播场次。
 			instance.GetInstance(ctx).Logger.Errorf("failed to add recorder, err: %v", err)
+			if err != ErrRecorderExist && err != ErrRecorderQueued {
+				m.sessions.end(live.GetLiveId())
+			}
 		}
 	}))
 
@@ -85,30 +110,69 @@ func (m *manager) registryListener(ctx context.Context, ed events.Dispatcher) {
 		if !m.HasRecorder(ctx, live.GetLiveId()) {
 			return
 		}
+		// 记录新的房间名。
+		m.sessions.addTitle(live.GetLiveId(), roomNameOf(ctx, live))
 		// 尝试重启录制器。
 		if err := m.RestartRecorder(ctx, live); err != nil {
 			// 如果重启录制器失败，则记录错误。
-			instance.GetInstance(ctx).Logger.Errorf("failed to cronRestart recorder, err: %v", err)
+			instance.GetInstance(ctx).Logger.Errorf("failed to restart recorder, err: %v", err)
+		}
+	}))
+
+	// 3. 以章节模式录制时，房间名称或分区变化时在正在录制的文件中添加章节。
+	ed.AddEventListener(listeners.RoomInfoChanged, events.NewEventListener(func(event *events.Event) {
+		live := event.Object.(live.Live) // 类型断言。
+		recorder, err := m.GetRecorder(ctx, live.GetLiveId())
+		if err != nil {
+			return
+		}
+		info := infoOf(ctx, live)
+		if info == nil {
+			return
+		}
+		m.sessions.addTitle(live.GetLiveId(), info.RoomName)
+		recorder.AddChapter(chapters.KindTitle, info.RoomName)
+		if info.Category != "" {
+			recorder.AddChapter(chapters.KindCategory, info.Category)
 		}
 	}))
 
-	// 3. 创建一个通用的事件监听器来移除录制器。
+	// 4. 创建一个通用的事件监听器来移除录制器。
 	removeEvtListener := events.NewEventListener(func(event *events.Event) {
 		live := event.Object.(live.Live) // 类型断言。
-		// 检查是否有对应的录制器。
-		if !m.HasRecorder(ctx, live.GetLiveId()) {
+		// 断网期间保留录制器和直播场次，由录制器自行重试，避免误删。
+		if event.Type == listeners.LiveEnd && isOutage(ctx) {
+			return
+		}
+		// 结束直播场次，最后一个录制文件写入完成后才会发出场次结束事件。
+		defer m.sessions.end(live.GetLiveId())
+		// 检查是否有对应的录制器或正在等待录制。
+		if !m.HasRecorder(ctx, live.GetLiveId()) && !m.isQueued(live.GetLiveId()) {
 			return
 		}
 		// 尝试移除录制器。
-		if err := m.RemoveRecorder(ctx, live.GetLiveId()); err != nil {
+		reason := SegmentEndStopped
+		if event.Type == listeners.LiveEnd {
+			reason = SegmentEndLiveEnd
+		}
+		if err := m.removeRecorder(ctx, live.GetLiveId(), reason); err != nil {
 			// 如果移除录制器失败，则记录错误。
 			instance.GetInstance(ctx).Logger.Errorf("failed to remove recorder, err: %v", err)
 		}
 	})
 
-	// 4. 使用上面创建的通用监听器来监听直播结束和监听停止事件。
+	// 5. 使用上面创建的通用监听器来监听直播结束和监听停止事件。
 	ed.AddEventListener(listeners.LiveEnd, removeEvtListener)
 	ed.AddEventListener(listeners.ListenStop, removeEvtListener)
+
+	// 6. 磁盘剩余空间低于停止阈值时，停止该输出目录下优先级最低的录制。
+	ed.AddEventListener(disk.DiskLow, events.NewEventListener(func(event *events.Event) {
+		status := event.Object.(*disk.Status)
+		if status.Level != disk.LevelStop {
+			return
+		}
+		m.stopLowestPriority(ctx, status.Path)
+	}))
 }
 
 // Start 启动 Recorder Manager 并注册事件监听器。
@@ -121,6 +185,13 @@ func (m *manager) Start(ctx context.Context) error {
 	}
 	// 3. 注册事件监听器。
 	m.registryListener(ctx, inst.EventDispatcher.(events.Dispatcher))
+	// 4. 定期推送录制器状态。
+	go m.broadcastStatus(ctx)
+	// 5. 在开始新的录制前找出上次异常退出时未正常结束的录制文件，并在后台修复。
+	if orphans := findOrphans(inst.Config.OutputRoots()); len(orphans) > 0 {
+		inst.Logger.Warnf("发现%d个未正常结束的录制文件，正在修复", len(orphans))
+		go m.recoverOrphans(ctx, orphans)
+	}
 	return nil
 }
 
@@ -129,16 +200,72 @@ func (m *manager) Close(ctx context.Context) {
 	// 1. 获取锁以同步操作。
 	m.lock.Lock()
 	defer m.lock.Unlock()
-	// 2. 关闭所有活跃的录制器。
-	for id, recorder := range m.recorders {
-		recorder.Close()
-		delete(m.recorders, id)
+	// 2. 关闭所有活跃的录制器并结束直播场次。
+	for id := range m.recorders {
+		m.closeRecorderLocked(id, SegmentEndStopped)
 	}
+	m.waiting = make(map[live.ID]*QueueItem)
+	m.sessions.endAll()
+	close(m.stop)
 	// 3. 减少等待组的计数。
 	inst := instance.GetInstance(ctx)
 	inst.WaitGroup.Done()
 }
 
+// Shutdown 关闭 Recorder Manager，并等待所有录制器的录制文件关闭、元数据写入完成，
+// 包括关闭 Recorder Manager 前已被移除但仍在写入文件的录制器，
+// 再等待录制文件的完整性检查、录制后处理任务的提交和直播场次的拼接完成。
+// ctx 结束时仍未结束的录制器会记录到日志中，并返回 ErrShutdownTimeout。
+func (m *manager) Shutdown(ctx context.Context) error {
+	// 1. 关闭 Recorder Manager，记录需要等待的录制器。
+	m.Close(ctx)
+	m.lock.RLock()
+	recorders := make(map[Recorder]live.ID, len(m.closing))
+	for recorder, id := range m.closing {
+		recorders[recorder] = id
+	}
+	m.lock.RUnlock()
+
+	// 2. 等待所有录制器结束。
+	for recorder := range recorders {
+		select {
+		case <-recorder.Done():
+			delete(recorders, recorder)
+		case <-ctx.Done():
+		}
+	}
+	logger := instance.GetInstance(ctx).Logger
+	if len(recorders) > 0 {
+		for _, id := range recorders {
+			logger.WithField("live_id", id).Warn("录制器未能在退出期限内结束，录制文件可能不完整")
+		}
+		return fmt.Errorf("%w: %d 个录制器未结束", ErrShutdownTimeout, len(recorders))
+	}
+
+	// 3. 录制器结束后不会再有新的后台任务，等待已有的任务完成。
+	if !m.sessions.wait(ctx) {
+		logger.Warn("录制文件的检查或拼接未能在退出期限内完成，部分录制文件未提交录制后处理")
+		return fmt.Errorf("%w: 后台任务未完成", ErrShutdownTimeout)
+	}
+	return nil
+}
+
+// closeRecorderLocked 关闭录制器并从管理器中移除，reason 为写入直播场次清单的停止原因，调用方需持有写锁。
+// 关闭后的录制器仍可能在写入文件，退出时需要等待它结束。
+func (m *manager) closeRecorderLocked(liveId live.ID, reason string) {
+	recorder := m.recorders[liveId]
+	setStopReason(recorder, reason)
+	recorder.Close()
+	delete(m.recorders, liveId)
+	m.closing[recorder] = liveId
+	go func() {
+		<-recorder.Done()
+		m.lock.Lock()
+		delete(m.closing, recorder)
+		m.lock.Unlock()
+	}()
+}
+
 // AddRecorder 添加一个录制器。
 func (m *manager) AddRecorder(ctx context.Context, live live.Live) error {
 
@@ -176,68 +303,69 @@ func (m *manager) AddRecorder(ctx context.Context, live live.Live) error {
 	if _, ok := m.recorders[live.GetLiveId()]; ok {
 		return ErrRecorderExist
 	}
-	// 3. 创建新的录制器。
-	recorder, err := newRecorder(ctx, live)
-	if err != nil {
-		return err
+	if _, ok := m.waiting[live.GetLiveId()]; ok {
+		return ErrRecorderQueued
 	}
-	// 4. 将新录制器添加到管理器。
-	m.recorders[live.GetLiveId()] = recorder
-	// 5. 如果配置了视频分割，启动定时重启任务。
-	if maxDur := m.cfg.VideoSplitStrategies.MaxDuration; maxDur != 0 {
-		go m.cronRestart(ctx, live)
+	// 3. 达到同时录制上限时，停止优先级更低的录制，否则加入等待队列。
+	if !m.hasSlotLocked(ctx) && !m.preemptLocked(ctx, m.priorityOf(ctx, live.GetRawUrl())) {
+		m.enqueueLocked(ctx, live, false)
+		inst.Logger.Infof("已达到同时录制上限，直播间[%s]等待录制", live.GetLiveId())
+		return nil
 	}
-	// 6. 启动录制器。
-	return recorder.Start(ctx)
+	// 4. 创建并启动新的录制器。
+	return m.startLocked(ctx, live)
 }
 
-// cronRestart 定期重新启动录制器，用于分割视频。
-func (m *manager) cronRestart(ctx context.Context, live live.Live) {
-	// 1. 获取指定的录制器。
-	recorder, err := m.GetRecorder(ctx, live.GetLiveId())
+// startLocked 创建并启动录制器，调用方需持有锁。
+func (m *manager) startLocked(ctx context.Context, live live.Live) error {
+	// 1. 创建新的录制器。
+	recorder, err := newRecorder(ctx, live)
 	if err != nil {
-		return
-	}
-	// 2. 检查是否需要重新启动录制器。
-	if time.Since(recorder.StartTime()) < m.cfg.VideoSplitStrategies.MaxDuration {
-		time.AfterFunc(time.Minute/4, func() {
-			m.cronRestart(ctx, live)
-		})
-		return
-	}
-	// 3. 重新启动录制器。
-	if err := m.RestartRecorder(ctx, live); err != nil {
-		return
+		return err
 	}
+	// 2. 将新录制器添加到管理器。
+	m.recorders[live.GetLiveId()] = recorder
+	// 3. 启动录制器，按时长和大小分割视频由解析器无缝完成。
+	return recorder.Start(ctx)
 }
 
-// RestartRecorder 重新启动录制器，用于分割视频。
+// RestartRecorder 重新启动录制器，新的录制器沿用原录制器的名额。
 func (m *manager) RestartRecorder(ctx context.Context, live live.Live) error {
-	// 1. 移除当前录制器。
-	if err := m.RemoveRecorder(ctx, live.GetLiveId()); err != nil {
-		return err
-	}
-	// 2. 添加新的录制器。
-	if err := m.AddRecorder(ctx, live); err != nil {
-		return err
+	// 1. 加锁以同步操作。
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	// 2. 关闭当前录制器。
+	if _, ok := m.recorders[live.GetLiveId()]; !ok {
+		return ErrRecorderNotExist
 	}
-	return nil
+	m.closeRecorderLocked(live.GetLiveId(), SegmentEndRoomNameChanged)
+	// 3. 创建并启动新的录制器。
+	return m.startLocked(ctx, live)
 }
 
 // RemoveRecorder 移除录制器。
 func (m *manager) RemoveRecorder(ctx context.Context, liveId live.ID) error {
+	return m.removeRecorder(ctx, liveId, SegmentEndStopped)
+}
+
+// removeRecorder 移除录制器，reason 为写入直播场次清单的停止原因。
+func (m *manager) removeRecorder(ctx context.Context, liveId live.ID, reason string) error {
 	// 1. 加锁以同步操作。
 	m.lock.Lock()
 	defer m.lock.Unlock()
-	// 2. 检查录制器是否存在。
-	recorder, ok := m.recorders[liveId]
-	if !ok {
+	// 2. 等待录制的直播间直接移出等待队列。
+	if _, ok := m.waiting[liveId]; ok {
+		delete(m.waiting, liveId)
+		return nil
+	}
+	// 3. 检查录制器是否存在。
+	if _, ok := m.recorders[liveId]; !ok {
 		return ErrRecorderNotExist
 	}
-	// 3. 关闭录制器。
-	recorder.Close()
-	// 4. 从管理器中移除录制器。
-	delete(m.recorders, liveId)
+	// 4. 关闭录制器并从管理器中移除。
+	m.closeRecorderLocked(liveId, reason)
+	// 5. 空出的名额交给等待中的直播间。
+	m.dequeueLocked(ctx)
 	return nil
 }
 
@@ -263,3 +391,78 @@ func (m *manager) HasRecorder(ctx context.Context, liveId live.ID) bool {
 	_, ok := m.recorders[liveId]
 	return ok
 }
+
+// stopLowestPriority 结束输出目录位于 root 之下、优先级最低的一个正在录制的文件，
+// 优先级相同时优先停止最晚开始的录制。
+func (m *manager) stopLowestPriority(ctx context.Context, root string) {
+	// 1. 获取输出目录位于 root 之下的录制器及其优先级。
+	inst := instance.GetInstance(ctx)
+	type candidate struct {
+		id       live.ID
+		recorder Recorder
+		priority int
+	}
+	m.lock.RLock()
+	candidates := make([]candidate, 0, len(m.recorders))
+	for id, r := range m.recorders {
+		c := candidate{id: id, recorder: r}
+		if l, ok := inst.Lives[id]; ok {
+			path, err := filepath.Abs(m.cfg.EffectiveConfig(l.GetRawUrl()).OutPutPath)
+			if err == nil && !disk.IsUnder(path, root) {
+				continue
+			}
+			if room, err := m.cfg.GetLiveRoomByUrl(l.GetRawUrl()); err == nil {
+				c.priority = room.Priority
+			}
+		}
+		candidates = append(candidates, c)
+	}
+	m.lock.RUnlock()
+
+	// 2. 按优先级从低到高排序。
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].priority != candidates[j].priority {
+			return candidates[i].priority < candidates[j].priority
+		}
+		return candidates[i].recorder.StartTime().After(candidates[j].recorder.StartTime())
+	})
+
+	// 3. 停止第一个正在录制的文件。
+	for _, c := range candidates {
+		setStopReason(c.recorder, SegmentEndDiskLow)
+		if c.recorder.StopCurrent() {
+			inst.Logger.Warnf("磁盘剩余空间不足，已停止录制[%s]", c.id)
+			return
+		}
+		setStopReason(c.recorder, "")
+	}
+}
+
+// infoOf 返回缓存中直播间的信息，没有缓存时返回 nil。
+func infoOf(ctx context.Context, l live.Live) *live.Info {
+	obj, err := instance.GetInstance(ctx).Cache.Get(l)
+	if err != nil {
+		return nil
+	}
+	return obj.(*live.Info)
+}
+
+// roomNameOf 返回缓存中直播间的房间名。
+func roomNameOf(ctx context.Context, l live.Live) string {
+	if info := infoOf(ctx, l); info != nil {
+		return info.RoomName
+	}
+	return ""
+}
+
+// isDiskCritical 返回输出目录所在磁盘的剩余空间是否低于严重阈值。
+func isDiskCritical(ctx context.Context, path string) bool {
+	dm, ok := instance.GetInstance(ctx).DiskMonitor.(disk.Monitor)
+	return ok && dm.LevelOf(path) >= disk.LevelCritical
+}
+
+// isOutage 返回监听器管理器是否处于断网状态。
+func isOutage(ctx context.Context) bool {
+	lm, ok := instance.GetInstance(ctx).ListenerManager.(listeners.Manager)
+	return ok && lm.IsOutage()
+}
@@ -2,45 +2,265 @@ package recorders
 
 import (
 	"context"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 
 	"github.com/yuhaohwang/bililive-go/src/configs"
 	"github.com/yuhaohwang/bililive-go/src/instance"
+	"github.com/yuhaohwang/bililive-go/src/listeners"
 	"github.com/yuhaohwang/bililive-go/src/live"
 	livemock "github.com/yuhaohwang/bililive-go/src/live/mock"
+	"github.com/yuhaohwang/bililive-go/src/log"
 )
 
+// fakeListenerManager 是一个总是处于监听状态的监听器管理器。
+type fakeListenerManager struct {
+	listeners.Manager
+}
+
+func (fakeListenerManager) HasListener(ctx context.Context, liveId live.ID) bool {
+	return true
+}
+
+func (fakeListenerManager) IsOutage() bool {
+	return false
+}
+
 func TestManagerAddAndRemoveRecorder(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
+	cfg := configs.NewConfig()
+	cfg.LiveRooms = []configs.LiveRoom{{Url: "https://example.com/test", Listen: true, Record: true}}
+	cfg.RefreshLiveRoomIndexCache()
 	ctx := context.WithValue(context.Background(), instance.Key, &instance.Instance{
-		Config: new(configs.Config),
+		Config:          cfg,
+		ListenerManager: fakeListenerManager{},
 	})
 	m := NewManager(ctx)
 	backup := newRecorder
 	newRecorder = func(ctx context.Context, live live.Live) (Recorder, error) {
+		done := make(chan struct{})
 		r := NewMockRecorder(ctrl)
 		r.EXPECT().Start(ctx).Return(nil)
-		r.EXPECT().Close()
+		r.EXPECT().Close().Do(func() { close(done) })
+		r.EXPECT().Done().Return((<-chan struct{})(done)).AnyTimes()
 		return r, nil
 	}
 	defer func() { newRecorder = backup }()
 	l := livemock.NewMockLive(ctrl)
 	l.EXPECT().GetLiveId().Return(live.ID("test")).AnyTimes()
-	assert.NoError(t, m.AddRecorder(context.Background(), l))
-	assert.Equal(t, ErrRecorderExist, m.AddRecorder(context.Background(), l))
-	ln, err := m.GetRecorder(context.Background(), "test")
+	l.EXPECT().GetRawUrl().Return("https://example.com/test").AnyTimes()
+	assert.NoError(t, m.AddRecorder(ctx, l))
+	assert.Equal(t, ErrRecorderExist, m.AddRecorder(ctx, l))
+	ln, err := m.GetRecorder(ctx, "test")
 	assert.NoError(t, err)
 	assert.NotNil(t, ln)
-	assert.True(t, m.HasRecorder(context.Background(), "test"))
-	assert.NoError(t, m.RestartRecorder(context.Background(), l))
-	assert.NoError(t, m.RemoveRecorder(context.Background(), "test"))
-	assert.Equal(t, ErrRecorderNotExist, m.RemoveRecorder(context.Background(), "test"))
-	_, err = m.GetRecorder(context.Background(), "test")
+	assert.True(t, m.HasRecorder(ctx, "test"))
+	assert.NoError(t, m.RestartRecorder(ctx, l))
+	assert.NoError(t, m.RemoveRecorder(ctx, "test"))
+	assert.Equal(t, ErrRecorderNotExist, m.RemoveRecorder(ctx, "test"))
+	_, err = m.GetRecorder(ctx, "test")
 	assert.Equal(t, ErrRecorderNotExist, err)
-	assert.False(t, m.HasRecorder(context.Background(), "test"))
+	assert.False(t, m.HasRecorder(ctx, "test"))
+}
+
+func TestManagerStopLowestPriority(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cfg := configs.NewConfig()
+	other := t.TempDir()
+	cfg.OutPutPath = t.TempDir()
+	cfg.LiveRooms = []configs.LiveRoom{
+		{Url: "https://example.com/high", Priority: 10},
+		{Url: "https://example.com/low", Priority: -1},
+		{Url: "https://example.com/idle", Priority: -5},
+		{Url: "https://example.com/other", Priority: -10, RoomConfig: configs.RoomConfig{OutPutPath: &other}},
+	}
+	cfg.Log.OutPutFolder = t.TempDir()
+	cfg.RefreshLiveRoomIndexCache()
+	lives := make(map[live.ID]live.Live)
+	for _, room := range cfg.LiveRooms {
+		l := livemock.NewMockLive(ctrl)
+		l.EXPECT().GetRawUrl().Return(room.Url).AnyTimes()
+		lives[live.ID(room.Url)] = l
+	}
+	ctx := context.WithValue(context.Background(), instance.Key, &instance.Instance{
+		Config: cfg,
+		Lives:  lives,
+	})
+	log.New(ctx)
+	m := NewManager(ctx).(*manager)
+
+	high, low, idle, otherRec := NewMockRecorder(ctrl), NewMockRecorder(ctrl), NewMockRecorder(ctrl), NewMockRecorder(ctrl)
+	for _, r := range []*MockRecorder{high, low, idle, otherRec} {
+		r.EXPECT().StartTime().Return(time.Now()).AnyTimes()
+	}
+	m.recorders[live.ID("https://example.com/high")] = high
+	m.recorders[live.ID("https://example.com/low")] = low
+	m.recorders[live.ID("https://example.com/idle")] = idle
+	m.recorders[live.ID("https://example.com/other")] = otherRec
+
+	// 优先级最低的录制器没有正在录制的文件时，停止下一个，其他输出目录下的录制不受影响
+	gomock.InOrder(
+		idle.EXPECT().StopCurrent().Return(false),
+		low.EXPECT().StopCurrent().Return(true),
+	)
+	m.stopLowestPriority(ctx, cfg.OutPutPath)
+}
+
+func TestManagerQueue(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cfg := configs.NewConfig()
+	cfg.MaxRecordings = 1
+	cfg.LiveRooms = []configs.LiveRoom{
+		{Url: "https://example.com/low", Listen: true, Record: true, Priority: -1},
+		{Url: "https://example.com/mid", Listen: true, Record: true},
+		{Url: "https://example.com/high", Listen: true, Record: true, Priority: 10},
+	}
+	cfg.Log.OutPutFolder = t.TempDir()
+	cfg.RefreshLiveRoomIndexCache()
+	lives := make(map[live.ID]live.Live)
+	for _, room := range cfg.LiveRooms {
+		l := livemock.NewMockLive(ctrl)
+		l.EXPECT().GetLiveId().Return(live.ID(room.Url)).AnyTimes()
+		l.EXPECT().GetRawUrl().Return(room.Url).AnyTimes()
+		lives[live.ID(room.Url)] = l
+	}
+	ctx := context.WithValue(context.Background(), instance.Key, &instance.Instance{
+		Config:          cfg,
+		Lives:           lives,
+		ListenerManager: fakeListenerManager{},
+	})
+	log.New(ctx)
+	m := NewManager(ctx)
+
+	started := make(map[live.ID]int)
+	backup := newRecorder
+	newRecorder = func(ctx context.Context, l live.Live) (Recorder, error) {
+		started[l.GetLiveId()]++
+		done := make(chan struct{})
+		r := NewMockRecorder(ctrl)
+		r.EXPECT().Start(ctx).Return(nil)
+		r.EXPECT().StartTime().Return(time.Now()).AnyTimes()
+		r.EXPECT().Close().Do(func() { close(done) })
+		r.EXPECT().Done().Return((<-chan struct{})(done)).AnyTimes()
+		return r, nil
+	}
+	defer func() { newRecorder = backup }()
+	low, mid, high := lives["https://example.com/low"], lives["https://example.com/mid"], lives["https://example.com/high"]
+
+	// 达到上限后优先级更高的直播间停止低优先级的录制，优先级不高于正在录制的直播间时等待
+	assert.NoError(t, m.AddRecorder(ctx, low))
+	assert.NoError(t, m.AddRecorder(ctx, high))
+	assert.NoError(t, m.AddRecorder(ctx, mid))
+	assert.Equal(t, ErrRecorderQueued, m.AddRecorder(ctx, mid))
+	assert.True(t, m.HasRecorder(ctx, high.GetLiveId()))
+	assert.False(t, m.HasRecorder(ctx, low.GetLiveId()))
+	status := m.GetQueueStatus(ctx)
+	assert.Equal(t, 1, status.MaxRecordings)
+	assert.Equal(t, 1, status.Running)
+	if assert.Len(t, status.Waiting, 2) {
+		assert.Equal(t, mid.GetLiveId(), status.Waiting[0].LiveId)
+		assert.False(t, status.Waiting[0].Preempted)
+		assert.Equal(t, low.GetLiveId(), status.Waiting[1].LiveId)
+		assert.True(t, status.Waiting[1].Preempted)
+	}
+
+	// 录制结束后按优先级开始等待中的录制
+	assert.NoError(t, m.RemoveRecorder(ctx, high.GetLiveId()))
+	assert.True(t, m.HasRecorder(ctx, mid.GetLiveId()))
+
+	// 等待中的直播间下播后移出等待队列
+	assert.NoError(t, m.RemoveRecorder(ctx, low.GetLiveId()))
+	assert.Empty(t, m.GetQueueStatus(ctx).Waiting)
+	assert.NoError(t, m.RemoveRecorder(ctx, mid.GetLiveId()))
+	assert.Equal(t, map[live.ID]int{low.GetLiveId(): 1, mid.GetLiveId(): 1, high.GetLiveId(): 1}, started)
+}
+
+func TestManagerShutdown(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cfg := configs.NewConfig()
+	cfg.LiveRooms = []configs.LiveRoom{
+		{Url: "https://example.com/done", Listen: true, Record: true},
+		{Url: "https://example.com/hang", Listen: true, Record: true},
+	}
+	cfg.Log.OutPutFolder = t.TempDir()
+	cfg.RefreshLiveRoomIndexCache()
+	inst := &instance.Instance{
+		Config:          cfg,
+		ListenerManager: fakeListenerManager{},
+	}
+	ctx := context.WithValue(context.Background(), instance.Key, inst)
+	log.New(ctx)
+	m := NewManager(ctx)
+	inst.WaitGroup.Add(1)
+
+	// 关闭后立即结束的录制器和一直没有结束的录制器
+	backup := newRecorder
+	newRecorder = func(ctx context.Context, l live.Live) (Recorder, error) {
+		done := make(chan struct{})
+		r := NewMockRecorder(ctrl)
+		r.EXPECT().Start(ctx).Return(nil)
+		if l.GetLiveId() == "https://example.com/done" {
+			r.EXPECT().Close().Do(func() { close(done) })
+		} else {
+			r.EXPECT().Close()
+		}
+		r.EXPECT().Done().Return((<-chan struct{})(done)).AnyTimes()
+		return r, nil
+	}
+	defer func() { newRecorder = backup }()
+	for _, room := range cfg.LiveRooms {
+		l := livemock.NewMockLive(ctrl)
+		l.EXPECT().GetLiveId().Return(live.ID(room.Url)).AnyTimes()
+		l.EXPECT().GetRawUrl().Return(room.Url).AnyTimes()
+		assert.NoError(t, m.AddRecorder(ctx, l))
+	}
+
+	// 退出前已被移除但仍在写入文件的录制器也需要等待，期限内没有结束时退出不完整
+	assert.NoError(t, m.RemoveRecorder(ctx, "https://example.com/hang"))
+	shutdownCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, m.Shutdown(shutdownCtx), ErrShutdownTimeout)
+	assert.False(t, m.HasRecorder(ctx, "https://example.com/done"))
+	inst.WaitGroup.Wait()
+
+	// 已结束的录制器从等待列表中移除，只剩下仍在写入文件的录制器
+	mgr := m.(*manager)
+	assert.Eventually(t, func() bool {
+		mgr.lock.RLock()
+		defer mgr.lock.RUnlock()
+		return len(mgr.closing) == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestManagerShutdownWaitsTasks(t *testing.T) {
+	cfg := configs.NewConfig()
+	cfg.Log.OutPutFolder = t.TempDir()
+	inst := &instance.Instance{Config: cfg}
+	ctx := context.WithValue(context.Background(), instance.Key, inst)
+	log.New(ctx)
+	m := NewManager(ctx).(*manager)
+	inst.WaitGroup.Add(1)
+
+	// 录制器结束后仍在检查或拼接的录制文件，退出时需要等待完成
+	var finished int32
+	m.sessions.goTask(func() {
+		time.Sleep(50 * time.Millisecond)
+		atomic.StoreInt32(&finished, 1)
+	})
+	shutdownCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	assert.NoError(t, m.Shutdown(shutdownCtx))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&finished))
 }
@@ -0,0 +1,85 @@
+package recorders
+
+import (
+	"context"
+
+	"github.com/yuhaohwang/bililive-go/src/instance"
+	"github.com/yuhaohwang/bililive-go/src/live"
+	"github.com/yuhaohwang/bililive-go/src/pkg/chapters"
+	"github.com/yuhaohwang/bililive-go/src/pkg/events"
+)
+
+// defaultMarkerLabel 是未指定名称时标记的名称。
+const defaultMarkerLabel = "标记"
+
+// AddMarker 在直播间正在录制的文件的当前位置添加标记，记录到章节文件和直播场次清单中，并通知 WebSocket 客户端。
+func (m *manager) AddMarker(ctx context.Context, liveId live.ID, label string) (*Chapter, error) {
+	// 1. 在正在录制的文件中添加标记。
+	r, err := m.GetRecorder(ctx, liveId)
+	if err != nil {
+		return nil, err
+	}
+	if label == "" {
+		label = defaultMarkerLabel
+	}
+	c, err := r.AddChapter(chapters.KindMarker, label)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. 记录到直播场次清单中。
+	m.sessions.addMarker(liveId, c)
+
+	// 3. 通知标记已添加。
+	inst := instance.GetInstance(ctx)
+	if ed, ok := inst.EventDispatcher.(events.Dispatcher); ok {
+		ed.DispatchEvent(events.NewEvent(MarkerAdded, c))
+	}
+	if wsm := inst.WebsocketManager; wsm != nil {
+		wsm.BroadcastMessage("markerAdded", c)
+	}
+	return c, nil
+}
+
+// GetMarkers 返回直播间当前直播场次中的所有标记。
+func (m *manager) GetMarkers(ctx context.Context, liveId live.ID) []*Chapter {
+	return m.sessions.markers(liveId)
+}
+
+// addMarker 在直播间当前的直播场次中记录标记。
+func (reg *sessionRegistry) addMarker(liveId live.ID, c *Chapter) {
+	reg.lock.Lock()
+	s := reg.sessions[liveId]
+	reg.lock.Unlock()
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	copied := *c
+	s.manifest.Markers = append(s.manifest.Markers, &copied)
+	s.saveLocked()
+}
+
+// markers 返回直播间当前直播场次中所有标记的副本。
+func (reg *sessionRegistry) markers(liveId live.ID) []*Chapter {
+	reg.lock.Lock()
+	s := reg.sessions[liveId]
+	reg.lock.Unlock()
+	if s == nil {
+		return []*Chapter{}
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return copyMarkers(s.manifest.Markers)
+}
+
+// copyMarkers 返回标记列表的副本。
+func copyMarkers(markers []*Chapter) []*Chapter {
+	copied := make([]*Chapter, len(markers))
+	for i, c := range markers {
+		c := *c
+		copied[i] = &c
+	}
+	return copied
+}
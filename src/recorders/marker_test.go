@@ -0,0 +1,60 @@
+package recorders
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bluele/gcache"
+	"github.com/golang/mock/gomock"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yuhaohwang/bililive-go/src/configs"
+	"github.com/yuhaohwang/bililive-go/src/instance"
+	"github.com/yuhaohwang/bililive-go/src/interfaces"
+	"github.com/yuhaohwang/bililive-go/src/live"
+	livemock "github.com/yuhaohwang/bililive-go/src/live/mock"
+	"github.com/yuhaohwang/bililive-go/src/pkg/chapters"
+)
+
+func TestManagerAddMarker(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	cfg := configs.NewConfig()
+	cfg.OutPutPath = t.TempDir()
+	ctx := context.WithValue(context.Background(), instance.Key, &instance.Instance{
+		Config: cfg,
+		Logger: &interfaces.Logger{Logger: logrus.New()},
+		Cache:  gcache.New(4).LRU().Build(),
+	})
+	m := NewManager(ctx).(*manager)
+	l := livemock.NewMockLive(ctrl)
+	l.EXPECT().GetLiveId().Return(live.ID("test")).AnyTimes()
+	l.EXPECT().GetRawUrl().Return("https://example.com/test").AnyTimes()
+	l.EXPECT().GetPlatformCNName().Return("test").AnyTimes()
+	l.EXPECT().GetLastStartTime().Return(time.Time{}).AnyTimes()
+
+	// 1. 没有录制器时无法添加标记。
+	_, err := m.AddMarker(ctx, "test", "")
+	assert.Equal(t, ErrRecorderNotExist, err)
+
+	// 2. 添加的标记记录到直播场次清单中，未指定名称时使用默认名称。
+	r := NewMockRecorder(ctrl)
+	m.recorders["test"] = r
+	m.sessions.start(ctx, l)
+	marker := &Chapter{Chapter: chapters.Chapter{StartMs: 1000, Kind: chapters.KindMarker, Title: defaultMarkerLabel}, File: "a.flv"}
+	r.EXPECT().AddChapter(chapters.KindMarker, defaultMarkerLabel).Return(marker, nil)
+	c, err := m.AddMarker(ctx, "test", "")
+	assert.NoError(t, err)
+	assert.Equal(t, marker, c)
+	assert.Equal(t, []*Chapter{marker}, m.GetMarkers(ctx, "test"))
+
+	// 3. 没有正在录制的文件时返回错误。
+	r.EXPECT().AddChapter(chapters.KindMarker, "label").Return(nil, ErrNotRecording)
+	_, err = m.AddMarker(ctx, "test", "label")
+	assert.Equal(t, ErrNotRecording, err)
+	assert.Len(t, m.GetMarkers(ctx, "test"), 1)
+	assert.Empty(t, m.GetMarkers(ctx, "other"))
+}
@@ -36,6 +36,21 @@ func (m *MockRecorder) EXPECT() *MockRecorderMockRecorder {
 	return m.recorder
 }
 
+// AddChapter mocks base method.
+func (m *MockRecorder) AddChapter(arg0, arg1 string) (*Chapter, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddChapter", arg0, arg1)
+	ret0, _ := ret[0].(*Chapter)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddChapter indicates an expected call of AddChapter.
+func (mr *MockRecorderMockRecorder) AddChapter(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddChapter", reflect.TypeOf((*MockRecorder)(nil).AddChapter), arg0, arg1)
+}
+
 // Close mocks base method.
 func (m *MockRecorder) Close() {
 	m.ctrl.T.Helper()
@@ -48,13 +63,26 @@ func (mr *MockRecorderMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockRecorder)(nil).Close))
 }
 
+// Done mocks base method.
+func (m *MockRecorder) Done() <-chan struct{} {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Done")
+	ret0, _ := ret[0].(<-chan struct{})
+	return ret0
+}
+
+// Done indicates an expected call of Done.
+func (mr *MockRecorderMockRecorder) Done() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Done", reflect.TypeOf((*MockRecorder)(nil).Done))
+}
+
 // GetStatus mocks base method.
-func (m *MockRecorder) GetStatus() (map[string]string, error) {
+func (m *MockRecorder) GetStatus() *Status {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "GetStatus")
-	ret0, _ := ret[0].(map[string]string)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
+	ret0, _ := ret[0].(*Status)
+	return ret0
 }
 
 // GetStatus indicates an expected call of GetStatus.
@@ -91,6 +119,20 @@ func (mr *MockRecorderMockRecorder) StartTime() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartTime", reflect.TypeOf((*MockRecorder)(nil).StartTime))
 }
 
+// StopCurrent mocks base method.
+func (m *MockRecorder) StopCurrent() bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StopCurrent")
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// StopCurrent indicates an expected call of StopCurrent.
+func (mr *MockRecorderMockRecorder) StopCurrent() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StopCurrent", reflect.TypeOf((*MockRecorder)(nil).StopCurrent))
+}
+
 // MockManager is a mock of Manager interface.
 type MockManager struct {
 	ctrl     *gomock.Controller
@@ -155,6 +197,20 @@ func (mr *MockManagerMockRecorder) GetRecorder(arg0, arg1 interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRecorder", reflect.TypeOf((*MockManager)(nil).GetRecorder), arg0, arg1)
 }
 
+// GetQueueStatus mocks base method.
+func (m *MockManager) GetQueueStatus(arg0 context.Context) QueueStatus {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetQueueStatus", arg0)
+	ret0, _ := ret[0].(QueueStatus)
+	return ret0
+}
+
+// GetQueueStatus indicates an expected call of GetQueueStatus.
+func (mr *MockManagerMockRecorder) GetQueueStatus(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetQueueStatus", reflect.TypeOf((*MockManager)(nil).GetQueueStatus), arg0)
+}
+
 // HasRecorder mocks base method.
 func (m *MockManager) HasRecorder(arg0 context.Context, arg1 live.ID) bool {
 	m.ctrl.T.Helper()
@@ -0,0 +1,140 @@
+package recorders
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/yuhaohwang/bililive-go/src/instance"
+	"github.com/yuhaohwang/bililive-go/src/live"
+)
+
+// QueueItem 是因超过同时录制上限而等待录制的直播间。
+type QueueItem struct {
+	LiveId    live.ID   `json:"live_id"`   // 直播唯一标识
+	LiveUrl   string    `json:"live_url"`  // 直播原始 URL
+	Priority  int       `json:"priority"`  // 录制优先级
+	Preempted bool      `json:"preempted"` // 是否因优先级更高的直播间开播而被停止
+	QueuedAt  time.Time `json:"queued_at"` // 开始等待的时间
+
+	live live.Live
+}
+
+// QueueStatus 是同时录制上限和等待队列的状态。
+type QueueStatus struct {
+	MaxRecordings int          `json:"max_recordings"` // 同时录制的上限，0 表示不限制
+	Running       int          `json:"running"`        // 正在录制的直播间数量
+	Waiting       []*QueueItem `json:"waiting"`        // 等待录制的直播间，按开始录制的先后顺序排列
+}
+
+// GetQueueStatus 返回同时录制上限和等待队列的状态。
+func (m *manager) GetQueueStatus(ctx context.Context) QueueStatus {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	status := QueueStatus{
+		MaxRecordings: instance.GetInstance(ctx).Config.MaxRecordings,
+		Running:       len(m.recorders),
+		Waiting:       make([]*QueueItem, 0, len(m.waiting)),
+	}
+	for _, item := range m.sortedWaitingLocked() {
+		copied := *item
+		status.Waiting = append(status.Waiting, &copied)
+	}
+	return status
+}
+
+// isQueued 返回直播间是否在等待录制。
+func (m *manager) isQueued(liveId live.ID) bool {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	_, ok := m.waiting[liveId]
+	return ok
+}
+
+// hasSlotLocked 返回是否还可以开始新的录制，调用方需持有锁。
+func (m *manager) hasSlotLocked(ctx context.Context) bool {
+	limit := instance.GetInstance(ctx).Config.MaxRecordings
+	return limit <= 0 || len(m.recorders) < limit
+}
+
+// priorityOf 返回直播间的录制优先级。
+func (m *manager) priorityOf(ctx context.Context, url string) int {
+	room, err := instance.GetInstance(ctx).Config.GetLiveRoomByUrl(url)
+	if err != nil {
+		return 0
+	}
+	return room.Priority
+}
+
+// enqueueLocked 将直播间加入等待队列，调用方需持有锁。
+func (m *manager) enqueueLocked(ctx context.Context, l live.Live, preempted bool) {
+	m.waiting[l.GetLiveId()] = &QueueItem{
+		LiveId:    l.GetLiveId(),
+		LiveUrl:   l.GetRawUrl(),
+		Priority:  m.priorityOf(ctx, l.GetRawUrl()),
+		Preempted: preempted,
+		QueuedAt:  time.Now(),
+		live:      l,
+	}
+}
+
+// preemptLocked 在达到同时录制上限时，停止一个优先级低于 priority 的录制并将其放回等待队列。
+// 优先级相同时优先停止最晚开始的录制，没有可以停止的录制时返回 false。调用方需持有锁。
+func (m *manager) preemptLocked(ctx context.Context, priority int) bool {
+	inst := instance.GetInstance(ctx)
+	var (
+		victim     live.Live
+		victimPrio int
+		victimTime time.Time
+	)
+	for id, r := range m.recorders {
+		l, ok := inst.Lives[id]
+		if !ok {
+			continue
+		}
+		p := m.priorityOf(ctx, l.GetRawUrl())
+		if p >= priority {
+			continue
+		}
+		if victim == nil || p < victimPrio || (p == victimPrio && r.StartTime().After(victimTime)) {
+			victim, victimPrio, victimTime = l, p, r.StartTime()
+		}
+	}
+	if victim == nil {
+		return false
+	}
+	m.closeRecorderLocked(victim.GetLiveId(), SegmentEndPreempted)
+	m.enqueueLocked(ctx, victim, true)
+	inst.Logger.Warnf("已达到同时录制上限，停止优先级较低的录制[%s]", victim.GetLiveId())
+	return true
+}
+
+// sortedWaitingLocked 返回按优先级从高到低、等待时间从长到短排列的等待队列，调用方需持有锁。
+func (m *manager) sortedWaitingLocked() []*QueueItem {
+	items := make([]*QueueItem, 0, len(m.waiting))
+	for _, item := range m.waiting {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Priority != items[j].Priority {
+			return items[i].Priority > items[j].Priority
+		}
+		return items[i].QueuedAt.Before(items[j].QueuedAt)
+	})
+	return items
+}
+
+// dequeueLocked 在有空闲名额时按顺序开始等待中的录制，调用方需持有锁。
+func (m *manager) dequeueLocked(ctx context.Context) {
+	for _, item := range m.sortedWaitingLocked() {
+		if !m.hasSlotLocked(ctx) {
+			return
+		}
+		delete(m.waiting, item.LiveId)
+		if err := m.startLocked(ctx, item.live); err != nil {
+			instance.GetInstance(ctx).Logger.Errorf("failed to start queued recorder, err: %v", err)
+			continue
+		}
+		instance.GetInstance(ctx).Logger.Infof("开始录制等待中的直播间[%s]，已等待%s", item.LiveId, time.Since(item.QueuedAt).Round(time.Second))
+	}
+}
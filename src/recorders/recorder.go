@@ -4,12 +4,11 @@ package recorders
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"runtime"
 	"strconv"
 	"strings"
 	"sync"
@@ -25,12 +24,18 @@ import (
 	"github.com/yuhaohwang/bililive-go/src/interfaces"
 	"github.com/yuhaohwang/bililive-go/src/live"
 	"github.com/yuhaohwang/bililive-go/src/pkg/events"
+	"github.com/yuhaohwang/bililive-go/src/pkg/metadata"
 	"github.com/yuhaohwang/bililive-go/src/pkg/parser"
 	"github.com/yuhaohwang/bililive-go/src/pkg/parser/ffmpeg"
+	"github.com/yuhaohwang/bililive-go/src/pkg/parser/hls"
 	"github.com/yuhaohwang/bililive-go/src/pkg/parser/native/flv"
 	"github.com/yuhaohwang/bililive-go/src/pkg/utils"
+	"github.com/yuhaohwang/bililive-go/src/postprocessors"
 )
 
+// backlogMaxDelay 是检测到开播后允许补录的最长时间。
+const backlogMaxDelay = time.Minute
+
 const (
 	begin uint32 = iota
 	pending
@@ -40,11 +45,14 @@ const (
 
 // for test
 var (
-	newParser = func(u *url.URL, useNativeFlvParser bool, cfg map[string]string) (parser.Parser, error) {
+	newParser = func(u *url.URL, feature configs.Feature, cfg map[string]string) (parser.Parser, error) {
 		parserName := ffmpeg.Name
-		if strings.Contains(u.Path, ".flv") && useNativeFlvParser {
+		if strings.Contains(u.Path, ".flv") && feature.UseNativeFlvParser {
 			parserName = flv.Name
 		}
+		if strings.Contains(u.Path, ".m3u8") && feature.UseNativeHlsParser {
+			parserName = hls.Name
+		}
 		return parser.New(parserName, cfg)
 	}
 
@@ -69,14 +77,16 @@ func getDefaultFileNameTmpl(config *configs.Config) *template.Template {
 type Recorder interface {
 	Start(ctx context.Context) error
 	StartTime() time.Time
-	GetStatus() (map[string]string, error)
+	GetStatus() *Status
+	StopCurrent() bool
+	AddChapter(kind, title string) (*Chapter, error)
 	Close()
+	Done() <-chan struct{}
 }
 
 // recorder 是 Recorder 接口的实现。
 type recorder struct {
-	Live       live.Live
-	OutPutPath string
+	Live live.Live
 
 	config     *configs.Config
 	ed         events.Dispatcher
@@ -86,16 +96,27 @@ type recorder struct {
 	parser     parser.Parser
 	parserLock *sync.RWMutex
 
-	stop  chan struct{}
-	state uint32
+	stop      chan struct{}
+	done      chan struct{} // 主循环结束、录制文件和元数据都已写入完成时关闭
+	state     uint32
+	recording uint32
+	attempted uint32 // 是否已尝试过录制
+
+	stalledUrl string // 上一次录制停滞的直播流地址
+
+	sessions   *sessionRegistry
+	stopReason atomic.Value // 由外部停止当前录制的原因，写入直播场次清单
+	chapters   atomic.Value // 当前录制文件的章节，类型为 *chapterTracker
+
+	statusLock sync.Mutex
+	status     Status // 录制器自身记录的状态，查询时再合并解析器的统计
 }
 
 // NewRecorder 创建一个新的 Recorder 实例。
 func NewRecorder(ctx context.Context, live live.Live) (Recorder, error) {
 	inst := instance.GetInstance(ctx)
-	return &recorder{
+	r := &recorder{
 		Live:       live,
-		OutPutPath: instance.GetInstance(ctx).Config.OutPutPath,
 		config:     inst.Config,
 		cache:      inst.Cache,
 		startTime:  time.Now(),
@@ -103,15 +124,37 @@ func NewRecorder(ctx context.Context, live live.Live) (Recorder, error) {
 		logger:     inst.Logger,
 		state:      begin,
 		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
 		parserLock: new(sync.RWMutex),
-	}, nil
+	}
+	if m, ok := inst.RecorderManager.(*manager); ok {
+		r.sessions = m.sessions
+	}
+	return r, nil
 }
 
 // tryRecord 尝试录制直播流。
 func (r *recorder) tryRecord(ctx context.Context) {
+	// 断网期间不重新拉流，等待网络恢复后继续重试
+	if isOutage(ctx) {
+		time.Sleep(5 * time.Second)
+		return
+	}
+
+	// 磁盘剩余空间不足时不开始新的录制，等待空间释放后继续重试
+	if isDiskCritical(ctx, r.config.EffectiveConfig(r.Live.GetRawUrl()).OutPutPath) {
+		r.getLogger().Warn("磁盘剩余空间不足，暂停录制，将在5秒后重试...")
+		time.Sleep(5 * time.Second)
+		return
+	}
+
 	// 获取直播流的URL列表
 	urls, err := r.Live.GetStreamUrls()
 	if err != nil || len(urls) == 0 {
+		if err == nil {
+			err = errors.New("没有可用的直播流")
+		}
+		r.setLastError(err)
 		r.getLogger().WithError(err).Warn("无法获取直播流URL，将在5秒后重试...")
 		time.Sleep(5 * time.Second)
 		return
@@ -121,6 +164,9 @@ func (r *recorder) tryRecord(ctx context.Context) {
 	obj, _ := r.cache.Get(r.Live)
 	info := obj.(*live.Info)
 
+	// 获取直播间生效的配置
+	cfg := r.config.EffectiveConfig(r.Live.GetRawUrl())
+
 	isCache := false
 
 	fileName := ""
@@ -128,89 +174,122 @@ func (r *recorder) tryRecord(ctx context.Context) {
 
 	if isCache {
 		liveId := string(r.Live.GetLiveId())
-		fileName = filepath.Join(r.OutPutPath, "cache", liveId+"_%03d.ts")
-		jsonFilePath = filepath.Join(r.OutPutPath, "cache", liveId+".metadata.json")
+		fileName = filepath.Join(cfg.OutPutPath, "cache", liveId+"_%03d.ts")
+		jsonFilePath = filepath.Join(cfg.OutPutPath, "cache", liveId+".metadata.json")
 	}
 
-	url := urls[0]
+	url := r.pickStreamUrl(urls)
 
 	if !isCache {
-		// 设置文件名模板
-		tmpl := getDefaultFileNameTmpl(r.config)
-		if r.config.OutputTmpl != "" {
-			_tmpl, err := template.New("user_filename").Funcs(utils.GetFuncMap(r.config)).Parse(r.config.OutputTmpl)
-			if err == nil {
-				tmpl = _tmpl
-			}
-		}
-
 		// 生成文件名
-		buf := new(bytes.Buffer)
-		if err = tmpl.Execute(buf, info); err != nil {
-			panic(fmt.Sprintf("无法渲染文件名，错误：%v", err))
-		}
-		fileName = filepath.Join(r.OutPutPath, buf.String())
-
-		// 如果URL中包含 "m3u8"，则将文件名更改为 .ts 扩展名
-		if strings.Contains(url.Path, "m3u8") {
-			fileName = fileName[:len(fileName)-4] + ".ts"
-		}
-
-		// 如果只有音频，将文件名更改为 .aac 扩展名
-		if info.AudioOnly {
-			fileName = fileName[:strings.LastIndex(fileName, ".")] + ".aac"
-		}
+		fileName = r.getFileName(cfg, info, url)
 
 		// metadata.json
-		// 如果 fileName 有扩展名，则替换为 ".json"，否则添加 ".json"
-		ext := filepath.Ext(fileName)
-		if ext != "" {
-			// 有扩展名，直接替换为 ".metadata.json"
-			jsonFilePath = fileName[:len(fileName)-len(ext)] + ".metadata.json"
-		} else {
-			// 没有扩展名，直接加上 ".metadata.json"
-			jsonFilePath = fileName + ".metadata.json"
-		}
+		jsonFilePath = metadata.PathOf(fileName)
 	}
 
 	outputPath, _ := filepath.Split(fileName)
 
 	// 创建输出目录
 	if err = mkdir(outputPath); err != nil {
+		r.setLastError(err)
 		r.getLogger().WithError(err).Errorf("无法创建输出目录[%s]", outputPath)
 		return
 	}
 
 	// 初始化解析器配置
 	parserCfg := map[string]string{
-		"timeout_in_us": strconv.Itoa(r.config.TimeoutInUs),
+		"timeout_in_us": strconv.Itoa(cfg.TimeoutInUs),
 	}
-	if r.config.Debug {
+	if cfg.Debug {
 		parserCfg["debug"] = "true"
 	}
 
 	// 根据 URL 初始化解析器
-	p, err := newParser(url, r.config.Feature.UseNativeFlvParser, parserCfg)
+	p, err := newParser(url, cfg.Feature, parserCfg)
 	if err != nil {
+		r.setLastError(err)
 		r.getLogger().WithError(err).Error("初始化解析器失败")
 		return
 	}
 
+	// 配置了冗余录制时同时录制多个副本，冗余录制不支持无缝切分和开播补录
+	if cfg.Redundancy.Copies > 1 {
+		rp, err := newRedundantParser(p, urls, url, fileName, cfg, parserCfg)
+		if err != nil {
+			r.setLastError(err)
+			r.getLogger().WithError(err).Error("初始化解析器失败")
+			return
+		}
+		p = rp
+	}
+
+	// 配置了视频分割时，由解析器在关键帧处无缝切分文件
+	var st *splitTracker
+	if sp, ok := p.(parser.SplitParser); ok {
+		st = newSplitTracker(ctx, r, cfg, info, url, fileName)
+		if opts := st.options(); opts.Enabled() {
+			sp.SetSplitOptions(opts)
+		} else {
+			st = nil
+		}
+	}
+
+	// 刚开播时从直播回看窗口中补录检测到开播前错过的内容
+	if bp, ok := p.(parser.BacklogParser); ok && r.shouldRecoverBacklog(cfg) {
+		bp.SetBacklogOptions(parser.BacklogOptions{
+			FromOldest: cfg.HlsBacklog.FromOldest,
+			Lookback:   cfg.HlsBacklog.Lookback,
+			OnBacklog: func(backlog parser.Backlog) {
+				r.saveBacklog(jsonFilePath, backlog)
+			},
+		})
+	}
+
 	// 设置并关闭当前解析器
 	r.setAndCloseParser(p)
 
-	// 记录开始时间
+	// 记录开始时间，并将本次录制加入当前的直播场次
 	r.startTime = time.Now()
+	sess := r.sessions.get(ctx, r.Live)
+	sess.openSegment()
+	defer sess.closeSegment()
 	r.getLogger().Debug("开始解析直播流(" + url.String() + ", " + fileName + ")")
 
 	jsonData := info
 	jsonData.Recording = true
 	// 保存 JSON 数据到文件
 	r.saveJSONToFile(jsonFilePath, jsonData)
+	r.saveRecordTime(jsonFilePath, "start_time_unix", r.startTime)
+	rp, redundant := p.(*redundantParser)
+	if redundant {
+		r.startCopies(rp, jsonData)
+	}
 
-	// 解析直播流并记录结果
-	result := r.parser.ParseLiveStream(ctx, url, r.Live, fileName)
+	// 解析直播流并记录结果，直播流停滞时停止解析器，下一轮重新获取直播流地址
+	r.chapters.Store(newChapterTracker(r, fileName, r.startTime, info, cfg.VideoSplitStrategies.ChapterOnChanged))
+	r.startStatus(url.String(), fileName, r.startTime)
+	atomic.StoreUint32(&r.recording, 1)
+	wd := startWatchdog(r.parser, cfg.StallTimeout)
+	result := r.parser.ParseLiveStream(ctx, url, r.Live, metadata.PartOf(fileName))
+	stalled := wd.finish()
+	atomic.StoreUint32(&r.recording, 0)
+	r.chapters.Store((*chapterTracker)(nil))
 	r.getLogger().Println(result)
+	if stalled != nil {
+		r.setLastError(errors.New("直播流停滞"))
+	} else if result != nil {
+		r.setLastError(result)
+	}
+
+	// 切分后录制结束时写入的是最后一个分段
+	segStart := r.startTime
+	if st != nil {
+		fileName = st.file
+		jsonFilePath = metadata.PathOf(fileName)
+		segStart = st.start
+	}
+	r.finishPart(fileName)
 
 	// 记录结束时间
 	r.getLogger().Debug("结束解析直播流(" + url.String() + ", " + fileName + ")")
@@ -218,87 +297,68 @@ func (r *recorder) tryRecord(ctx context.Context) {
 	jsonData.Recording = false
 	// 再次保存 JSON 数据到文件
 	r.saveJSONToFile(jsonFilePath, jsonData)
+	r.saveRecordTime(jsonFilePath, "end_time_unix", time.Now())
+	if stalled != nil {
+		r.saveStall(jsonFilePath, url, stalled)
+		r.ed.DispatchEvent(events.NewEvent(RecorderStalled, r.Live))
+	}
+	if st != nil {
+		st.finish()
+	}
 
 	// 移除空文件
 	removeEmptyFile(fileName)
-
-	// 获取 FFmpeg 路径
-	ffmpegPath, err := utils.GetFFmpegPath(ctx)
-	if err != nil {
-		r.getLogger().WithError(err).Error("无法找到 FFmpeg")
-		return
+	var copies []string
+	if redundant {
+		copies = r.finishCopies(rp, jsonData)
 	}
 
-	// 执行自定义命令或转换
-	cmdStr := strings.Trim(r.config.OnRecordFinished.CustomCommandline, "")
-	if len(cmdStr) > 0 {
-		tmpl, err := template.New("custom_commandline").Funcs(utils.GetFuncMap(r.config)).Parse(cmdStr)
-		if err != nil {
-			r.getLogger().WithError(err).Error("自定义命令行解析失败")
-			return
+	// 将录制文件加入直播场次清单
+	if fileExists(fileName) {
+		reason := r.takeStopReason()
+		if stalled != nil {
+			reason = SegmentEndStalled
 		}
+		sess.addSegment(fileName, info.RoomName, segStart, time.Now(), reason)
+	}
 
-		buf := new(bytes.Buffer)
-		if err := tmpl.Execute(buf, struct {
-			*live.Info
-			FileName string
-			Ffmpeg   string
-		}{
-			Info:     info,
-			FileName: fileName,
-			Ffmpeg:   ffmpegPath,
-		}); err != nil {
-			r.getLogger().WithError(err).Errorln("无法渲染自定义命令行")
-			return
-		}
+	// 检查文件完整性并提交录制后处理任务
+	r.finishFile(ctx, sess, info, fileName, copies...)
+}
 
-		bash := ""
-		args := []string{}
-		switch runtime.GOOS {
-		case "linux":
-			bash = "sh"
-			args = []string{"-c"}
-		case "windows":
-			bash = "cmd"
-			args = []string{"/C"}
-		default:
-			r.getLogger().Warnln("不支持的操作系统", runtime.GOOS)
+// getFileName 根据文件名模板生成录制文件名。
+func (r *recorder) getFileName(cfg *configs.Config, info *live.Info, url *url.URL) string {
+	// 设置文件名模板
+	tmpl := getDefaultFileNameTmpl(cfg)
+	if cfg.OutputTmpl != "" {
+		_tmpl, err := template.New("user_filename").Funcs(utils.GetFuncMap(cfg)).Parse(cfg.OutputTmpl)
+		if err == nil {
+			tmpl = _tmpl
 		}
+	}
 
-		args = append(args, buf.String())
-		r.getLogger().Debugf("开始执行自定义命令行: %s", args[1])
-		cmd := exec.Command(bash, args...)
-		if r.config.Debug {
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-		}
-		if err = cmd.Run(); err != nil {
-			r.getLogger().WithError(err).Debugf("自定义命令行执行失败(%s %s)\n", bash, strings.Join(args, " "))
-		} else if r.config.OnRecordFinished.DeleteFlvAfterConvert {
-			os.Remove(fileName)
-		}
-		r.getLogger().Debugf("结束执行自定义命令行: %s", args[1])
-	} else if r.config.OnRecordFinished.ConvertToMp4 {
-		convertCmd := exec.Command(
-			ffmpegPath,
-			"-hide_banner",
-			"-i",
-			fileName,
-			"-c",
-			"copy",
-			fileName+".mp4",
-		)
-		if err = convertCmd.Run(); err != nil {
-			convertCmd.Process.Kill()
-			r.getLogger().Debugln(err)
-		} else if r.config.OnRecordFinished.DeleteFlvAfterConvert {
-			os.Remove(fileName)
-		}
+	// 生成文件名
+	buf := new(bytes.Buffer)
+	if err := tmpl.Execute(buf, info); err != nil {
+		panic(fmt.Sprintf("无法渲染文件名，错误：%v", err))
+	}
+	fileName := filepath.Join(cfg.OutPutPath, buf.String())
+
+	// 如果URL中包含 "m3u8"，则将文件名更改为 .ts 扩展名
+	if strings.Contains(url.Path, "m3u8") {
+		fileName = fileName[:len(fileName)-4] + ".ts"
+	}
+
+	// 如果只有音频，将文件名更改为 .aac 扩展名
+	if info.AudioOnly {
+		fileName = fileName[:strings.LastIndex(fileName, ".")] + ".aac"
 	}
+	return fileName
 }
 
 // run 启动录制器的主循环。
 func (r *recorder) run(ctx context.Context) {
+	defer close(r.done)
 	for {
 		select {
 		case <-r.stop:
@@ -345,6 +405,50 @@ func (r *recorder) StartTime() time.Time {
 	return r.startTime
 }
 
+// StopCurrent 结束正在录制的文件，录制器本身不会关闭，会在下一轮重新尝试录制。
+// 当前没有正在录制的文件时返回 false。
+func (r *recorder) StopCurrent() bool {
+	if atomic.LoadUint32(&r.recording) == 0 {
+		return false
+	}
+	p := r.getParser()
+	if p == nil {
+		return false
+	}
+	p.Stop()
+	r.getLogger().Info("Record Stop Current")
+	return true
+}
+
+// AddChapter 在正在录制的文件的当前位置添加章节，当前没有正在录制的文件时返回 ErrNotRecording。
+// 房间名称和分区的变化只在开启章节模式时记录，与当前相同时忽略并返回 nil。
+// 当前位置优先使用解析器已写入的时长，解析器不支持时使用文件开始写入后经过的时间。
+func (r *recorder) AddChapter(kind, title string) (*Chapter, error) {
+	t := r.chapterTracker()
+	if t == nil || atomic.LoadUint32(&r.recording) == 0 {
+		return nil, ErrNotRecording
+	}
+	offset := time.Duration(-1)
+	if p, ok := r.getParser().(parser.ProgressParser); ok {
+		if d := p.Progress(); d > 0 {
+			offset = d
+		}
+	}
+	c := t.add(kind, title, time.Now(), offset)
+	if c == nil {
+		return nil, nil
+	}
+	c.LiveId = r.Live.GetLiveId()
+	r.getLogger().Infof("添加章节(%s): %s, %dms", c.Kind, c.Title, c.StartMs)
+	return c, nil
+}
+
+// chapterTracker 返回当前录制文件的章节，没有正在录制的文件时返回 nil。
+func (r *recorder) chapterTracker() *chapterTracker {
+	t, _ := r.chapters.Load().(*chapterTracker)
+	return t
+}
+
 // Close 关闭录制器。
 func (r *recorder) Close() {
 	if !atomic.CompareAndSwapUint32(&r.state, running, stopped) {
@@ -358,6 +462,26 @@ func (r *recorder) Close() {
 	r.ed.DispatchEvent(events.NewEvent(RecorderStop, r.Live))
 }
 
+// Done 返回一个通道，录制器关闭后正在录制的文件和元数据都写入完成时关闭。
+func (r *recorder) Done() <-chan struct{} {
+	return r.done
+}
+
+// setStopReason 记录由外部停止录制器当前录制的原因。
+func setStopReason(r Recorder, reason string) {
+	if r, ok := r.(*recorder); ok {
+		r.stopReason.Store(reason)
+	}
+}
+
+// takeStopReason 返回并清除当前录制的停止原因，没有由外部停止时视为直播流结束。
+func (r *recorder) takeStopReason() string {
+	if reason, ok := r.stopReason.Swap("").(string); ok && reason != "" {
+		return reason
+	}
+	return SegmentEndStreamEnded
+}
+
 // getLogger 返回记录器实例。
 func (r *recorder) getLogger() *logrus.Entry {
 	return r.logger.WithFields(r.getFields())
@@ -376,13 +500,54 @@ func (r *recorder) getFields() map[string]interface{} {
 	}
 }
 
-// GetStatus 获取录制器的状态。
-func (r *recorder) GetStatus() (map[string]string, error) {
-	statusP, ok := r.getParser().(parser.StatusParser)
+// shouldRecoverBacklog 返回本次录制是否需要从直播回看窗口中补录。
+// 只有检测到开播后的第一次录制需要补录，避免重试或重启录制时重复录制已有的内容。
+func (r *recorder) shouldRecoverBacklog(cfg *configs.Config) bool {
+	if !atomic.CompareAndSwapUint32(&r.attempted, 0, 1) {
+		return false
+	}
+	if !cfg.HlsBacklog.FromOldest && cfg.HlsBacklog.Lookback <= 0 {
+		return false
+	}
+	return time.Since(r.Live.GetLastStartTime()) < backlogMaxDelay
+}
+
+// saveBacklog 将补录的内容写入元数据文件。
+func (r *recorder) saveBacklog(jsonFilePath string, backlog parser.Backlog) {
+	err := metadata.Update(jsonFilePath, map[string]interface{}{
+		"backlog": metadata.Backlog{
+			Segments:   backlog.Segments,
+			DurationMs: backlog.Duration.Milliseconds(),
+		},
+	})
+	if err != nil {
+		r.getLogger().WithError(err).Error("写入补录信息失败")
+	}
+}
+
+// saveRecordTime 将录制文件开始或结束录制的时间写入元数据文件。
+func (r *recorder) saveRecordTime(jsonFilePath, key string, t time.Time) {
+	if err := metadata.Update(jsonFilePath, map[string]interface{}{key: t.Unix()}); err != nil {
+		r.getLogger().WithError(err).Error("写入录制时间失败")
+	}
+}
+
+// finishPart 在录制结束后去掉录制文件的 .part 扩展名，程序异常退出时留下的 .part 文件会在下次启动时修复。
+func (r *recorder) finishPart(fileName string) {
+	if err := os.Rename(metadata.PartOf(fileName), fileName); err != nil && !errors.Is(err, os.ErrNotExist) {
+		r.getLogger().WithError(err).Errorf("重命名录制文件失败: %s", fileName)
+	}
+}
+
+// submitPostProcess 将录制完成的文件提交给录制后处理管理器。
+func (r *recorder) submitPostProcess(ctx context.Context, info *live.Info, fileName string) {
+	ppm, ok := instance.GetInstance(ctx).PostProcessorManager.(postprocessors.Manager)
 	if !ok {
-		return nil, ErrParserNotSupportStatus
+		return
+	}
+	if _, err := ppm.Submit(ctx, info, fileName); err != nil {
+		r.getLogger().WithError(err).Error("提交录制后处理任务失败")
 	}
-	return statusP.Status()
 }
 
 // saveJSONToFile 将 JSON 数据保存到文件
@@ -394,8 +559,8 @@ func (r *recorder) saveJSONToFile(jsonFilePath string, info *live.Info) error {
 		r.getLogger().Info("编码JSON时发生错误:", err)
 	}
 
-	// 保存 JSON 数据到文件，覆盖同名文件
-	err = os.WriteFile(jsonFilePath, jsonData, 0644)
+	// 合并保存 JSON 数据到文件，保留固定标记等已有字段
+	err = metadata.UpdateWithJSON(jsonFilePath, jsonData)
 	if err != nil {
 		r.getLogger().Info("写入METADATA JSON文件时发生错误:", err)
 	}
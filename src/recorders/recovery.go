@@ -0,0 +1,163 @@
+package recorders
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yuhaohwang/bililive-go/src/instance"
+	"github.com/yuhaohwang/bililive-go/src/live"
+	"github.com/yuhaohwang/bililive-go/src/pkg/events"
+	"github.com/yuhaohwang/bililive-go/src/pkg/integrity"
+	"github.com/yuhaohwang/bililive-go/src/pkg/metadata"
+	"github.com/yuhaohwang/bililive-go/src/postprocessors"
+)
+
+// recordingExts 是录制器写入的录制文件的扩展名，用于根据元数据文件找到对应的录制文件。
+var recordingExts = []string{".flv", ".ts", ".aac", ".mp4"}
+
+// findOrphans 在输出目录中查找程序异常退出时未正常结束的录制文件，返回去掉 .part 扩展名后的文件名。
+// 只有元数据中仍标记为正在录制的文件才视为未正常结束，没有元数据文件的 .part 文件不是录制器写入的，不做处理。
+func findOrphans(roots []string) []string {
+	var orphans []string
+	seen := make(map[string]bool)
+	add := func(file string) {
+		if !seen[file] {
+			seen[file] = true
+			orphans = append(orphans, file)
+		}
+	}
+	for _, root := range roots {
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if d.Name() == sessionDir {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			switch {
+			case strings.HasSuffix(path, metadata.PartExt):
+				if isRecording(metadata.PathOf(path)) {
+					add(strings.TrimSuffix(path, metadata.PartExt))
+				}
+			case strings.HasSuffix(path, metadata.Ext):
+				if isRecording(path) {
+					if file := recordingOf(path); file != "" {
+						add(file)
+					}
+				}
+			}
+			return nil
+		})
+	}
+	return orphans
+}
+
+// isRecording 返回元数据文件是否存在且仍标记为正在录制。
+func isRecording(jsonFilePath string) bool {
+	md, err := metadata.Read(jsonFilePath)
+	return err == nil && md.Recording
+}
+
+// recordingOf 返回元数据文件对应的录制文件，录制文件不存在时返回空字符串。
+func recordingOf(jsonFilePath string) string {
+	base := strings.TrimSuffix(jsonFilePath, metadata.Ext)
+	for _, ext := range recordingExts {
+		if file := base + ext; fileExists(file) || fileExists(metadata.PartOf(file)) {
+			return file
+		}
+	}
+	return ""
+}
+
+// recoverOrphans 依次修复未正常结束的录制文件。
+func (m *manager) recoverOrphans(ctx context.Context, orphans []string) {
+	logger := instance.GetInstance(ctx).Logger
+	for _, file := range orphans {
+		if err := m.recoverFile(ctx, file); err != nil {
+			logger.WithError(err).Errorf("修复未正常结束的录制文件失败: %s", file)
+		}
+	}
+}
+
+// recoverFile 修复一个未正常结束的录制文件：截掉尾部不完整的标签，去掉 .part 扩展名，
+// 更新元数据文件并记录完整性检查结果，最后补交录制结束时没有提交的录制后处理任务。
+func (m *manager) recoverFile(ctx context.Context, file string) error {
+	inst := instance.GetInstance(ctx)
+	logger := inst.Logger.WithField("file", file)
+
+	// 1. 截掉尾部不完整的标签，并去掉 .part 扩展名。
+	src := file
+	if part := metadata.PartOf(file); fileExists(part) {
+		if fileExists(file) {
+			return os.ErrExist
+		}
+		src = part
+	}
+	report, truncated, err := integrity.Repair(src)
+	if err != nil && !errors.Is(err, integrity.ErrUnsupportedFormat) {
+		return err
+	}
+	if src != file {
+		if err := os.Rename(src, file); err != nil {
+			return err
+		}
+	}
+
+	// 2. 没有写入任何内容的文件直接删除。
+	jsonFilePath := metadata.PathOf(file)
+	removeEmptyFile(file)
+	if !fileExists(file) {
+		os.Remove(jsonFilePath)
+		logger.Info("已删除未正常结束的空录制文件")
+		return nil
+	}
+
+	// 3. 更新元数据文件。
+	md, _ := metadata.Read(jsonFilePath)
+	fields := map[string]interface{}{
+		"recording": false,
+		"recovery":  &metadata.Recovery{TruncatedBytes: truncated, TimeUnix: time.Now().Unix()},
+	}
+	if stat, err := os.Stat(file); err == nil && (md == nil || md.EndTimeUnix == 0) {
+		fields["end_time_unix"] = stat.ModTime().Unix()
+	}
+	if err := metadata.Update(jsonFilePath, fields); err != nil {
+		return err
+	}
+	logger.Warnf("已修复未正常结束的录制文件，截掉尾部%d字节", truncated)
+
+	// 4. 记录完整性检查结果并通知录制文件已结束。
+	info := &live.Info{}
+	var liveId live.ID
+	if md != nil {
+		liveId = live.ID(md.Id)
+		info.HostName, info.RoomName = md.HostName, md.RoomName
+		if l, ok := inst.Lives[liveId]; ok {
+			info.Live = l
+		}
+	}
+	ed, _ := inst.EventDispatcher.(events.Dispatcher)
+	if report != nil {
+		saveVerification(ctx, ed, logger, &Verification{LiveId: liveId, File: file, Report: report})
+	}
+	if ed != nil {
+		ed.DispatchEvent(events.NewEvent(RecordingRecovered, file))
+		ed.DispatchEvent(events.NewEvent(RecordingFinished, file))
+	}
+
+	// 5. 补交录制后处理任务。
+	if ppm, ok := inst.PostProcessorManager.(postprocessors.Manager); ok {
+		if _, err := ppm.Submit(ctx, info, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
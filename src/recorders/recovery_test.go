@@ -0,0 +1,81 @@
+package recorders
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yuhaohwang/bililive-go/src/configs"
+	"github.com/yuhaohwang/bililive-go/src/instance"
+	"github.com/yuhaohwang/bililive-go/src/interfaces"
+	"github.com/yuhaohwang/bililive-go/src/pkg/integrity"
+	"github.com/yuhaohwang/bililive-go/src/pkg/metadata"
+)
+
+func TestRecoverOrphans(t *testing.T) {
+	ctx := context.WithValue(context.Background(), instance.Key, &instance.Instance{
+		Config: configs.NewConfig(),
+		Logger: &interfaces.Logger{Logger: logrus.New()},
+	})
+	dir := t.TempDir()
+	m := &manager{}
+	a, b, c, d := filepath.Join(dir, "a.flv"), filepath.Join(dir, "b.flv"), filepath.Join(dir, "c.flv"), filepath.Join(dir, "d.flv")
+	recording := map[string]interface{}{"id": "test", "recording": true}
+
+	// 1. 尾部标签不完整的 .part 文件、元数据仍标记为正在录制的文件和空的 .part 文件都需要修复，
+	// 已正常结束的文件和会话目录中的文件不受影响。
+	writeFLVPart(t, metadata.PartOf(a), 0, 10, 1)
+	stat, err := os.Stat(metadata.PartOf(a))
+	assert.NoError(t, err)
+	assert.NoError(t, os.Truncate(metadata.PartOf(a), stat.Size()-7))
+	assert.NoError(t, metadata.Update(metadata.PathOf(a), recording))
+	writeFLVPart(t, b, 0, 10, 1)
+	assert.NoError(t, metadata.Update(metadata.PathOf(b), recording))
+	assert.NoError(t, os.WriteFile(metadata.PartOf(c), nil, 0644))
+	assert.NoError(t, metadata.Update(metadata.PathOf(c), recording))
+	writeFLVPart(t, d, 0, 10, 1)
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, sessionDir), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, sessionDir, "e.flv.part"), nil, 0644))
+
+	// 没有元数据文件的 .part 文件不是录制器写入的，不做处理。
+	stray := filepath.Join(dir, "foo.mp4.part")
+	assert.NoError(t, os.WriteFile(stray, []byte("half"), 0644))
+
+	orphans := findOrphans([]string{dir})
+	assert.Equal(t, []string{a, b, c}, orphans)
+
+	for _, file := range orphans {
+		assert.NoError(t, m.recoverFile(ctx, file))
+	}
+
+	// 2. 截掉尾部不完整的标签并去掉 .part 扩展名，元数据记录修复信息。
+	assert.FileExists(t, a)
+	assert.NoFileExists(t, metadata.PartOf(a))
+	md, err := metadata.Read(metadata.PathOf(a))
+	assert.NoError(t, err)
+	assert.False(t, md.Recording)
+	assert.NotNil(t, md.Recovery)
+	assert.Positive(t, md.Recovery.TruncatedBytes)
+	assert.NotZero(t, md.EndTimeUnix)
+	assert.Equal(t, string(integrity.LevelOK), md.Integrity)
+
+	// 3. 完整的文件只更新元数据。
+	md, err = metadata.Read(metadata.PathOf(b))
+	assert.NoError(t, err)
+	assert.False(t, md.Recording)
+	assert.Zero(t, md.Recovery.TruncatedBytes)
+
+	// 4. 空文件连同元数据文件一起删除。
+	assert.NoFileExists(t, metadata.PartOf(c))
+	assert.NoFileExists(t, c)
+	assert.NoFileExists(t, metadata.PathOf(c))
+
+	// 5. 修复完成后不再有需要修复的文件，其他 .part 文件保持不变。
+	assert.Empty(t, findOrphans([]string{dir}))
+	assert.FileExists(t, stray)
+	assert.NoFileExists(t, filepath.Join(dir, "foo.mp4"))
+}
@@ -0,0 +1,172 @@
+package recorders
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yuhaohwang/bililive-go/src/configs"
+	"github.com/yuhaohwang/bililive-go/src/live"
+	"github.com/yuhaohwang/bililive-go/src/pkg/events"
+	"github.com/yuhaohwang/bililive-go/src/pkg/metadata"
+	"github.com/yuhaohwang/bililive-go/src/pkg/parser"
+)
+
+// copyFileName 返回第 index 个冗余副本的文件名，第 0 个副本即主录制文件。
+func copyFileName(fileName string, index int) string {
+	if index == 0 {
+		return fileName
+	}
+	ext := filepath.Ext(fileName)
+	return fmt.Sprintf("%s.copy%d%s", strings.TrimSuffix(fileName, ext), index, ext)
+}
+
+// recordCopy 是冗余录制中的一个副本。
+type recordCopy struct {
+	parser parser.Parser
+	url    *url.URL
+	file   string
+	stall  *stall // 录制期间检测到的停滞
+}
+
+// redundantParser 同时运行多个解析器，从不同的直播流地址录制同一场直播的多个副本。
+// 第一个副本为主录制文件，每个副本单独检测停滞，一个副本中断不影响其他副本继续录制。
+type redundantParser struct {
+	copies       []*recordCopy
+	stallTimeout time.Duration
+}
+
+// newRedundantParser 为主解析器之外的副本创建解析器，各个副本依次使用不同的直播流地址，
+// 直播流地址少于副本数量时从头循环使用。
+func newRedundantParser(primary parser.Parser, urls []*url.URL, primaryUrl *url.URL, fileName string,
+	cfg *configs.Config, parserCfg map[string]string) (*redundantParser, error) {
+	ordered := []*url.URL{primaryUrl}
+	for _, u := range urls {
+		if u.String() != primaryUrl.String() {
+			ordered = append(ordered, u)
+		}
+	}
+	p := &redundantParser{
+		copies:       []*recordCopy{{parser: primary, url: primaryUrl, file: fileName}},
+		stallTimeout: cfg.StallTimeout,
+	}
+	for i := 1; i < cfg.Redundancy.Copies; i++ {
+		u := ordered[i%len(ordered)]
+		cp, err := newParser(u, cfg.Feature, parserCfg)
+		if err != nil {
+			return nil, err
+		}
+		p.copies = append(p.copies, &recordCopy{parser: cp, url: u, file: copyFileName(fileName, i)})
+	}
+	return p, nil
+}
+
+// ParseLiveStream 同时录制所有副本，直到所有副本都结束。url 和 file 由各个副本决定，这里不使用。
+// 任意一个副本正常结束即视为录制成功，否则返回主录制文件的错误。
+func (p *redundantParser) ParseLiveStream(ctx context.Context, _ *url.URL, l live.Live, _ string) error {
+	errs := make([]error, len(p.copies))
+	var wg sync.WaitGroup
+	for i, c := range p.copies {
+		wg.Add(1)
+		go func(i int, c *recordCopy) {
+			defer wg.Done()
+			wd := startWatchdog(c.parser, p.stallTimeout)
+			errs[i] = c.parser.ParseLiveStream(ctx, c.url, l, metadata.PartOf(c.file))
+			c.stall = wd.finish()
+		}(i, c)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err == nil {
+			return nil
+		}
+	}
+	return errs[0]
+}
+
+// Stop 停止所有副本的录制。
+func (p *redundantParser) Stop() error {
+	for _, c := range p.copies {
+		c.parser.Stop()
+	}
+	return nil
+}
+
+// Status 返回主录制文件的解析器状态。
+func (p *redundantParser) Status() (map[string]string, error) {
+	sp, ok := p.copies[0].parser.(parser.StatusParser)
+	if !ok {
+		return nil, ErrParserNotSupportStatus
+	}
+	status, err := sp.Status()
+	if err != nil {
+		return nil, err
+	}
+	status["copies"] = fmt.Sprint(len(p.copies))
+	return status, nil
+}
+
+// Stats 返回主录制文件的写入统计。
+func (p *redundantParser) Stats() parser.Stats {
+	if sp, ok := p.copies[0].parser.(parser.StatsParser); ok {
+		return sp.Stats()
+	}
+	return parser.Stats{}
+}
+
+// Progress 返回主录制文件已写入的时长，主解析器不支持时返回 0。
+func (p *redundantParser) Progress() time.Duration {
+	if pp, ok := p.copies[0].parser.(parser.ProgressParser); ok {
+		return pp.Progress()
+	}
+	return 0
+}
+
+// startCopies 在冗余录制开始时写入其余副本的元数据文件。
+func (r *recorder) startCopies(p *redundantParser, info *live.Info) {
+	primary := filepath.Base(p.copies[0].file)
+	for _, c := range p.copies[1:] {
+		jsonFilePath := metadata.PathOf(c.file)
+		r.saveJSONToFile(jsonFilePath, info)
+		r.saveRecordTime(jsonFilePath, "start_time_unix", r.startTime)
+		if err := metadata.Update(jsonFilePath, map[string]interface{}{"copy_of": primary}); err != nil {
+			r.getLogger().WithError(err).Error("写入冗余副本信息失败")
+		}
+	}
+}
+
+// finishCopies 在冗余录制结束后写入各个副本的元数据文件，并在主录制文件的元数据中记录其余副本，
+// 返回仍然存在的副本文件。
+func (r *recorder) finishCopies(p *redundantParser, info *live.Info) []string {
+	primary := p.copies[0]
+	var files, names []string
+	for i, c := range p.copies {
+		jsonFilePath := metadata.PathOf(c.file)
+		if i > 0 {
+			r.finishPart(c.file)
+			removeEmptyFile(c.file)
+			if !fileExists(c.file) {
+				os.Remove(jsonFilePath)
+				continue
+			}
+			r.saveJSONToFile(jsonFilePath, info)
+			r.saveRecordTime(jsonFilePath, "end_time_unix", time.Now())
+			files, names = append(files, c.file), append(names, filepath.Base(c.file))
+		}
+		if c.stall != nil {
+			r.saveStall(jsonFilePath, c.url, c.stall)
+			r.ed.DispatchEvent(events.NewEvent(RecorderStalled, r.Live))
+		}
+	}
+	if len(names) > 0 {
+		if err := metadata.Update(metadata.PathOf(primary.file), map[string]interface{}{"copies": names}); err != nil {
+			r.getLogger().WithError(err).Error("写入冗余副本信息失败")
+		}
+	}
+	return files
+}
@@ -0,0 +1,75 @@
+package recorders
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yuhaohwang/bililive-go/src/configs"
+	"github.com/yuhaohwang/bililive-go/src/live"
+	"github.com/yuhaohwang/bililive-go/src/pkg/metadata"
+	"github.com/yuhaohwang/bililive-go/src/pkg/parser"
+)
+
+// hostParser 将直播流地址的主机名写入录制文件，主机名为 fail 时返回错误。
+type hostParser struct {
+	fakeParser
+}
+
+func (p *hostParser) ParseLiveStream(ctx context.Context, url *url.URL, live live.Live, file string) error {
+	if url.Host == "fail" {
+		return errors.New("fail")
+	}
+	return os.WriteFile(file, []byte(url.Host), 0644)
+}
+
+func TestCopyFileName(t *testing.T) {
+	assert.Equal(t, "a/test.flv", copyFileName("a/test.flv", 0))
+	assert.Equal(t, "a/test.copy1.flv", copyFileName("a/test.flv", 1))
+	assert.Equal(t, "a/test.copy2.ts", copyFileName("a/test.ts", 2))
+}
+
+func TestRedundantParser(t *testing.T) {
+	backup := newParser
+	newParser = func(u *url.URL, feature configs.Feature, cfg map[string]string) (parser.Parser, error) {
+		return &hostParser{}, nil
+	}
+	defer func() { newParser = backup }()
+
+	a, _ := url.Parse("https://a/live.flv")
+	b, _ := url.Parse("https://b/live.flv")
+	fail, _ := url.Parse("https://fail/live.flv")
+	cfg := configs.NewConfig()
+	cfg.Redundancy.Copies = 3
+	file := filepath.Join(t.TempDir(), "test.flv")
+
+	// 副本依次使用不同的直播流地址，地址不够时循环使用，录制过程中写入 .part 文件
+	p, err := newRedundantParser(&hostParser{}, []*url.URL{a, b}, b, file, cfg, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, p.ParseLiveStream(context.Background(), nil, nil, ""))
+	for i, host := range []string{"b", "a", "b"} {
+		content, err := os.ReadFile(metadata.PartOf(copyFileName(file, i)))
+		assert.NoError(t, err)
+		assert.Equal(t, host, string(content))
+	}
+
+	// 任意一个副本成功即视为录制成功
+	cfg.Redundancy.Copies = 2
+	p, err = newRedundantParser(&hostParser{}, []*url.URL{fail, a}, fail, file, cfg, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, p.ParseLiveStream(context.Background(), nil, nil, ""))
+
+	// 所有副本失败时返回主录制文件的错误，停止时停止所有副本
+	p, err = newRedundantParser(&hostParser{}, []*url.URL{fail}, fail, file, cfg, nil)
+	assert.NoError(t, err)
+	assert.Error(t, p.ParseLiveStream(context.Background(), nil, nil, ""))
+	assert.NoError(t, p.Stop())
+	for _, c := range p.copies {
+		assert.Equal(t, uint32(1), c.parser.(*hostParser).stopped)
+	}
+}
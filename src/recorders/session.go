@@ -0,0 +1,385 @@
+package recorders
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+
+	"github.com/yuhaohwang/bililive-go/src/configs"
+	"github.com/yuhaohwang/bililive-go/src/instance"
+	"github.com/yuhaohwang/bililive-go/src/interfaces"
+	"github.com/yuhaohwang/bililive-go/src/live"
+	"github.com/yuhaohwang/bililive-go/src/pkg/events"
+	"github.com/yuhaohwang/bililive-go/src/pkg/metadata"
+)
+
+// 分段结束的原因，无缝切分的原因见 parser.SplitReasonMaxDuration 等常量。
+const (
+	SegmentEndStreamEnded     = "stream_ended"      // 直播流中断或结束，之后重新拉流
+	SegmentEndStalled         = "stalled"           // 直播流停滞，之后重新拉流
+	SegmentEndRoomNameChanged = "room_name_changed" // 房间名变化，重新开始录制
+	SegmentEndPreempted       = "preempted"         // 达到同时录制上限，被优先级更高的直播间抢占
+	SegmentEndDiskLow         = "disk_low"          // 磁盘剩余空间不足
+	SegmentEndLiveEnd         = "live_end"          // 直播结束
+	SegmentEndStopped         = "stopped"           // 停止监听或程序退出
+)
+
+// sessionDir 是直播场次清单在输出目录中的目录名。
+const sessionDir = ".sessions"
+
+// Segment 是直播场次中的一个录制文件。
+type Segment struct {
+	Index      int       `json:"index"`       // 分段序号，从 0 开始
+	File       string    `json:"file"`        // 录制文件路径
+	Title      string    `json:"title"`       // 结束录制时的房间标题
+	StartTime  time.Time `json:"start_time"`  // 开始录制的时间
+	EndTime    time.Time `json:"end_time"`    // 结束录制的时间
+	OffsetMs   int64     `json:"offset_ms"`   // 开始录制的时间相对于场次开始的偏移
+	DurationMs int64     `json:"duration_ms"` // 录制时长
+	EndReason  string    `json:"end_reason"`  // 本分段结束的原因
+}
+
+// Session 是一场直播的清单，按顺序记录这场直播产生的所有录制文件。
+type Session struct {
+	ID        string     `json:"id"`                 // 场次唯一标识
+	LiveId    live.ID    `json:"live_id"`            // 直播唯一标识
+	LiveUrl   string     `json:"live_url"`           // 直播原始 URL
+	Platform  string     `json:"platform"`           // 平台中文名称
+	HostName  string     `json:"host_name"`          // 主播名
+	StartTime time.Time  `json:"start_time"`         // 开播的时间
+	EndTime   time.Time  `json:"end_time,omitempty"` // 场次结束的时间
+	Titles    []string   `json:"titles"`             // 直播期间出现过的所有房间标题，按出现的顺序排列
+	Segments  []*Segment `json:"segments"`           // 录制文件，按开始录制的顺序排列
+	File      string     `json:"file,omitempty"`     // 所有分段拼接后的录制文件
+	Markers   []*Chapter `json:"markers,omitempty"`  // 录制期间手动添加的标记，按添加的顺序排列
+}
+
+// LoadSession 在全局和各直播间的输出目录中查找并读取直播场次清单。
+func LoadSession(ctx context.Context, id string) (*Session, error) {
+	if id == "" || filepath.Base(id) != id {
+		return nil, ErrSessionNotExist
+	}
+	for _, root := range instance.GetInstance(ctx).Config.OutputRoots() {
+		b, err := os.ReadFile(filepath.Join(root, sessionDir, id+".json"))
+		if err != nil {
+			continue
+		}
+		manifest := new(Session)
+		if err := json.Unmarshal(b, manifest); err != nil {
+			return nil, err
+		}
+		return manifest, nil
+	}
+	return nil, ErrSessionNotExist
+}
+
+// Locate 将相对于开播时间的片段起点和终点转换为录制文件及相对于文件开头的位置。
+// 分段已拼接时使用拼接后的文件，否则片段必须位于同一个分段中。
+func (s *Session) Locate(startMs, endMs int64) (file string, fileStartMs, fileEndMs int64, err error) {
+	if len(s.Segments) == 0 {
+		return "", 0, 0, fmt.Errorf("直播场次[%s]没有录制文件", s.ID)
+	}
+	if s.File != "" {
+		base := s.Segments[0].OffsetMs
+		if startMs < base {
+			startMs = base
+		}
+		return s.File, startMs - base, endMs - base, nil
+	}
+	for _, seg := range s.Segments {
+		if startMs < seg.OffsetMs || startMs >= seg.OffsetMs+seg.DurationMs {
+			continue
+		}
+		if endMs > seg.OffsetMs+seg.DurationMs {
+			return "", 0, 0, fmt.Errorf("片段跨越了多个录制文件，请先拼接直播场次")
+		}
+		return seg.File, startMs - seg.OffsetMs, endMs - seg.OffsetMs, nil
+	}
+	return "", 0, 0, fmt.Errorf("直播场次[%s]中没有包含该位置的录制文件", s.ID)
+}
+
+// session 维护一场直播的清单。最后一个录制文件写入并检查完成后场次才会结束。
+type session struct {
+	lock     sync.Mutex
+	ctx      context.Context
+	manifest *Session
+	path     string // 清单文件路径
+	ed       events.Dispatcher
+	logger   *interfaces.Logger
+	concat   configs.SessionConcat
+	reg      *sessionRegistry
+	held     []heldFile // 等待拼接的录制文件
+	open     int        // 正在录制或检查的分段数
+	ending   bool       // 直播已结束，等待正在录制或检查的分段完成
+	ended    bool
+}
+
+// sessionRegistry 记录每个直播间当前的直播场次。
+type sessionRegistry struct {
+	lock     sync.Mutex
+	sessions map[live.ID]*session
+	tasks    sync.WaitGroup // 完整性检查、提交录制后处理和拼接等后台任务，退出时需要等待它们完成
+}
+
+// newSessionRegistry 创建一个新的 sessionRegistry 实例。
+func newSessionRegistry() *sessionRegistry {
+	return &sessionRegistry{sessions: make(map[live.ID]*session)}
+}
+
+// start 在开播时开始新的直播场次，结束该直播间之前的场次。
+func (reg *sessionRegistry) start(ctx context.Context, l live.Live) *session {
+	reg.lock.Lock()
+	defer reg.lock.Unlock()
+	if old, ok := reg.sessions[l.GetLiveId()]; ok {
+		old.end()
+	}
+	s := newSession(ctx, l)
+	s.reg = reg
+	reg.sessions[l.GetLiveId()] = s
+	return s
+}
+
+// goTask 在后台执行任务，并记录到需要在退出时等待的任务中。
+func (reg *sessionRegistry) goTask(f func()) {
+	if reg == nil {
+		go f()
+		return
+	}
+	reg.tasks.Add(1)
+	go func() {
+		defer reg.tasks.Done()
+		f()
+	}()
+}
+
+// wait 等待所有后台任务完成，ctx 结束时返回 false。
+func (reg *sessionRegistry) wait(ctx context.Context) bool {
+	done := make(chan struct{})
+	go func() {
+		reg.tasks.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// get 返回直播间当前的直播场次，没有检测到开播就开始录制时创建新的场次。
+func (reg *sessionRegistry) get(ctx context.Context, l live.Live) *session {
+	if reg == nil {
+		return nil
+	}
+	reg.lock.Lock()
+	if s, ok := reg.sessions[l.GetLiveId()]; ok {
+		reg.lock.Unlock()
+		return s
+	}
+	reg.lock.Unlock()
+	return reg.start(ctx, l)
+}
+
+// end 结束直播间当前的直播场次。
+func (reg *sessionRegistry) end(liveId live.ID) {
+	reg.lock.Lock()
+	defer reg.lock.Unlock()
+	if s, ok := reg.sessions[liveId]; ok {
+		s.end()
+		delete(reg.sessions, liveId)
+	}
+}
+
+// endAll 结束所有直播场次。
+func (reg *sessionRegistry) endAll() {
+	reg.lock.Lock()
+	defer reg.lock.Unlock()
+	for id, s := range reg.sessions {
+		s.end()
+		delete(reg.sessions, id)
+	}
+}
+
+// addTitle 记录直播间当前场次中出现的房间标题。
+func (reg *sessionRegistry) addTitle(liveId live.ID, title string) {
+	reg.lock.Lock()
+	s := reg.sessions[liveId]
+	reg.lock.Unlock()
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.addTitleLocked(title) {
+		s.saveLocked()
+	}
+}
+
+// newSession 创建直播场次，写入清单并通知场次开始。
+func newSession(ctx context.Context, l live.Live) *session {
+	inst := instance.GetInstance(ctx)
+	id, _ := uuid.NewV4()
+	manifest := &Session{
+		ID:        id.String(),
+		LiveId:    l.GetLiveId(),
+		LiveUrl:   l.GetRawUrl(),
+		Platform:  l.GetPlatformCNName(),
+		StartTime: l.GetLastStartTime(),
+		Titles:    []string{},
+		Segments:  []*Segment{},
+	}
+	if manifest.StartTime.IsZero() {
+		manifest.StartTime = time.Now()
+	}
+	cfg := inst.Config.EffectiveConfig(l.GetRawUrl())
+	s := &session{
+		ctx:      ctx,
+		manifest: manifest,
+		path:     filepath.Join(cfg.OutPutPath, sessionDir, manifest.ID+".json"),
+		logger:   inst.Logger,
+		concat:   cfg.SessionConcat,
+	}
+	s.ed, _ = inst.EventDispatcher.(events.Dispatcher)
+	if obj, err := inst.Cache.Get(l); err == nil {
+		info := obj.(*live.Info)
+		manifest.HostName = info.HostName
+		s.addTitleLocked(info.RoomName)
+	}
+
+	s.saveLocked()
+	s.logger.Infof("直播场次[%s]开始: %s", manifest.ID, manifest.LiveUrl)
+	s.dispatchLocked(SessionStart)
+	return s
+}
+
+// openSegment 开始录制或检查一个分段，分段结束前场次不会结束。
+func (s *session) openSegment() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.open++
+}
+
+// closeSegment 结束录制或检查一个分段。
+func (s *session) closeSegment() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.open--
+	s.finishLocked()
+}
+
+// addSegment 将写入完成的录制文件加入清单，并在录制文件的元数据中记录所属的场次。
+func (s *session) addSegment(file, title string, start, end time.Time, reason string) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	seg := &Segment{
+		Index:      len(s.manifest.Segments),
+		File:       file,
+		Title:      title,
+		StartTime:  start,
+		EndTime:    end,
+		OffsetMs:   start.Sub(s.manifest.StartTime).Milliseconds(),
+		DurationMs: end.Sub(start).Milliseconds(),
+		EndReason:  reason,
+	}
+	s.manifest.Segments = append(s.manifest.Segments, seg)
+	s.addTitleLocked(title)
+	s.saveLocked()
+	err := metadata.Update(metadata.PathOf(file), map[string]interface{}{
+		"session": metadata.SessionRef{ID: s.manifest.ID, Index: seg.Index},
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("写入直播场次信息失败")
+	}
+}
+
+// end 标记直播已结束，正在录制的分段全部完成后结束场次。
+func (s *session) end() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.ending = true
+	s.finishLocked()
+}
+
+// finishLocked 在直播已结束且没有正在录制或检查的分段时结束场次，调用方需持有锁。
+// 开启了拼接时在后台拼接分段，完成后再结束场次。
+func (s *session) finishLocked() {
+	if !s.ending || s.open > 0 || s.ended {
+		return
+	}
+	s.ended = true
+	s.manifest.EndTime = time.Now()
+	if s.concat.Enable {
+		s.reg.goTask(s.finishConcat)
+		return
+	}
+	s.saveLocked()
+	s.logger.Infof("直播场次[%s]结束，共%d个录制文件", s.manifest.ID, len(s.manifest.Segments))
+	s.dispatchLocked(SessionEnd)
+}
+
+// addTitleLocked 记录新出现的房间标题，返回标题是否为新出现的，调用方需持有锁。
+func (s *session) addTitleLocked(title string) bool {
+	if title == "" {
+		return false
+	}
+	for _, t := range s.manifest.Titles {
+		if t == title {
+			return false
+		}
+	}
+	s.manifest.Titles = append(s.manifest.Titles, title)
+	return true
+}
+
+// snapshotLocked 返回清单的副本，调用方需持有锁。
+func (s *session) snapshotLocked() *Session {
+	manifest := *s.manifest
+	manifest.Titles = append([]string(nil), s.manifest.Titles...)
+	manifest.Segments = make([]*Segment, len(s.manifest.Segments))
+	for i, seg := range s.manifest.Segments {
+		copied := *seg
+		manifest.Segments[i] = &copied
+	}
+	manifest.Markers = copyMarkers(s.manifest.Markers)
+	return &manifest
+}
+
+// dispatchLocked 分发携带清单副本的场次事件，调用方需持有锁。
+func (s *session) dispatchLocked(eventType events.EventType) {
+	if s.ed != nil {
+		s.ed.DispatchEvent(events.NewEvent(eventType, s.snapshotLocked()))
+	}
+}
+
+// saveLocked 将清单写入文件，先写入临时文件再替换，调用方需持有锁。
+func (s *session) saveLocked() {
+	b, err := json.MarshalIndent(s.manifest, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(s.path), os.ModePerm)
+	}
+	if err == nil {
+		tmp := s.path + ".tmp"
+		if err = os.WriteFile(tmp, b, 0644); err == nil {
+			err = os.Rename(tmp, s.path)
+		}
+	}
+	if err != nil {
+		s.logger.WithError(err).Error("写入直播场次清单失败")
+	}
+}
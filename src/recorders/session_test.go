@@ -0,0 +1,115 @@
+package recorders
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bluele/gcache"
+	"github.com/golang/mock/gomock"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yuhaohwang/bililive-go/src/configs"
+	"github.com/yuhaohwang/bililive-go/src/instance"
+	"github.com/yuhaohwang/bililive-go/src/interfaces"
+	"github.com/yuhaohwang/bililive-go/src/live"
+	livemock "github.com/yuhaohwang/bililive-go/src/live/mock"
+	"github.com/yuhaohwang/bililive-go/src/pkg/events"
+	"github.com/yuhaohwang/bililive-go/src/pkg/metadata"
+)
+
+func TestSession(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dir := t.TempDir()
+	cfg := configs.NewConfig()
+	cfg.OutPutPath = dir
+	inst := &instance.Instance{
+		Config: cfg,
+		Logger: &interfaces.Logger{Logger: logrus.New()},
+		Cache:  gcache.New(4).LRU().Build(),
+	}
+	ctx := context.WithValue(context.Background(), instance.Key, inst)
+	ed := events.NewDispatcher(ctx)
+	received := make(chan *events.Event, 4)
+	listener := events.NewEventListener(func(event *events.Event) { received <- event })
+	ed.AddEventListener(SessionStart, listener)
+	ed.AddEventListener(SessionEnd, listener)
+
+	start := time.Now().Add(-time.Minute)
+	l := livemock.NewMockLive(ctrl)
+	l.EXPECT().GetLiveId().Return(live.ID("test")).AnyTimes()
+	l.EXPECT().GetRawUrl().Return("https://example.com/test").AnyTimes()
+	l.EXPECT().GetPlatformCNName().Return("test").AnyTimes()
+	l.EXPECT().GetLastStartTime().Return(start).AnyTimes()
+	inst.Cache.Set(l, &live.Info{Live: l, HostName: "host", RoomName: "title1"})
+
+	// 1. 开播时开始新的直播场次。
+	reg := newSessionRegistry()
+	s := reg.start(ctx, l)
+	assert.Equal(t, s, reg.get(ctx, l))
+	event := <-received
+	assert.Equal(t, SessionStart, event.Type)
+	assert.Equal(t, []string{"title1"}, event.Object.(*Session).Titles)
+
+	// 2. 分段按顺序加入清单，并在录制文件的元数据中记录所属的场次。
+	files := []string{filepath.Join(dir, "a.flv"), filepath.Join(dir, "b.flv")}
+	for _, file := range files {
+		assert.NoError(t, os.WriteFile(file, []byte("test"), 0644))
+	}
+	s.openSegment()
+	s.addSegment(files[0], "title1", start.Add(time.Second), start.Add(10*time.Second), "max_duration")
+	reg.addTitle("test", "title2")
+	s.addSegment(files[1], "title2", start.Add(10*time.Second), start.Add(20*time.Second), SegmentEndLiveEnd)
+	md, err := metadata.Read(metadata.PathOf(files[1]))
+	assert.NoError(t, err)
+	assert.Equal(t, &metadata.SessionRef{ID: s.manifest.ID, Index: 1}, md.Session)
+
+	// 3. 直播结束后等待正在录制的分段完成才结束场次。
+	reg.end("test")
+	select {
+	case event := <-received:
+		t.Fatalf("unexpected event %s", event.Type)
+	case <-time.After(50 * time.Millisecond):
+	}
+	s.closeSegment()
+	event = <-received
+	assert.Equal(t, SessionEnd, event.Type)
+	manifest := event.Object.(*Session)
+	assert.Equal(t, []string{"title1", "title2"}, manifest.Titles)
+	assert.Len(t, manifest.Segments, 2)
+	assert.Equal(t, int64(1000), manifest.Segments[0].OffsetMs)
+	assert.Equal(t, int64(9000), manifest.Segments[0].DurationMs)
+	assert.Equal(t, "max_duration", manifest.Segments[0].EndReason)
+	assert.Equal(t, SegmentEndLiveEnd, manifest.Segments[1].EndReason)
+	assert.False(t, manifest.EndTime.IsZero())
+
+	// 4. 清单文件与事件中的清单一致，下一场直播使用新的场次。
+	b, err := os.ReadFile(filepath.Join(dir, sessionDir, manifest.ID+".json"))
+	assert.NoError(t, err)
+	var saved Session
+	assert.NoError(t, json.Unmarshal(b, &saved))
+	assert.Equal(t, manifest.ID, saved.ID)
+	assert.Len(t, saved.Segments, 2)
+	assert.NotEqual(t, s, reg.get(ctx, l))
+
+	// 5. 按 ID 读取清单，相对于开播时间的位置转换为录制文件中的位置。
+	loaded, err := LoadSession(ctx, manifest.ID)
+	assert.NoError(t, err)
+	file, startMs, endMs, err := loaded.Locate(12000, 15000)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{files[1], int64(2000), int64(5000)}, []interface{}{file, startMs, endMs})
+	_, _, _, err = loaded.Locate(5000, 15000)
+	assert.Error(t, err)
+	loaded.File = filepath.Join(dir, "a.concat.flv")
+	file, startMs, endMs, err = loaded.Locate(5000, 15000)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{loaded.File, int64(4000), int64(14000)}, []interface{}{file, startMs, endMs})
+	_, err = LoadSession(ctx, "../"+manifest.ID)
+	assert.Equal(t, ErrSessionNotExist, err)
+}
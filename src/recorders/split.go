@@ -0,0 +1,140 @@
+package recorders
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yuhaohwang/bililive-go/src/configs"
+	"github.com/yuhaohwang/bililive-go/src/live"
+	"github.com/yuhaohwang/bililive-go/src/pkg/metadata"
+	"github.com/yuhaohwang/bililive-go/src/pkg/parser"
+)
+
+// splitTracker 记录一次录制中无缝切分产生的分段，并将分段边界写入元数据文件。
+type splitTracker struct {
+	ctx   context.Context
+	r     *recorder
+	cfg   *configs.Config
+	info  *live.Info
+	url   *url.URL
+	file  string         // 当前正在写入的文件
+	start time.Time      // 当前分段开始写入的时间
+	split metadata.Split // 当前分段的信息
+	sess  *session       // 分段所属的直播场次
+}
+
+// newSplitTracker 创建一个新的 splitTracker 实例。
+func newSplitTracker(ctx context.Context, r *recorder, cfg *configs.Config, info *live.Info, url *url.URL, file string) *splitTracker {
+	now := time.Now()
+	return &splitTracker{
+		ctx:   ctx,
+		r:     r,
+		cfg:   cfg,
+		info:  info,
+		url:   url,
+		file:  file,
+		start: now,
+		split: metadata.Split{StartTimeUnix: now.Unix()},
+		sess:  r.sessions.get(ctx, r.Live),
+	}
+}
+
+// options 返回解析器使用的切分条件。
+func (s *splitTracker) options() parser.SplitOptions {
+	opts := parser.SplitOptions{
+		MaxDuration: s.cfg.VideoSplitStrategies.MaxDuration,
+		NextFile:    s.nextFile,
+		OnSplit:     s.onSplit,
+	}
+	if size := s.cfg.VideoSplitStrategies.MaxFileSize; size > 0 {
+		opts.MaxFileSize = int64(size)
+	}
+	if s.cfg.VideoSplitStrategies.Aligned() {
+		opts.NextSplitTime = s.cfg.VideoSplitStrategies.NextAlignedTime
+	}
+	return opts
+}
+
+// nextFile 根据文件名模板生成下一个分段正在录制时写入的文件名，文件名重复时添加序号。
+func (s *splitTracker) nextFile() string {
+	name := s.r.getFileName(s.cfg, s.info, s.url)
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; name == s.file || fileExists(name) || fileExists(metadata.PartOf(name)); i++ {
+		name = fmt.Sprintf("%s_%03d%s", base, i, ext)
+	}
+	if err := mkdir(filepath.Dir(name)); err != nil {
+		s.r.getLogger().WithError(err).Errorf("无法创建输出目录[%s]", filepath.Dir(name))
+	}
+	return metadata.PartOf(name)
+}
+
+// onSplit 结束上一个分段并开始记录新的分段。
+func (s *splitTracker) onSplit(split parser.Split) {
+	// 1. 去掉上一个分段的 .part 扩展名，之后都使用录制文件的文件名。
+	split.PrevFile = strings.TrimSuffix(split.PrevFile, metadata.PartExt)
+	split.NextFile = strings.TrimSuffix(split.NextFile, metadata.PartExt)
+	s.r.finishPart(split.PrevFile)
+
+	// 2. 更新上一个分段的元数据，检查文件完整性并提交录制后处理任务。
+	prev := s.split
+	prev.NextFile = relPath(split.PrevFile, split.NextFile)
+	prev.Reason = split.Reason
+	prev.EndOffsetMs = split.Offset.Milliseconds()
+	prev.EndTimeUnix = split.Time.Unix()
+	s.info.Recording = false
+	s.r.saveJSONToFile(metadata.PathOf(split.PrevFile), s.info)
+	s.saveSplit(split.PrevFile, prev)
+	s.sess.addSegment(split.PrevFile, s.info.RoomName, s.start, split.Time, split.Reason)
+	s.r.finishFile(s.ctx, s.sess, s.info, split.PrevFile)
+	s.r.getLogger().Infof("录制文件已切分(%s): %s -> %s", split.Reason, split.PrevFile, split.NextFile)
+
+	// 3. 写入新分段的元数据。
+	s.file = split.NextFile
+	s.start = split.Time
+	s.split = metadata.Split{
+		Index:         prev.Index + 1,
+		PrevFile:      relPath(split.NextFile, split.PrevFile),
+		StartOffsetMs: prev.EndOffsetMs,
+		StartTimeUnix: prev.EndTimeUnix,
+	}
+	s.info.Recording = true
+	s.r.saveJSONToFile(metadata.PathOf(split.NextFile), s.info)
+	s.saveSplit(split.NextFile, s.split)
+	if t := s.r.chapterTracker(); t != nil {
+		t.split(split.NextFile, split.Time)
+	}
+	s.r.splitStatus(split.NextFile, split.Time)
+}
+
+// finish 在录制结束时写入最后一个分段的结束时间。
+func (s *splitTracker) finish() {
+	s.split.EndTimeUnix = time.Now().Unix()
+	s.saveSplit(s.file, s.split)
+}
+
+// saveSplit 将分段信息写入录制文件的元数据文件。
+func (s *splitTracker) saveSplit(file string, split metadata.Split) {
+	if err := metadata.Update(metadata.PathOf(file), map[string]interface{}{"split": split}); err != nil {
+		s.r.getLogger().WithError(err).Error("写入分段信息失败")
+	}
+}
+
+// relPath 返回 target 相对于 file 所在目录的路径。
+func relPath(file, target string) string {
+	if rel, err := filepath.Rel(filepath.Dir(file), target); err == nil {
+		return rel
+	}
+	return target
+}
+
+// fileExists 返回文件是否存在。
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
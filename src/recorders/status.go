@@ -0,0 +1,119 @@
+package recorders
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/yuhaohwang/bililive-go/src/instance"
+	"github.com/yuhaohwang/bililive-go/src/live"
+	"github.com/yuhaohwang/bililive-go/src/pkg/parser"
+)
+
+// statusInterval 是通过 WebSocket 推送录制器状态的间隔。
+const statusInterval = 5 * time.Second
+
+// Status 是录制器的状态。码率、帧率等解析器统计的字段只在正在录制时有值，
+// 没有在录制时 Parser、StreamUrl 和 File 为上一次录制的值。
+type Status struct {
+	LiveId          live.ID   `json:"live_id"`              // 直播唯一标识
+	Recording       bool      `json:"recording"`            // 是否正在录制
+	Parser          string    `json:"parser,omitempty"`     // 解析器名称
+	StreamUrl       string    `json:"stream_url,omitempty"` // 直播流地址
+	File            string    `json:"file,omitempty"`       // 当前写入的文件
+	Bytes           int64     `json:"bytes"`                // 当前文件已写入的字节数
+	BitrateKbps     float64   `json:"bitrate_kbps"`         // 码率
+	FPS             float64   `json:"fps"`                  // 帧率
+	MediaDurationMs int64     `json:"media_duration_ms"`    // 当前文件已写入的媒体时长
+	WallDurationMs  int64     `json:"wall_duration_ms"`     // 当前文件开始写入后经过的时间
+	Restarts        int       `json:"restarts"`             // 录制器启动后重新拉流的次数
+	LastError       string    `json:"last_error,omitempty"` // 最近一次录制失败的原因
+	FileStartTime   time.Time `json:"file_start_time"`      // 当前文件开始写入的时间
+}
+
+// GetStatus 返回录制器的状态，正在录制时合并解析器统计的当前文件的写入状态。
+func (r *recorder) GetStatus() *Status {
+	r.statusLock.Lock()
+	status := r.status
+	r.statusLock.Unlock()
+	status.LiveId = r.Live.GetLiveId()
+	status.Recording = atomic.LoadUint32(&r.recording) == 1
+	if !status.Recording {
+		return &status
+	}
+	status.WallDurationMs = time.Since(status.FileStartTime).Milliseconds()
+	if sp, ok := r.getParser().(parser.StatsParser); ok {
+		stats := sp.Stats()
+		status.Parser = stats.Parser
+		if stats.File != "" {
+			status.File = stats.File
+		}
+		status.Bytes = stats.Bytes
+		status.BitrateKbps = stats.BitrateKbps
+		status.FPS = stats.FPS
+		status.MediaDurationMs = stats.MediaDuration.Milliseconds()
+	}
+	return &status
+}
+
+// startStatus 在开始录制时记录直播流地址和文件，第一次之后的录制计为重新拉流。
+func (r *recorder) startStatus(url, file string, start time.Time) {
+	r.statusLock.Lock()
+	defer r.statusLock.Unlock()
+	if r.status.StreamUrl != "" {
+		r.status.Restarts++
+	}
+	r.status.StreamUrl = url
+	r.status.File = file
+	r.status.FileStartTime = start
+}
+
+// splitStatus 在无缝切分时记录新的文件。
+func (r *recorder) splitStatus(file string, start time.Time) {
+	r.statusLock.Lock()
+	defer r.statusLock.Unlock()
+	r.status.File = file
+	r.status.FileStartTime = start
+}
+
+// setLastError 记录最近一次录制失败的原因。
+func (r *recorder) setLastError(err error) {
+	r.statusLock.Lock()
+	defer r.statusLock.Unlock()
+	r.status.LastError = err.Error()
+}
+
+// GetStatuses 返回所有录制器的状态，按直播唯一标识排序。
+func (m *manager) GetStatuses(ctx context.Context) []*Status {
+	m.lock.RLock()
+	statuses := make([]*Status, 0, len(m.recorders))
+	for _, r := range m.recorders {
+		statuses = append(statuses, r.GetStatus())
+	}
+	m.lock.RUnlock()
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].LiveId < statuses[j].LiveId
+	})
+	return statuses
+}
+
+// broadcastStatus 定期通过 WebSocket 推送所有录制器的状态，直到管理器关闭。
+func (m *manager) broadcastStatus(ctx context.Context) {
+	ticker := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+		}
+		wsm := instance.GetInstance(ctx).WebsocketManager
+		if wsm == nil {
+			continue
+		}
+		if statuses := m.GetStatuses(ctx); len(statuses) > 0 {
+			wsm.BroadcastMessage("recorderStatus", statuses)
+		}
+	}
+}
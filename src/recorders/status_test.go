@@ -0,0 +1,69 @@
+package recorders
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yuhaohwang/bililive-go/src/live"
+	livemock "github.com/yuhaohwang/bililive-go/src/live/mock"
+	"github.com/yuhaohwang/bililive-go/src/pkg/parser"
+)
+
+// statsParser 是返回固定写入统计的解析器。
+type statsParser struct {
+	parser.Parser
+	stats parser.Stats
+}
+
+func (p *statsParser) Stats() parser.Stats {
+	return p.stats
+}
+
+func TestRecorderStatus(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	l := livemock.NewMockLive(ctrl)
+	l.EXPECT().GetLiveId().Return(live.ID("test")).AnyTimes()
+	r := &recorder{Live: l, parserLock: new(sync.RWMutex)}
+
+	// 1. 没有录制过时只有直播唯一标识。
+	assert.Equal(t, &Status{LiveId: "test"}, r.GetStatus())
+
+	// 2. 正在录制时合并解析器的写入统计，重新拉流和切分更新对应的字段。
+	start := time.Now().Add(-time.Minute)
+	r.startStatus("https://example.com/1.flv", "a.flv", start)
+	r.setLastError(errors.New("直播流停滞"))
+	r.startStatus("https://example.com/2.flv", "a_001.flv", start)
+	r.splitStatus("b.flv", start.Add(30*time.Second))
+	r.parser = &statsParser{stats: parser.Stats{
+		Parser:        "native",
+		Bytes:         1000,
+		MediaDuration: 2 * time.Second,
+		BitrateKbps:   4,
+		FPS:           30,
+	}}
+	r.recording = 1
+	status := r.GetStatus()
+	assert.True(t, status.Recording)
+	assert.Equal(t, "native", status.Parser)
+	assert.Equal(t, "https://example.com/2.flv", status.StreamUrl)
+	assert.Equal(t, "b.flv", status.File)
+	assert.Equal(t, int64(1000), status.Bytes)
+	assert.Equal(t, int64(2000), status.MediaDurationMs)
+	assert.Equal(t, 1, status.Restarts)
+	assert.Equal(t, "直播流停滞", status.LastError)
+	assert.GreaterOrEqual(t, status.WallDurationMs, int64(30000))
+
+	// 3. 停止录制后保留上一次录制的信息，不再返回写入统计。
+	r.recording = 0
+	status = r.GetStatus()
+	assert.False(t, status.Recording)
+	assert.Equal(t, "b.flv", status.File)
+	assert.Zero(t, status.Bytes)
+}
@@ -0,0 +1,99 @@
+package recorders
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/yuhaohwang/bililive-go/src/instance"
+	"github.com/yuhaohwang/bililive-go/src/live"
+	"github.com/yuhaohwang/bililive-go/src/pkg/events"
+	"github.com/yuhaohwang/bililive-go/src/pkg/integrity"
+	"github.com/yuhaohwang/bililive-go/src/pkg/metadata"
+)
+
+// verifySem 限制同时进行的完整性检查数量，避免录制期间占用过多磁盘读写。
+var verifySem = make(chan struct{}, 1)
+
+// Verification 是 RecordingVerified 事件携带的检查结果。
+type Verification struct {
+	LiveId live.ID           `json:"live_id"`
+	File   string            `json:"file"`
+	Report *integrity.Report `json:"report"`
+}
+
+// finishFile 在后台检查录制完成的文件，将结果写入元数据文件后再提交录制后处理任务，
+// 以便处理步骤根据检查结果决定是否执行。冗余录制的其他副本只检查，由录制后处理从中选出最佳副本。
+// 直播场次开启了拼接时，录制文件等到场次结束拼接后再提交录制后处理任务。
+func (r *recorder) finishFile(ctx context.Context, sess *session, info *live.Info, fileName string, copies ...string) {
+	if _, err := os.Stat(fileName); err != nil && len(copies) == 0 {
+		return
+	}
+	// 直播信息会随刷新和切分而变化，保存文件结束时的副本
+	infoCopy := *info
+	sess.openSegment()
+	r.sessions.goTask(func() {
+		defer sess.closeSegment()
+		for _, file := range append([]string{fileName}, copies...) {
+			if fileExists(file) {
+				r.verify(ctx, file)
+				r.ed.DispatchEvent(events.NewEvent(RecordingFinished, file))
+			}
+		}
+		if sess.holds() {
+			sess.hold(fileName, &infoCopy)
+			return
+		}
+		r.submitPostProcess(ctx, &infoCopy, fileName)
+	})
+}
+
+// verify 检查录制文件的完整性，并将结果写入元数据文件。
+func (r *recorder) verify(ctx context.Context, fileName string) {
+	// 1. 检查文件，不支持的格式不做记录。
+	verifySem <- struct{}{}
+	report, err := integrity.Verify(fileName)
+	<-verifySem
+	if errors.Is(err, integrity.ErrUnsupportedFormat) {
+		r.getLogger().Debugf("跳过完整性检查: %s", fileName)
+		return
+	}
+	if err != nil {
+		r.getLogger().WithError(err).Errorf("完整性检查失败: %s", fileName)
+		return
+	}
+
+	// 2. 记录并通知检查结果。
+	saveVerification(ctx, r.ed, r.getLogger(), &Verification{
+		LiveId: r.Live.GetLiveId(),
+		File:   fileName,
+		Report: report,
+	})
+}
+
+// saveVerification 将完整性检查结果写入元数据文件，并通过事件和 WebSocket 通知。
+func saveVerification(ctx context.Context, ed events.Dispatcher, logger *logrus.Entry, v *Verification) {
+	// 1. 将检查结果写入元数据文件。
+	err := metadata.Update(metadata.PathOf(v.File), map[string]interface{}{
+		"integrity":        v.Report.Integrity,
+		"integrity_report": v.Report,
+	})
+	if err != nil {
+		logger.WithError(err).Error("写入完整性检查结果失败")
+	}
+	if v.Report.Integrity == integrity.LevelOK {
+		logger.Infof("完整性检查通过(%s): %s", v.Report, v.File)
+	} else {
+		logger.Warnf("录制文件不完整(%s): %s", v.Report, v.File)
+	}
+
+	// 2. 通知检查结果。
+	if ed != nil {
+		ed.DispatchEvent(events.NewEvent(RecordingVerified, v))
+	}
+	if wsm := instance.GetInstance(ctx).WebsocketManager; wsm != nil {
+		wsm.BroadcastMessage("recordingVerified", v)
+	}
+}
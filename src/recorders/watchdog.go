@@ -0,0 +1,104 @@
+package recorders
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/yuhaohwang/bililive-go/src/pkg/counter"
+	"github.com/yuhaohwang/bililive-go/src/pkg/metadata"
+	"github.com/yuhaohwang/bililive-go/src/pkg/parser"
+)
+
+// watchdogInterval 是检查录制进度的最长间隔，测试时可修改。
+var watchdogInterval = 5 * time.Second
+
+// stall 记录一次直播流停滞。
+type stall struct {
+	bytes        uint      // 停滞时已接收的字节数
+	lastProgress time.Time // 最后一次接收到数据的时间
+	detected     time.Time // 检测到停滞的时间
+}
+
+// watchdog 在录制期间定期检查解析器已接收的数据量，持续没有增长时停止解析器。
+// 只有实现了 counter.Counter 接口的解析器支持停滞检测。
+type watchdog struct {
+	done   chan struct{}
+	result chan *stall
+}
+
+// startWatchdog 为解析器启动停滞检测，timeout 不大于 0 或解析器不支持时不检测。
+func startWatchdog(p parser.Parser, timeout time.Duration) *watchdog {
+	w := &watchdog{
+		done:   make(chan struct{}),
+		result: make(chan *stall, 1),
+	}
+	c, ok := p.(counter.Counter)
+	if !ok || timeout <= 0 {
+		w.result <- nil
+		return w
+	}
+	interval := watchdogInterval
+	if timeout < interval {
+		interval = timeout
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		last, lastProgress := c.Count(), time.Now()
+		for {
+			select {
+			case <-w.done:
+				w.result <- nil
+				return
+			case now := <-ticker.C:
+				if n := c.Count(); n != last {
+					last, lastProgress = n, now
+					continue
+				}
+				if now.Sub(lastProgress) >= timeout {
+					p.Stop()
+					w.result <- &stall{bytes: last, lastProgress: lastProgress, detected: now}
+					return
+				}
+			}
+		}
+	}()
+	return w
+}
+
+// finish 结束停滞检测，返回录制期间检测到的停滞，没有停滞时返回 nil。
+func (w *watchdog) finish() *stall {
+	close(w.done)
+	return <-w.result
+}
+
+// saveStall 记录直播流停滞，下一次录制时优先使用其他直播流地址。
+func (r *recorder) saveStall(jsonFilePath string, url *url.URL, s *stall) {
+	r.stalledUrl = url.String()
+	r.getLogger().Warnf("直播流已停滞%s，已接收%d字节，重新获取直播流地址",
+		s.detected.Sub(s.lastProgress).Round(time.Second), s.bytes)
+	err := metadata.Update(jsonFilePath, map[string]interface{}{
+		"stall": metadata.Stall{
+			Bytes:            uint64(s.bytes),
+			LastProgressUnix: s.lastProgress.Unix(),
+			DetectedUnix:     s.detected.Unix(),
+		},
+	})
+	if err != nil {
+		r.getLogger().WithError(err).Error("写入停滞信息失败")
+	}
+}
+
+// pickStreamUrl 返回本次录制使用的直播流地址，上一次录制因停滞结束时优先使用其他地址。
+func (r *recorder) pickStreamUrl(urls []*url.URL) *url.URL {
+	stalled := r.stalledUrl
+	r.stalledUrl = ""
+	if stalled != "" {
+		for _, u := range urls {
+			if u.String() != stalled {
+				return u
+			}
+		}
+	}
+	return urls[0]
+}
@@ -0,0 +1,78 @@
+package recorders
+
+import (
+	"context"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yuhaohwang/bililive-go/src/live"
+)
+
+// fakeParser 是一个每次读取计数时增长指定字节数的解析器。
+type fakeParser struct {
+	growth  uint64
+	count   uint64
+	stopped uint32
+}
+
+func (p *fakeParser) ParseLiveStream(ctx context.Context, url *url.URL, live live.Live, file string) error {
+	return nil
+}
+
+func (p *fakeParser) Stop() error {
+	atomic.StoreUint32(&p.stopped, 1)
+	return nil
+}
+
+func (p *fakeParser) Count() uint {
+	return uint(atomic.AddUint64(&p.count, p.growth))
+}
+
+func TestWatchdog(t *testing.T) {
+	backup := watchdogInterval
+	watchdogInterval = 10 * time.Millisecond
+	defer func() { watchdogInterval = backup }()
+
+	// 数据持续增长时不会停止解析器
+	p := &fakeParser{growth: 100}
+	wd := startWatchdog(p, 30*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	assert.Nil(t, wd.finish())
+	assert.Equal(t, uint32(0), atomic.LoadUint32(&p.stopped))
+
+	// 数据不再增长时停止解析器并返回停滞信息
+	p = &fakeParser{}
+	wd = startWatchdog(p, 30*time.Millisecond)
+	assert.Eventually(t, func() bool { return atomic.LoadUint32(&p.stopped) == 1 }, time.Second, 5*time.Millisecond)
+	s := wd.finish()
+	if assert.NotNil(t, s) {
+		assert.GreaterOrEqual(t, s.detected.Sub(s.lastProgress), 30*time.Millisecond)
+	}
+
+	// 未配置超时时不检测
+	p = &fakeParser{}
+	wd = startWatchdog(p, 0)
+	time.Sleep(50 * time.Millisecond)
+	assert.Nil(t, wd.finish())
+	assert.Equal(t, uint32(0), atomic.LoadUint32(&p.stopped))
+}
+
+func TestPickStreamUrl(t *testing.T) {
+	a, _ := url.Parse("https://a.example.com/live.flv")
+	b, _ := url.Parse("https://b.example.com/live.flv")
+	r := &recorder{}
+	assert.Equal(t, a, r.pickStreamUrl([]*url.URL{a, b}))
+
+	// 停滞后优先使用其他地址，只生效一次
+	r.stalledUrl = a.String()
+	assert.Equal(t, b, r.pickStreamUrl([]*url.URL{a, b}))
+	assert.Equal(t, a, r.pickStreamUrl([]*url.URL{a, b}))
+
+	// 没有其他地址时使用原地址
+	r.stalledUrl = a.String()
+	assert.Equal(t, a, r.pickStreamUrl([]*url.URL{a}))
+}
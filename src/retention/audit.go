@@ -0,0 +1,46 @@
+package retention
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// auditFileName 是审计日志在输出目录中的文件名。
+const auditFileName = ".retention_audit.log"
+
+// auditEntry 是审计日志中的一条删除记录。
+type auditEntry struct {
+	Time     time.Time `json:"time"`            // 删除时间
+	Path     string    `json:"path"`            // 录制文件路径
+	Files    []string  `json:"files"`           // 删除的所有文件
+	Size     int64     `json:"size"`            // 释放的空间
+	Room     string    `json:"room"`            // 所属直播间
+	Platform string    `json:"platform"`        // 所属平台
+	Reason   string    `json:"reason"`          // 删除原因
+	Error    string    `json:"error,omitempty"` // 删除失败的原因
+}
+
+// auditLog 以 JSON Lines 格式追加记录所有删除操作。
+type auditLog struct {
+	lock sync.Mutex
+	path string
+}
+
+// write 追加一条删除记录。
+func (a *auditLog) write(entry auditEntry) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(a.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
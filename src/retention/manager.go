@@ -0,0 +1,216 @@
+package retention
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yuhaohwang/bililive-go/src/configs"
+	"github.com/yuhaohwang/bililive-go/src/instance"
+	"github.com/yuhaohwang/bililive-go/src/interfaces"
+	"github.com/yuhaohwang/bililive-go/src/pkg/metadata"
+)
+
+// 定义状态常量用于标记管理器的状态。
+const (
+	begin uint32 = iota
+	running
+	stopped
+)
+
+// Manager 定义了保留策略管理器的接口，它实现了 interfaces.Module 接口。
+type Manager interface {
+	interfaces.Module
+	Plan(ctx context.Context) (*Plan, error)
+	Apply(ctx context.Context) (*Plan, error)
+	SetPinned(ctx context.Context, file string, pinned bool) error
+}
+
+// NewManager 创建一个新的保留策略管理器。
+func NewManager(ctx context.Context) Manager {
+	inst := instance.GetInstance(ctx)
+	m := &manager{
+		config: inst.Config,
+		logger: inst.Logger,
+		audit:  &auditLog{path: filepath.Join(inst.Config.OutPutPath, auditFileName)},
+		state:  begin,
+		stop:   make(chan struct{}),
+	}
+	inst.RetentionManager = m
+	return m
+}
+
+// manager 实现了 Manager 接口。
+type manager struct {
+	config *configs.Config
+	logger *interfaces.Logger
+	audit  *auditLog
+
+	// lock 保证同一时间只有一次保留策略在执行。
+	lock sync.Mutex
+
+	state uint32
+	stop  chan struct{}
+}
+
+// Start 启动保留策略管理器，按配置的间隔定期执行保留策略。
+func (m *manager) Start(ctx context.Context) error {
+	if !m.config.Retention.Enable {
+		return nil
+	}
+	if !atomic.CompareAndSwapUint32(&m.state, begin, running) {
+		return nil
+	}
+	go m.run(ctx)
+	return nil
+}
+
+// Close 关闭保留策略管理器。
+func (m *manager) Close(ctx context.Context) {
+	if !atomic.CompareAndSwapUint32(&m.state, running, stopped) {
+		return
+	}
+	close(m.stop)
+}
+
+// run 启动管理器的主循环。
+func (m *manager) run(ctx context.Context) {
+	ticker := time.NewTicker(m.config.Retention.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			var (
+				plan *Plan
+				err  error
+			)
+			if m.config.Retention.DryRun {
+				plan, err = m.Plan(ctx)
+			} else {
+				plan, err = m.Apply(ctx)
+			}
+			if err != nil {
+				m.logger.WithError(err).Error("执行保留策略失败")
+				continue
+			}
+			if len(plan.Evictions) > 0 {
+				m.logger.WithField("dry_run", plan.DryRun).
+					Infof("保留策略共删除%d个录制文件，释放%d字节", len(plan.Evictions), plan.FreedBytes)
+			}
+		}
+	}
+}
+
+// Plan 试运行保留策略，返回将被删除的录制文件，不会删除任何文件。
+func (m *manager) Plan(ctx context.Context) (*Plan, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	recordings, err := m.scan()
+	if err != nil {
+		return nil, err
+	}
+	plan := makePlan(m.config, recordings, time.Now())
+	plan.DryRun = true
+	return plan, nil
+}
+
+// Apply 执行保留策略，删除录制文件及其附属文件，并记录到审计日志。
+func (m *manager) Apply(ctx context.Context) (*Plan, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	// 1. 计算需要删除的录制文件。
+	recordings, err := m.scan()
+	if err != nil {
+		return nil, err
+	}
+	plan := makePlan(m.config, recordings, time.Now())
+
+	// 2. 依次删除，并记录到审计日志。
+	for _, e := range plan.Evictions {
+		entry := auditEntry{
+			Time:     time.Now(),
+			Path:     e.Path,
+			Files:    e.Files,
+			Size:     e.Size,
+			Room:     e.Room,
+			Platform: e.Platform,
+			Reason:   e.Reason,
+		}
+		if err := removeFiles(e.Files); err != nil {
+			entry.Error = err.Error()
+			plan.Errors = append(plan.Errors, err.Error())
+			plan.FreedBytes -= e.Size
+		}
+		if err := m.audit.write(entry); err != nil {
+			m.logger.WithError(err).Error("写入保留策略审计日志失败")
+		}
+		m.logger.WithField("reason", e.Reason).Infof("保留策略已删除录制文件: %s", e.Path)
+		removeEmptyDirs(filepath.Dir(e.Path), e.Root)
+	}
+	return plan, nil
+}
+
+// scan 遍历全局和各直播间的输出目录，返回所有已录制完成的录制文件。
+func (m *manager) scan() ([]*Recording, error) {
+	recordings := make([]*Recording, 0, 64)
+	for _, root := range m.config.OutputRoots() {
+		rs, err := scan(root)
+		if err != nil {
+			return nil, err
+		}
+		recordings = append(recordings, rs...)
+	}
+	return recordings, nil
+}
+
+// SetPinned 固定或取消固定录制文件所在的场次，固定的场次不会被保留策略删除。
+func (m *manager) SetPinned(ctx context.Context, file string, pinned bool) error {
+	if _, err := os.Stat(file); err != nil {
+		return err
+	}
+	return metadata.Update(metadata.PathOf(file), map[string]interface{}{"pinned": pinned})
+}
+
+// removeFiles 删除所有文件，返回遇到的第一个错误。
+func removeFiles(files []string) error {
+	var firstErr error
+	for _, file := range files {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// removeEmptyDirs 自下而上删除空目录，直到根目录为止，不会删除根目录及根目录之外的目录。
+func removeEmptyDirs(dir, root string) {
+	if root == "" {
+		return
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return
+	}
+	prefix := strings.TrimSuffix(root, string(filepath.Separator)) + string(filepath.Separator)
+	for {
+		abs, err := filepath.Abs(dir)
+		if err != nil || !strings.HasPrefix(abs, prefix) {
+			return
+		}
+		if entries, err := os.ReadDir(abs); err != nil || len(entries) > 0 {
+			return
+		}
+		if err := os.Remove(abs); err != nil {
+			return
+		}
+		dir = filepath.Dir(abs)
+	}
+}
@@ -0,0 +1,29 @@
+package retention
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoveEmptyDirs(t *testing.T) {
+	// 直播间的输出目录位于全局输出目录之外，且名称比全局输出目录短
+	parent := t.TempDir()
+	root := filepath.Join(parent, "r")
+	dir := filepath.Join(root, "平台", "主播")
+	assert.NoError(t, os.MkdirAll(dir, os.ModePerm))
+
+	// 删除空目录直到输出目录为止，不删除输出目录及其上级目录
+	removeEmptyDirs(dir, root)
+	assert.NoDirExists(t, filepath.Join(root, "平台"))
+	assert.DirExists(t, root)
+	assert.DirExists(t, parent)
+
+	// 不在输出目录之下的目录不做处理
+	other := filepath.Join(parent, "other")
+	assert.NoError(t, os.MkdirAll(other, os.ModePerm))
+	removeEmptyDirs(other, root)
+	assert.DirExists(t, other)
+}
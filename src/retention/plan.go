@@ -0,0 +1,172 @@
+package retention
+
+import (
+	"sort"
+	"time"
+
+	"github.com/yuhaohwang/bililive-go/src/configs"
+)
+
+// 删除录制文件的原因。
+const (
+	ReasonMaxAge          = "max_age"           // 超过保留天数
+	ReasonKeepSessions    = "keep_sessions"     // 超过保留的场次数
+	ReasonRoomMaxSize     = "room_max_size"     // 超过直播间的总大小上限
+	ReasonPlatformMaxSize = "platform_max_size" // 超过平台的总大小上限
+)
+
+const mb = 1024 * 1024
+
+// Eviction 表示一个将被删除的录制文件。
+type Eviction struct {
+	Path     string    `json:"path"`     // 录制文件路径
+	Files    []string  `json:"files"`    // 将被删除的所有文件
+	Size     int64     `json:"size"`     // 将释放的空间
+	ModTime  time.Time `json:"mod_time"` // 最后修改时间
+	Room     string    `json:"room"`     // 所属直播间
+	Platform string    `json:"platform"` // 所属平台
+	Reason   string    `json:"reason"`   // 删除原因
+	Root     string    `json:"-"`        // 录制文件所在的输出目录，删除后清理空目录时不超出该目录
+}
+
+// Plan 表示一次执行保留策略的结果。
+type Plan struct {
+	DryRun     bool       `json:"dry_run"`          // 是否为试运行
+	Evictions  []Eviction `json:"evictions"`        // 将被删除的录制文件，按修改时间从旧到新排列
+	FreedBytes int64      `json:"freed_bytes"`      // 将释放的总空间
+	Errors     []string   `json:"errors,omitempty"` // 删除失败的信息
+}
+
+// planner 根据保留规则计算需要删除的录制文件。
+type planner struct {
+	cfg     *configs.Config
+	now     time.Time
+	pinned  map[string]bool   // 已固定的场次
+	evicted map[string]string // 录制文件路径到删除原因的映射
+}
+
+// makePlan 根据配置计算需要删除的录制文件。
+func makePlan(cfg *configs.Config, recordings []*Recording, now time.Time) *Plan {
+	p := &planner{
+		cfg:     cfg,
+		now:     now,
+		pinned:  make(map[string]bool),
+		evicted: make(map[string]string),
+	}
+	for _, r := range recordings {
+		if r.Pinned {
+			p.pinned[r.Session] = true
+		}
+	}
+
+	// 1. 按修改时间从新到旧排列。
+	sort.Slice(recordings, func(i, j int) bool {
+		return recordings[i].ModTime.After(recordings[j].ModTime)
+	})
+
+	// 2. 按直播间执行保留规则。
+	rooms := make(map[string][]*Recording)
+	for _, r := range recordings {
+		rooms[r.Room] = append(rooms[r.Room], r)
+	}
+	for room, rs := range rooms {
+		p.applyRoom(cfg.GetRetentionPolicy(room), rs)
+	}
+
+	// 3. 按平台执行总大小上限。
+	platforms := make(map[string][]*Recording)
+	for _, r := range recordings {
+		if r.Platform != "" {
+			platforms[r.Platform] = append(platforms[r.Platform], r)
+		}
+	}
+	for platform, rs := range platforms {
+		p.applyMaxSize(cfg.Retention.PlatformMaxSizeMB[platform], rs, ReasonPlatformMaxSize)
+	}
+
+	// 4. 生成结果。
+	plan := &Plan{Evictions: make([]Eviction, 0, len(p.evicted))}
+	for _, r := range recordings {
+		reason, ok := p.evicted[r.Path]
+		if !ok {
+			continue
+		}
+		plan.Evictions = append(plan.Evictions, Eviction{
+			Path:     r.Path,
+			Files:    r.Files,
+			Size:     r.Size,
+			ModTime:  r.ModTime,
+			Room:     r.Room,
+			Platform: r.Platform,
+			Reason:   reason,
+			Root:     r.Root,
+		})
+		plan.FreedBytes += r.Size
+	}
+	sort.Slice(plan.Evictions, func(i, j int) bool {
+		return plan.Evictions[i].ModTime.Before(plan.Evictions[j].ModTime)
+	})
+	return plan
+}
+
+// evict 标记删除录制文件，已固定的场次和已标记的文件会被跳过。
+func (p *planner) evict(r *Recording, reason string) bool {
+	if p.pinned[r.Session] {
+		return false
+	}
+	if _, ok := p.evicted[r.Path]; ok {
+		return false
+	}
+	p.evicted[r.Path] = reason
+	return true
+}
+
+// applyRoom 对单个直播间的录制文件执行保留规则，rs 按修改时间从新到旧排列。
+func (p *planner) applyRoom(policy configs.RetentionPolicy, rs []*Recording) {
+	// 1. 删除超过保留天数的文件。
+	if policy.MaxAgeDays > 0 {
+		deadline := p.now.AddDate(0, 0, -policy.MaxAgeDays)
+		for _, r := range rs {
+			if r.ModTime.Before(deadline) {
+				p.evict(r, ReasonMaxAge)
+			}
+		}
+	}
+
+	// 2. 只保留最近的若干场次，已固定的场次不计入。
+	if policy.KeepSessions > 0 {
+		sessions := make(map[string]bool)
+		for _, r := range rs {
+			if p.pinned[r.Session] {
+				continue
+			}
+			if !sessions[r.Session] && len(sessions) >= policy.KeepSessions {
+				p.evict(r, ReasonKeepSessions)
+				continue
+			}
+			sessions[r.Session] = true
+		}
+	}
+
+	// 3. 执行直播间的总大小上限。
+	p.applyMaxSize(policy.MaxSizeMB, rs, ReasonRoomMaxSize)
+}
+
+// applyMaxSize 从最旧的文件开始删除，直到剩余文件的总大小不超过上限，rs 按修改时间从新到旧排列。
+func (p *planner) applyMaxSize(maxSizeMB uint64, rs []*Recording, reason string) {
+	if maxSizeMB == 0 {
+		return
+	}
+	var total int64
+	for _, r := range rs {
+		if _, ok := p.evicted[r.Path]; !ok {
+			total += r.Size
+		}
+	}
+	limit := int64(maxSizeMB * mb)
+	for i := len(rs) - 1; i >= 0 && total > limit; i-- {
+		if p.evict(rs[i], reason) {
+			total -= rs[i].Size
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package retention
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/yuhaohwang/bililive-go/src/configs"
+)
+
+func newRecording(path, room, session string, age time.Duration, sizeMB int64, now time.Time) *Recording {
+	return &Recording{
+		Path:     path,
+		Files:    []string{path},
+		Size:     sizeMB * mb,
+		ModTime:  now.Add(-age),
+		Room:     room,
+		Platform: "平台",
+		Session:  session,
+	}
+}
+
+func evictedPaths(plan *Plan) map[string]string {
+	paths := make(map[string]string)
+	for _, e := range plan.Evictions {
+		paths[e.Path] = e.Reason
+	}
+	return paths
+}
+
+func TestMakePlan(t *testing.T) {
+	now := time.Now()
+	day := 24 * time.Hour
+	cfg := configs.NewConfig()
+	cfg.LiveRooms = []configs.LiveRoom{
+		{Url: "a", RoomConfig: configs.RoomConfig{Retention: &configs.RetentionPolicy{KeepSessions: 2}}},
+		{Url: "b", RoomConfig: configs.RoomConfig{Retention: &configs.RetentionPolicy{MaxSizeMB: 25}}},
+	}
+	cfg.RefreshLiveRoomIndexCache()
+	cfg.Retention.Default.MaxAgeDays = 7
+
+	recordings := []*Recording{
+		// 直播间 a 只保留最近两场，已固定的场次不计入
+		newRecording("a1", "a", "a@1", 4*day, 10, now),
+		newRecording("a2", "a", "a@2", 3*day, 10, now),
+		newRecording("a3-1", "a", "a@3", 2*day, 10, now),
+		newRecording("a3-2", "a", "a@3", 2*day-time.Hour, 10, now),
+		newRecording("a4", "a", "a@4", day, 10, now),
+		// 直播间 b 总大小不超过 25MB
+		newRecording("b1", "b", "b1", 30*day, 10, now),
+		newRecording("b2", "b", "b2", 20*day, 10, now),
+		newRecording("b3", "b", "b3", 10*day, 10, now),
+		// 其他直播间使用默认规则
+		newRecording("c1", "c", "c1", 8*day, 10, now),
+		newRecording("c2", "c", "c2", 6*day, 10, now),
+	}
+	recordings[1].Pinned = true
+
+	plan := makePlan(cfg, recordings, now)
+	assert.Equal(t, map[string]string{
+		"a1": ReasonKeepSessions,
+		"b1": ReasonRoomMaxSize,
+		"c1": ReasonMaxAge,
+	}, evictedPaths(plan))
+	assert.Equal(t, int64(30*mb), plan.FreedBytes)
+	assert.Equal(t, "b1", plan.Evictions[0].Path)
+
+	// 平台总大小上限在直播间规则之后执行
+	cfg.Retention.PlatformMaxSizeMB = map[string]uint64{"平台": 50}
+	plan = makePlan(cfg, recordings, now)
+	assert.Equal(t, map[string]string{
+		"a1": ReasonKeepSessions,
+		"b1": ReasonRoomMaxSize,
+		"c1": ReasonMaxAge,
+		"b2": ReasonPlatformMaxSize,
+		"b3": ReasonPlatformMaxSize,
+	}, evictedPaths(plan))
+}
@@ -0,0 +1,132 @@
+// Package retention 包含录制文件保留策略相关的代码。
+package retention
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yuhaohwang/bililive-go/src/pkg/metadata"
+)
+
+// videoExts 是录制文件的扩展名。
+var videoExts = map[string]bool{
+	".flv": true,
+	".ts":  true,
+	".mp4": true,
+	".mkv": true,
+	".aac": true,
+	".m4a": true,
+}
+
+// Recording 表示一个录制文件及其附属文件。
+type Recording struct {
+	Path     string    // 录制文件路径，同名的多个录制文件取第一个
+	Files    []string  // 包括录制文件在内的所有同名文件
+	Size     int64     // 所有文件的总大小
+	ModTime  time.Time // 最后修改时间
+	Room     string    // 直播间 URL，没有元数据文件时为所在目录
+	Platform string    // 平台中文名称，没有元数据文件时为空
+	Session  string    // 直播场次，同一直播间同一次开播的录制文件属于同一场次
+	Pinned   bool      // 是否已固定
+	Root     string    // 扫描到该录制文件的输出目录
+}
+
+// scan 遍历目录，返回所有已录制完成的录制文件。
+func scan(root string) ([]*Recording, error) {
+	recordings := make([]*Recording, 0, 64)
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return err
+		}
+		rs, err := scanDir(path)
+		if err != nil {
+			return err
+		}
+		for _, r := range rs {
+			r.Root = root
+		}
+		recordings = append(recordings, rs...)
+		return nil
+	})
+	return recordings, err
+}
+
+// scanDir 将目录中的文件按录制文件分组，附属文件归入文件名前缀最长的录制文件。
+func scanDir(dir string) ([]*Recording, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. 找出所有录制文件的文件名前缀。
+	groups := make(map[string]*Recording)
+	bases := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := filepath.Ext(name)
+		if entry.IsDir() || !videoExts[ext] {
+			continue
+		}
+		base := strings.TrimSuffix(name, ext)
+		if _, ok := groups[base]; !ok {
+			groups[base] = &Recording{Path: filepath.Join(dir, name)}
+			bases = append(bases, base)
+		}
+	}
+	if len(groups) == 0 {
+		return nil, nil
+	}
+	// 前缀长的优先匹配，避免 a.flv 抢走 a.b.flv 的附属文件
+	sort.Slice(bases, func(i, j int) bool { return len(bases[i]) > len(bases[j]) })
+
+	// 2. 将文件归入对应的录制文件。
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		for _, base := range bases {
+			if !strings.HasPrefix(name, base+".") {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				break
+			}
+			r := groups[base]
+			r.Files = append(r.Files, filepath.Join(dir, name))
+			r.Size += info.Size()
+			if info.ModTime().After(r.ModTime) {
+				r.ModTime = info.ModTime()
+			}
+			break
+		}
+	}
+
+	// 3. 读取元数据，跳过正在录制的文件。
+	recordings := make([]*Recording, 0, len(groups))
+	for _, base := range bases {
+		r := groups[base]
+		r.Room = dir
+		r.Session = filepath.Join(dir, base)
+		if md, err := metadata.Read(filepath.Join(dir, base+metadata.Ext)); err == nil {
+			if md.Recording {
+				continue
+			}
+			r.Pinned = md.Pinned
+			r.Platform = md.PlatformCNName
+			if md.LiveUrl != "" {
+				r.Room = md.LiveUrl
+				if md.LastStartTimeUnix > 0 {
+					r.Session = md.LiveUrl + "@" + strconv.FormatInt(md.LastStartTimeUnix, 10)
+				}
+			}
+		}
+		recordings = append(recordings, r)
+	}
+	return recordings, nil
+}
@@ -0,0 +1,58 @@
+package retention
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScan(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "平台", "主播")
+	assert.NoError(t, os.MkdirAll(dir, os.ModePerm))
+	files := map[string]string{
+		"a.flv":           "12345",
+		"a.mp4":           "123",
+		"a.metadata.json": `{"live_url":"https://example.com/1","platform_cn_name":"平台","last_start_time_unix":100,"pinned":true}`,
+		"a.b.flv":         "1",
+		"a.b.jpg":         "1",
+		"c.ts":            "1",
+		"c.metadata.json": `{"recording":true}`,
+		"other.txt":       "1",
+	}
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	recordings, err := scan(root)
+	assert.NoError(t, err)
+	assert.Len(t, recordings, 2)
+	for _, r := range recordings {
+		assert.Equal(t, root, r.Root)
+	}
+	byPath := make(map[string]*Recording)
+	for _, r := range recordings {
+		byPath[filepath.Base(r.Path)] = r
+	}
+
+	// 同名的录制文件和附属文件归为一组
+	a := byPath["a.flv"]
+	assert.ElementsMatch(t, []string{
+		filepath.Join(dir, "a.flv"),
+		filepath.Join(dir, "a.mp4"),
+		filepath.Join(dir, "a.metadata.json"),
+	}, a.Files)
+	assert.Equal(t, "https://example.com/1", a.Room)
+	assert.Equal(t, "平台", a.Platform)
+	assert.Equal(t, "https://example.com/1@100", a.Session)
+	assert.True(t, a.Pinned)
+
+	// 附属文件归入前缀最长的录制文件，没有元数据时以目录作为直播间
+	ab := byPath["a.b.flv"]
+	assert.ElementsMatch(t, []string{filepath.Join(dir, "a.b.flv"), filepath.Join(dir, "a.b.jpg")}, ab.Files)
+	assert.Equal(t, int64(2), ab.Size)
+	assert.Equal(t, dir, ab.Room)
+	assert.False(t, ab.Pinned)
+}
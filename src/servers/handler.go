@@ -11,19 +11,26 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/tidwall/gjson"
 	"gopkg.in/yaml.v2"
 
+	"github.com/yuhaohwang/bililive-go/src/catalog"
 	"github.com/yuhaohwang/bililive-go/src/configs"
 	"github.com/yuhaohwang/bililive-go/src/consts"
+	"github.com/yuhaohwang/bililive-go/src/disk"
 	"github.com/yuhaohwang/bililive-go/src/instance"
 	"github.com/yuhaohwang/bililive-go/src/listeners"
 	"github.com/yuhaohwang/bililive-go/src/live"
+	"github.com/yuhaohwang/bililive-go/src/pkg/metadata"
+	"github.com/yuhaohwang/bililive-go/src/postprocessors"
 	"github.com/yuhaohwang/bililive-go/src/pushers"
 	"github.com/yuhaohwang/bililive-go/src/recorders"
+	"github.com/yuhaohwang/bililive-go/src/retention"
 )
 
 // parseInfo 从直播信息对象中提取相关数据并构建一个 live.Info 结构。
@@ -52,6 +59,14 @@ func parseInfo(ctx context.Context, l live.Live) *live.Info {
 	info.Recording = inst.RecorderManager.(recorders.Manager).HasRecorder(ctx, l.GetLiveId())
 	info.Pushing = inst.PusherManager.(pushers.Manager).HasPusher(ctx, l.GetLiveId())
 
+	// 正在录制时附带录制器的状态
+	info.RecorderStatus = nil
+	if recorder, err := inst.RecorderManager.(recorders.Manager).GetRecorder(ctx, l.GetLiveId()); err == nil {
+		if status := recorder.GetStatus(); status.Recording {
+			info.RecorderStatus = status
+		}
+	}
+
 	// 返回填充好数据的 live.Info 结构
 	return info
 }
@@ -208,6 +223,7 @@ func addLiveImpl(ctx context.Context, urlStr string, isListen bool, isRecord boo
 			Push:   isPush,
 		}
 		inst.Config.LiveRooms = append(inst.Config.LiveRooms, liveRoom)
+		inst.Config.RefreshLiveRoomIndexCache()
 	}
 	return info, nil
 }
@@ -403,8 +419,20 @@ func applyLiveRoomsByConfig(ctx context.Context, newLiveRooms []configs.LiveRoom
 
 // 获取应用程序信息
 func getInfo(writer http.ResponseWriter, r *http.Request) {
+	info := struct {
+		consts.Info
+		Disk  *disk.Status   `json:"disk,omitempty"`  // 全局输出目录所在磁盘的状态
+		Disks []*disk.Status `json:"disks,omitempty"` // 所有输出目录所在磁盘的状态
+	}{
+		Info: consts.AppInfo,
+	}
+	// 附带输出目录所在磁盘的剩余空间
+	if dm, ok := instance.GetInstance(r.Context()).DiskMonitor.(disk.Monitor); ok {
+		info.Disk, _ = dm.Status()
+		info.Disks, _ = dm.Statuses()
+	}
 	// 返回应用程序信息
-	writeJSON(writer, consts.AppInfo)
+	writeJSON(writer, info)
 }
 
 // 获取文件信息
@@ -737,3 +765,400 @@ func mainHandler(writer http.ResponseWriter, r *http.Request) {
 
 	writeJSON(writer, parseInfo(r.Context(), live))
 }
+
+// 获取所有录制后处理任务
+func getAllJobs(writer http.ResponseWriter, r *http.Request) {
+	ppm, ok := instance.GetInstance(r.Context()).PostProcessorManager.(postprocessors.Manager)
+	if !ok {
+		writeJSON(writer, []*postprocessors.Job{})
+		return
+	}
+	writeJSON(writer, ppm.GetJobs(r.Context()))
+}
+
+// 获取同时录制上限和等待录制的直播间
+func getRecorderQueue(writer http.ResponseWriter, r *http.Request) {
+	rm, ok := instance.GetInstance(r.Context()).RecorderManager.(recorders.Manager)
+	if !ok {
+		writeJsonWithStatusCode(writer, http.StatusServiceUnavailable, commonResp{
+			ErrNo:  http.StatusServiceUnavailable,
+			ErrMsg: "录制器管理器未初始化",
+		})
+		return
+	}
+	writeJSON(writer, rm.GetQueueStatus(r.Context()))
+}
+
+// 获取所有录制器的状态
+func getRecorderStatuses(writer http.ResponseWriter, r *http.Request) {
+	rm, ok := instance.GetInstance(r.Context()).RecorderManager.(recorders.Manager)
+	if !ok {
+		writeJsonWithStatusCode(writer, http.StatusServiceUnavailable, commonResp{
+			ErrNo:  http.StatusServiceUnavailable,
+			ErrMsg: "录制器管理器未初始化",
+		})
+		return
+	}
+	writeJSON(writer, rm.GetStatuses(r.Context()))
+}
+
+// 获取单个直播间录制器的状态，没有录制器时返回未在录制的状态
+func getRecorderStatus(writer http.ResponseWriter, r *http.Request) {
+	inst := instance.GetInstance(r.Context())
+	vars := mux.Vars(r)
+	id := live.ID(vars["id"])
+	if _, ok := inst.Lives[id]; !ok {
+		writeJsonWithStatusCode(writer, http.StatusNotFound, commonResp{
+			ErrNo:  http.StatusNotFound,
+			ErrMsg: fmt.Sprintf("live id: %s 找不到", vars["id"]),
+		})
+		return
+	}
+	rm, ok := inst.RecorderManager.(recorders.Manager)
+	if !ok {
+		writeJsonWithStatusCode(writer, http.StatusServiceUnavailable, commonResp{
+			ErrNo:  http.StatusServiceUnavailable,
+			ErrMsg: "录制器管理器未初始化",
+		})
+		return
+	}
+	recorder, err := rm.GetRecorder(r.Context(), id)
+	if err != nil {
+		writeJSON(writer, &recorders.Status{LiveId: id})
+		return
+	}
+	writeJSON(writer, recorder.GetStatus())
+}
+
+// 获取单个录制后处理任务
+func getJob(writer http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	ppm, ok := instance.GetInstance(r.Context()).PostProcessorManager.(postprocessors.Manager)
+	if !ok {
+		writeJsonWithStatusCode(writer, http.StatusNotFound, commonResp{
+			ErrNo:  http.StatusNotFound,
+			ErrMsg: postprocessors.ErrJobNotExist.Error(),
+		})
+		return
+	}
+	job, err := ppm.GetJob(r.Context(), vars["id"])
+	if err != nil {
+		writeJsonWithStatusCode(writer, http.StatusNotFound, commonResp{
+			ErrNo:  http.StatusNotFound,
+			ErrMsg: fmt.Sprintf("job id: %s 找不到", vars["id"]),
+		})
+		return
+	}
+	writeJSON(writer, job)
+}
+
+/*
+Post 数据示例
+
+	{
+		"label": "精彩片段"
+	}
+*/
+// 在直播间正在录制的文件的当前位置添加标记
+func addMarker(writer http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	var req struct {
+		Label string `json:"label"`
+	}
+	// 请求体为空时使用默认名称
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeJsonWithStatusCode(writer, http.StatusBadRequest, commonResp{
+			ErrNo:  http.StatusBadRequest,
+			ErrMsg: err.Error(),
+		})
+		return
+	}
+	rm, ok := instance.GetInstance(r.Context()).RecorderManager.(recorders.Manager)
+	if !ok {
+		writeJsonWithStatusCode(writer, http.StatusServiceUnavailable, commonResp{
+			ErrNo:  http.StatusServiceUnavailable,
+			ErrMsg: "录制器管理器未初始化",
+		})
+		return
+	}
+	marker, err := rm.AddMarker(r.Context(), live.ID(vars["id"]), req.Label)
+	switch err {
+	case nil:
+		writeJSON(writer, marker)
+	case recorders.ErrRecorderNotExist, recorders.ErrNotRecording:
+		writeJsonWithStatusCode(writer, http.StatusConflict, commonResp{
+			ErrNo:  http.StatusConflict,
+			ErrMsg: fmt.Sprintf("live id: %s 没有正在录制的文件", vars["id"]),
+		})
+	default:
+		writeJsonWithStatusCode(writer, http.StatusInternalServerError, commonResp{
+			ErrNo:  http.StatusInternalServerError,
+			ErrMsg: err.Error(),
+		})
+	}
+}
+
+// 获取直播间当前直播场次中的所有标记
+func getMarkers(writer http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	rm, ok := instance.GetInstance(r.Context()).RecorderManager.(recorders.Manager)
+	if !ok {
+		writeJsonWithStatusCode(writer, http.StatusServiceUnavailable, commonResp{
+			ErrNo:  http.StatusServiceUnavailable,
+			ErrMsg: "录制器管理器未初始化",
+		})
+		return
+	}
+	writeJSON(writer, rm.GetMarkers(r.Context(), live.ID(vars["id"])))
+}
+
+// resolveOutputPath 将相对于全局输出目录的路径或绝对路径转换为绝对路径，
+// 并拒绝全局和各直播间输出目录之外的路径。
+func resolveOutputPath(ctx context.Context, path string) (string, error) {
+	cfg := instance.GetInstance(ctx).Config
+	base, err := filepath.Abs(cfg.OutPutPath)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(base, path)
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	for _, root := range append(cfg.OutputRoots(), base) {
+		if absPath == root || strings.HasPrefix(absPath, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator)) {
+			return absPath, nil
+		}
+	}
+	return "", errors.New("异常路径")
+}
+
+// 试运行保留策略，返回将被删除的录制文件
+func getRetentionPlan(writer http.ResponseWriter, r *http.Request) {
+	rm, ok := instance.GetInstance(r.Context()).RetentionManager.(retention.Manager)
+	if !ok {
+		writeJsonWithStatusCode(writer, http.StatusServiceUnavailable, commonResp{
+			ErrNo:  http.StatusServiceUnavailable,
+			ErrMsg: "保留策略未初始化",
+		})
+		return
+	}
+	plan, err := rm.Plan(r.Context())
+	if err != nil {
+		writeJsonWithStatusCode(writer, http.StatusInternalServerError, commonResp{
+			ErrNo:  http.StatusInternalServerError,
+			ErrMsg: err.Error(),
+		})
+		return
+	}
+	writeJSON(writer, plan)
+}
+
+// 立即执行保留策略，删除录制文件
+func runRetention(writer http.ResponseWriter, r *http.Request) {
+	rm, ok := instance.GetInstance(r.Context()).RetentionManager.(retention.Manager)
+	if !ok {
+		writeJsonWithStatusCode(writer, http.StatusServiceUnavailable, commonResp{
+			ErrNo:  http.StatusServiceUnavailable,
+			ErrMsg: "保留策略未初始化",
+		})
+		return
+	}
+	plan, err := rm.Apply(r.Context())
+	if err != nil {
+		writeJsonWithStatusCode(writer, http.StatusInternalServerError, commonResp{
+			ErrNo:  http.StatusInternalServerError,
+			ErrMsg: err.Error(),
+		})
+		return
+	}
+	writeJSON(writer, plan)
+}
+
+/*
+Put 数据示例
+
+	{
+		"path": "哔哩哔哩/主播名/[2024-01-01 20-00-00][主播名][房间名].flv",
+		"pinned": true
+	}
+*/
+// 固定或取消固定录制文件所在的场次
+func setRecordingPinned(writer http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Path   string `json:"path"`
+		Pinned bool   `json:"pinned"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJsonWithStatusCode(writer, http.StatusBadRequest, commonResp{
+			ErrNo:  http.StatusBadRequest,
+			ErrMsg: err.Error(),
+		})
+		return
+	}
+	path, err := resolveOutputPath(r.Context(), req.Path)
+	if err != nil {
+		writeJsonWithStatusCode(writer, http.StatusBadRequest, commonResp{
+			ErrNo:  http.StatusBadRequest,
+			ErrMsg: err.Error(),
+		})
+		return
+	}
+	rm, ok := instance.GetInstance(r.Context()).RetentionManager.(retention.Manager)
+	if !ok {
+		writeJsonWithStatusCode(writer, http.StatusServiceUnavailable, commonResp{
+			ErrNo:  http.StatusServiceUnavailable,
+			ErrMsg: "保留策略未初始化",
+		})
+		return
+	}
+	if err := rm.SetPinned(r.Context(), path, req.Pinned); err != nil {
+		writeJsonWithStatusCode(writer, http.StatusBadRequest, commonResp{
+			ErrNo:  http.StatusBadRequest,
+			ErrMsg: err.Error(),
+		})
+		return
+	}
+	writeJSON(writer, commonResp{
+		Data: "OK",
+	})
+}
+
+// parseQueryTime 解析查询参数中的时间，支持 RFC3339 格式和本地时区的日期。
+func parseQueryTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
+
+// 按直播间、时间范围和标题查询录制文件
+func getRecordings(writer http.ResponseWriter, r *http.Request) {
+	cm, ok := instance.GetInstance(r.Context()).CatalogManager.(catalog.Manager)
+	if !ok {
+		writeJsonWithStatusCode(writer, http.StatusServiceUnavailable, commonResp{
+			ErrNo:  http.StatusServiceUnavailable,
+			ErrMsg: "录制文件索引未初始化",
+		})
+		return
+	}
+	params := r.URL.Query()
+	q := catalog.Query{
+		Room:  params.Get("room"),
+		Title: params.Get("title"),
+	}
+	var err error
+	if q.From, err = parseQueryTime(params.Get("from")); err == nil {
+		q.To, err = parseQueryTime(params.Get("to"))
+	}
+	// 只指定日期时包含当天
+	if err == nil && len(params.Get("to")) == len("2006-01-02") {
+		q.To = q.To.Add(24*time.Hour - time.Nanosecond)
+	}
+	if err == nil && params.Get("page") != "" {
+		q.Page, err = strconv.Atoi(params.Get("page"))
+	}
+	if err == nil && params.Get("page_size") != "" {
+		q.PageSize, err = strconv.Atoi(params.Get("page_size"))
+	}
+	if err != nil {
+		writeJsonWithStatusCode(writer, http.StatusBadRequest, commonResp{
+			ErrNo:  http.StatusBadRequest,
+			ErrMsg: err.Error(),
+		})
+		return
+	}
+	writeJSON(writer, cm.Query(r.Context(), q))
+}
+
+/*
+Post 数据示例
+
+	{
+		"file": "哔哩哔哩/主播名/[2024-01-01 20-00-00][主播名][房间名].flv",
+		"start_ms": 60000,
+		"end_ms": 90000,
+		"format": "mp4",
+		"precise": false
+	}
+*/
+// 从录制文件或直播场次中截取片段，作为录制后处理任务执行
+func clipRecording(writer http.ResponseWriter, r *http.Request) {
+	var req struct {
+		File    string `json:"file"`    // 相对于输出目录的录制文件路径
+		Session string `json:"session"` // 直播场次 ID，指定时起点和终点相对于开播时间
+		StartMs int64  `json:"start_ms"`
+		EndMs   int64  `json:"end_ms"`
+		Format  string `json:"format"`
+		Precise bool   `json:"precise"`
+	}
+	badRequest := func(err error) {
+		writeJsonWithStatusCode(writer, http.StatusBadRequest, commonResp{
+			ErrNo:  http.StatusBadRequest,
+			ErrMsg: err.Error(),
+		})
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		badRequest(err)
+		return
+	}
+
+	// 1. 找到片段所在的录制文件及片段在文件中的位置。
+	var (
+		file    string
+		startMs = req.StartMs
+		endMs   = req.EndMs
+		err     error
+	)
+	switch {
+	case req.Session != "":
+		var sess *recorders.Session
+		if sess, err = recorders.LoadSession(r.Context(), req.Session); err == nil {
+			file, startMs, endMs, err = sess.Locate(req.StartMs, req.EndMs)
+		}
+	case req.File != "":
+		file, err = resolveOutputPath(r.Context(), req.File)
+	default:
+		err = errors.New("需要指定录制文件或直播场次")
+	}
+	if err == nil && (startMs < 0 || endMs <= startMs) {
+		err = errors.New("片段的起点和终点无效")
+	}
+	if err == nil {
+		if _, statErr := os.Stat(file); statErr != nil {
+			err = fmt.Errorf("录制文件不存在: %s", req.File)
+		}
+	}
+	if err != nil {
+		badRequest(err)
+		return
+	}
+
+	// 2. 创建截取片段的处理任务。
+	ppm, ok := instance.GetInstance(r.Context()).PostProcessorManager.(postprocessors.Manager)
+	if !ok {
+		writeJsonWithStatusCode(writer, http.StatusServiceUnavailable, commonResp{
+			ErrNo:  http.StatusServiceUnavailable,
+			ErrMsg: "录制后处理未初始化",
+		})
+		return
+	}
+	info := &live.Info{}
+	if md, err := metadata.Read(metadata.PathOf(file)); err == nil {
+		info.HostName, info.RoomName = md.HostName, md.RoomName
+	}
+	job, err := ppm.SubmitSteps(r.Context(), info, file, postprocessors.ClipSteps(startMs, endMs, req.Format, req.Precise))
+	if err != nil {
+		writeJsonWithStatusCode(writer, http.StatusServiceUnavailable, commonResp{
+			ErrNo:  http.StatusServiceUnavailable,
+			ErrMsg: err.Error(),
+		})
+		return
+	}
+	writeJSON(writer, job)
+}
@@ -52,10 +52,22 @@ func initMux(ctx context.Context) *mux.Router {
 	apiRoute.HandleFunc("/lives", addLives).Methods("POST")
 	apiRoute.HandleFunc("/lives/{id}", getLive).Methods("GET")
 	apiRoute.HandleFunc("/lives/{id}", removeLive).Methods("DELETE")
+	apiRoute.HandleFunc("/lives/{id}/markers", getMarkers).Methods("GET")
+	apiRoute.HandleFunc("/lives/{id}/markers", addMarker).Methods("POST")
+	apiRoute.HandleFunc("/lives/{id}/status", getRecorderStatus).Methods("GET")
 	apiRoute.HandleFunc("/lives/{id}/{action}", mainHandler).Methods("GET")
 	apiRoute.HandleFunc("/file/{path:.*}", getFileInfo).Methods("GET")
 	apiRoute.HandleFunc("/lives/{id}/push", setRtmp).Methods("put")
 	apiRoute.HandleFunc("/lives/{id}/{resource}/{action}", mainHandler).Methods("GET")
+	apiRoute.HandleFunc("/recorders/queue", getRecorderQueue).Methods("GET")
+	apiRoute.HandleFunc("/recorders/status", getRecorderStatuses).Methods("GET")
+	apiRoute.HandleFunc("/jobs", getAllJobs).Methods("GET")
+	apiRoute.HandleFunc("/jobs/{id}", getJob).Methods("GET")
+	apiRoute.HandleFunc("/recordings", getRecordings).Methods("GET")
+	apiRoute.HandleFunc("/recordings/clip", clipRecording).Methods("POST")
+	apiRoute.HandleFunc("/retention/plan", getRetentionPlan).Methods("GET")
+	apiRoute.HandleFunc("/retention/run", runRetention).Methods("POST")
+	apiRoute.HandleFunc("/retention/pin", setRecordingPinned).Methods("PUT")
 	apiRoute.Handle("/metrics", promhttp.Handler()) // 用于处理 Prometheus 监控数据
 	m.HandleFunc("/ws", wsManager.HandleConnection) //开启websocket服务器
 